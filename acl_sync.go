@@ -0,0 +1,345 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ACLUser is the desired state of a user synced by ACLSync.
+type ACLUser struct {
+	Name string
+	// Enabled allows the user to authenticate ("on").
+	Enabled bool
+	// NoPass allows the user to authenticate with any password.
+	NoPass bool
+	// Passwords are the passwords of the user. Only the SHA-256 hashes of
+	// the passwords are sent to the server.
+	Passwords []string
+	// PasswordHashes are the hex-encoded SHA-256 hashes of the passwords,
+	// e.g. to keep the passwords out of the provisioning pipeline.
+	PasswordHashes []string
+	// Keys are the key patterns, e.g. "~app:*" or "%R~cache:*".
+	Keys []string
+	// Channels are the Pub/Sub channel patterns, e.g. "&events:*".
+	Channels []string
+	// Commands are the command rules, e.g. "-@all +@read -keys". They are
+	// compared with the rules returned by ACL GETUSER, so they should be
+	// written in the same form to avoid updating the user on every sync.
+	// "-@all" is implied if the rules don't start with "+@all" or "-@all".
+	Commands string
+}
+
+func (u *ACLUser) passwordHashes() []string {
+	hashes := make([]string, 0, len(u.Passwords)+len(u.PasswordHashes))
+	for _, password := range u.Passwords {
+		sum := sha256.Sum256([]byte(password))
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	for _, hash := range u.PasswordHashes {
+		hashes = append(hashes, strings.ToLower(hash))
+	}
+	return sortedSet(hashes)
+}
+
+// ACLSpec is the declarative list of the users synced by ACLSync.
+type ACLSpec struct {
+	Users []ACLUser
+	// Prune deletes the users that are not in Users. The "default" user
+	// and the users in Keep are never deleted.
+	Prune bool
+	// Keep are the users that are not deleted by Prune.
+	Keep []string
+	// Save persists the changes to the ACL file with ACL SAVE. The server
+	// must be configured with aclfile.
+	Save bool
+	// DryRun only reports the changes without applying them.
+	DryRun bool
+}
+
+// ACL change operations reported by ACLSync.
+const (
+	ACLCreate = "create"
+	ACLUpdate = "update"
+	ACLDelete = "delete"
+)
+
+// ACLChange is a change applied by ACLSync.
+type ACLChange struct {
+	// Addr is the address of the node the change is applied to.
+	Addr string
+	User string
+	Op   string
+	// Rules are the arguments of ACL SETUSER after the user name. The
+	// passwords are included as the "#<hash>" rules.
+	Rules []string
+}
+
+// ACLSync makes the users of the server match the spec: the users that
+// differ from the spec are reset and set with ACL SETUSER, and with
+// ACLSpec.Prune the users that are not in the spec are deleted with ACL
+// DELUSER. Syncing the same spec again makes no changes, so it can be run
+// on every deployment. The ACLs are not replicated, so with ClusterClient
+// and Ring the users are synced on all the nodes.
+func ACLSync(ctx context.Context, client UniversalClient, spec *ACLSpec) ([]ACLChange, error) {
+	var mu sync.Mutex
+	var changes []ACLChange
+
+	err := forEachACLNode(ctx, client, func(ctx context.Context, node *Client) error {
+		nodeChanges, err := aclSyncNode(ctx, node, spec)
+		mu.Lock()
+		changes = append(changes, nodeChanges...)
+		mu.Unlock()
+		return err
+	})
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Addr < changes[j].Addr
+	})
+	return changes, err
+}
+
+func forEachACLNode(
+	ctx context.Context, client UniversalClient, fn func(ctx context.Context, node *Client) error,
+) error {
+	switch c := client.(type) {
+	case *Client:
+		return fn(ctx, c)
+	case *ClusterClient:
+		return c.ForEachShard(ctx, fn)
+	case *Ring:
+		return c.ForEachShard(ctx, fn)
+	default:
+		return fmt.Errorf("redis: ACLSync does not support %T", client)
+	}
+}
+
+func aclSyncNode(ctx context.Context, node *Client, spec *ACLSpec) ([]ACLChange, error) {
+	names, err := node.Do(ctx, "acl", "users").StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	addr := node.opt.Addr
+	var changes []ACLChange
+	wanted := make(map[string]bool, len(spec.Users))
+	for i := range spec.Users {
+		user := &spec.Users[i]
+		wanted[user.Name] = true
+
+		op := ACLCreate
+		if existing[user.Name] {
+			op = ACLUpdate
+			reply, err := node.Do(ctx, "acl", "getuser", user.Name).Result()
+			if err != nil {
+				return changes, err
+			}
+			current, err := parseACLUser(user.Name, reply)
+			if err != nil {
+				return changes, err
+			}
+			if aclUserEqual(current, user) {
+				continue
+			}
+		}
+
+		change := ACLChange{
+			Addr:  addr,
+			User:  user.Name,
+			Op:    op,
+			Rules: aclUserRules(user),
+		}
+		if !spec.DryRun {
+			args := make([]interface{}, 0, 3+len(change.Rules))
+			args = append(args, "acl", "setuser", user.Name)
+			for _, rule := range change.Rules {
+				args = append(args, rule)
+			}
+			if err := node.Do(ctx, args...).Err(); err != nil {
+				return changes, fmt.Errorf("redis: ACL SETUSER %s failed: %w", user.Name, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	if spec.Prune {
+		for _, name := range names {
+			if wanted[name] || name == "default" || contains(spec.Keep, name) {
+				continue
+			}
+			if !spec.DryRun {
+				if err := node.Do(ctx, "acl", "deluser", name).Err(); err != nil {
+					return changes, fmt.Errorf("redis: ACL DELUSER %s failed: %w", name, err)
+				}
+			}
+			changes = append(changes, ACLChange{Addr: addr, User: name, Op: ACLDelete})
+		}
+	}
+
+	if spec.Save && !spec.DryRun && len(changes) > 0 {
+		if err := node.Do(ctx, "acl", "save").Err(); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// aclUserRules returns the ACL SETUSER rules that reset the user to u.
+func aclUserRules(u *ACLUser) []string {
+	rules := []string{"reset"}
+	if u.Enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+	if u.NoPass {
+		rules = append(rules, "nopass")
+	}
+	for _, hash := range u.passwordHashes() {
+		rules = append(rules, "#"+hash)
+	}
+	rules = append(rules, u.Keys...)
+	rules = append(rules, u.Channels...)
+	rules = append(rules, strings.Fields(u.Commands)...)
+	return rules
+}
+
+// aclUserState is the state of a user returned by ACL GETUSER.
+type aclUserState struct {
+	enabled        bool
+	noPass         bool
+	passwordHashes []string
+	keys           []string
+	channels       []string
+	commands       string
+}
+
+func aclUserEqual(current *aclUserState, u *ACLUser) bool {
+	return current.enabled == u.Enabled &&
+		current.noPass == u.NoPass &&
+		stringsEqual(current.passwordHashes, u.passwordHashes()) &&
+		stringsEqual(current.keys, sortedSet(u.Keys)) &&
+		stringsEqual(current.channels, sortedSet(u.Channels)) &&
+		current.commands == normalizeACLCommands(u.Commands)
+}
+
+// parseACLUser parses the ACL GETUSER reply of Redis 6 and 7.
+func parseACLUser(name string, reply interface{}) (*aclUserState, error) {
+	fields := make(map[string]interface{})
+	switch reply := reply.(type) {
+	case []interface{}:
+		for i := 0; i+1 < len(reply); i += 2 {
+			if k, ok := reply[i].(string); ok {
+				fields[k] = reply[i+1]
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, v := range reply {
+			if k, ok := k.(string); ok {
+				fields[k] = v
+			}
+		}
+	default:
+		return nil, fmt.Errorf("redis: unexpected ACL GETUSER %s reply: %T", name, reply)
+	}
+
+	u := new(aclUserState)
+	for _, flag := range aclStrings(fields["flags"]) {
+		switch flag {
+		case "on":
+			u.enabled = true
+		case "nopass":
+			u.noPass = true
+		case "allkeys":
+			fields["keys"] = "~*"
+		case "allchannels":
+			fields["channels"] = "&*"
+		}
+	}
+	u.passwordHashes = sortedSet(aclStrings(fields["passwords"]))
+	u.keys = sortedSet(aclPatterns(fields["keys"], "~"))
+	u.channels = sortedSet(aclPatterns(fields["channels"], "&"))
+	if s, ok := fields["commands"].(string); ok {
+		u.commands = normalizeACLCommands(s)
+	}
+	return u, nil
+}
+
+// aclPatterns returns the key or channel patterns with the prefix. Redis 7
+// returns the patterns as a string of rules, e.g. "~a* %R~b*", and Redis 6
+// as an array of patterns without the prefix.
+func aclPatterns(v interface{}, prefix string) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		patterns := aclStrings(v)
+		for i, p := range patterns {
+			patterns[i] = prefix + p
+		}
+		return patterns
+	}
+	return nil
+}
+
+func aclStrings(v interface{}) []string {
+	vals, _ := v.([]interface{})
+	ss := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// normalizeACLCommands returns the command rules in the form returned by ACL
+// GETUSER, which starts with "+@all" or "-@all".
+func normalizeACLCommands(s string) string {
+	rules := strings.Fields(s)
+	for i, rule := range rules {
+		switch strings.ToLower(rule) {
+		case "allcommands":
+			rules[i] = "+@all"
+		case "nocommands":
+			rules[i] = "-@all"
+		}
+	}
+	if len(rules) == 0 || (rules[0] != "+@all" && rules[0] != "-@all") {
+		rules = append([]string{"-@all"}, rules...)
+	}
+	return strings.Join(rules, " ")
+}
+
+func sortedSet(ss []string) []string {
+	out := make([]string, 0, len(ss))
+	seen := make(map[string]bool, len(ss))
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/util"
+)
+
+// AuditRule redacts the arguments of the audited commands, see
+// AuditOptions.Rules, or of all the commands, see SetRedactRules. The key of a
+// command is its first key, e.g. the first key after the number of keys of
+// EVAL, or otherwise the first argument after the command name, e.g. the
+// parameter name of CONFIG SET.
+type AuditRule struct {
+	// Commands are the names of the commands the rule applies to, e.g. "set"
+	// or "config set". Empty matches all the commands.
+	Commands []string
+	// KeyPattern is a glob-style pattern, as in KEYS, the key must match.
+	// Empty matches all the keys.
+	KeyPattern string
+	// RedactKey also replaces the key with "?". By default only the other
+	// arguments, i.e. the values, are redacted.
+	RedactKey bool
+}
+
+func (r *AuditRule) match(name, key string) bool {
+	if len(r.Commands) > 0 && !contains(r.Commands, name) {
+		return false
+	}
+	return r.KeyPattern == "" || util.MatchGlob(r.KeyPattern, key)
+}
+
+// AuditEntry is a command processed by a client with the audit hook.
+type AuditEntry struct {
+	Time time.Time
+	// Duration is how long it took to process the command or, for commands
+	// of a pipeline, the whole pipeline.
+	Duration time.Duration
+	// Name is the command name, e.g. "get" or "config set".
+	Name string
+	// Args are the command arguments including the name. Redacted
+	// arguments are replaced with "?".
+	Args []string
+	Err  error
+}
+
+// AuditOptions are used to configure the hook returned by NewAuditHook.
+type AuditOptions struct {
+	// Commands are the names of the audited commands, e.g. "flushall" or
+	// "config set". Default is all the commands.
+	Commands []string
+	// Rules are applied in order to every audited command in addition to
+	// the rules set with SetRedactRules. Passwords of AUTH, HELLO, MIGRATE,
+	// ACL SETUSER and CONFIG SET are always redacted.
+	Rules []AuditRule
+
+	// Handler is called for every audited command, e.g. to write the
+	// entries to a log.
+	// Default logs the entries with Logger.
+	Handler func(ctx context.Context, entry *AuditEntry)
+	// Logger is used to log the entries with the info level when Handler
+	// is not set.
+	// Default is the logger set with SetLogger.
+	Logger Logger
+}
+
+type auditStartKey struct{}
+
+type auditHook struct {
+	opt AuditOptions
+}
+
+var _ Hook = (*auditHook)(nil)
+
+// NewAuditHook returns a hook that reports the commands processed by the
+// client together with the arguments and the result, e.g. for compliance
+// logging. Commands are reported after they are processed.
+func NewAuditHook(opt *AuditOptions) Hook {
+	h := new(auditHook)
+	if opt != nil {
+		h.opt = *opt
+	}
+	if h.opt.Handler == nil {
+		h.opt.Handler = h.log
+	}
+	return h
+}
+
+func (h *auditHook) log(ctx context.Context, entry *AuditEntry) {
+	keyvals := []interface{}{
+		"cmd", strings.Join(entry.Args, " "),
+		"duration", entry.Duration,
+	}
+	if entry.Err != nil {
+		keyvals = append(keyvals, "error", entry.Err)
+	}
+	internal.Log(ctx, h.opt.Logger, internal.LogLevelInfo, "redis audit", keyvals...)
+}
+
+func (h *auditHook) BeforeProcess(ctx context.Context, cmd Cmder) (context.Context, error) {
+	return context.WithValue(ctx, auditStartKey{}, time.Now()), nil
+}
+
+func (h *auditHook) AfterProcess(ctx context.Context, cmd Cmder) error {
+	start, _ := ctx.Value(auditStartKey{}).(time.Time)
+	h.audit(ctx, start, cmd)
+	return nil
+}
+
+func (h *auditHook) BeforeProcessPipeline(ctx context.Context, cmds []Cmder) (context.Context, error) {
+	return context.WithValue(ctx, auditStartKey{}, time.Now()), nil
+}
+
+func (h *auditHook) AfterProcessPipeline(ctx context.Context, cmds []Cmder) error {
+	start, _ := ctx.Value(auditStartKey{}).(time.Time)
+	for _, cmd := range cmds {
+		h.audit(ctx, start, cmd)
+	}
+	return nil
+}
+
+func (h *auditHook) audit(ctx context.Context, start time.Time, cmd Cmder) {
+	name := auditCmdName(cmd)
+	if len(h.opt.Commands) > 0 && !contains(h.opt.Commands, name) {
+		return
+	}
+
+	entry := &AuditEntry{
+		Time: start,
+		Name: name,
+		Args: h.args(cmd, name),
+	}
+	if !start.IsZero() {
+		entry.Duration = time.Since(start)
+	}
+	if err := cmd.Err(); err != nil && err != Nil {
+		entry.Err = err
+	}
+	h.opt.Handler(ctx, entry)
+}
+
+func (h *auditHook) args(cmd Cmder, name string) []string {
+	out := formatArgs(cmd.Args())
+	for i, redacted := range redactMask(cmd, name, out, h.opt.Rules) {
+		if redacted {
+			out[i] = "?"
+		}
+	}
+	return out
+}
+
+// auditCmdName is like FullName, but includes the subcommands of all the
+// container commands, e.g. "config set" or "acl setuser".
+func auditCmdName(cmd Cmder) string {
+	switch name := cmd.Name(); name {
+	case "acl", "client", "config", "function", "memory", "module", "object",
+		"script", "slowlog", "xgroup", "xinfo":
+		if args := cmd.Args(); len(args) > 1 {
+			if s, ok := args[1].(string); ok {
+				return name + " " + strings.ToLower(s)
+			}
+		}
+		return name
+	default:
+		return cmd.FullName()
+	}
+}
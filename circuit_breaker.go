@@ -0,0 +1,239 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by the commands of a client whose circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("redis: circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the commands through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all the commands with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe commands through to check whether
+	// the node recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions are used to configure a CircuitBreaker.
+type CircuitBreakerOptions struct {
+	// FailureRatio is the ratio of failed commands that opens the breaker.
+	// Only network errors and timeouts are failures; Redis errors, e.g.
+	// WRONGTYPE, and canceled contexts are not.
+	// Default is 0.5.
+	FailureRatio float64
+	// MinRequests is the minimum number of commands in Window before the
+	// breaker can open.
+	// Default is 20.
+	MinRequests int
+	// Window is the period the failure ratio is calculated for.
+	// Default is 10 seconds.
+	Window time.Duration
+	// OpenTimeout is how long the breaker stays open before it lets probe
+	// commands through.
+	// Default is 5 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe commands that must succeed
+	// to close the breaker. A failed probe opens the breaker again.
+	// Default is 1.
+	HalfOpenRequests int
+
+	// OnStateChange is called when the state of the breaker changes, e.g.
+	// to log it or to export it as a metric.
+	OnStateChange func(from, to CircuitState)
+}
+
+func (opt *CircuitBreakerOptions) init() {
+	if opt.FailureRatio == 0 {
+		opt.FailureRatio = 0.5
+	}
+	if opt.MinRequests == 0 {
+		opt.MinRequests = 20
+	}
+	if opt.Window == 0 {
+		opt.Window = 10 * time.Second
+	}
+	if opt.OpenTimeout == 0 {
+		opt.OpenTimeout = 5 * time.Second
+	}
+	if opt.HalfOpenRequests == 0 {
+		opt.HalfOpenRequests = 1
+	}
+}
+
+// CircuitBreaker is a Limiter that fails the commands fast with
+// ErrCircuitOpen after too many of them failed, so a dying node does not
+// make every command wait for the dial and read timeouts. Clients created
+// with Options.CircuitBreaker have their own breakers, e.g. every node of
+// a ClusterClient and every shard of a Ring.
+type CircuitBreaker struct {
+	opt CircuitBreakerOptions
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // allowed probes in the half-open state
+	successes   int // succeeded probes in the half-open state
+
+	// changes are the state changes reported after unlocking mu.
+	changes []circuitChange
+}
+
+type circuitChange struct {
+	from, to CircuitState
+}
+
+var _ Limiter = (*CircuitBreaker)(nil)
+
+// NewCircuitBreaker returns a new circuit breaker.
+func NewCircuitBreaker(opt *CircuitBreakerOptions) *CircuitBreaker {
+	b := new(CircuitBreaker)
+	if opt != nil {
+		b.opt = *opt
+	}
+	b.opt.init()
+	b.windowStart = time.Now()
+	return b
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+	b.checkOpenTimeout(time.Now())
+	return b.state
+}
+
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.checkOpenTimeout(time.Now())
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probes >= b.opt.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) ReportResult(result error) {
+	failed := isCircuitFailure(result)
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	switch b.state {
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.opt.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.opt.MinRequests &&
+			float64(b.failures) >= b.opt.FailureRatio*float64(b.requests) {
+			b.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			b.setState(CircuitOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opt.HalfOpenRequests {
+			b.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// cancel is called instead of ReportResult when the allowed command was
+// not sent, so it does not use the probe.
+func (b *CircuitBreaker) cancel() {
+	b.mu.Lock()
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+func (b *CircuitBreaker) checkOpenTimeout(now time.Time) {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.opt.OpenTimeout {
+		b.setState(CircuitHalfOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	from := b.state
+	b.state = state
+
+	switch state {
+	case CircuitOpen:
+		b.openedAt = now
+	case CircuitHalfOpen:
+		b.probes = 0
+		b.successes = 0
+	case CircuitClosed:
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+
+	if b.opt.OnStateChange != nil {
+		b.changes = append(b.changes, circuitChange{from: from, to: state})
+	}
+}
+
+// unlock unlocks mu and calls OnStateChange, so it can use the breaker.
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		b.opt.OnStateChange(c.from, c.to)
+	}
+}
+
+// isCircuitFailure reports whether the error indicates that the node is
+// unhealthy.
+func isCircuitFailure(err error) bool {
+	switch err {
+	case nil, Nil, ErrClosed, ErrCircuitOpen, context.Canceled:
+		return false
+	}
+	return !isRedisError(err)
+}
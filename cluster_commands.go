@@ -54,6 +54,74 @@ func (c *ClusterClient) ScriptLoad(ctx context.Context, script string) *StringCm
 	return cmd
 }
 
+// FunctionLoad loads the library on all the master nodes.
+func (c *ClusterClient) FunctionLoad(ctx context.Context, code string) *StringCmd {
+	return c.functionLoad(ctx, NewStringCmd(ctx, "function", "load", code))
+}
+
+// FunctionLoadReplace loads the library on all the master nodes replacing
+// the existing library with the same name.
+func (c *ClusterClient) FunctionLoadReplace(ctx context.Context, code string) *StringCmd {
+	return c.functionLoad(ctx, NewStringCmd(ctx, "function", "load", "replace", code))
+}
+
+func (c *ClusterClient) functionLoad(ctx context.Context, cmd *StringCmd) *StringCmd {
+	_ = c.hooks.process(ctx, cmd, func(ctx context.Context, _ Cmder) error {
+		mu := &sync.Mutex{}
+		err := c.ForEachMaster(ctx, func(ctx context.Context, master *Client) error {
+			masterCmd := NewStringCmd(ctx, cmd.Args()...)
+			_ = master.Process(ctx, masterCmd)
+			val, err := masterCmd.Result()
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			if cmd.Val() == "" {
+				cmd.val = val
+			}
+			mu.Unlock()
+
+			return nil
+		})
+		if err != nil {
+			cmd.SetErr(err)
+		}
+		return nil
+	})
+	return cmd
+}
+
+// FunctionDelete deletes the library on all the master nodes.
+func (c *ClusterClient) FunctionDelete(ctx context.Context, libName string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "function", "delete", libName)
+	_ = c.hooks.process(ctx, cmd, func(ctx context.Context, _ Cmder) error {
+		err := c.ForEachMaster(ctx, func(ctx context.Context, master *Client) error {
+			return master.FunctionDelete(ctx, libName).Err()
+		})
+		if err != nil {
+			cmd.SetErr(err)
+		}
+		return nil
+	})
+	return cmd
+}
+
+// FunctionFlush deletes all the libraries on all the master nodes.
+func (c *ClusterClient) FunctionFlush(ctx context.Context) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "function", "flush")
+	_ = c.hooks.process(ctx, cmd, func(ctx context.Context, _ Cmder) error {
+		err := c.ForEachMaster(ctx, func(ctx context.Context, master *Client) error {
+			return master.FunctionFlush(ctx).Err()
+		})
+		if err != nil {
+			cmd.SetErr(err)
+		}
+		return nil
+	})
+	return cmd
+}
+
 func (c *ClusterClient) ScriptFlush(ctx context.Context) *StatusCmd {
 	cmd := NewStatusCmd(ctx, "script", "flush")
 	_ = c.hooks.process(ctx, cmd, func(ctx context.Context, _ Cmder) error {
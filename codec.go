@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"encoding/json"
+
+	"github.com/farss/redis/v8/internal/proto"
+)
+
+// Codec encodes Go values to bytes and decodes them back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec that uses encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+//------------------------------------------------------------------------------
+
+// Marshaler is implemented by the types that control how they are written
+// as command args, e.g.
+//
+//	func (s Status) MarshalRedis() ([]byte, error) {
+//		return []byte(s.String()), nil
+//	}
+//
+// Marshaler takes precedence over encoding.BinaryMarshaler, which takes
+// precedence over encoding.TextMarshaler.
+type Marshaler interface {
+	MarshalRedis() ([]byte, error)
+}
+
+// Unmarshaler is implemented by the types that control how they are scanned
+// from replies, e.g. with StringCmd.Scan or into struct fields with the
+// `redis:"field"` tag. Unmarshaler takes precedence over
+// encoding.BinaryUnmarshaler, which takes precedence over
+// encoding.TextUnmarshaler.
+type Unmarshaler interface {
+	UnmarshalRedis(b []byte) error
+}
+
+var (
+	_ proto.Marshaler   = (Marshaler)(nil)
+	_ proto.Unmarshaler = (Unmarshaler)(nil)
+)
+
+//------------------------------------------------------------------------------
+
+// TimeEncoding is how time.Time and time.Duration command args are encoded
+// and how the replies are scanned into them, e.g. with StringCmd.Time.
+type TimeEncoding int
+
+const (
+	// TimeRFC3339Nano encodes times with time.RFC3339Nano and durations in
+	// nanoseconds. It is the default.
+	TimeRFC3339Nano TimeEncoding = TimeEncoding(proto.TimeRFC3339Nano)
+	// TimeRFC3339 encodes times with time.RFC3339 and durations in seconds.
+	TimeRFC3339 TimeEncoding = TimeEncoding(proto.TimeRFC3339)
+	// TimeUnix encodes times as unix seconds and durations in seconds.
+	TimeUnix TimeEncoding = TimeEncoding(proto.TimeUnix)
+	// TimeUnixMilli encodes times as unix milliseconds and durations in
+	// milliseconds.
+	TimeUnixMilli TimeEncoding = TimeEncoding(proto.TimeUnixMilli)
+)
+
+// newEncoding returns the encoding of the connections or nil if the defaults
+// are used.
+func newEncoding(codec Codec, timeEnc TimeEncoding) *proto.Encoding {
+	if codec == nil && timeEnc == TimeRFC3339Nano {
+		return nil
+	}
+	return &proto.Encoding{
+		Codec: codec,
+		Time:  proto.TimeEncoding(timeEnc),
+	}
+}
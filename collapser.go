@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal/hashtag"
+)
+
+// GetCollapserOptions are used to configure a GetCollapser.
+type GetCollapserOptions struct {
+	// Window is how long GET commands are collected before they are sent
+	// together as a single MGET command.
+	// Default is 1 millisecond.
+	Window time.Duration
+	// MaxKeys is the maximum number of keys in a single MGET command.
+	// The collected keys are sent right away once the limit is reached.
+	// Default is 100 keys.
+	MaxKeys int
+}
+
+func (opt *GetCollapserOptions) init() {
+	if opt.Window == 0 {
+		opt.Window = time.Millisecond
+	}
+	if opt.MaxKeys == 0 {
+		opt.MaxKeys = 100
+	}
+}
+
+// GetCollapser merges concurrent GET commands issued within a short window
+// into a single MGET command. Concurrent GETs of the same key share one
+// request, which reduces load on Redis when many goroutines miss the same
+// cache entry at once. It's safe for concurrent use by multiple goroutines.
+//
+// When used with ClusterClient the keys are collected per hash slot, because
+// MGET can't operate on keys from different slots. When used with Ring the
+// keys are collected per shard, because Ring sends MGET to the shard of the
+// first key.
+type GetCollapser struct {
+	client  Cmdable
+	cluster bool
+	ring    *Ring
+	opt     GetCollapserOptions
+
+	mu      sync.Mutex
+	batches map[string]*getBatch
+}
+
+type getBatch struct {
+	ctx   context.Context
+	keys  []string
+	index map[string]int
+	timer *time.Timer
+
+	done chan struct{}
+	vals []interface{}
+	err  error
+}
+
+// NewGetCollapser returns a GetCollapser that sends MGET commands using client.
+// opt can be nil to use the default options.
+func NewGetCollapser(client Cmdable, opt *GetCollapserOptions) *GetCollapser {
+	c := &GetCollapser{
+		client:  client,
+		batches: make(map[string]*getBatch),
+	}
+	if opt != nil {
+		c.opt = *opt
+	}
+	c.opt.init()
+	_, c.cluster = client.(*ClusterClient)
+	c.ring, _ = client.(*Ring)
+	return c
+}
+
+// batchKey returns the key of the batch the key is collected in.
+func (c *GetCollapser) batchKey(key string) string {
+	switch {
+	case c.cluster:
+		return strconv.Itoa(hashtag.Slot(key))
+	case c.ring != nil:
+		return c.ring.shards.Hash(key)
+	default:
+		return ""
+	}
+}
+
+// Get returns the value of the key like Client.Get does, but the command
+// is sent to Redis together with other GET commands.
+func (c *GetCollapser) Get(ctx context.Context, key string) *StringCmd {
+	cmd := NewStringCmd(ctx, "get", key)
+
+	batch := c.batchKey(key)
+
+	c.mu.Lock()
+	b := c.batches[batch]
+	if b == nil {
+		b = &getBatch{
+			ctx:   detachedContext{ctx},
+			index: make(map[string]int),
+			done:  make(chan struct{}),
+		}
+		c.batches[batch] = b
+		b.timer = time.AfterFunc(c.opt.Window, func() {
+			c.flush(batch, b)
+		})
+	}
+	i, ok := b.index[key]
+	if !ok {
+		i = len(b.keys)
+		b.index[key] = i
+		b.keys = append(b.keys, key)
+	}
+	full := len(b.keys) >= c.opt.MaxKeys
+	if full {
+		// Stop collecting keys for the batch.
+		delete(c.batches, batch)
+	}
+	c.mu.Unlock()
+
+	// If the timer already fired, the batch is being flushed by the timer.
+	if full && b.timer.Stop() {
+		c.flush(batch, b)
+	}
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		cmd.SetErr(ctx.Err())
+		return cmd
+	}
+
+	switch {
+	case b.err != nil:
+		cmd.SetErr(b.err)
+	case b.vals[i] == nil:
+		cmd.SetErr(Nil)
+	default:
+		s, _ := b.vals[i].(string)
+		cmd.SetVal(s)
+	}
+	return cmd
+}
+
+func (c *GetCollapser) flush(batch string, b *getBatch) {
+	c.mu.Lock()
+	if c.batches[batch] == b {
+		delete(c.batches, batch)
+	}
+	c.mu.Unlock()
+
+	b.vals, b.err = c.client.MGet(b.ctx, b.keys...).Result()
+	close(b.done)
+}
+
+// detachedContext keeps the values of the parent context, but is never
+// canceled. It allows a batch to outlive the caller that started it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
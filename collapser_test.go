@@ -0,0 +1,74 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var _ = Describe("GetCollapser", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("merges concurrent GETs into MGET", func() {
+		for i := 0; i < 10; i++ {
+			Expect(client.Set(ctx, fmt.Sprintf("key%d", i), i, 0).Err()).NotTo(HaveOccurred())
+		}
+
+		var mu sync.Mutex
+		var cmds []redis.Cmder
+		client.AddHook(&hook{
+			beforeProcess: func(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+				mu.Lock()
+				cmds = append(cmds, cmd)
+				mu.Unlock()
+				return ctx, nil
+			},
+		})
+
+		collapser := redis.NewGetCollapser(client, &redis.GetCollapserOptions{
+			Window: 50 * time.Millisecond,
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 12; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				val, err := collapser.Get(ctx, fmt.Sprintf("key%d", i%11)).Result()
+				if i%11 == 10 {
+					Expect(err).To(Equal(redis.Nil))
+					return
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal(fmt.Sprint(i % 11)))
+			}(i)
+		}
+		wg.Wait()
+
+		Expect(cmds).To(HaveLen(1))
+		Expect(cmds[0].Name()).To(Equal("mget"))
+		Expect(cmds[0].Args()).To(HaveLen(12))
+	})
+
+	It("sends keys once MaxKeys is reached", func() {
+		collapser := redis.NewGetCollapser(client, &redis.GetCollapserOptions{
+			Window:  time.Hour,
+			MaxKeys: 1,
+		})
+
+		err := collapser.Get(ctx, "key").Err()
+		Expect(err).To(Equal(redis.Nil))
+	})
+})
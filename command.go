@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"reflect"
 	"strconv"
 	"time"
 
@@ -17,6 +18,7 @@ type Cmder interface {
 	Name() string
 	FullName() string
 	Args() []interface{}
+	SetArgs(args ...interface{})
 	String() string
 	stringArg(int) string
 	firstKeyPos() int8
@@ -31,7 +33,7 @@ type Cmder interface {
 
 func setCmdsErr(cmds []Cmder, e error) {
 	for _, cmd := range cmds {
-		if cmd.Err() == nil {
+		if err := cmd.Err(); err == nil || err == ErrNotExecuted {
 			cmd.SetErr(e)
 		}
 	}
@@ -65,13 +67,13 @@ func cmdFirstKeyPos(cmd Cmder, info *CommandInfo) int {
 	}
 
 	switch cmd.Name() {
-	case "eval", "evalsha":
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
 		if cmd.stringArg(2) != "0" {
 			return 3
 		}
 
 		return 0
-	case "publish":
+	case "publish", "spublish":
 		return 1
 	case "memory":
 		// https://github.com/redis/redis/issues/7493
@@ -86,19 +88,26 @@ func cmdFirstKeyPos(cmd Cmder, info *CommandInfo) int {
 	return 0
 }
 
+// cmdString formats the cmd with the arguments redacted by SetRedactRules.
 func cmdString(cmd Cmder, val interface{}) string {
 	b := make([]byte, 0, 64)
 
-	for i, arg := range cmd.Args() {
+	args := formatArgs(cmd.Args())
+	mask := redactMask(cmd, auditCmdName(cmd), args, nil)
+	for i, arg := range args {
 		if i > 0 {
 			b = append(b, ' ')
 		}
-		b = internal.AppendArg(b, arg)
+		if mask != nil && mask[i] {
+			b = append(b, '?')
+		} else {
+			b = append(b, arg...)
+		}
 	}
 
 	if err := cmd.Err(); err != nil {
 		b = append(b, ": "...)
-		b = append(b, err.Error()...)
+		b = append(b, redactErrString(err.Error(), args, mask)...)
 	} else if val != nil {
 		b = append(b, ": "...)
 		b = internal.AppendArg(b, val)
@@ -147,6 +156,13 @@ func (cmd *baseCmd) Args() []interface{} {
 	return cmd.args
 }
 
+// SetArgs replaces the command arguments including the name, e.g. to
+// rewrite the keys in a ProcessMiddleware. It must be called before the
+// command is processed.
+func (cmd *baseCmd) SetArgs(args ...interface{}) {
+	cmd.args = args
+}
+
 func (cmd *baseCmd) stringArg(pos int) string {
 	if pos < 0 || pos >= len(cmd.args) {
 		return ""
@@ -177,6 +193,19 @@ func (cmd *baseCmd) Err() error {
 	return cmd.err
 }
 
+// exists reports whether the command succeeded with a non-nil reply and
+// returns the error unless it is Nil.
+func (cmd *baseCmd) exists() (bool, error) {
+	switch cmd.err {
+	case nil:
+		return true, nil
+	case Nil:
+		return false, nil
+	default:
+		return false, cmd.err
+	}
+}
+
 func (cmd *baseCmd) readTimeout() *time.Duration {
 	return cmd._readTimeout
 }
@@ -191,6 +220,7 @@ type Cmd struct {
 	baseCmd
 
 	val interface{}
+	enc *proto.Encoding
 }
 
 func NewCmd(ctx context.Context, args ...interface{}) *Cmd {
@@ -218,6 +248,29 @@ func (cmd *Cmd) Result() (interface{}, error) {
 	return cmd.val, cmd.err
 }
 
+// ValOrDefault returns the value or def if the reply is nil or the command
+// failed.
+func (cmd *Cmd) ValOrDefault(def interface{}) interface{} {
+	if cmd.err != nil {
+		return def
+	}
+	return cmd.val
+}
+
+// Exists reports whether the reply is not nil. Unlike Result, it returns
+// a nil error instead of Nil.
+func (cmd *Cmd) Exists() (bool, error) {
+	return cmd.exists()
+}
+
+// Ok is like Result, but returns false instead of the Nil error, e.g.
+//
+//	val, ok, err := rdb.Do(ctx, "get", "key").Ok()
+func (cmd *Cmd) Ok() (interface{}, bool, error) {
+	ok, err := cmd.exists()
+	return cmd.val, ok, err
+}
+
 func (cmd *Cmd) Text() (string, error) {
 	if cmd.err != nil {
 		return "", cmd.err
@@ -463,8 +516,22 @@ func (cmd *Cmd) BoolSlice() ([]bool, error) {
 	return bools, nil
 }
 
+// Scan scans the reply into dst, which must be a pointer. Arrays are scanned
+// into slices, and arrays of field-value pairs, e.g. the replies of CONFIG GET,
+// into maps with string keys or structs using the `redis:"field"` tags, so
+// nested replies like XRANGE can be scanned into e.g.
+// []map[string]map[string]string. Other values are scanned like with
+// StringCmd.Scan. Nil values leave the destinations unchanged.
+func (cmd *Cmd) Scan(dst interface{}) error {
+	if cmd.err != nil {
+		return cmd.err
+	}
+	return scanReply(dst, cmd.val, cmd.enc)
+}
+
 func (cmd *Cmd) readReply(rd *proto.Reader) (err error) {
 	cmd.val, err = rd.ReadReply(sliceParser)
+	cmd.enc = rd.Encoding()
 	return err
 }
 
@@ -495,6 +562,7 @@ type SliceCmd struct {
 	baseCmd
 
 	val []interface{}
+	enc *proto.Encoding
 }
 
 var _ Cmder = (*SliceCmd)(nil)
@@ -526,11 +594,16 @@ func (cmd *SliceCmd) String() string {
 
 // Scan scans the results from the map into a destination struct. The map keys
 // are matched in the Redis struct fields by the `redis:"field"` tag.
+// Other destinations, e.g. slices, are scanned like with Cmd.Scan.
 func (cmd *SliceCmd) Scan(dst interface{}) error {
 	if cmd.err != nil {
 		return cmd.err
 	}
 
+	if v := reflect.ValueOf(dst); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return scanReply(dst, cmd.val, cmd.enc)
+	}
+
 	// Pass the list of keys and values.
 	// Skip the first two args for: HMGET key
 	var args []interface{}
@@ -541,7 +614,41 @@ func (cmd *SliceCmd) Scan(dst interface{}) error {
 		args = cmd.args[1:]
 	}
 
-	return hscan.Scan(dst, args, cmd.val)
+	return hscan.ScanEncoding(dst, args, cmd.val, cmd.enc)
+}
+
+// ScanValues scans the values into dst, one destination per value, e.g.
+// the values returned by MGET. Types that are not supported natively are
+// unmarshaled with Options.Codec. Nil values, e.g. the values of missing
+// keys, leave the destinations unchanged.
+func (cmd *SliceCmd) ScanValues(dst ...interface{}) error {
+	if cmd.err != nil {
+		return cmd.err
+	}
+	if len(dst) != len(cmd.val) {
+		return fmt.Errorf("redis: got %d values, wanted %d destinations",
+			len(cmd.val), len(dst))
+	}
+
+	for i, v := range cmd.val {
+		var b []byte
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			b = util.StringToBytes(v)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		case error:
+			return v
+		default:
+			return fmt.Errorf("redis: can't scan value %d of type %T", i, v)
+		}
+		if err := proto.ScanEncoding(b, dst[i], cmd.enc); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (cmd *SliceCmd) readReply(rd *proto.Reader) error {
@@ -550,6 +657,7 @@ func (cmd *SliceCmd) readReply(rd *proto.Reader) error {
 		return err
 	}
 	cmd.val = v.([]interface{})
+	cmd.enc = rd.Encoding()
 	return nil
 }
 
@@ -861,6 +969,7 @@ type StringCmd struct {
 	baseCmd
 
 	val string
+	enc *proto.Encoding
 }
 
 var _ Cmder = (*StringCmd)(nil)
@@ -886,6 +995,35 @@ func (cmd *StringCmd) Result() (string, error) {
 	return cmd.Val(), cmd.err
 }
 
+// ValOrDefault returns the value or def if the key does not exist or the
+// command failed.
+func (cmd *StringCmd) ValOrDefault(def string) string {
+	if cmd.err != nil {
+		return def
+	}
+	return cmd.val
+}
+
+// Exists reports whether the key exists, so that a missing key is told apart
+// from an empty value. Unlike Result, it returns a nil error instead of Nil.
+func (cmd *StringCmd) Exists() (bool, error) {
+	return cmd.exists()
+}
+
+// Ok is like Result, but returns false instead of the Nil error, e.g.
+//
+//	val, ok, err := rdb.Get(ctx, "key").Ok()
+//	if err != nil {
+//		return err
+//	}
+//	if !ok {
+//		// The key does not exist.
+//	}
+func (cmd *StringCmd) Ok() (string, bool, error) {
+	ok, err := cmd.exists()
+	return cmd.val, ok, err
+}
+
 func (cmd *StringCmd) Bytes() ([]byte, error) {
 	return util.StringToBytes(cmd.val), cmd.err
 }
@@ -940,14 +1078,16 @@ func (cmd *StringCmd) Time() (time.Time, error) {
 	if cmd.err != nil {
 		return time.Time{}, cmd.err
 	}
-	return time.Parse(time.RFC3339Nano, cmd.Val())
+	return cmd.enc.ParseTime(util.StringToBytes(cmd.val))
 }
 
+// Scan scans the value into val. Types that are not supported natively are
+// unmarshaled with Options.Codec.
 func (cmd *StringCmd) Scan(val interface{}) error {
 	if cmd.err != nil {
 		return cmd.err
 	}
-	return proto.Scan([]byte(cmd.val), val)
+	return proto.ScanEncoding([]byte(cmd.val), val, cmd.enc)
 }
 
 func (cmd *StringCmd) String() string {
@@ -956,11 +1096,65 @@ func (cmd *StringCmd) String() string {
 
 func (cmd *StringCmd) readReply(rd *proto.Reader) (err error) {
 	cmd.val, err = rd.ReadString()
+	cmd.enc = rd.Encoding()
 	return err
 }
 
 //------------------------------------------------------------------------------
 
+// BytesCmd is like StringCmd, but passes the value to fn without copying it
+// to a string, e.g. for the hot paths where the allocation of the values
+// shows up in profiles. The value is the read buffer of the connection, which
+// is reused by the next command: it is only valid until fn returns, so fn
+// must copy the bytes it keeps, and it must not be modified. fn is called
+// while the reply is read, before the hooks see the command and before the
+// command is done, i.e. before Process returns or, for the commands of a
+// pipeline, before Exec returns. It is not called for the nil reply, which
+// is reported by Err as usual.
+//
+// fn runs on the goroutine that reads the reply, which is not always the
+// caller: the reply is read by another goroutine when the context can be
+// canceled, in the pipelines of ClusterClient and Ring, where the callbacks
+// of the commands sent to different nodes can run concurrently, and in
+// StreamPipeline, where fn can run before Exec is called.
+//
+// fn is called once per reply, so it is called more than once only when a
+// pipeline is retried after a network error and the command is sent again.
+// A single command is not processed again after its reply is read, and
+// ClusterClient doesn't hedge BytesCmd.
+type BytesCmd struct {
+	baseCmd
+
+	fn func(b []byte)
+}
+
+var _ Cmder = (*BytesCmd)(nil)
+
+func NewBytesCmd(ctx context.Context, fn func(b []byte), args ...interface{}) *BytesCmd {
+	return &BytesCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+		fn: fn,
+	}
+}
+
+func (cmd *BytesCmd) String() string {
+	return cmdString(cmd, nil)
+}
+
+func (cmd *BytesCmd) readReply(rd *proto.Reader) error {
+	b, err := rd.ReadTmpBytes()
+	if err != nil {
+		return err
+	}
+	cmd.fn(b)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
 type FloatCmd struct {
 	baseCmd
 
@@ -1111,6 +1305,50 @@ func (cmd *StringSliceCmd) readReply(rd *proto.Reader) error {
 
 //------------------------------------------------------------------------------
 
+// BytesSliceCmd is like StringSliceCmd, but passes the values to fn without
+// copying them like BytesCmd, with the same rules for when fn is called.
+// fn is called with the index of every value; nil values are nil slices.
+type BytesSliceCmd struct {
+	baseCmd
+
+	fn func(i int, b []byte)
+}
+
+var _ Cmder = (*BytesSliceCmd)(nil)
+
+func NewBytesSliceCmd(ctx context.Context, fn func(i int, b []byte), args ...interface{}) *BytesSliceCmd {
+	return &BytesSliceCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+		fn: fn,
+	}
+}
+
+func (cmd *BytesSliceCmd) String() string {
+	return cmdString(cmd, nil)
+}
+
+func (cmd *BytesSliceCmd) readReply(rd *proto.Reader) error {
+	_, err := rd.ReadArrayReply(func(rd *proto.Reader, n int64) (interface{}, error) {
+		for i := 0; i < int(n); i++ {
+			switch b, err := rd.ReadTmpBytes(); {
+			case err == Nil:
+				cmd.fn(i, nil)
+			case err != nil:
+				return nil, err
+			default:
+				cmd.fn(i, b)
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+//------------------------------------------------------------------------------
+
 type BoolSliceCmd struct {
 	baseCmd
 
@@ -1165,6 +1403,7 @@ type StringStringMapCmd struct {
 	baseCmd
 
 	val map[string]string
+	enc *proto.Encoding
 }
 
 var _ Cmder = (*StringStringMapCmd)(nil)
@@ -1195,7 +1434,9 @@ func (cmd *StringStringMapCmd) String() string {
 }
 
 // Scan scans the results from the map into a destination struct. The map keys
-// are matched in the Redis struct fields by the `redis:"field"` tag.
+// are matched in the Redis struct fields by the `redis:"field"` tag. Fields
+// of the types that are not supported natively, e.g. structs and maps, are
+// unmarshaled with Options.Codec.
 func (cmd *StringStringMapCmd) Scan(dest interface{}) error {
 	if cmd.err != nil {
 		return cmd.err
@@ -1207,7 +1448,7 @@ func (cmd *StringStringMapCmd) Scan(dest interface{}) error {
 	}
 
 	for k, v := range cmd.val {
-		if err := strct.Scan(k, v); err != nil {
+		if err := strct.ScanEncoding(k, v, cmd.enc); err != nil {
 			return err
 		}
 	}
@@ -1216,6 +1457,7 @@ func (cmd *StringStringMapCmd) Scan(dest interface{}) error {
 }
 
 func (cmd *StringStringMapCmd) readReply(rd *proto.Reader) error {
+	cmd.enc = rd.Encoding()
 	_, err := rd.ReadArrayReply(func(rd *proto.Reader, n int64) (interface{}, error) {
 		cmd.val = make(map[string]string, n/2)
 		for i := int64(0); i < n; i += 2 {
@@ -1349,6 +1591,27 @@ type XMessage struct {
 	Values map[string]interface{}
 }
 
+// Scan scans the message values into the struct dst. The fields are matched
+// by the `redis:"field"` tag.
+func (m XMessage) Scan(dst interface{}) error {
+	strct, err := hscan.Struct(dst)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range m.Values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if err := strct.Scan(k, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type XMessageSliceCmd struct {
 	baseCmd
 
@@ -1762,8 +2025,9 @@ func (cmd *XAutoClaimCmd) String() string {
 
 func (cmd *XAutoClaimCmd) readReply(rd *proto.Reader) error {
 	_, err := rd.ReadArrayReply(func(rd *proto.Reader, n int64) (interface{}, error) {
-		if n != 2 {
-			return nil, fmt.Errorf("got %d, wanted 2", n)
+		// Redis 7 also replies with the IDs of deleted messages.
+		if n != 2 && n != 3 {
+			return nil, fmt.Errorf("got %d, wanted 2 or 3", n)
 		}
 		var err error
 
@@ -1777,6 +2041,12 @@ func (cmd *XAutoClaimCmd) readReply(rd *proto.Reader) error {
 			return nil, err
 		}
 
+		if n == 3 {
+			if _, err := rd.ReadArrayReply(sliceParser); err != nil {
+				return nil, err
+			}
+		}
+
 		return nil, nil
 	})
 	return err
@@ -1821,8 +2091,9 @@ func (cmd *XAutoClaimJustIDCmd) String() string {
 
 func (cmd *XAutoClaimJustIDCmd) readReply(rd *proto.Reader) error {
 	_, err := rd.ReadArrayReply(func(rd *proto.Reader, n int64) (interface{}, error) {
-		if n != 2 {
-			return nil, fmt.Errorf("got %d, wanted 2", n)
+		// Redis 7 also replies with the IDs of deleted messages.
+		if n != 2 && n != 3 {
+			return nil, fmt.Errorf("got %d, wanted 2 or 3", n)
 		}
 		var err error
 
@@ -1844,6 +2115,12 @@ func (cmd *XAutoClaimJustIDCmd) readReply(rd *proto.Reader) error {
 			}
 		}
 
+		if n == 3 {
+			if _, err := rd.ReadArrayReply(sliceParser); err != nil {
+				return nil, err
+			}
+		}
+
 		return nil, nil
 	})
 	return err
@@ -2625,6 +2902,16 @@ func (cmd *ScanCmd) Iterator() *ScanIterator {
 	}
 }
 
+// PrefetchIterator is like Iterator, but the returned iterator fetches
+// the next page in the background while the current page is consumed.
+// This hides the round trip per page when sweeping large keyspaces.
+func (cmd *ScanCmd) PrefetchIterator() *ScanIterator {
+	return &ScanIterator{
+		cmd:      cmd,
+		prefetch: true,
+	}
+}
+
 //------------------------------------------------------------------------------
 
 type ClusterNode struct {
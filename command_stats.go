@@ -0,0 +1,196 @@
+package redis
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Latencies are recorded in microseconds in log-linear buckets: the values
+// are grouped by the power of two, and every group is split into
+// latencySubBuckets linear buckets, so the relative error is below 1/16.
+const (
+	latencySubBits    = 4
+	latencySubBuckets = 1 << latencySubBits
+	latencyMaxBits    = 32 // ~71 minutes
+	latencyNumBuckets = (latencyMaxBits - latencySubBits + 1) * latencySubBuckets
+)
+
+func latencyBucket(d time.Duration) int {
+	us := uint64(d / time.Microsecond)
+	if d < 0 {
+		us = 0
+	}
+	if us < latencySubBuckets {
+		return int(us)
+	}
+	if us >= 1<<latencyMaxBits {
+		return latencyNumBuckets - 1
+	}
+	shift := bits.Len64(us) - latencySubBits - 1
+	return (shift+1)*latencySubBuckets + int(us>>shift) - latencySubBuckets
+}
+
+// latencyBucketValue returns the middle of the bucket.
+func latencyBucketValue(i int) time.Duration {
+	if i < latencySubBuckets {
+		return time.Duration(i) * time.Microsecond
+	}
+	shift := i/latencySubBuckets - 1
+	lower := uint64(i%latencySubBuckets+latencySubBuckets) << shift
+	mid := lower + (uint64(1)<<shift)/2
+	return time.Duration(mid) * time.Microsecond
+}
+
+// CommandStats contains latency statistics of a command. Latency is the time
+// spent processing the command including retries, but excluding the hooks.
+type CommandStats struct {
+	Count  uint64        // number of processed commands
+	Errors uint64        // number of failed commands, not counting Nil replies
+	Total  time.Duration // total latency
+	Max    time.Duration // maximum latency
+
+	buckets []uint64
+}
+
+// Mean returns the mean latency.
+func (s *CommandStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Percentile returns the latency below which the percentage p (0-100) of
+// the commands fall, e.g. 99 for p99. The value is approximate with the
+// relative error below 1/16, but it never exceeds Max.
+func (s *CommandStats) Percentile(p float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(s.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var n uint64
+	for i, count := range s.buckets {
+		n += count
+		if n >= rank {
+			if d := latencyBucketValue(i); d < s.Max {
+				return d
+			}
+			return s.Max
+		}
+	}
+	return s.Max
+}
+
+func (s *CommandStats) merge(other *CommandStats) {
+	s.Count += other.Count
+	s.Errors += other.Errors
+	s.Total += other.Total
+	if other.Max > s.Max {
+		s.Max = other.Max
+	}
+	if s.buckets == nil {
+		s.buckets = make([]uint64, latencyNumBuckets)
+	}
+	for i, count := range other.buckets {
+		s.buckets[i] += count
+	}
+}
+
+func mergeCommandStats(dst, src map[string]*CommandStats) {
+	for name, stats := range src {
+		if s, ok := dst[name]; ok {
+			s.merge(stats)
+		} else {
+			dst[name] = stats
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type cmdLatency struct {
+	count  uint64 // atomic
+	errors uint64 // atomic
+	total  uint64 // atomic
+	max    uint64 // atomic
+
+	buckets [latencyNumBuckets]uint64 // atomic
+}
+
+func (l *cmdLatency) record(d time.Duration, err error) {
+	atomic.AddUint64(&l.count, 1)
+	if err != nil && err != Nil {
+		atomic.AddUint64(&l.errors, 1)
+	}
+	atomic.AddUint64(&l.total, uint64(d))
+	for {
+		max := atomic.LoadUint64(&l.max)
+		if uint64(d) <= max || atomic.CompareAndSwapUint64(&l.max, max, uint64(d)) {
+			break
+		}
+	}
+	atomic.AddUint64(&l.buckets[latencyBucket(d)], 1)
+}
+
+func (l *cmdLatency) stats() *CommandStats {
+	s := &CommandStats{
+		Count:   atomic.LoadUint64(&l.count),
+		Errors:  atomic.LoadUint64(&l.errors),
+		Total:   time.Duration(atomic.LoadUint64(&l.total)),
+		Max:     time.Duration(atomic.LoadUint64(&l.max)),
+		buckets: make([]uint64, latencyNumBuckets),
+	}
+	for i := range l.buckets {
+		s.buckets[i] = atomic.LoadUint64(&l.buckets[i])
+	}
+	return s
+}
+
+// commandStats records latencies of the commands by name.
+type commandStats struct {
+	mu   sync.RWMutex
+	cmds map[string]*cmdLatency
+}
+
+func newCommandStats() *commandStats {
+	return &commandStats{
+		cmds: make(map[string]*cmdLatency),
+	}
+}
+
+func (s *commandStats) record(name string, d time.Duration, err error) {
+	s.mu.RLock()
+	l := s.cmds[name]
+	s.mu.RUnlock()
+
+	if l == nil {
+		s.mu.Lock()
+		l = s.cmds[name]
+		if l == nil {
+			l = new(cmdLatency)
+			s.cmds[name] = l
+		}
+		s.mu.Unlock()
+	}
+
+	l.record(d, err)
+}
+
+func (s *commandStats) stats() map[string]*CommandStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m := make(map[string]*CommandStats, len(s.cmds))
+	for name, l := range s.cmds {
+		m[name] = l.stats()
+	}
+	return m
+}
@@ -57,6 +57,34 @@ var _ = Describe("Cmd", func() {
 		Expect(f).To(Equal(float64(10)))
 	})
 
+	It("has nil-safe accessors", func() {
+		Expect(client.Set(ctx, "empty", "", 0).Err()).NotTo(HaveOccurred())
+
+		get := client.Get(ctx, "empty")
+		Expect(get.ValOrDefault("default")).To(Equal(""))
+		ok, err := get.Exists()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		get = client.Get(ctx, "missing")
+		Expect(get.ValOrDefault("default")).To(Equal("default"))
+		val, ok, err := get.Ok()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(val).To(Equal(""))
+
+		get = redis.NewStringResult("", errors.New("oops"))
+		ok, err = get.Exists()
+		Expect(err).To(MatchError("oops"))
+		Expect(ok).To(BeFalse())
+
+		do := client.Do(ctx, "get", "missing")
+		Expect(do.ValOrDefault(1)).To(Equal(1))
+		ok, err = do.Exists()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
 	It("supports float32", func() {
 		f := float32(66.97)
 
@@ -20,6 +20,7 @@ type KvScanCmd struct {
 	page   []string
 	cursor string
 	flag   int
+	enc    *proto.Encoding
 
 	process cmdable
 }
@@ -70,6 +71,7 @@ func (cmd *KvScanCmd) String() string {
 }
 
 func (cmd *KvScanCmd) readReply(rd *proto.Reader) (err error) {
+	cmd.enc = rd.Encoding()
 	cmd.page, cmd.cursor, err = cmd.readScanReply(rd)
 	return err
 }
@@ -113,12 +115,24 @@ func (cmd *KvScanCmd) Iterator() *KvScanIterator {
 	}
 }
 
+// PrefetchIterator is like Iterator, but the returned iterator fetches
+// the next page in the background while the current page is consumed.
+func (cmd *KvScanCmd) PrefetchIterator() *KvScanIterator {
+	return &KvScanIterator{
+		cmd:      cmd,
+		prefetch: true,
+	}
+}
+
 // KvScanIterator is used to incrementally iterate over a collection of elements.
 // It's safe for concurrent use by multiple goroutines.
 type KvScanIterator struct {
 	mu  sync.Mutex // protects Scanner and pos
 	cmd *KvScanCmd
 	pos int
+
+	prefetch bool
+	next     chan *KvScanCmd // next page fetched in the background
 }
 
 // Err returns the last iterator error, if any.
@@ -139,6 +153,10 @@ func (it *KvScanIterator) Next(ctx context.Context) bool {
 		return false
 	}
 
+	if it.prefetch && it.next == nil {
+		it.startPrefetch(ctx)
+	}
+
 	// Advance cursor, check if we are still within range.
 	if it.pos < len(it.cmd.page) {
 		it.pos++
@@ -151,17 +169,22 @@ func (it *KvScanIterator) Next(ctx context.Context) bool {
 			return false
 		}
 
-		// Fetch next page.
-		switch it.cmd.args[0] {
-		case "scan", "qscan":
-			it.cmd.args[1] = it.cmd.cursor
-		default:
-			it.cmd.args[2] = it.cmd.cursor
-		}
-
-		err := it.cmd.process(ctx, it.cmd)
-		if err != nil {
-			return false
+		if it.next != nil {
+			// Wait for the page fetched in the background.
+			it.cmd = <-it.next
+			it.next = nil
+			if it.cmd.Err() != nil {
+				return false
+			}
+			it.startPrefetch(ctx)
+		} else {
+			// Fetch next page.
+			setScanCursor(it.cmd.args, it.cmd.cursor)
+
+			err := it.cmd.process(ctx, it.cmd)
+			if err != nil {
+				return false
+			}
 		}
 
 		it.pos = 1
@@ -173,6 +196,27 @@ func (it *KvScanIterator) Next(ctx context.Context) bool {
 	}
 }
 
+// startPrefetch starts fetching the page after the current one in a separate
+// goroutine. The result is picked up by Next once the current page is consumed.
+func (it *KvScanIterator) startPrefetch(ctx context.Context) {
+	if it.cmd.cursor == "0" {
+		return
+	}
+
+	args := make([]interface{}, len(it.cmd.args))
+	copy(args, it.cmd.args)
+	setScanCursor(args, it.cmd.cursor)
+
+	cmd := NewKvScanCmd(ctx, it.cmd.process, it.cmd.flag, args...)
+	next := make(chan *KvScanCmd, 1)
+	it.next = next
+
+	go func() {
+		_ = cmd.process(ctx, cmd)
+		next <- cmd
+	}()
+}
+
 // Val returns the key/field at the current cursor position.
 func (it *KvScanIterator) Val() string {
 	var v string
@@ -215,3 +259,31 @@ func (it *KvScanIterator) KeyValBytes() (k string, v []byte) {
 	it.mu.Unlock()
 	return k, v
 }
+
+// Decode decodes the value at the current cursor position into dst like
+// StringCmd.Scan, so with Options.Codec dst can be any type supported by the
+// codec. Like KeyVal, it advances the cursor past the value, so the key must
+// be read with Val before, e.g.
+//
+//	for it.Next(ctx) {
+//		key := it.Val()
+//		var user User
+//		if err := it.Decode(&user); err != nil {
+//			return err
+//		}
+//	}
+func (it *KvScanIterator) Decode(dst interface{}) error {
+	if it.cmd.flag&ScanValue == 0 {
+		panic("don't support Decode as not scan value")
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if err := it.cmd.Err(); err != nil {
+		return err
+	}
+	if it.pos <= 0 || it.pos >= len(it.cmd.page) {
+		return fmt.Errorf("redis: no value at the current cursor position")
+	}
+	it.pos++
+	return proto.ScanEncoding([]byte(it.cmd.page[it.pos-1]), dst, it.cmd.enc)
+}
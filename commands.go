@@ -2,11 +2,15 @@ package redis
 
 import (
 	"context"
+	"encoding"
 	"errors"
+	"fmt"
 	"io"
+	"reflect"
 	"time"
 
 	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/hscan"
 )
 
 // KeepTTL is a Redis KEEPTTL option to keep existing TTL, it requires your redis-server version >= 6.0,
@@ -22,11 +26,8 @@ func usePrecise(dur time.Duration) bool {
 
 func formatMs(ctx context.Context, dur time.Duration) int64 {
 	if dur > 0 && dur < time.Millisecond {
-		internal.Logger.Printf(
-			ctx,
-			"specified duration is %s, but minimal supported value is %s - truncating to 1ms",
-			dur, time.Millisecond,
-		)
+		internal.Log(ctx, nil, internal.LogLevelWarn,
+			"specified duration is less than 1ms - truncating to 1ms", "duration", dur)
 		return 1
 	}
 	return int64(dur / time.Millisecond)
@@ -34,11 +35,8 @@ func formatMs(ctx context.Context, dur time.Duration) int64 {
 
 func formatSec(ctx context.Context, dur time.Duration) int64 {
 	if dur > 0 && dur < time.Second {
-		internal.Logger.Printf(
-			ctx,
-			"specified duration is %s, but minimal supported value is %s - truncating to 1s",
-			dur, time.Second,
-		)
+		internal.Log(ctx, nil, internal.LogLevelWarn,
+			"specified duration is less than 1s - truncating to 1s", "duration", dur)
 		return 1
 	}
 	return int64(dur / time.Second)
@@ -73,7 +71,17 @@ func appendArg(dst []interface{}, arg interface{}) []interface{} {
 			dst = append(dst, k, v)
 		}
 		return dst
+	case time.Time, Marshaler, encoding.BinaryMarshaler, encoding.TextMarshaler:
+		return append(dst, arg)
 	default:
+		// Structs are appended as field-value pairs using the `redis` tag.
+		v := reflect.ValueOf(arg)
+		if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			return hscan.AppendFields(dst, v)
+		}
 		return append(dst, arg)
 	}
 }
@@ -125,6 +133,7 @@ type Cmdable interface {
 	Decr(ctx context.Context, key string) *IntCmd
 	DecrBy(ctx context.Context, key string, decrement int64) *IntCmd
 	Get(ctx context.Context, key string) *StringCmd
+	GetBytes(ctx context.Context, key string, fn func(b []byte)) *BytesCmd
 	GetRange(ctx context.Context, key string, start, end int64) *StringCmd
 	GetSet(ctx context.Context, key string, value interface{}) *StringCmd
 	GetEx(ctx context.Context, key string, expiration time.Duration) *StringCmd
@@ -165,6 +174,7 @@ type Cmdable interface {
 	HDel(ctx context.Context, key string, fields ...string) *IntCmd
 	HExists(ctx context.Context, key, field string) *BoolCmd
 	HGet(ctx context.Context, key, field string) *StringCmd
+	HGetBytes(ctx context.Context, key, field string, fn func(b []byte)) *BytesCmd
 	HGetAll(ctx context.Context, key string) *StringStringMapCmd
 	HIncrBy(ctx context.Context, key, field string, incr int64) *IntCmd
 	HIncrByFloat(ctx context.Context, key, field string, incr float64) *FloatCmd
@@ -172,6 +182,7 @@ type Cmdable interface {
 	HLen(ctx context.Context, key string) *IntCmd
 	HMGet(ctx context.Context, key string, fields ...string) *SliceCmd
 	HSet(ctx context.Context, key string, values ...interface{}) *IntCmd
+	HSetStruct(ctx context.Context, key string, v interface{}) *IntCmd
 	HMSet(ctx context.Context, key string, values ...interface{}) *BoolCmd
 	HSetNX(ctx context.Context, key, field string, value interface{}) *BoolCmd
 	HVals(ctx context.Context, key string) *StringSliceCmd
@@ -192,6 +203,7 @@ type Cmdable interface {
 	LPush(ctx context.Context, key string, values ...interface{}) *IntCmd
 	LPushX(ctx context.Context, key string, values ...interface{}) *IntCmd
 	LRange(ctx context.Context, key string, start, stop int64) *StringSliceCmd
+	LRangeBytes(ctx context.Context, key string, start, stop int64, fn func(i int, b []byte)) *BytesSliceCmd
 	LRem(ctx context.Context, key string, count int64, value interface{}) *IntCmd
 	LSet(ctx context.Context, key string, index int64, value interface{}) *StatusCmd
 	LTrim(ctx context.Context, key string, start, stop int64) *StatusCmd
@@ -341,6 +353,7 @@ type Cmdable interface {
 	FlushDB(ctx context.Context) *StatusCmd
 	FlushDBAsync(ctx context.Context) *StatusCmd
 	Info(ctx context.Context, section ...string) *StringCmd
+	InfoStruct(ctx context.Context, sections ...string) *InfoCmd
 	LastSave(ctx context.Context) *IntCmd
 	Save(ctx context.Context) *StatusCmd
 	Shutdown(ctx context.Context) *StatusCmd
@@ -355,15 +368,27 @@ type Cmdable interface {
 
 	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd
 	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd
+	EvalRO(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd
+	EvalShaRO(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd
 	ScriptExists(ctx context.Context, hashes ...string) *BoolSliceCmd
 	ScriptFlush(ctx context.Context) *StatusCmd
 	ScriptKill(ctx context.Context) *StatusCmd
 	ScriptLoad(ctx context.Context, script string) *StringCmd
 
+	FunctionLoad(ctx context.Context, code string) *StringCmd
+	FunctionLoadReplace(ctx context.Context, code string) *StringCmd
+	FunctionDelete(ctx context.Context, libName string) *StatusCmd
+	FunctionFlush(ctx context.Context) *StatusCmd
+	FCall(ctx context.Context, function string, keys []string, args ...interface{}) *Cmd
+	FCallRO(ctx context.Context, function string, keys []string, args ...interface{}) *Cmd
+
 	Publish(ctx context.Context, channel string, message interface{}) *IntCmd
+	SPublish(ctx context.Context, channel string, message interface{}) *IntCmd
 	PubSubChannels(ctx context.Context, pattern string) *StringSliceCmd
 	PubSubNumSub(ctx context.Context, channels ...string) *StringIntMapCmd
 	PubSubNumPat(ctx context.Context) *IntCmd
+	PubSubShardChannels(ctx context.Context, pattern string) *StringSliceCmd
+	PubSubShardNumSub(ctx context.Context, channels ...string) *StringIntMapCmd
 
 	ClusterSlots(ctx context.Context) *ClusterSlotsCmd
 	ClusterNodes(ctx context.Context) *StringCmd
@@ -405,6 +430,8 @@ type StatefulCmdable interface {
 	Select(ctx context.Context, index int) *StatusCmd
 	SwapDB(ctx context.Context, index1, index2 int) *StatusCmd
 	ClientSetName(ctx context.Context, name string) *BoolCmd
+	ClientSetInfo(ctx context.Context, attr, value string) *StatusCmd
+	ScriptDebug(ctx context.Context, mode string) *StatusCmd
 }
 
 var (
@@ -461,6 +488,23 @@ func (c statefulCmdable) ClientSetName(ctx context.Context, name string) *BoolCm
 	return cmd
 }
 
+// ClientSetInfo sets an attribute of the connection, i.e. "lib-name" or
+// "lib-ver", that is reported by CLIENT LIST (Redis >= 7.2).
+func (c statefulCmdable) ClientSetInfo(ctx context.Context, attr, value string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "client", "setinfo", attr, value)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// ScriptDebug sets the Lua debugger mode of the connection for the scripts
+// evaluated after it, i.e. ScriptDebugYes, ScriptDebugSync or ScriptDebugNo.
+// See Conn.DebugScript.
+func (c statefulCmdable) ScriptDebug(ctx context.Context, mode string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "script", "debug", mode)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 //------------------------------------------------------------------------------
 
 func (c cmdable) Command(ctx context.Context) *CommandsInfoCmd {
@@ -788,6 +832,20 @@ func (c cmdable) Get(ctx context.Context, key string) *StringCmd {
 	return cmd
 }
 
+// GetBytes is like Get, but passes the value to fn without copying it, e.g.
+//
+//	var buf bytes.Buffer
+//	err := rdb.GetBytes(ctx, "key", func(b []byte) {
+//		buf.Write(b)
+//	}).Err()
+//
+// See BytesCmd for how long the value is valid.
+func (c cmdable) GetBytes(ctx context.Context, key string, fn func(b []byte)) *BytesCmd {
+	cmd := NewBytesCmd(ctx, fn, "get", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) GetRange(ctx context.Context, key string, start, end int64) *StringCmd {
 	cmd := NewStringCmd(ctx, "getrange", key, start, end)
 	_ = c(ctx, cmd)
@@ -856,6 +914,62 @@ func (c cmdable) MGet(ctx context.Context, keys ...string) *SliceCmd {
 	return cmd
 }
 
+// MGetScan gets the values of the fields of the struct pointed to by dst that
+// have the `redis:"field"` tag with a single MGET sent with the client. The
+// key of every field is keyFn(field) or the field name when keyFn is nil, e.g.
+//
+//	var settings struct {
+//		Theme string `redis:"theme"`
+//		Limit int    `redis:"limit"`
+//	}
+//	err := redis.MGetScan(ctx, rdb, &settings, func(field string) string {
+//		return "{settings:" + userID + "}:" + field
+//	})
+//
+// The fields of the keys that do not exist are set to zero values. Like
+// HGetAllScan, it can't be used with pipelines.
+//
+// With ClusterClient all the keys must be in the same hash slot, e.g. by
+// sharing a hash tag like above, or MGET fails with the CROSSSLOT error.
+func MGetScan(ctx context.Context, c Cmdable, dst interface{}, keyFn func(field string) string) error {
+	strct, err := hscan.Struct(dst)
+	if err != nil {
+		return err
+	}
+
+	fields := strct.Keys()
+	if len(fields) == 0 {
+		return fmt.Errorf("redis: MGetScan(%T) has no fields to get", dst)
+	}
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		if keyFn != nil {
+			keys[i] = keyFn(field)
+		} else {
+			keys[i] = field
+		}
+	}
+
+	cmd := c.MGet(ctx, keys...)
+	if err := cmd.Err(); err != nil {
+		return err
+	}
+	for i, val := range cmd.Val() {
+		if i >= len(fields) {
+			break
+		}
+		field, _ := strct.Field(fields[i])
+		if val == nil {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		if err := scanReplyValue(field, val, cmd.enc); err != nil {
+			return fmt.Errorf("redis: can't scan key %q into field %q: %w", keys[i], fields[i], err)
+		}
+	}
+	return nil
+}
+
 // MSet is like Set but accepts multiple values:
 //   - MSet("key1", "value1", "key2", "value2")
 //   - MSet([]string{"key1", "value1", "key2", "value2"})
@@ -1246,12 +1360,29 @@ func (c cmdable) HGet(ctx context.Context, key, field string) *StringCmd {
 	return cmd
 }
 
+// HGetBytes is like HGet, but passes the value to fn without copying it.
+// See BytesCmd for how long the value is valid.
+func (c cmdable) HGetBytes(ctx context.Context, key, field string, fn func(b []byte)) *BytesCmd {
+	cmd := NewBytesCmd(ctx, fn, "hget", key, field)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) HGetAll(ctx context.Context, key string) *StringStringMapCmd {
 	cmd := NewStringStringMapCmd(ctx, "hgetall", key)
 	_ = c(ctx, cmd)
 	return cmd
 }
 
+// HGetAllScan gets all the fields of the hash with the client and scans them
+// into the struct pointed to by dst using the `redis:"field"` tags, including
+// the fields of embedded structs. Fields that are not in the hash are left
+// unchanged. In pipelines the reply is not available until the pipeline is
+// executed, so HGetAll and StringStringMapCmd.Scan are used instead.
+func HGetAllScan(ctx context.Context, c Cmdable, key string, dst interface{}) error {
+	return c.HGetAll(ctx, key).Scan(dst)
+}
+
 func (c cmdable) HIncrBy(ctx context.Context, key, field string, incr int64) *IntCmd {
 	cmd := NewIntCmd(ctx, "hincrby", key, field, incr)
 	_ = c(ctx, cmd)
@@ -1306,6 +1437,31 @@ func (c cmdable) HSet(ctx context.Context, key string, values ...interface{}) *I
 	return cmd
 }
 
+// HSetStruct sets the fields of the hash to the fields of the struct v that
+// have the `redis:"field"` tag, including the fields of embedded structs.
+// Fields with the omitempty option are skipped when they have zero values.
+func (c cmdable) HSetStruct(ctx context.Context, key string, v interface{}) *IntCmd {
+	args := []interface{}{"hset", key}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		cmd := NewIntCmd(ctx, args...)
+		cmd.SetErr(fmt.Errorf("redis: HSetStruct(non-struct %T)", v))
+		return cmd
+	}
+
+	args = hscan.AppendFields(args, rv)
+	cmd := NewIntCmd(ctx, args...)
+	if len(args) == 2 {
+		cmd.SetErr(fmt.Errorf("redis: HSetStruct(%T) has no fields to set", v))
+		return cmd
+	}
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 // HMSet is a deprecated version of HSet left for compatibility with Redis 3.
 func (c cmdable) HMSet(ctx context.Context, key string, values ...interface{}) *BoolCmd {
 	args := make([]interface{}, 2, 2+len(values))
@@ -1490,6 +1646,14 @@ func (c cmdable) LRange(ctx context.Context, key string, start, stop int64) *Str
 	return cmd
 }
 
+// LRangeBytes is like LRange, but passes the values to fn without copying
+// them. See BytesCmd for how long the values are valid.
+func (c cmdable) LRangeBytes(ctx context.Context, key string, start, stop int64, fn func(i int, b []byte)) *BytesSliceCmd {
+	cmd := NewBytesSliceCmd(ctx, fn, "lrange", key, start, stop)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) LRem(ctx context.Context, key string, count int64, value interface{}) *IntCmd {
 	cmd := NewIntCmd(ctx, "lrem", key, count, value)
 	_ = c(ctx, cmd)
@@ -1751,6 +1915,8 @@ type XAddArgs struct {
 	Approx bool
 	Limit  int64
 	ID     string
+	// Values can be a map, a slice of field-value pairs or a struct with
+	// fields that have the `redis:"field"` tag.
 	Values interface{}
 }
 
@@ -1971,22 +2137,37 @@ func (c cmdable) XPending(ctx context.Context, stream, group string) *XPendingCm
 }
 
 type XPendingExtArgs struct {
-	Stream   string
-	Group    string
-	Idle     time.Duration
-	Start    string
-	End      string
-	Count    int64
+	Stream string
+	Group  string
+	// Idle filters out entries that have been idle for less than Idle.
+	// It requires Redis >= 6.2.
+	Idle time.Duration
+	// Start and End limit the range of IDs. Default is "-" and "+".
+	Start string
+	End   string
+	Count int64
+	// Consumer filters entries owned by the consumer.
 	Consumer string
 }
 
+// XPendingExt returns the pending entries of the group. Every entry contains
+// the number of deliveries (RetryCount) and the time elapsed since the last
+// delivery (Idle).
 func (c cmdable) XPendingExt(ctx context.Context, a *XPendingExtArgs) *XPendingExtCmd {
+	start, end := a.Start, a.End
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+
 	args := make([]interface{}, 0, 9)
 	args = append(args, "xpending", a.Stream, a.Group)
 	if a.Idle != 0 {
 		args = append(args, "idle", formatMs(ctx, a.Idle))
 	}
-	args = append(args, a.Start, a.End, a.Count)
+	args = append(args, start, end, a.Count)
 	if a.Consumer != "" {
 		args = append(args, a.Consumer)
 	}
@@ -3124,24 +3305,29 @@ func (c cmdable) MemoryUsage(ctx context.Context, key string, samples ...int) *I
 //------------------------------------------------------------------------------
 
 func (c cmdable) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd {
-	cmdArgs := make([]interface{}, 3+len(keys), 3+len(keys)+len(args))
-	cmdArgs[0] = "eval"
-	cmdArgs[1] = script
-	cmdArgs[2] = len(keys)
-	for i, key := range keys {
-		cmdArgs[3+i] = key
-	}
-	cmdArgs = appendArgs(cmdArgs, args)
-	cmd := NewCmd(ctx, cmdArgs...)
-	cmd.SetFirstKeyPos(3)
-	_ = c(ctx, cmd)
-	return cmd
+	return c.eval(ctx, "eval", script, keys, args...)
 }
 
 func (c cmdable) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd {
+	return c.eval(ctx, "evalsha", sha1, keys, args...)
+}
+
+// EvalRO is a read-only variant of Eval. With ClusterOptions.ReadOnly it can
+// be executed on replicas. It requires Redis >= 7.0.
+func (c cmdable) EvalRO(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd {
+	return c.eval(ctx, "eval_ro", script, keys, args...)
+}
+
+// EvalShaRO is a read-only variant of EvalSha. With ClusterOptions.ReadOnly
+// it can be executed on replicas. It requires Redis >= 7.0.
+func (c cmdable) EvalShaRO(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd {
+	return c.eval(ctx, "evalsha_ro", sha1, keys, args...)
+}
+
+func (c cmdable) eval(ctx context.Context, name, scriptOrHash string, keys []string, args ...interface{}) *Cmd {
 	cmdArgs := make([]interface{}, 3+len(keys), 3+len(keys)+len(args))
-	cmdArgs[0] = "evalsha"
-	cmdArgs[1] = sha1
+	cmdArgs[0] = name
+	cmdArgs[1] = scriptOrHash
 	cmdArgs[2] = len(keys)
 	for i, key := range keys {
 		cmdArgs[3+i] = key
@@ -3185,6 +3371,62 @@ func (c cmdable) ScriptLoad(ctx context.Context, script string) *StringCmd {
 
 //------------------------------------------------------------------------------
 
+// FunctionLoad loads the library of functions. It returns the library name.
+// It requires Redis >= 7.0.
+func (c cmdable) FunctionLoad(ctx context.Context, code string) *StringCmd {
+	cmd := NewStringCmd(ctx, "function", "load", code)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// FunctionLoadReplace loads the library of functions replacing the existing
+// library with the same name.
+func (c cmdable) FunctionLoadReplace(ctx context.Context, code string) *StringCmd {
+	cmd := NewStringCmd(ctx, "function", "load", "replace", code)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) FunctionDelete(ctx context.Context, libName string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "function", "delete", libName)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) FunctionFlush(ctx context.Context) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "function", "flush")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// FCall invokes the function loaded with FunctionLoad.
+func (c cmdable) FCall(ctx context.Context, function string, keys []string, args ...interface{}) *Cmd {
+	return c.fcall(ctx, "fcall", function, keys, args...)
+}
+
+// FCallRO is a read-only variant of FCall for the functions registered with
+// the no-writes flag. With ClusterOptions.ReadOnly it can be executed on
+// replicas.
+func (c cmdable) FCallRO(ctx context.Context, function string, keys []string, args ...interface{}) *Cmd {
+	return c.fcall(ctx, "fcall_ro", function, keys, args...)
+}
+
+func (c cmdable) fcall(ctx context.Context, name, function string, keys []string, args ...interface{}) *Cmd {
+	cmdArgs := make([]interface{}, 3+len(keys), 3+len(keys)+len(args))
+	cmdArgs[0] = name
+	cmdArgs[1] = function
+	cmdArgs[2] = len(keys)
+	for i, key := range keys {
+		cmdArgs[3+i] = key
+	}
+	cmdArgs = appendArgs(cmdArgs, args)
+	cmd := NewCmd(ctx, cmdArgs...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
 // Publish posts the message to the channel.
 func (c cmdable) Publish(ctx context.Context, channel string, message interface{}) *IntCmd {
 	cmd := NewIntCmd(ctx, "publish", channel, message)
@@ -3192,6 +3434,13 @@ func (c cmdable) Publish(ctx context.Context, channel string, message interface{
 	return cmd
 }
 
+// SPublish posts the message to the shard channel.
+func (c cmdable) SPublish(ctx context.Context, channel string, message interface{}) *IntCmd {
+	cmd := NewIntCmd(ctx, "spublish", channel, message)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) PubSubChannels(ctx context.Context, pattern string) *StringSliceCmd {
 	args := []interface{}{"pubsub", "channels"}
 	if pattern != "*" {
@@ -3220,6 +3469,28 @@ func (c cmdable) PubSubNumPat(ctx context.Context) *IntCmd {
 	return cmd
 }
 
+func (c cmdable) PubSubShardChannels(ctx context.Context, pattern string) *StringSliceCmd {
+	args := []interface{}{"pubsub", "shardchannels"}
+	if pattern != "*" {
+		args = append(args, pattern)
+	}
+	cmd := NewStringSliceCmd(ctx, args...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) PubSubShardNumSub(ctx context.Context, channels ...string) *StringIntMapCmd {
+	args := make([]interface{}, 2+len(channels))
+	args[0] = "pubsub"
+	args[1] = "shardnumsub"
+	for i, channel := range channels {
+		args[2+i] = channel
+	}
+	cmd := NewStringIntMapCmd(ctx, args...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 //------------------------------------------------------------------------------
 
 func (c cmdable) ClusterSlots(ctx context.Context) *ClusterSlotsCmd {
@@ -1025,6 +1025,24 @@ var _ = Describe("Commands", func() {
 			Expect(get.Val()).To(Equal("hello"))
 		})
 
+		It("should GetBytes", func() {
+			var val []byte
+			fn := func(b []byte) {
+				val = append(val, b...)
+			}
+
+			err := client.GetBytes(ctx, "_", fn).Err()
+			Expect(err).To(Equal(redis.Nil))
+			Expect(val).To(BeNil())
+
+			err = client.Set(ctx, "key", "hello", 0).Err()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = client.GetBytes(ctx, "key", fn).Err()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(val).To(Equal([]byte("hello")))
+		})
+
 		It("should GetBit", func() {
 			setBit := client.SetBit(ctx, "key", 7, 1)
 			Expect(setBit.Err()).NotTo(HaveOccurred())
@@ -1184,6 +1202,23 @@ var _ = Describe("Commands", func() {
 			Expect(d).To(Equal(data{Key1: "hello1", Key2: 123}))
 		})
 
+		It("should MGetScan", func() {
+			err := client.MSet(ctx, "settings:theme", "dark", "settings:limit", 10).Err()
+			Expect(err).NotTo(HaveOccurred())
+
+			type settings struct {
+				Theme string `redis:"theme"`
+				Limit int    `redis:"limit"`
+				Lang  string `redis:"lang"`
+			}
+			s := settings{Lang: "en"}
+			err = redis.MGetScan(ctx, client, &s, func(field string) string {
+				return "settings:" + field
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s).To(Equal(settings{Theme: "dark", Limit: 10}))
+		})
+
 		It("should MSetNX", func() {
 			mSetNX := client.MSetNX(ctx, "key1", "hello1", "key2", "hello2")
 			Expect(mSetNX.Err()).NotTo(HaveOccurred())
@@ -1825,6 +1860,32 @@ var _ = Describe("Commands", func() {
 			Expect(hGet.Val()).To(Equal("hello"))
 		})
 
+		It("should HSetStruct and HGetAllScan", func() {
+			type Base struct {
+				ID int `redis:"id"`
+			}
+			type user struct {
+				Base
+				Name    string `redis:"name"`
+				Comment string `redis:"comment,omitempty"`
+			}
+
+			n, err := client.HSetStruct(ctx, "hash", &user{Base: Base{ID: 1}, Name: "alice"}).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(int64(2)))
+
+			m, err := client.HGetAll(ctx, "hash").Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m).To(Equal(map[string]string{"id": "1", "name": "alice"}))
+
+			var u user
+			Expect(redis.HGetAllScan(ctx, client, "hash", &u)).NotTo(HaveOccurred())
+			Expect(u).To(Equal(user{Base: Base{ID: 1}, Name: "alice"}))
+
+			err = client.HSetStruct(ctx, "hash", "value").Err()
+			Expect(err).To(MatchError("redis: HSetStruct(non-struct string)"))
+		})
+
 		It("should HSetNX", func() {
 			hSetNX := client.HSetNX(ctx, "hash", "key", "hello")
 			Expect(hSetNX.Err()).NotTo(HaveOccurred())
@@ -2191,6 +2252,18 @@ var _ = Describe("Commands", func() {
 			Expect(lRange.Val()).To(Equal([]string{}))
 		})
 
+		It("should LRangeBytes", func() {
+			err := client.RPush(ctx, "list", "one", "two").Err()
+			Expect(err).NotTo(HaveOccurred())
+
+			var vals []string
+			err = client.LRangeBytes(ctx, "list", 0, -1, func(i int, b []byte) {
+				vals = append(vals, string(b))
+			}).Err()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vals).To(Equal([]string{"one", "two"}))
+		})
+
 		It("should LRange", func() {
 			rPush := client.RPush(ctx, "list", "one")
 			Expect(rPush.Err()).NotTo(HaveOccurred())
@@ -4392,6 +4465,31 @@ var _ = Describe("Commands", func() {
 			}))
 		})
 
+		It("should XAdd struct and scan XMessage", func() {
+			type event struct {
+				Name  string `redis:"name"`
+				Count int    `redis:"count"`
+				Note  string `redis:"note,omitempty"`
+				Skip  string
+			}
+
+			id, err := client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream",
+				Values: &event{Name: "login", Count: 3, Skip: "skip"},
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			vals, err := client.XRange(ctx, "stream", id, id).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vals).To(Equal([]redis.XMessage{
+				{ID: id, Values: map[string]interface{}{"name": "login", "count": "3"}},
+			}))
+
+			var got event
+			Expect(vals[0].Scan(&got)).NotTo(HaveOccurred())
+			Expect(got).To(Equal(event{Name: "login", Count: 3}))
+		})
+
 		// TODO XAdd There is a bug in the limit parameter.
 		// TODO Don't test it for now.
 		// TODO link: https://github.com/redis/redis/issues/9046
@@ -4657,6 +4755,17 @@ var _ = Describe("Commands", func() {
 				infoExt, err = client.XPendingExt(ctx, args).Result()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(infoExt).To(HaveLen(0))
+
+				// Start and End default to the whole range.
+				infoExt, err = client.XPendingExt(ctx, &redis.XPendingExtArgs{
+					Stream: "stream",
+					Group:  "group",
+					Count:  2,
+				}).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(infoExt).To(HaveLen(2))
+				Expect(infoExt[0].ID).To(Equal("1-0"))
+				Expect(infoExt[0].RetryCount).To(Equal(int64(1)))
 			})
 
 			It("should XGroup Create Delete Consumer", func() {
@@ -5475,6 +5584,48 @@ var _ = Describe("Commands", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(vals).To(Equal([]interface{}{int64(12), proto.RedisError("error"), "abc"}))
 		})
+
+		It("runs scripts from ScriptRegistry", func() {
+			registry := redis.NewScriptRegistry(client)
+			echo := registry.Register("echo", "return ARGV[1]")
+			Expect(registry.Get("echo")).To(Equal(echo))
+
+			Expect(client.ScriptFlush(ctx).Err()).NotTo(HaveOccurred())
+			Expect(registry.Load(ctx)).NotTo(HaveOccurred())
+			Expect(echo.Exists(ctx, client).Val()).To(Equal([]bool{true}))
+
+			Expect(registry.Run(ctx, "echo", nil, "hello").Val()).To(Equal("hello"))
+
+			// Falls back to EVAL when the script cache is flushed.
+			Expect(client.ScriptFlush(ctx).Err()).NotTo(HaveOccurred())
+			Expect(registry.Run(ctx, "echo", nil, "hello").Val()).To(Equal("hello"))
+
+			err := registry.Run(ctx, "missing", nil).Err()
+			Expect(err).To(MatchError(`redis: script "missing" is not registered`))
+		})
+
+		It("runs scripts with named parameters", func() {
+			registry := redis.NewScriptRegistry(client)
+			registry.RegisterNamed("limit", `
+				local n = redis.call('INCR', @counter)
+				if n == 1 then
+					redis.call('PEXPIRE', @counter, @window)
+				end
+				return {n, @note}
+			`, []string{"counter"}, []string{"window", "note"})
+
+			vals, err := registry.RunNamed(ctx, "limit", map[string]interface{}{
+				"counter": "requests",
+				"window":  1000,
+				"note":    "user@example.com",
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vals).To(Equal([]interface{}{int64(1), "user@example.com"}))
+			Expect(client.PTTL(ctx, "requests").Val()).To(BeNumerically(">", 0))
+
+			err = registry.RunNamed(ctx, "limit", map[string]interface{}{"counter": "requests"}).Err()
+			Expect(err).To(MatchError(`redis: script arg "window" is missing`))
+		})
 	})
 
 	Describe("SlowLogGet", func() {
@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DNSOptions are used to configure how the default dialer resolves the host
+// name of the address, e.g. to follow DNS based failover or to spread the
+// connections across the replicas of a proxy.
+type DNSOptions struct {
+	// Resolver is used to look up the addresses of the host.
+	// Default is net.DefaultResolver.
+	Resolver *net.Resolver
+	// CacheTTL is how long the addresses are cached. The cached addresses
+	// are also used when the host can't be resolved again.
+	// Default is to resolve the host on every dial.
+	CacheTTL time.Duration
+}
+
+// dnsDialer resolves the host name before every dial and connects to the
+// addresses in turn, so the new connections rotate across the addresses.
+// When an address can't be dialed, the next one is tried.
+type dnsDialer struct {
+	opt DNSOptions
+
+	mu    sync.Mutex
+	hosts map[string]*dnsEntry
+
+	next uint32 // atomic
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSDialer(opt *DNSOptions) *dnsDialer {
+	d := &dnsDialer{
+		opt:   *opt,
+		hosts: make(map[string]*dnsEntry),
+	}
+	if d.opt.Resolver == nil {
+		d.opt.Resolver = net.DefaultResolver
+	}
+	return d
+}
+
+func (d *dnsDialer) dial(
+	ctx context.Context, netDialer *net.Dialer, network, addr string, tlsConfig *tls.Config,
+) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return dialAddr(ctx, netDialer, network, addr, tlsConfig)
+	}
+
+	// The certificate is verified with the host name instead of the address.
+	if tlsConfig != nil && tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	if net.ParseIP(host) != nil {
+		return dialAddr(ctx, netDialer, network, addr, tlsConfig)
+	}
+
+	addrs, err := d.lookup(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(atomic.AddUint32(&d.next, 1) - 1)
+	var firstErr error
+	for i := range addrs {
+		ip := addrs[(start+i)%len(addrs)]
+		conn, err := dialAddr(ctx, netDialer, network, net.JoinHostPort(ip, port), tlsConfig)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func (d *dnsDialer) lookup(ctx context.Context, network, host string) ([]string, error) {
+	d.mu.Lock()
+	entry := d.hosts[host]
+	d.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.resolve(ctx, network, host)
+	if err != nil {
+		if entry != nil {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	if d.opt.CacheTTL > 0 {
+		d.mu.Lock()
+		d.hosts[host] = &dnsEntry{
+			addrs:   addrs,
+			expires: time.Now().Add(d.opt.CacheTTL),
+		}
+		d.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+func (d *dnsDialer) resolve(ctx context.Context, network, host string) ([]string, error) {
+	ips, err := d.opt.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		isIP4 := ip.IP.To4() != nil
+		if (network == "tcp4" && !isIP4) || (network == "tcp6" && isIP4) {
+			continue
+		}
+		addrs = append(addrs, ip.String())
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("redis: no %s addresses found for %q", network, host)
+	}
+	return addrs, nil
+}
+
+// dialAddr dials the addr and performs the TLS handshake, if tlsConfig is
+// set, within the dialer timeout.
+func dialAddr(
+	ctx context.Context, netDialer *net.Dialer, network, addr string, tlsConfig *tls.Config,
+) (net.Conn, error) {
+	if netDialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, netDialer.Timeout)
+		defer cancel()
+	}
+
+	conn, err := netDialer.DialContext(ctx, network, addr)
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
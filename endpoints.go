@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/pool"
+)
+
+// EndpointsOptions are used to configure a client created with
+// NewFailoverEndpointsClient.
+type EndpointsOptions struct {
+	// Options are the options of the connections to the endpoints.
+	// Addr is ignored.
+	Options *Options
+
+	// HealthCheckInterval is how often the endpoints are checked.
+	// Default is 1 second.
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout is the timeout of a health check.
+	// Default is Options.DialTimeout.
+	HealthCheckTimeout time.Duration
+	// HealthCheck checks that the endpoint can serve the commands.
+	// Default is to send PING.
+	HealthCheck func(ctx context.Context, c *Client) error
+
+	// FailbackDelay is how long a preferred endpoint must be healthy before
+	// the client falls back to it. The client fails over to a healthy
+	// endpoint as soon as the current endpoint is unhealthy.
+	// Default is to fall back at the first successful health check.
+	FailbackDelay time.Duration
+}
+
+func (opt *EndpointsOptions) init(clientOpt *Options) {
+	if opt.HealthCheckInterval == 0 {
+		opt.HealthCheckInterval = time.Second
+	}
+	if opt.HealthCheckTimeout == 0 {
+		opt.HealthCheckTimeout = clientOpt.DialTimeout
+	}
+	if opt.HealthCheck == nil {
+		opt.HealthCheck = func(ctx context.Context, c *Client) error {
+			return c.Ping(ctx).Err()
+		}
+	}
+}
+
+// NewFailoverEndpointsClient returns a client that connects to the first
+// healthy addr, for setups where the failover is done with keepalived,
+// virtual IPs or DNS instead of Redis Sentinel. The addrs are ordered by
+// preference: the first one is the primary endpoint and the others are the
+// backups. The endpoints are checked in the background and, when the client
+// switches to another endpoint, the connections to the previous one are
+// closed. opt can be nil.
+func NewFailoverEndpointsClient(opt *EndpointsOptions, addrs ...string) *Client {
+	if len(addrs) == 0 {
+		panic("redis: NewFailoverEndpointsClient requires at least one addr")
+	}
+	if opt == nil {
+		opt = new(EndpointsOptions)
+	}
+
+	var clientOpt *Options
+	if opt.Options != nil {
+		clientOpt = opt.Options.clone()
+	} else {
+		clientOpt = new(Options)
+	}
+	clientOpt.Addr = "FailoverEndpointsClient"
+
+	failover := newEndpointsFailover(opt, clientOpt, addrs)
+
+	dialer := clientOpt.Dialer
+	if dialer == nil {
+		dialer = clientOpt.defaultDialer()
+	}
+	clientOpt.Dialer = failover.dialer(dialer)
+	clientOpt.init()
+	failover.opt.init(clientOpt)
+
+	connHooks := new(connHooks)
+	connPool := newConnPool(clientOpt, connHooks)
+
+	failover.onSwitch = func(addr string) {
+		_ = connPool.Filter(func(cn *pool.Conn) bool {
+			conn, ok := cn.NetConn().(*endpointConn)
+			return !ok || conn.endpoint != addr
+		})
+	}
+
+	c := Client{
+		baseClient: newBaseClient(clientOpt, connPool, connHooks),
+		ctx:        context.Background(),
+	}
+	c.cmdable = c.Process
+	c.onClose = failover.Close
+
+	go failover.run()
+
+	return &c
+}
+
+// endpointsFailover tracks the endpoint used by the client.
+type endpointsFailover struct {
+	opt    EndpointsOptions
+	addrs  []string
+	logger Logger
+
+	// checkers are the clients used to check the endpoints.
+	checkers []*Client
+
+	onSwitch func(addr string)
+
+	mu      sync.RWMutex
+	current int
+
+	// failback is the preferred endpoint that is healthy since
+	// failbackSince or -1.
+	failback      int
+	failbackSince time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newEndpointsFailover(opt *EndpointsOptions, clientOpt *Options, addrs []string) *endpointsFailover {
+	f := &endpointsFailover{
+		opt:      *opt,
+		addrs:    append([]string(nil), addrs...),
+		logger:   clientOpt.Logger,
+		failback: -1,
+		closed:   make(chan struct{}),
+	}
+	for _, addr := range f.addrs {
+		checkOpt := clientOpt.clone()
+		checkOpt.Addr = addr
+		checkOpt.PoolSize = 1
+		checkOpt.MinIdleConns = 0
+		checkOpt.MaxRetries = -1
+		checkOpt.KeyPrefix = ""
+		checkOpt.Limiter = nil
+		f.checkers = append(f.checkers, NewClient(checkOpt))
+	}
+	return f
+}
+
+func (f *endpointsFailover) addr() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.addrs[f.current]
+}
+
+func (f *endpointsFailover) dialer(
+	dialer func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		addr := f.addr()
+		conn, err := dialer(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &endpointConn{Conn: conn, endpoint: addr}, nil
+	}
+}
+
+func (f *endpointsFailover) run() {
+	ticker := time.NewTicker(f.opt.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		f.check(context.Background())
+
+		select {
+		case <-ticker.C:
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// check checks the endpoints and switches to the best healthy endpoint.
+func (f *endpointsFailover) check(ctx context.Context) {
+	healthy := make([]bool, len(f.checkers))
+	best := -1
+	for i, checker := range f.checkers {
+		healthy[i] = f.checkEndpoint(ctx, checker)
+		if healthy[i] && best == -1 {
+			best = i
+		}
+	}
+
+	f.mu.Lock()
+	if best == -1 || best == f.current {
+		// No endpoint is healthy or the current one is the best one.
+		f.failback = -1
+		f.mu.Unlock()
+		return
+	}
+
+	if best < f.current && healthy[f.current] && f.opt.FailbackDelay > 0 {
+		if f.failback != best {
+			f.failback = best
+			f.failbackSince = time.Now()
+		}
+		if time.Since(f.failbackSince) < f.opt.FailbackDelay {
+			f.mu.Unlock()
+			return
+		}
+	}
+
+	prev := f.addrs[f.current]
+	f.current = best
+	f.failback = -1
+	addr := f.addrs[best]
+	f.mu.Unlock()
+
+	internal.Log(ctx, f.logger, internal.LogLevelInfo, "redis: switched endpoint",
+		"from", prev, "addr", addr)
+	f.onSwitch(addr)
+}
+
+func (f *endpointsFailover) checkEndpoint(ctx context.Context, checker *Client) bool {
+	ctx, cancel := context.WithTimeout(ctx, f.opt.HealthCheckTimeout)
+	defer cancel()
+	return f.opt.HealthCheck(ctx, checker) == nil
+}
+
+func (f *endpointsFailover) Close() error {
+	var firstErr error
+	f.closeOnce.Do(func() {
+		close(f.closed)
+		for _, checker := range f.checkers {
+			if err := checker.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
+
+// endpointConn is a connection to the endpoint.
+type endpointConn struct {
+	net.Conn
+	endpoint string
+}
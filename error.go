@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net"
 	"strings"
@@ -25,6 +26,83 @@ type Error interface {
 
 var _ Error = proto.RedisError("")
 
+// IsTimeout reports whether err is a network timeout, a timeout waiting for
+// a free connection in the pool or an expired context deadline.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, pool.ErrPoolTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsLoading reports whether err is a LOADING error, i.e. the server is
+// loading the dataset in memory.
+func IsLoading(err error) bool {
+	return hasRedisErrorPrefix(err, "LOADING ")
+}
+
+// IsReadOnly reports whether err is a READONLY error, i.e. a write command
+// was sent to a replica.
+func IsReadOnly(err error) bool {
+	return hasRedisErrorPrefix(err, "READONLY ")
+}
+
+// IsClusterDown reports whether err is a CLUSTERDOWN error, i.e. the
+// cluster can't serve the hash slot.
+func IsClusterDown(err error) bool {
+	return hasRedisErrorPrefix(err, "CLUSTERDOWN ")
+}
+
+// IsTryAgain reports whether err is a TRYAGAIN error, e.g. the keys of a
+// multi-key command are being migrated.
+func IsTryAgain(err error) bool {
+	return hasRedisErrorPrefix(err, "TRYAGAIN ")
+}
+
+// IsMaxClients reports whether err is returned because the server reached
+// the maxclients limit.
+func IsMaxClients(err error) bool {
+	return hasRedisErrorPrefix(err, "ERR max number of clients reached")
+}
+
+// IsMoved reports whether err is a MOVED redirect and returns the address
+// of the node that serves the hash slot.
+func IsMoved(err error) (addr string, ok bool) {
+	return redirectAddr(err, "MOVED ")
+}
+
+// IsAsk reports whether err is an ASK redirect and returns the address of
+// the node the command must be sent to.
+func IsAsk(err error) (addr string, ok bool) {
+	return redirectAddr(err, "ASK ")
+}
+
+func hasRedisErrorPrefix(err error, prefix string) bool {
+	var redisErr proto.RedisError
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), prefix)
+}
+
+// redirectAddr parses redirects like "MOVED 3999 127.0.0.1:6381".
+func redirectAddr(err error, prefix string) (string, bool) {
+	var redisErr proto.RedisError
+	if !errors.As(err, &redisErr) {
+		return "", false
+	}
+	s := string(redisErr)
+	if !strings.HasPrefix(s, prefix) {
+		return "", false
+	}
+	i := strings.LastIndexByte(s, ' ')
+	if i < len(prefix) {
+		return "", false
+	}
+	return s[i+1:], true
+}
+
 func shouldRetry(err error, retryTimeout bool) bool {
 	switch err {
 	case io.EOF, io.ErrUnexpectedEOF:
@@ -56,6 +134,9 @@ func shouldRetry(err error, retryTimeout bool) bool {
 	if strings.HasPrefix(s, "TRYAGAIN ") {
 		return true
 	}
+	if isAuthError(err) {
+		return true
+	}
 
 	return false
 }
@@ -84,6 +165,10 @@ func isBadConn(err error, allowTimeout bool, addr string) bool {
 			// of the connection. Force a DNS resolution when all connections
 			// of the pool are recycled
 			return true
+		case isAuthError(err):
+			// Close connections that are not authenticated anymore, so the
+			// new connections authenticate with the current credentials.
+			return true
 		default:
 			return false
 		}
@@ -129,6 +214,27 @@ func isReadOnlyError(err error) bool {
 	return strings.HasPrefix(err.Error(), "READONLY ")
 }
 
+// isAuthError reports whether the connection is not authenticated or the
+// credentials are rejected, e.g. after they were rotated.
+func isAuthError(err error) bool {
+	s := err.Error()
+	return strings.HasPrefix(s, "NOAUTH ") || strings.HasPrefix(s, "WRONGPASS ")
+}
+
+// isReplicaRejectedError reports whether a replica could not execute a
+// read-only script or function that the master can, e.g. because the script
+// is not loaded on the replica or the replica runs an older Redis.
+func isReplicaRejectedError(err error) bool {
+	if !isRedisError(err) {
+		return false
+	}
+	s := err.Error()
+	return strings.HasPrefix(s, "NOSCRIPT ") ||
+		strings.HasPrefix(s, "READONLY ") ||
+		strings.HasPrefix(s, "ERR unknown command") ||
+		strings.HasPrefix(s, "ERR Function not found")
+}
+
 func isMovedSameConnAddr(err error, addr string) bool {
 	redisError := err.Error()
 	if !strings.HasPrefix(redisError, "MOVED ") {
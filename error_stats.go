@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/farss/redis/v8/internal/pool"
+)
+
+// ErrorStats contains the number of errors by type. Every attempt is
+// counted, so a command that fails and is retried can be counted several
+// times. Errors that do not belong to any type are not counted.
+type ErrorStats struct {
+	Timeouts     uint64 // network timeouts
+	ConnErrors   uint64 // other network errors, e.g. connection refused or reset
+	PoolTimeouts uint64 // timeouts waiting for a free connection in the pool
+	Moved        uint64 // MOVED redirects
+	Ask          uint64 // ASK redirects
+	Loading      uint64 // LOADING errors, i.e. the server is loading the dataset
+	ReadOnly     uint64 // READONLY errors, i.e. writes sent to a replica
+	OOM          uint64 // OOM errors, i.e. the server reached maxmemory
+}
+
+func (s *ErrorStats) add(other *ErrorStats) {
+	s.Timeouts += other.Timeouts
+	s.ConnErrors += other.ConnErrors
+	s.PoolTimeouts += other.PoolTimeouts
+	s.Moved += other.Moved
+	s.Ask += other.Ask
+	s.Loading += other.Loading
+	s.ReadOnly += other.ReadOnly
+	s.OOM += other.OOM
+}
+
+type errorStats struct {
+	timeouts     uint64 // atomic
+	connErrors   uint64 // atomic
+	poolTimeouts uint64 // atomic
+	moved        uint64 // atomic
+	ask          uint64 // atomic
+	loading      uint64 // atomic
+	readOnly     uint64 // atomic
+	oom          uint64 // atomic
+}
+
+func (s *errorStats) record(err error) {
+	if s == nil || err == nil || err == Nil {
+		return
+	}
+	if counter := s.counter(err); counter != nil {
+		atomic.AddUint64(counter, 1)
+	}
+}
+
+func (s *errorStats) counter(err error) *uint64 {
+	if isRedisError(err) {
+		msg := err.Error()
+		switch {
+		case strings.HasPrefix(msg, "MOVED "):
+			return &s.moved
+		case strings.HasPrefix(msg, "ASK "):
+			return &s.ask
+		case strings.HasPrefix(msg, "LOADING "):
+			return &s.loading
+		case strings.HasPrefix(msg, "READONLY "):
+			return &s.readOnly
+		case strings.HasPrefix(msg, "OOM "):
+			return &s.oom
+		}
+		return nil
+	}
+
+	switch err {
+	case pool.ErrPoolTimeout:
+		return &s.poolTimeouts
+	case context.Canceled, context.DeadlineExceeded:
+		return nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return &s.connErrors
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return &s.timeouts
+		}
+		return &s.connErrors
+	}
+	return nil
+}
+
+// recordCmds records the Redis errors of the commands. Network errors are
+// recorded once per pipeline by the caller.
+func (s *errorStats) recordCmds(cmds []Cmder) {
+	if s == nil {
+		return
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); isRedisError(err) {
+			s.record(err)
+		}
+	}
+}
+
+func (s *errorStats) stats() *ErrorStats {
+	return &ErrorStats{
+		Timeouts:     atomic.LoadUint64(&s.timeouts),
+		ConnErrors:   atomic.LoadUint64(&s.connErrors),
+		PoolTimeouts: atomic.LoadUint64(&s.poolTimeouts),
+		Moved:        atomic.LoadUint64(&s.moved),
+		Ask:          atomic.LoadUint64(&s.ask),
+		Loading:      atomic.LoadUint64(&s.loading),
+		ReadOnly:     atomic.LoadUint64(&s.readOnly),
+		OOM:          atomic.LoadUint64(&s.oom),
+	}
+}
@@ -29,6 +29,21 @@ func (redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) e
 	return nil
 }
 
+type redisCmdHook struct {
+	redisHook
+}
+
+var _ redis.PipelineCmdHook = redisCmdHook{}
+
+func (redisCmdHook) BeforeProcessPipelineCmd(ctx context.Context, cmd redis.Cmder) context.Context {
+	fmt.Printf("pipeline command starting processing: <%s>\n", cmd)
+	return ctx
+}
+
+func (redisCmdHook) AfterProcessPipelineCmd(ctx context.Context, cmd redis.Cmder) {
+	fmt.Printf("pipeline command finished processing: <%s>\n", cmd)
+}
+
 func Example_instrumentation() {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: ":6379",
@@ -55,6 +70,25 @@ func ExamplePipeline_instrumentation() {
 	// pipeline finished processing: [ping: PONG ping: PONG]
 }
 
+func ExamplePipelineCmdHook() {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: ":6379",
+	})
+	rdb.AddHook(redisCmdHook{})
+
+	rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Ping(ctx)
+		pipe.Ping(ctx)
+		return nil
+	})
+	// Output: pipeline starting processing: [ping:  ping: ]
+	// pipeline command starting processing: <ping: >
+	// pipeline command starting processing: <ping: >
+	// pipeline command finished processing: <ping: PONG>
+	// pipeline command finished processing: <ping: PONG>
+	// pipeline finished processing: [ping: PONG ping: PONG]
+}
+
 func ExampleClient_Watch_instrumentation() {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: ":6379",
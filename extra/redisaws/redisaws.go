@@ -0,0 +1,273 @@
+// Package redisaws provides IAM authentication for Amazon ElastiCache and
+// Amazon MemoryDB, e.g.
+//
+//	tokens := redisaws.NewTokenProvider(&redisaws.Options{
+//		UserID:      "app-user",
+//		ClusterName: "my-cluster",
+//		Region:      "us-east-1",
+//	})
+//	rdb := redis.NewClusterClient(&redis.ClusterOptions{
+//		Addrs:               []string{"clustercfg.my-cluster.xxxxxx.use1.cache.amazonaws.com:6379"},
+//		TLSConfig:           &tls.Config{},
+//		CredentialsProvider: tokens.Credentials,
+//	})
+//
+// The tokens are presigned with AWS Signature Version 4 and are reused
+// until they are close to their expiry.
+package redisaws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenExpiry is how long the tokens are valid.
+	tokenExpiry = 15 * time.Minute
+
+	// emptyPayloadHash is the SHA-256 hash of the empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Credentials are the AWS credentials used to sign the tokens.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for the temporary credentials, e.g. of an IAM
+	// role.
+	SessionToken string
+}
+
+// EnvCredentials returns the credentials set with the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvCredentials(ctx context.Context) (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, errors.New("redisaws: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return creds, nil
+}
+
+// Options are used to configure a TokenProvider.
+type Options struct {
+	// UserID is the ID of the IAM-enabled user.
+	UserID string
+	// ClusterName is the name of the replication group or serverless cache
+	// of ElastiCache, or of the MemoryDB cluster.
+	ClusterName string
+	// Region is the AWS region of the cluster, e.g. "us-east-1".
+	Region string
+	// Service is "elasticache" or "memorydb".
+	// Default is "elasticache".
+	Service string
+	// Serverless is set for ElastiCache Serverless caches.
+	Serverless bool
+
+	// Credentials returns the credentials used to sign the tokens, e.g.
+	// retrieved with an aws.CredentialsProvider of the AWS SDK.
+	// Default is EnvCredentials.
+	Credentials func(ctx context.Context) (Credentials, error)
+	// TokenTTL is how long a token is reused before a new one is generated.
+	// It must be less than 15 minutes, when the tokens expire.
+	// Default is 10 minutes.
+	TokenTTL time.Duration
+}
+
+func (opt *Options) init() {
+	if opt.Service == "" {
+		opt.Service = "elasticache"
+	}
+	if opt.Credentials == nil {
+		opt.Credentials = EnvCredentials
+	}
+	if opt.TokenTTL == 0 {
+		opt.TokenTTL = 10 * time.Minute
+	}
+}
+
+// TokenProvider generates the IAM authentication tokens.
+// It's safe for concurrent use by multiple goroutines.
+type TokenProvider struct {
+	opt Options
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewTokenProvider returns a new TokenProvider.
+func NewTokenProvider(opt *Options) *TokenProvider {
+	p := &TokenProvider{opt: *opt}
+	p.opt.init()
+	return p
+}
+
+// Credentials returns the user ID and a token. It is meant to be used as
+// redis.Options.CredentialsProvider.
+func (p *TokenProvider) Credentials(ctx context.Context) (username, password string, err error) {
+	token, err := p.Token(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return p.opt.UserID, token, nil
+}
+
+// Token returns the cached token or generates a new one.
+func (p *TokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.token != "" && now.Before(p.expires) {
+		return p.token, nil
+	}
+
+	creds, err := p.opt.Credentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("redisaws: can't get the credentials: %w", err)
+	}
+
+	p.token = p.generate(creds, now)
+	p.expires = now.Add(p.opt.TokenTTL)
+	return p.token, nil
+}
+
+func (p *TokenProvider) generate(creds Credentials, now time.Time) string {
+	query := map[string]string{
+		"Action": "connect",
+		"User":   p.opt.UserID,
+	}
+	if p.opt.Serverless {
+		query["ResourceType"] = "ServerlessCache"
+	}
+	return presign(&presignRequest{
+		host:        strings.ToLower(p.opt.ClusterName),
+		path:        "/",
+		query:       query,
+		region:      p.opt.Region,
+		service:     p.opt.Service,
+		payloadHash: emptyPayloadHash,
+		expires:     tokenExpiry,
+	}, creds, now)
+}
+
+//------------------------------------------------------------------------------
+
+type presignRequest struct {
+	host        string
+	path        string
+	query       map[string]string
+	region      string
+	service     string
+	payloadHash string
+	expires     time.Duration
+}
+
+// presign returns the GET request URL without the scheme presigned with
+// AWS Signature Version 4.
+func presign(req *presignRequest, creds Credentials, now time.Time) string {
+	now = now.UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + req.region + "/" + req.service + "/aws4_request"
+
+	query := make(map[string]string, len(req.query)+6)
+	for k, v := range req.query {
+		query[k] = v
+	}
+	query["X-Amz-Algorithm"] = "AWS4-HMAC-SHA256"
+	query["X-Amz-Credential"] = creds.AccessKeyID + "/" + scope
+	query["X-Amz-Date"] = now.Format("20060102T150405Z")
+	query["X-Amz-Expires"] = fmt.Sprint(int(req.expires / time.Second))
+	query["X-Amz-SignedHeaders"] = "host"
+	if creds.SessionToken != "" {
+		query["X-Amz-Security-Token"] = creds.SessionToken
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		req.path,
+		canonicalQuery,
+		"host:" + req.host + "\n",
+		"host",
+		req.payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		query["X-Amz-Date"],
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, req.region)
+	key = hmacSHA256(key, req.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return req.host + req.path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func canonicalQueryString(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(uriEncode(k))
+		b.WriteByte('=')
+		b.WriteString(uriEncode(query[k]))
+	}
+	return b.String()
+}
+
+// uriEncode encodes all the bytes except the unreserved characters as
+// required by Signature Version 4.
+func uriEncode(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package rediscache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LocalCache is the in-process tier of a Cache. It must be safe for
+// concurrent use by multiple goroutines. Other caches, e.g. ristretto, can be
+// used with a small adapter.
+type LocalCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+	Del(key string)
+	// Clear removes all the entries.
+	Clear()
+}
+
+// LRU is a LocalCache that evicts the least recently used entries.
+type LRU struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+var _ LocalCache = (*LRU)(nil)
+
+type lruEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// NewLRU returns an LRU that keeps at most size entries for at most ttl.
+// The entries don't expire if ttl is 0.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	if size <= 0 {
+		panic("rediscache: size must be positive")
+	}
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.data, true
+}
+
+func (c *LRU) Set(key string, data []byte) {
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.data = data
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, data: data, expires: expires})
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *LRU) Del(key string) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.mu.Unlock()
+}
+
+func (c *LRU) Clear() {
+	c.mu.Lock()
+	c.ll.Init()
+	c.entries = make(map[string]*list.Element)
+	c.mu.Unlock()
+}
+
+// Len returns the number of entries, including the expired ones that are
+// not removed yet.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,477 @@
+// Package rediscache implements a two-tier cache: an in-process LocalCache in
+// front of Redis. Concurrent misses of the same key are collapsed into a
+// single load, and the local caches of the other instances are invalidated
+// when a key changes, e.g.
+//
+//	cache := rediscache.New(&rediscache.Options{
+//		Redis:        rdb,
+//		LocalCache:   rediscache.NewLRU(10000, time.Minute),
+//		Invalidation: rediscache.PubSubInvalidation,
+//	})
+//	defer cache.Close()
+//
+//	var user User
+//	err := cache.Once(ctx, &rediscache.Item{
+//		Key:   "user:" + id,
+//		Value: &user,
+//		TTL:   time.Hour,
+//		Do: func(ctx context.Context) (interface{}, error) {
+//			return db.GetUser(ctx, id)
+//		},
+//	})
+package rediscache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// ErrCacheMiss is returned by Get when the key is not cached.
+var ErrCacheMiss = errors.New("rediscache: cache miss")
+
+// trackingChannel is the channel of the invalidation messages of client
+// tracking.
+const trackingChannel = "__redis__:invalidate"
+
+// Invalidation is how the local caches of the other instances are
+// invalidated when a key changes.
+type Invalidation int
+
+const (
+	// NoInvalidation doesn't invalidate the other local caches, so they
+	// return stale values until the entries expire.
+	NoInvalidation Invalidation = iota
+	// PubSubInvalidation publishes the keys changed by Set and Delete to
+	// Options.Channel. The keys changed without the Cache are not
+	// invalidated.
+	PubSubInvalidation
+	// TrackingInvalidation uses client tracking in broadcasting mode, so
+	// Redis sends the invalidations of all the keys with the
+	// Options.TrackingPrefixes, including the keys changed without the
+	// Cache. It requires Redis 6 and Options.Redis must be a *redis.Client.
+	TrackingInvalidation
+)
+
+// Options are used to configure a Cache.
+type Options struct {
+	// Redis is the shared tier.
+	Redis redis.UniversalClient
+	// LocalCache is the in-process tier.
+	// Default is to only use Redis.
+	LocalCache LocalCache
+
+	// Codec marshals the values.
+	// Default is redis.JSONCodec.
+	Codec redis.Codec
+	// DefaultTTL is the TTL of the items without Item.TTL.
+	// Default is 1 hour.
+	DefaultTTL time.Duration
+
+	// Invalidation is how the local caches are kept in sync.
+	// Default is NoInvalidation.
+	Invalidation Invalidation
+	// Channel is the channel of PubSubInvalidation.
+	// Default is "rediscache:invalidate".
+	Channel string
+	// TrackingPrefixes are the prefixes of the keys tracked by
+	// TrackingInvalidation.
+	// Default is all the keys.
+	TrackingPrefixes []string
+
+	// Logger logs the loaded values that Once could not cache.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *Options) init() {
+	if opt.Redis == nil {
+		panic("rediscache: Redis is required")
+	}
+	if opt.Codec == nil {
+		opt.Codec = redis.JSONCodec
+	}
+	if opt.DefaultTTL == 0 {
+		opt.DefaultTTL = time.Hour
+	}
+	if opt.Channel == "" {
+		opt.Channel = "rediscache:invalidate"
+	}
+}
+
+// Item is a cached value.
+type Item struct {
+	Key string
+	// Value is the value for Set or a pointer to the value for Once.
+	Value interface{}
+	// TTL is the TTL of the key in Redis.
+	// Default is Options.DefaultTTL.
+	TTL time.Duration
+	// Do loads the value on a cache miss in Once.
+	Do func(ctx context.Context) (interface{}, error)
+	// SkipLocalCache only uses Redis.
+	SkipLocalCache bool
+}
+
+// Stats are the hits and misses of a Cache.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	LocalHits   uint64
+	LocalMisses uint64
+}
+
+// Cache is a two-tier cache. It's safe for concurrent use by multiple
+// goroutines.
+type Cache struct {
+	opt Options
+	id  string
+
+	group group
+	stats Stats
+	// gen is incremented by every invalidation, so the values that were
+	// read from Redis while they were invalidated are not cached locally.
+	gen uint64
+
+	pubsub  *redis.PubSub
+	tracker *redis.Client
+}
+
+// New returns a new Cache.
+func New(opt *Options) *Cache {
+	c := &Cache{
+		opt: *opt,
+		id:  randomID(),
+	}
+	c.opt.init()
+
+	if c.opt.LocalCache == nil {
+		return c
+	}
+	switch c.opt.Invalidation {
+	case PubSubInvalidation:
+		c.pubsub = c.opt.Redis.Subscribe(context.Background(), c.opt.Channel)
+	case TrackingInvalidation:
+		rdb, ok := c.opt.Redis.(*redis.Client)
+		if !ok {
+			panic("rediscache: TrackingInvalidation requires a *redis.Client")
+		}
+		c.tracker = c.newTracker(rdb)
+		c.pubsub = c.tracker.Subscribe(context.Background(), trackingChannel)
+	}
+	if c.pubsub != nil {
+		go c.listen(c.pubsub.ChannelWithSubscriptions(context.Background(), 100))
+	}
+	return c
+}
+
+// newTracker returns a client whose connection enables client tracking with
+// the invalidations redirected to itself before it subscribes to them.
+func (c *Cache) newTracker(rdb *redis.Client) *redis.Client {
+	opt := *rdb.Options()
+	opt.PoolSize = 1
+	opt.MinIdleConns = 0
+
+	onConnect := opt.OnConnect
+	opt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		args := []interface{}{"client", "tracking", "on", "redirect", id, "bcast"}
+		for _, prefix := range c.opt.TrackingPrefixes {
+			args = append(args, "prefix", prefix)
+		}
+		return cn.Process(ctx, redis.NewCmd(ctx, args...))
+	}
+	return redis.NewClient(&opt)
+}
+
+// Close stops the invalidation of the local cache.
+func (c *Cache) Close() error {
+	var firstErr error
+	if c.pubsub != nil {
+		firstErr = c.pubsub.Close()
+	}
+	if c.tracker != nil {
+		if err := c.tracker.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats returns the hits and misses.
+func (c *Cache) Stats() *Stats {
+	return &Stats{
+		Hits:        atomic.LoadUint64(&c.stats.Hits),
+		Misses:      atomic.LoadUint64(&c.stats.Misses),
+		LocalHits:   atomic.LoadUint64(&c.stats.LocalHits),
+		LocalMisses: atomic.LoadUint64(&c.stats.LocalMisses),
+	}
+}
+
+// Set caches the value of the item.
+func (c *Cache) Set(ctx context.Context, item *Item) error {
+	b, err := c.opt.Codec.Marshal(item.Value)
+	if err != nil {
+		return err
+	}
+	return c.set(ctx, item, b)
+}
+
+func (c *Cache) set(ctx context.Context, item *Item, b []byte) error {
+	ttl := item.TTL
+	if ttl == 0 {
+		ttl = c.opt.DefaultTTL
+	}
+	if err := c.opt.Redis.Set(ctx, item.Key, b, ttl).Err(); err != nil {
+		return err
+	}
+	if c.opt.LocalCache != nil && !item.SkipLocalCache {
+		c.opt.LocalCache.Set(item.Key, b)
+	}
+	return c.publish(ctx, item.Key)
+}
+
+// Get unmarshals the cached value of the key into value. It returns
+// ErrCacheMiss if the key is not cached.
+func (c *Cache) Get(ctx context.Context, key string, value interface{}) error {
+	b, err := c.get(ctx, key, false)
+	if err != nil {
+		return err
+	}
+	return c.opt.Codec.Unmarshal(b, value)
+}
+
+// Exists reports whether the key is cached.
+func (c *Cache) Exists(ctx context.Context, key string) bool {
+	_, err := c.get(ctx, key, false)
+	return err == nil
+}
+
+func (c *Cache) get(ctx context.Context, key string, skipLocalCache bool) ([]byte, error) {
+	local := c.opt.LocalCache
+	if skipLocalCache {
+		local = nil
+	}
+	if local != nil {
+		if b, ok := local.Get(key); ok {
+			atomic.AddUint64(&c.stats.LocalHits, 1)
+			return b, nil
+		}
+		atomic.AddUint64(&c.stats.LocalMisses, 1)
+	}
+
+	gen := atomic.LoadUint64(&c.gen)
+	b, err := c.opt.Redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			atomic.AddUint64(&c.stats.Misses, 1)
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+	atomic.AddUint64(&c.stats.Hits, 1)
+
+	if local != nil && atomic.LoadUint64(&c.gen) == gen {
+		local.Set(key, b)
+	}
+	return b, nil
+}
+
+// Once unmarshals the cached value of the key into item.Value or, on a
+// cache miss, loads the value with item.Do and caches it. The concurrent
+// misses of the same key wait for the load started by the first one
+// until ctx is done.
+// The value is loaded and returned if Redis is unavailable.
+func (c *Cache) Once(ctx context.Context, item *Item) error {
+	b, err := c.get(ctx, item.Key, item.SkipLocalCache)
+	if err == nil {
+		if item.Value == nil {
+			return nil
+		}
+		if err := c.opt.Codec.Unmarshal(b, item.Value); err == nil {
+			return nil
+		}
+		// The cached value is stale, e.g. the type of the value changed,
+		// so it is loaded again.
+	}
+
+	b, err = c.group.do(ctx, item.Key, func() ([]byte, error) {
+		return c.load(ctx, item)
+	})
+	if err != nil {
+		return err
+	}
+	if item.Value == nil {
+		return nil
+	}
+	return c.opt.Codec.Unmarshal(b, item.Value)
+}
+
+func (c *Cache) load(ctx context.Context, item *Item) ([]byte, error) {
+	if item.Do == nil {
+		return nil, ErrCacheMiss
+	}
+	v, err := item.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.opt.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.set(ctx, item, b); err != nil {
+		c.log(ctx, "rediscache: set failed", item.Key, err)
+	}
+	return b, nil
+}
+
+// Delete deletes the key from Redis and the local caches.
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	if err := c.opt.Redis.Del(ctx, key).Err(); err != nil {
+		return err
+	}
+	c.DeleteFromLocalCache(key)
+	return c.publish(ctx, key)
+}
+
+// DeleteFromLocalCache deletes the key from the local cache of this
+// instance.
+func (c *Cache) DeleteFromLocalCache(key string) {
+	if c.opt.LocalCache != nil {
+		atomic.AddUint64(&c.gen, 1)
+		c.opt.LocalCache.Del(key)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// publish sends the invalidation of the key to the other instances. The
+// payload is prefixed with the ID of the Cache, so it ignores its own
+// invalidations.
+func (c *Cache) publish(ctx context.Context, key string) error {
+	if c.opt.LocalCache == nil || c.opt.Invalidation != PubSubInvalidation {
+		return nil
+	}
+	return c.opt.Redis.Publish(ctx, c.opt.Channel, c.id+":"+key).Err()
+}
+
+func (c *Cache) listen(ch <-chan interface{}) {
+	var subscribed bool
+	for msg := range ch {
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind != "subscribe" {
+				continue
+			}
+			// The invalidations are lost while the connection is down.
+			if subscribed {
+				atomic.AddUint64(&c.gen, 1)
+				c.opt.LocalCache.Clear()
+			}
+			subscribed = true
+		case *redis.Message:
+			c.invalidate(msg)
+		}
+	}
+}
+
+func (c *Cache) invalidate(msg *redis.Message) {
+	if msg.Channel == trackingChannel {
+		switch {
+		case len(msg.PayloadSlice) > 0:
+			for _, key := range msg.PayloadSlice {
+				c.DeleteFromLocalCache(key)
+			}
+		case msg.Payload != "":
+			c.DeleteFromLocalCache(msg.Payload)
+		default:
+			// All the keys are invalidated, e.g. after FLUSHALL.
+			atomic.AddUint64(&c.gen, 1)
+			c.opt.LocalCache.Clear()
+		}
+		return
+	}
+
+	i := strings.IndexByte(msg.Payload, ':')
+	if i < 0 || msg.Payload[:i] == c.id {
+		return
+	}
+	c.DeleteFromLocalCache(msg.Payload[i+1:])
+}
+
+func (c *Cache) log(ctx context.Context, msg, key string, err error) {
+	if c.opt.Logger != nil {
+		c.opt.Logger.Log(ctx, redis.LogLevelWarn, msg, "key", key, "error", err)
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//------------------------------------------------------------------------------
+
+// group collapses the concurrent loads of the same key.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+// errLoadPanicked is returned to the callers waiting for a load that
+// panicked. The panic itself is propagated to the caller that started it.
+var errLoadPanicked = errors.New("rediscache: load panicked")
+
+func (g *group) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &call{
+		done: make(chan struct{}),
+		err:  errLoadPanicked,
+	}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err
+}
@@ -0,0 +1,319 @@
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+type user struct {
+	Name string
+}
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func newTestCache(t *testing.T, rdb *redis.Client, inv Invalidation) *Cache {
+	c := New(&Options{
+		Redis:        rdb,
+		LocalCache:   NewLRU(100, time.Minute),
+		Invalidation: inv,
+	})
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestSetGet(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	c := newTestCache(t, rdb, NoInvalidation)
+	ctx := context.Background()
+
+	var u user
+	if err := c.Get(ctx, "user", &u); err != ErrCacheMiss {
+		t.Fatalf("got %v, want ErrCacheMiss", err)
+	}
+
+	if err := c.Set(ctx, &Item{Key: "user", Value: user{Name: "alice"}, TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.Get("user"); got != `{"Name":"alice"}` {
+		t.Fatalf("got %q in Redis", got)
+	}
+	if ttl := mr.TTL("user"); ttl != time.Minute {
+		t.Fatalf("got TTL %s, want 1m", ttl)
+	}
+
+	// The value is read from the local cache.
+	mr.Del("user")
+	if err := c.Get(ctx, "user", &u); err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+
+	if err := c.Delete(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Exists(ctx, "user") {
+		t.Fatal("the deleted key exists")
+	}
+
+	// The value read from Redis is cached locally.
+	mr.Set("user", `{"Name":"bob"}`)
+	if err := c.Get(ctx, "user", &u); err != nil || u.Name != "bob" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+	mr.Del("user")
+	if err := c.Get(ctx, "user", &u); err != nil || u.Name != "bob" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+
+	want := Stats{Hits: 1, Misses: 2, LocalHits: 2, LocalMisses: 3}
+	if got := c.Stats(); *got != want {
+		t.Fatalf("got %+v, want %+v", *got, want)
+	}
+}
+
+func TestOnce(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	c := newTestCache(t, rdb, NoInvalidation)
+	ctx := context.Background()
+
+	var loads int32
+	release := make(chan struct{})
+	item := func(u *user) *Item {
+		return &Item{
+			Key:   "user",
+			Value: u,
+			Do: func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&loads, 1)
+				<-release
+				return user{Name: "alice"}, nil
+			},
+		}
+	}
+
+	// The concurrent misses are collapsed into a single load.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u user
+			if err := c.Once(ctx, item(&u)); err != nil || u.Name != "alice" {
+				t.Errorf("got %+v, %v", u, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("got %d loads, want 1", n)
+	}
+	if !mr.Exists("user") {
+		t.Fatal("the loaded value is not cached")
+	}
+
+	var u user
+	if err := c.Once(ctx, item(&u)); err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("got %d loads, want 1", n)
+	}
+}
+
+func TestOnceError(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	c := newTestCache(t, rdb, NoInvalidation)
+	ctx := context.Background()
+
+	errLoad := errors.New("load failed")
+	err := c.Once(ctx, &Item{
+		Key:   "user",
+		Value: new(user),
+		Do: func(ctx context.Context) (interface{}, error) {
+			return nil, errLoad
+		},
+	})
+	if err != errLoad {
+		t.Fatalf("got %v, want %v", err, errLoad)
+	}
+	if mr.Exists("user") {
+		t.Fatal("the failed load is cached")
+	}
+
+	// The value is loaded when Redis is unavailable.
+	mr.Close()
+	var u user
+	err = c.Once(ctx, &Item{
+		Key:   "user",
+		Value: &u,
+		Do: func(ctx context.Context) (interface{}, error) {
+			return user{Name: "alice"}, nil
+		},
+	})
+	if err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+}
+
+func TestOncePanic(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	c := newTestCache(t, rdb, NoInvalidation)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		defer func() { _ = recover() }()
+		_ = c.Once(ctx, &Item{
+			Key: "user",
+			Do: func(ctx context.Context) (interface{}, error) {
+				close(started)
+				<-release
+				panic("load")
+			},
+		})
+	}()
+	<-started
+
+	// A waiter gives up when its ctx is done.
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := c.Once(waitCtx, &Item{Key: "user"}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Once(ctx, &Item{Key: "user"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-errCh:
+		if err != errLoadPanicked {
+			t.Fatalf("got %v, want %v", err, errLoadPanicked)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiter is blocked after the panic")
+	}
+
+	// The key can be loaded again.
+	var u user
+	err := c.Once(ctx, &Item{
+		Key:   "user",
+		Value: &u,
+		Do: func(ctx context.Context) (interface{}, error) {
+			return user{Name: "alice"}, nil
+		},
+	})
+	if err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+}
+
+func TestPubSubInvalidation(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	c1 := newTestCache(t, rdb, PubSubInvalidation)
+	c2 := newTestCache(t, rdb, PubSubInvalidation)
+	ctx := context.Background()
+
+	// Wait for the subscriptions.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := c1.Set(ctx, &Item{Key: "user", Value: user{Name: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err := c2.Get(ctx, "user", &u); err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+
+	if err := c1.Set(ctx, &Item{Key: "user", Value: user{Name: "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := c2.opt.LocalCache.Get("user"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the local cache is not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := c2.Get(ctx, "user", &u); err != nil || u.Name != "bob" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+
+	// A cache ignores its own invalidations.
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := c1.opt.LocalCache.Get("user"); !ok {
+		t.Fatal("the local cache of the writer is invalidated")
+	}
+}
+
+func TestTrackingInvalidation(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	c := New(&Options{Redis: rdb, LocalCache: NewLRU(100, 0)})
+	local := c.opt.LocalCache
+
+	local.Set("k1", nil)
+	local.Set("k2", nil)
+	local.Set("k3", nil)
+
+	c.invalidate(&redis.Message{Channel: trackingChannel, PayloadSlice: []string{"k1", "k2"}})
+	if _, ok := local.Get("k1"); ok {
+		t.Fatal("k1 is not invalidated")
+	}
+	if _, ok := local.Get("k3"); !ok {
+		t.Fatal("k3 is invalidated")
+	}
+
+	c.invalidate(&redis.Message{Channel: trackingChannel})
+	if _, ok := local.Get("k3"); ok {
+		t.Fatal("the local cache is not cleared")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2, time.Hour)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Get("a")
+	c.Set("c", []byte("3"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("the least recently used entry is not evicted")
+	}
+	if b, ok := c.Get("a"); !ok || string(b) != "1" {
+		t.Fatalf("got %q, %v", b, ok)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("got %d entries, want 2", c.Len())
+	}
+
+	c.entries["a"].Value.(*lruEntry).expires = time.Now().Add(-time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("the expired entry is returned")
+	}
+
+	c.Clear()
+	if c.Len() != 0 {
+		t.Fatalf("got %d entries, want 0", c.Len())
+	}
+}
@@ -51,7 +51,7 @@ func CmdsString(cmds []redis.Cmder) (string, string) {
 func AppendCmd(b []byte, cmd redis.Cmder) []byte {
 	const numArgLimit = 32
 
-	for i, arg := range cmd.Args() {
+	for i, arg := range redis.RedactedArgs(cmd) {
 		if i > numArgLimit {
 			break
 		}
@@ -61,9 +61,9 @@ func AppendCmd(b []byte, cmd redis.Cmder) []byte {
 		b = appendArg(b, arg)
 	}
 
-	if err := cmd.Err(); err != nil {
+	if cmd.Err() != nil {
 		b = append(b, ": "...)
-		b = append(b, err.Error()...)
+		b = append(b, redis.RedactedErr(cmd)...)
 	}
 
 	return b
@@ -0,0 +1,185 @@
+package rediscompress
+
+import (
+	"context"
+
+	"github.com/farss/redis/v8"
+)
+
+// Hook compresses the string and []byte values of the commands that set
+// strings and hashes, which are written as is and not with the codec, and
+// decompresses the replies of the commands that get them. The values of the
+// other types are left to the codec of the client.
+//
+// The values are compressed in the following commands: SET, SETNX, SETEX,
+// PSETEX, GETSET, MSET, MSETNX, HSET, HSETNX and HMSET. The replies are
+// decompressed in GET, GETSET, GETDEL, GETEX, MGET, HGET, HMGET, HGETALL
+// and HVALS. Other commands, e.g. APPEND or GETRANGE, see the compressed
+// values.
+type Hook struct {
+	codec *Codec
+}
+
+var _ redis.Hook = (*Hook)(nil)
+
+// NewHook returns a hook that compresses the values with the codec.
+func NewHook(codec *Codec) *Hook {
+	return &Hook{codec: codec}
+}
+
+func (h *Hook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.compressArgs(cmd)
+}
+
+func (h *Hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.decompressReply(cmd)
+	return nil
+}
+
+func (h *Hook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		if err := h.compressArgs(cmd); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func (h *Hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.decompressReply(cmd)
+	}
+	return nil
+}
+
+// valuePos returns the position of the first value in the args of the
+// command and the distance between the values, or 0 if there is one value.
+func valuePos(name string) (pos, step int) {
+	switch name {
+	case "set", "setnx", "getset":
+		return 2, 0
+	case "setex", "psetex":
+		return 3, 0
+	case "mset", "msetnx":
+		return 2, 2
+	case "hset", "hmset":
+		return 3, 2
+	case "hsetnx":
+		return 3, 0
+	default:
+		return 0, 0
+	}
+}
+
+func (h *Hook) compressArgs(cmd redis.Cmder) error {
+	pos, step := valuePos(cmd.Name())
+	if pos == 0 {
+		return nil
+	}
+
+	args := cmd.Args()
+	end := len(args)
+	if step == 0 {
+		step, end = 1, pos+1
+		if end > len(args) {
+			return nil
+		}
+	}
+
+	var compressed []interface{}
+	for i := pos; i < end; i += step {
+		var b []byte
+		switch v := args[i].(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			continue
+		}
+
+		c, err := h.codec.compressRaw(b)
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		if len(c) == 0 || c[0] != magic {
+			continue
+		}
+		if compressed == nil {
+			// The args are copied, so the values of the caller are kept.
+			compressed = make([]interface{}, len(args))
+			copy(compressed, args)
+		}
+		compressed[i] = c
+	}
+	if compressed != nil {
+		cmd.SetArgs(compressed...)
+	}
+	return nil
+}
+
+func (h *Hook) decompressReply(cmd redis.Cmder) {
+	if cmd.Err() != nil {
+		return
+	}
+
+	var err error
+	switch cmd := cmd.(type) {
+	case *redis.StringCmd:
+		switch cmd.Name() {
+		case "get", "getset", "getdel", "getex", "hget":
+			var s string
+			if s, err = h.decompressString(cmd.Val()); err == nil {
+				cmd.SetVal(s)
+			}
+		}
+	case *redis.SliceCmd:
+		switch cmd.Name() {
+		case "mget", "hmget":
+			vals := cmd.Val()
+			for i, v := range vals {
+				s, ok := v.(string)
+				if !ok {
+					continue
+				}
+				if vals[i], err = h.decompressString(s); err != nil {
+					break
+				}
+			}
+		}
+	case *redis.StringStringMapCmd:
+		if cmd.Name() == "hgetall" {
+			for k, v := range cmd.Val() {
+				var s string
+				if s, err = h.decompressString(v); err != nil {
+					break
+				}
+				cmd.Val()[k] = s
+			}
+		}
+	case *redis.StringSliceCmd:
+		if cmd.Name() == "hvals" {
+			vals := cmd.Val()
+			for i, v := range vals {
+				if vals[i], err = h.decompressString(v); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		cmd.SetErr(err)
+	}
+}
+
+func (h *Hook) decompressString(s string) (string, error) {
+	if len(s) < 2 || s[0] != magic {
+		return s, nil
+	}
+	b, err := h.codec.Decompress([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
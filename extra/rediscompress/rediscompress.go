@@ -0,0 +1,185 @@
+// Package rediscompress provides a redis.Codec that compresses large values,
+// e.g.
+//
+//	rdb := redis.NewClient(&redis.Options{
+//		Codec: rediscompress.NewCodec(&rediscompress.Options{
+//			Algorithm: rediscompress.Zstd,
+//		}),
+//	})
+//
+// The values shorter than Options.Threshold are stored as encoded by the
+// wrapped codec, so the codec can read the values stored without compression
+// and compression can be enabled without migrating the existing data.
+package rediscompress
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/farss/redis/v8"
+)
+
+// Algorithm is a compression algorithm.
+type Algorithm byte
+
+const (
+	Snappy Algorithm = iota + 1
+	Zstd
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// magic is the first byte of the compressed values. It is followed by the
+// algorithm. Values encoded with JSON or text never start with it.
+const magic = 0xff
+
+// Options are used to configure the codec returned by NewCodec.
+type Options struct {
+	// Algorithm is used to compress the values.
+	// Default is Snappy.
+	Algorithm Algorithm
+	// Threshold is the minimum size of the encoded value to compress.
+	// Default is 1024 bytes.
+	Threshold int
+	// Codec encodes the values before the compression.
+	// Default is redis.JSONCodec.
+	Codec redis.Codec
+}
+
+func (opt *Options) init() {
+	if opt.Algorithm == 0 {
+		opt.Algorithm = Snappy
+	}
+	if opt.Threshold == 0 {
+		opt.Threshold = 1024
+	}
+	if opt.Codec == nil {
+		opt.Codec = redis.JSONCodec
+	}
+}
+
+// Codec compresses the values encoded with another codec. It decompresses
+// the values compressed with any of the algorithms, so the algorithm can be
+// changed without migrating the existing data. It is safe for concurrent use.
+type Codec struct {
+	opt Options
+
+	zenc *zstd.Encoder
+	zdec *zstd.Decoder
+}
+
+var _ redis.Codec = (*Codec)(nil)
+
+// NewCodec returns a new codec.
+func NewCodec(opt *Options) *Codec {
+	c := new(Codec)
+	if opt != nil {
+		c.opt = *opt
+	}
+	c.opt.init()
+
+	// The encoder and the decoder allocate their state lazily and never
+	// fail with the default options.
+	c.zenc, _ = zstd.NewWriter(nil)
+	c.zdec, _ = zstd.NewReader(nil)
+	return c
+}
+
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	b, err := c.opt.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Compress(b)
+}
+
+func (c *Codec) Unmarshal(b []byte, v interface{}) error {
+	b, err := c.Decompress(b)
+	if err != nil {
+		return err
+	}
+	return c.opt.Codec.Unmarshal(b, v)
+}
+
+// Compress compresses b if it is not shorter than Options.Threshold, e.g. to
+// compress []byte values, which are written as is and not with the codec.
+func (c *Codec) Compress(b []byte) ([]byte, error) {
+	return c.compress(b, c.opt.Threshold)
+}
+
+// compressRaw is like Compress, but it also compresses the short values that
+// start with the magic byte, so Decompress does not mistake them for
+// compressed values. Unlike the values encoded with the codec, raw values
+// can start with any byte.
+func (c *Codec) compressRaw(b []byte) ([]byte, error) {
+	threshold := c.opt.Threshold
+	if len(b) > 0 && b[0] == magic {
+		threshold = 0
+	}
+	return c.compress(b, threshold)
+}
+
+func (c *Codec) compress(b []byte, threshold int) ([]byte, error) {
+	if len(b) < threshold {
+		return b, nil
+	}
+
+	dst := []byte{magic, byte(c.opt.Algorithm)}
+	switch c.opt.Algorithm {
+	case Snappy:
+		n := snappy.MaxEncodedLen(len(b))
+		if n < 0 {
+			return nil, fmt.Errorf("rediscompress: value is too large: %d bytes", len(b))
+		}
+		dst = append(dst, make([]byte, n)...)
+		out := snappy.Encode(dst[2:], b)
+		return dst[:2+len(out)], nil
+	case Zstd:
+		return c.zenc.EncodeAll(b, dst), nil
+	default:
+		return nil, fmt.Errorf("rediscompress: unsupported algorithm: %s", c.opt.Algorithm)
+	}
+}
+
+// Close releases the resources of the zstd encoder and decoder. The codec
+// can't be used after Close.
+func (c *Codec) Close() error {
+	c.zdec.Close()
+	return c.zenc.Close()
+}
+
+// Decompress decompresses b if it was compressed with Compress or returns
+// it as is otherwise.
+func (c *Codec) Decompress(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != magic {
+		return b, nil
+	}
+
+	switch algo := Algorithm(b[1]); algo {
+	case Snappy:
+		out, err := snappy.Decode(nil, b[2:])
+		if err != nil {
+			return nil, fmt.Errorf("rediscompress: %s: %w", algo, err)
+		}
+		return out, nil
+	case Zstd:
+		out, err := c.zdec.DecodeAll(b[2:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("rediscompress: %s: %w", algo, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("rediscompress: unsupported algorithm: %s", algo)
+	}
+}
@@ -0,0 +1,125 @@
+package rediscompress
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/farss/redis/v8"
+)
+
+type value struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+func TestCodec(t *testing.T) {
+	for _, algo := range []Algorithm{Snappy, Zstd} {
+		c := NewCodec(&Options{Algorithm: algo, Threshold: 100})
+
+		in := value{Name: "large", Data: strings.Repeat("a", 1000)}
+		b, err := c.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 200 || b[0] != magic || Algorithm(b[1]) != algo {
+			t.Fatalf("%s: value is not compressed: %d bytes", algo, len(b))
+		}
+
+		var out value
+		if err := c.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Fatalf("%s: got %+v, want %+v", algo, out, in)
+		}
+	}
+}
+
+func TestCodecThreshold(t *testing.T) {
+	c := NewCodec(nil)
+
+	b, err := c.Marshal(value{Name: "small"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"small","data":""}`; string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+}
+
+func TestCodecMixedAlgorithms(t *testing.T) {
+	data := bytes.Repeat([]byte("abc"), 1000)
+
+	b, err := NewCodec(&Options{Algorithm: Zstd}).Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The codec decompresses the values compressed with other algorithms.
+	out, err := NewCodec(&Options{Algorithm: Snappy}).Decompress(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("decompressed value does not match")
+	}
+}
+
+func TestHook(t *testing.T) {
+	ctx := context.Background()
+	codec := NewCodec(&Options{Threshold: 100})
+	defer codec.Close()
+	hook := NewHook(codec)
+
+	large := strings.Repeat("a", 1000)
+	set := redis.NewStatusCmd(ctx, "set", "key", large)
+	if _, err := hook.BeforeProcess(ctx, set); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := set.Args()[2].([]byte)
+	if !ok || len(b) > 200 || b[0] != magic {
+		t.Fatalf("value is not compressed: %v", set.Args()[2])
+	}
+
+	get := redis.NewStringCmd(ctx, "get", "key")
+	get.SetVal(string(b))
+	if err := hook.AfterProcess(ctx, get); err != nil {
+		t.Fatal(err)
+	}
+	if got := get.Val(); got != large {
+		t.Fatalf("got %d bytes, want %d", len(got), len(large))
+	}
+}
+
+func TestHookMagicByte(t *testing.T) {
+	ctx := context.Background()
+	hook := NewHook(NewCodec(nil))
+
+	// Short raw values starting with the magic byte are compressed, so they
+	// are not mistaken for compressed values.
+	val := "\xff\x01raw"
+	mset := redis.NewStatusCmd(ctx, "mset", "k1", "small", "k2", val)
+	if _, err := hook.BeforeProcessPipeline(ctx, []redis.Cmder{mset}); err != nil {
+		t.Fatal(err)
+	}
+	args := mset.Args()
+	if args[2] != "small" {
+		t.Fatalf("small value is compressed: %v", args[2])
+	}
+	b, ok := args[4].([]byte)
+	if !ok {
+		t.Fatalf("value is not compressed: %v", args[4])
+	}
+
+	mget := redis.NewSliceCmd(ctx, "mget", "k1", "k2")
+	mget.SetVal([]interface{}{"small", string(b)})
+	if err := hook.AfterProcessPipeline(ctx, []redis.Cmder{mget}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mget.Val(); !reflect.DeepEqual(got, []interface{}{"small", val}) {
+		t.Fatalf("got %q", got)
+	}
+}
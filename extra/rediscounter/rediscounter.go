@@ -0,0 +1,204 @@
+// Package rediscounter implements sharded counters: the increments are
+// spread across a number of keys, so a high-rate counter is not a hot key,
+// and the keys are summed on read, e.g.
+//
+//	views := rediscounter.New(rdb, "views:home", nil)
+//
+//	err := views.Incr(ctx)
+//
+//	n, err := views.Get(ctx)
+package rediscounter
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+var (
+	// takeScript deletes the shard and returns its value.
+	takeScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if not v then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+return tonumber(v)
+`)
+	// foldScript adds the KEYS[2:] shards to the KEYS[1] shard and deletes
+	// them.
+	foldScript = redis.NewScript(`
+local sum = 0
+for i = 2, #KEYS do
+	local v = redis.call("GET", KEYS[i])
+	if v then
+		sum = sum + tonumber(v)
+		redis.call("DEL", KEYS[i])
+	end
+end
+if sum ~= 0 then
+	redis.call("INCRBY", KEYS[1], sum)
+end
+return sum
+`)
+)
+
+// Options are used to configure a Counter.
+type Options struct {
+	// Shards is the number of keys the increments are spread across. All the
+	// clients of the counter must use the same number of shards.
+	// Default is 16.
+	Shards int
+
+	// Logger logs the errors of RunCompaction.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *Options) init() {
+	if opt.Shards == 0 {
+		opt.Shards = 16
+	}
+}
+
+// Counter is a counter sharded across the keys with the name and the ":0" to
+// ":<Shards-1>" suffixes. It's safe for concurrent use by multiple
+// goroutines.
+//
+// On a cluster the keys are in different hash slots, so the increments are
+// spread across the nodes, unless the name has a hash tag, e.g.
+// "{user:1}:views", in which case they are in the same hash slot and
+// Compact is atomic.
+type Counter struct {
+	client   redis.Cmdable
+	opt      Options
+	keys     []string
+	sameSlot bool
+}
+
+// New returns a new Counter. opt can be nil to use the default options.
+func New(client redis.Cmdable, name string, opt *Options) *Counter {
+	c := &Counter{client: client}
+	if opt != nil {
+		c.opt = *opt
+	}
+	c.opt.init()
+
+	c.keys = make([]string, c.opt.Shards)
+	for i := range c.keys {
+		c.keys[i] = name + ":" + strconv.Itoa(i)
+	}
+	c.sameSlot = hasHashTag(name)
+	return c
+}
+
+// Keys returns the keys of the shards.
+func (c *Counter) Keys() []string {
+	return c.keys
+}
+
+// Incr increments the counter by 1.
+func (c *Counter) Incr(ctx context.Context) error {
+	return c.IncrBy(ctx, 1)
+}
+
+// IncrBy increments the counter by n, which can be negative. It increments
+// a random shard, so it does not return the value of the counter.
+func (c *Counter) IncrBy(ctx context.Context, n int64) error {
+	key := c.keys[rand.Intn(len(c.keys))]
+	return c.client.IncrBy(ctx, key, n).Err()
+}
+
+// Get returns the value of the counter, which is the sum of the shards.
+func (c *Counter) Get(ctx context.Context) (int64, error) {
+	cmds, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.keys {
+			pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	var sum int64
+	for _, cmd := range cmds {
+		n, err := cmd.(*redis.StringCmd).Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// Reset deletes the shards, which resets the counter to 0.
+func (c *Counter) Reset(ctx context.Context) error {
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// Compact adds the other shards to the first one and deletes them, so an
+// idle counter is stored in a single key.
+//
+// When the shards are in different hash slots each shard is moved
+// separately, so Get may return a lower value until the shard is added to
+// the first one. A shard that can't be added is restored.
+func (c *Counter) Compact(ctx context.Context) error {
+	if c.sameSlot {
+		return foldScript.Run(ctx, c.client, c.keys).Err()
+	}
+
+	for _, key := range c.keys[1:] {
+		n, err := takeScript.Run(ctx, c.client, []string{key}).Int64()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := c.client.IncrBy(ctx, c.keys[0], n).Err(); err != nil {
+			_ = c.client.IncrBy(context.Background(), key, n).Err()
+			return err
+		}
+	}
+	return nil
+}
+
+// RunCompaction compacts the counter every interval until the context is
+// done.
+func (c *Counter) RunCompaction(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.Compact(ctx)
+			if err != nil && ctx.Err() == nil && c.opt.Logger != nil {
+				c.opt.Logger.Log(ctx, redis.LogLevelWarn, "rediscounter: compaction failed", "error", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func hasHashTag(name string) bool {
+	if s := strings.IndexByte(name, '{'); s >= 0 {
+		return strings.IndexByte(name[s+1:], '}') > 0
+	}
+	return false
+}
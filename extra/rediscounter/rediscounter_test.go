@@ -0,0 +1,120 @@
+package rediscounter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestCounter(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	c := New(rdb, "views", &Options{Shards: 4})
+	ctx := context.Background()
+
+	if n, err := c.Get(ctx); err != nil || n != 0 {
+		t.Fatalf("got %d, %v, want 0", n, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := c.Incr(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := c.IncrBy(ctx, -5); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := c.Get(ctx); err != nil || n != 95 {
+		t.Fatalf("got %d, %v, want 95", n, err)
+	}
+	for _, key := range mr.Keys() {
+		if key != "views:0" && key != "views:1" && key != "views:2" && key != "views:3" {
+			t.Fatalf("unexpected key %q", key)
+		}
+	}
+
+	if err := c.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Get(ctx); err != nil || n != 0 {
+		t.Fatalf("got %d, %v after Reset, want 0", n, err)
+	}
+}
+
+func TestCounterCompact(t *testing.T) {
+	for _, name := range []string{"views", "{user:1}:views"} {
+		t.Run(name, func(t *testing.T) {
+			rdb, mr := newTestClient(t)
+			c := New(rdb, name, &Options{Shards: 4})
+			ctx := context.Background()
+
+			for i, key := range c.Keys() {
+				mr.Set(key, "10")
+				if i == 2 {
+					mr.Set(key, "-3")
+				}
+			}
+
+			if err := c.Compact(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if keys := mr.Keys(); len(keys) != 1 || keys[0] != name+":0" {
+				t.Fatalf("got keys %v, want only the first shard", keys)
+			}
+			if n, err := c.Get(ctx); err != nil || n != 27 {
+				t.Fatalf("got %d, %v, want 27", n, err)
+			}
+		})
+	}
+}
+
+func TestCounterRunCompaction(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	c := New(rdb, "views", &Options{Shards: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for _, key := range c.Keys() {
+		mr.Set(key, "1")
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.RunCompaction(ctx, 10*time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(mr.Keys()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got keys %v, want only the first shard", mr.Keys())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+	if n, err := c.Get(context.Background()); err != nil || n != 4 {
+		t.Fatalf("got %d, %v, want 4", n, err)
+	}
+}
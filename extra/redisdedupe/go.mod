@@ -0,0 +1,16 @@
+module github.com/go-redis/redis/extra/redisdedupe/v8
+
+go 1.17
+
+replace github.com/farss/redis/v8 => ../..
+
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/farss/redis/v8 v8.11.5
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
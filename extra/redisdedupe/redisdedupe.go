@@ -0,0 +1,256 @@
+// Package redisdedupe implements a filter that drops the events seen within
+// a time window, e.g.
+//
+//	dedupe := redisdedupe.New(rdb, &redisdedupe.Options{
+//		Window: 10 * time.Minute,
+//	})
+//
+//	seen, err := dedupe.CheckAndMark(ctx, ids...)
+//	for i, id := range ids {
+//		if !seen[i] {
+//			process(id)
+//		}
+//	}
+//
+// The events are stored in keys with a TTL or, with RedisBloom, in Bloom
+// filters.
+package redisdedupe
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// The filter of the current window is KEYS[1] and the filter of the
+// previous window is KEYS[2]. ARGV[1] and ARGV[2] are the capacity and the
+// error rate of the filters, ARGV[3] is when the current filter expires in
+// Unix milliseconds and ARGV[4:] are the IDs.
+var bloomScript = redis.NewScript(`
+local ids = {unpack(ARGV, 4)}
+local prev = {}
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	prev = redis.call("BF.MEXISTS", KEYS[2], unpack(ids))
+end
+local added = redis.call("BF.INSERT", KEYS[1], "CAPACITY", ARGV[1], "ERROR", ARGV[2], "ITEMS", unpack(ids))
+redis.call("PEXPIREAT", KEYS[1], ARGV[3])
+
+local seen = {}
+for i = 1, #added do
+	if added[i] == 0 or prev[i] == 1 then
+		seen[i] = 1
+	else
+		seen[i] = 0
+	end
+end
+return seen
+`)
+
+// batchSize limits the number of IDs passed at once to bloomScript, which
+// is below the number of values Lua can unpack.
+const batchSize = 1000
+
+// Backend is the storage of the seen events.
+type Backend int
+
+const (
+	// AutoBackend uses BloomBackend when RedisBloom is available and
+	// KeyBackend otherwise.
+	AutoBackend Backend = iota
+	// KeyBackend stores each event in a key that expires after the window.
+	// It is exact.
+	KeyBackend
+	// BloomBackend stores the events in a Bloom filter per window. It uses
+	// much less memory than KeyBackend but it may report events that were
+	// not seen as duplicates, at the Options.ErrorRate, and the events are
+	// kept between one and two windows. It requires RedisBloom.
+	BloomBackend
+)
+
+func (b Backend) String() string {
+	switch b {
+	case AutoBackend:
+		return "auto"
+	case KeyBackend:
+		return "key"
+	case BloomBackend:
+		return "bloom"
+	default:
+		return "Backend(" + strconv.Itoa(int(b)) + ")"
+	}
+}
+
+// Options are used to configure a Dedupe.
+type Options struct {
+	// Prefix is the prefix of the keys.
+	// Default is "dedupe:".
+	Prefix string
+	// Window is how long the events are remembered. It must be at least
+	// 1 millisecond.
+	// Default is 1 hour.
+	Window time.Duration
+
+	// Backend is the storage of the events.
+	// Default is AutoBackend.
+	Backend Backend
+	// Capacity is the expected number of events per window of BloomBackend.
+	// Default is 100000.
+	Capacity int64
+	// ErrorRate is the false positive rate of BloomBackend.
+	// Default is 0.001.
+	ErrorRate float64
+}
+
+func (opt *Options) init() {
+	if opt.Prefix == "" {
+		opt.Prefix = "dedupe:"
+	}
+	if opt.Window == 0 {
+		opt.Window = time.Hour
+	}
+	if opt.Window < time.Millisecond {
+		panic("redisdedupe: Window must be at least 1 millisecond")
+	}
+	if opt.Capacity == 0 {
+		opt.Capacity = 100000
+	}
+	if opt.ErrorRate == 0 {
+		opt.ErrorRate = 0.001
+	}
+}
+
+// Dedupe reports whether the events were seen within the window. It's safe
+// for concurrent use by multiple goroutines.
+type Dedupe struct {
+	client redis.UniversalClient
+	opt    Options
+
+	backend int32 // atomic Backend
+}
+
+// New returns a new Dedupe. opt can be nil to use the default options.
+func New(client redis.UniversalClient, opt *Options) *Dedupe {
+	d := &Dedupe{client: client}
+	if opt != nil {
+		d.opt = *opt
+	}
+	d.opt.init()
+	d.backend = int32(d.opt.Backend)
+	return d
+}
+
+// Backend returns the backend of the Dedupe. With AutoBackend it checks
+// whether RedisBloom is available until a check succeeds, so concurrent
+// first calls may check it more than once.
+func (d *Dedupe) Backend(ctx context.Context) (Backend, error) {
+	if backend := Backend(atomic.LoadInt32(&d.backend)); backend != AutoBackend {
+		return backend, nil
+	}
+
+	var backend Backend
+	err := d.client.Do(ctx, "BF.EXISTS", d.bloomKey(0), "").Err()
+	switch {
+	case err == nil:
+		backend = BloomBackend
+	case isUnknownCommand(err):
+		backend = KeyBackend
+	default:
+		return AutoBackend, err
+	}
+	atomic.StoreInt32(&d.backend, int32(backend))
+	return backend, nil
+}
+
+// Seen marks the event and reports whether it was seen within the window.
+func (d *Dedupe) Seen(ctx context.Context, id string) (bool, error) {
+	seen, err := d.CheckAndMark(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return seen[0], nil
+}
+
+// CheckAndMark marks the events and reports for each of them whether it was
+// seen within the window. An ID repeated in the batch is seen after its
+// first occurrence.
+func (d *Dedupe) CheckAndMark(ctx context.Context, ids ...string) ([]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	backend, err := d.Backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if backend == BloomBackend {
+		return d.checkBloom(ctx, ids)
+	}
+	return d.checkKeys(ctx, ids)
+}
+
+func (d *Dedupe) checkKeys(ctx context.Context, ids []string) ([]bool, error) {
+	cmds, err := d.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.SetNX(ctx, d.opt.Prefix+id, 1, d.opt.Window)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make([]bool, len(ids))
+	for i, cmd := range cmds {
+		seen[i] = !cmd.(*redis.BoolCmd).Val()
+	}
+	return seen, nil
+}
+
+func (d *Dedupe) checkBloom(ctx context.Context, ids []string) ([]bool, error) {
+	window := d.opt.Window.Milliseconds()
+	period := time.Now().UnixMilli() / window
+	keys := []string{d.bloomKey(period), d.bloomKey(period - 1)}
+	// The filter is used for its window and the next one.
+	expireAt := (period + 2) * window
+
+	seen := make([]bool, 0, len(ids))
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		ids = ids[len(batch):]
+
+		args := make([]interface{}, 0, 3+len(batch))
+		args = append(args, d.opt.Capacity, d.opt.ErrorRate, expireAt)
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		vals, err := bloomScript.Run(ctx, d.client, keys, args...).Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) != len(batch) {
+			return nil, fmt.Errorf("redisdedupe: unexpected script reply: %v", vals)
+		}
+		for _, v := range vals {
+			seen = append(seen, v == 1)
+		}
+	}
+	return seen, nil
+}
+
+// bloomKey returns the key of the filter of the window period. The filters
+// are in the same hash slot.
+func (d *Dedupe) bloomKey(period int64) string {
+	return "{" + d.opt.Prefix + "bloom}:" + strconv.FormatInt(period, 10)
+}
+
+func isUnknownCommand(err error) bool {
+	return strings.HasPrefix(err.Error(), "ERR unknown command")
+}
@@ -0,0 +1,80 @@
+package redisdedupe
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestCheckAndMark(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	d := New(rdb, &Options{Window: time.Minute})
+	ctx := context.Background()
+
+	// miniredis has no RedisBloom.
+	if backend, err := d.Backend(ctx); err != nil || backend != KeyBackend {
+		t.Fatalf("got %s, %v, want key", backend, err)
+	}
+
+	seen, err := d.CheckAndMark(ctx, "a", "b", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, false, true}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("got %v, want %v", seen, want)
+	}
+
+	seen, err = d.CheckAndMark(ctx, "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("got %v, want %v", seen, want)
+	}
+	if ttl := mr.TTL("dedupe:a"); ttl != time.Minute {
+		t.Fatalf("got TTL %s, want 1m", ttl)
+	}
+
+	// The events are forgotten after the window.
+	mr.FastForward(time.Minute)
+	if ok, err := d.Seen(ctx, "a"); err != nil || ok {
+		t.Fatalf("got %v, %v, want not seen", ok, err)
+	}
+	if ok, err := d.Seen(ctx, "a"); err != nil || !ok {
+		t.Fatalf("got %v, %v, want seen", ok, err)
+	}
+
+	if seen, err := d.CheckAndMark(ctx); err != nil || seen != nil {
+		t.Fatalf("got %v, %v, want nil", seen, err)
+	}
+}
+
+func TestBloomBackendUnavailable(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	d := New(rdb, &Options{Backend: BloomBackend})
+
+	if _, err := d.Seen(context.Background(), "a"); err == nil {
+		t.Fatal("got nil, want an error without RedisBloom")
+	}
+}
+
+func TestWindowTooShort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("New doesn't panic with a window below 1ms")
+		}
+	}()
+	New(nil, &Options{Window: time.Microsecond})
+}
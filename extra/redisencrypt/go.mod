@@ -0,0 +1,12 @@
+module github.com/go-redis/redis/extra/redisencrypt/v8
+
+go 1.17
+
+replace github.com/farss/redis/v8 => ../..
+
+require github.com/farss/redis/v8 v8.11.5
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
@@ -0,0 +1,209 @@
+// Package redisencrypt provides a redis.Codec that encrypts the values with
+// AES-GCM, e.g.
+//
+//	keys := redisencrypt.NewKeyring("2024-01", map[string][]byte{
+//		"2023-01": oldKey,
+//		"2024-01": newKey,
+//	})
+//	rdb := redis.NewClient(&redis.Options{
+//		Codec: redisencrypt.NewCodec(&redisencrypt.Options{
+//			Keys: keys,
+//		}),
+//	})
+//
+// The ID of the key is stored with every value, so the keys can be rotated
+// without re-encrypting the existing values: new values are encrypted with
+// the current key and the values encrypted with the previous keys can be
+// read as long as the key provider returns them.
+package redisencrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/farss/redis/v8"
+)
+
+// version is the first byte of the encrypted values. It is followed by the
+// length of the key ID, the key ID, the nonce and the ciphertext.
+const version = 1
+
+// ErrNotEncrypted is returned when decrypting a value that was not
+// encrypted with the codec.
+var ErrNotEncrypted = errors.New("redisencrypt: value is not encrypted")
+
+var errNoKeys = errors.New("redisencrypt: Options.Keys is not set")
+
+// KeyProvider provides the AES keys, which must be 16, 24 or 32 bytes long.
+// It must be safe for concurrent use.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new values and its ID,
+	// which must not be longer than 255 bytes.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the ID to decrypt values.
+	Key(id string) ([]byte, error)
+}
+
+// Keyring is a KeyProvider with a fixed set of keys.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+var _ KeyProvider = (*Keyring)(nil)
+
+// NewKeyring returns a keyring that encrypts the values with the key with
+// the current ID.
+func NewKeyring(current string, keys map[string][]byte) *Keyring {
+	m := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		m[id] = key
+	}
+	return &Keyring{
+		current: current,
+		keys:    m,
+	}
+}
+
+func (r *Keyring) CurrentKey() (string, []byte, error) {
+	key, err := r.Key(r.current)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.current, key, nil
+}
+
+func (r *Keyring) Key(id string) ([]byte, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("redisencrypt: unknown key %q", id)
+	}
+	return key, nil
+}
+
+// Options are used to configure the codec returned by NewCodec.
+type Options struct {
+	// Keys provides the encryption keys. It is required: without it the
+	// codec fails to encrypt and decrypt the values.
+	Keys KeyProvider
+	// Codec encodes the values before the encryption.
+	// Default is redis.JSONCodec.
+	Codec redis.Codec
+}
+
+func (opt *Options) init() {
+	if opt.Codec == nil {
+		opt.Codec = redis.JSONCodec
+	}
+}
+
+// Codec encrypts the values encoded with another codec. It is safe for
+// concurrent use.
+type Codec struct {
+	opt Options
+}
+
+var _ redis.Codec = (*Codec)(nil)
+
+// NewCodec returns a new codec. opt can be nil to use the default options.
+func NewCodec(opt *Options) *Codec {
+	c := new(Codec)
+	if opt != nil {
+		c.opt = *opt
+	}
+	c.opt.init()
+	return c
+}
+
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	b, err := c.opt.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encrypt(b)
+}
+
+func (c *Codec) Unmarshal(b []byte, v interface{}) error {
+	b, err := c.Decrypt(b)
+	if err != nil {
+		return err
+	}
+	return c.opt.Codec.Unmarshal(b, v)
+}
+
+// Encrypt encrypts b with the current key, e.g. to encrypt []byte values,
+// which are written as is and not with the codec.
+func (c *Codec) Encrypt(b []byte) ([]byte, error) {
+	if c.opt.Keys == nil {
+		return nil, errNoKeys
+	}
+	id, key, err := c.opt.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("redisencrypt: key ID is too long: %d bytes", len(id))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 2+len(id)+aead.NonceSize()+len(b)+aead.Overhead())
+	header = append(header, version, byte(len(id)))
+	header = append(header, id...)
+
+	nonce := header[len(header) : len(header)+aead.NonceSize()]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// The header is authenticated, so the key ID can't be changed.
+	return aead.Seal(header[:len(header)+len(nonce)], nonce, b, header), nil
+}
+
+// Decrypt decrypts b encrypted with Encrypt. It returns ErrNotEncrypted if
+// b was not encrypted.
+func (c *Codec) Decrypt(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != version || len(b) < 2+int(b[1]) {
+		return nil, ErrNotEncrypted
+	}
+	if c.opt.Keys == nil {
+		return nil, errNoKeys
+	}
+	header := b[:2+int(b[1])]
+	id := string(header[2:])
+
+	key, err := c.opt.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b = b[len(header):]
+	if len(b) < aead.NonceSize() {
+		return nil, ErrNotEncrypted
+	}
+	nonce, ciphertext := b[:aead.NonceSize()], b[aead.NonceSize():]
+
+	out, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, fmt.Errorf("redisencrypt: can't decrypt value with key %q: %w", id, err)
+	}
+	return out, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("redisencrypt: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,93 @@
+package redisencrypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 32)
+)
+
+type secret struct {
+	Token string `json:"token"`
+}
+
+func TestCodec(t *testing.T) {
+	c := NewCodec(&Options{
+		Keys: NewKeyring("k1", map[string][]byte{"k1": key1}),
+	})
+
+	b, err := c.Marshal(secret{Token: "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("s3cr3t")) {
+		t.Fatal("value is not encrypted")
+	}
+
+	var s secret
+	if err := c.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Token != "s3cr3t" {
+		t.Fatalf("got %q, want s3cr3t", s.Token)
+	}
+
+	if err := c.Unmarshal([]byte(`{"token":"plain"}`), &s); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("got %v, want ErrNotEncrypted", err)
+	}
+}
+
+func TestCodecRotation(t *testing.T) {
+	old := NewCodec(&Options{
+		Keys: NewKeyring("k1", map[string][]byte{"k1": key1}),
+	})
+	b, err := old.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCodec(&Options{
+		Keys: NewKeyring("k2", map[string][]byte{"k1": key1, "k2": key2}),
+	})
+	out, err := c.Decrypt(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "value" {
+		t.Fatalf("got %q, want value", out)
+	}
+
+	b2, err := c.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Decrypt(b2); err == nil {
+		t.Fatal("decrypted value encrypted with an unknown key")
+	}
+}
+
+func TestCodecTampering(t *testing.T) {
+	c := NewCodec(&Options{
+		Keys: NewKeyring("k1", map[string][]byte{"k1": key1}),
+	})
+	b, err := c.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b[len(b)-1] ^= 1
+	if _, err := c.Decrypt(b); err == nil {
+		t.Fatal("decrypted tampered value")
+	}
+}
+
+func TestCodecNoKeys(t *testing.T) {
+	c := NewCodec(nil)
+	if _, err := c.Marshal(secret{Token: "value"}); err != errNoKeys {
+		t.Fatalf("got %v, want %v", err, errNoKeys)
+	}
+}
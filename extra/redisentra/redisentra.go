@@ -0,0 +1,115 @@
+// Package redisentra provides Microsoft Entra ID authentication for Azure
+// Cache for Redis and Azure Managed Redis, e.g.
+//
+//	cred, err := azidentity.NewDefaultAzureCredential(nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	rdb := redis.NewClient(&redis.Options{
+//		Addr:      "my-cache.redis.cache.windows.net:6380",
+//		TLSConfig: &tls.Config{},
+//		TokenAuth: redis.NewTokenAuth(&redis.TokenAuthOptions{
+//			Source: redisentra.NewTokenSource(&redisentra.Options{
+//				GetToken: func(ctx context.Context) (string, time.Time, error) {
+//					tok, err := cred.GetToken(ctx, policy.TokenRequestOptions{
+//						Scopes: []string{redisentra.Scope},
+//					})
+//					return tok.Token, tok.ExpiresOn, err
+//				},
+//			}),
+//		}),
+//	})
+//
+// The access tokens are refreshed in the background before they expire and
+// the connections are re-authenticated with the new tokens.
+package redisentra
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// Scope is the scope of the access tokens for Azure Cache for Redis and
+// Azure Managed Redis.
+const Scope = "https://redis.azure.com/.default"
+
+// Options are used to configure a TokenSource.
+type Options struct {
+	// GetToken returns an access token for Scope and its expiry, e.g.
+	// requested with an azcore.TokenCredential of the Azure SDK.
+	GetToken func(ctx context.Context) (token string, expiresOn time.Time, err error)
+	// Username is the name of the Redis user, i.e. the object ID of the
+	// managed identity or the service principal.
+	// Default is the "oid" claim of the access token.
+	Username string
+}
+
+// TokenSource is a redis.TokenSource that returns the Entra ID access
+// tokens.
+type TokenSource struct {
+	opt Options
+}
+
+var _ redis.TokenSource = (*TokenSource)(nil)
+
+// NewTokenSource returns a new TokenSource.
+func NewTokenSource(opt *Options) *TokenSource {
+	if opt.GetToken == nil {
+		panic("redisentra: Options.GetToken is required")
+	}
+	return &TokenSource{opt: *opt}
+}
+
+// Token requests a new access token.
+func (s *TokenSource) Token(ctx context.Context) (*redis.Token, error) {
+	token, expiresOn, err := s.opt.GetToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("redisentra: can't get the access token: %w", err)
+	}
+
+	username := s.opt.Username
+	if username == "" {
+		username, err = objectID(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &redis.Token{
+		Username: username,
+		Password: token,
+		Expires:  expiresOn,
+	}, nil
+}
+
+// objectID returns the "oid" claim of the JWT token. The signature is not
+// verified, the token is verified by the server.
+func objectID(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("redisentra: the access token is not a JWT")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("redisentra: can't decode the access token: %w", err)
+	}
+
+	var claims struct {
+		OID string `json:"oid"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", fmt.Errorf("redisentra: can't decode the access token: %w", err)
+	}
+	if claims.OID == "" {
+		return "", errors.New("redisentra: the access token has no oid claim")
+	}
+	return claims.OID, nil
+}
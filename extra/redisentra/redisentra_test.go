@@ -0,0 +1,77 @@
+package redisentra
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJWT(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestTokenSource(t *testing.T) {
+	jwt := testJWT(`{"aud":"https://redis.azure.com","oid":"8f3b1c2a-0000-4000-8000-000000000001"}`)
+	expires := time.Now().Add(time.Hour)
+
+	s := NewTokenSource(&Options{
+		GetToken: func(ctx context.Context) (string, time.Time, error) {
+			return jwt, expires, nil
+		},
+	})
+
+	tok, err := s.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Username != "8f3b1c2a-0000-4000-8000-000000000001" {
+		t.Fatalf("got username %q, want the oid claim", tok.Username)
+	}
+	if tok.Password != jwt {
+		t.Fatalf("got password %q, want the access token", tok.Password)
+	}
+	if !tok.Expires.Equal(expires) {
+		t.Fatalf("got expires %s, want %s", tok.Expires, expires)
+	}
+}
+
+func TestTokenSourceUsername(t *testing.T) {
+	s := NewTokenSource(&Options{
+		Username: "app-user",
+		GetToken: func(ctx context.Context) (string, time.Time, error) {
+			return "opaque", time.Time{}, nil
+		},
+	})
+
+	tok, err := s.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Username != "app-user" {
+		t.Fatalf("got username %q, want app-user", tok.Username)
+	}
+}
+
+func TestTokenSourceError(t *testing.T) {
+	for _, getToken := range []func(ctx context.Context) (string, time.Time, error){
+		func(ctx context.Context) (string, time.Time, error) {
+			return "", time.Time{}, errors.New("expired")
+		},
+		func(ctx context.Context) (string, time.Time, error) {
+			return "opaque", time.Time{}, nil
+		},
+		func(ctx context.Context) (string, time.Time, error) {
+			return testJWT(`{"aud":"https://redis.azure.com"}`), time.Time{}, nil
+		},
+	} {
+		s := NewTokenSource(&Options{GetToken: getToken})
+		if _, err := s.Token(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "redisentra: ") {
+			t.Fatalf("got %v, want an error", err)
+		}
+	}
+}
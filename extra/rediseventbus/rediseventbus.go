@@ -0,0 +1,233 @@
+// Package rediseventbus implements typed topics on top of Redis Pub/Sub:
+// the values are marshaled on Publish and unmarshaled for the handlers, e.g.
+//
+//	var OrderCreated = rediseventbus.NewTopic("orders.created", func() interface{} {
+//		return new(Order)
+//	}, nil)
+//
+//	bus := rediseventbus.New(rdb, nil)
+//
+//	_, err := bus.Publish(ctx, OrderCreated, &Order{ID: 1})
+//
+//	sub, err := bus.Subscribe(ctx, OrderCreated, func(ctx context.Context, v interface{}) error {
+//		return ship(ctx, v.(*Order))
+//	})
+package rediseventbus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/farss/redis/v8"
+)
+
+// Topic is a named stream of values of the same type.
+type Topic struct {
+	name     string
+	newValue func() interface{}
+	typ      reflect.Type
+	codec    redis.Codec
+}
+
+// NewTopic returns a Topic. newValue must return a pointer to a new value the
+// messages are unmarshaled into. codec can be nil to use redis.JSONCodec.
+func NewTopic(name string, newValue func() interface{}, codec redis.Codec) *Topic {
+	if codec == nil {
+		codec = redis.JSONCodec
+	}
+	typ := reflect.TypeOf(newValue())
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("rediseventbus: newValue of topic %q must return a pointer", name))
+	}
+	return &Topic{
+		name:     name,
+		newValue: newValue,
+		typ:      typ,
+		codec:    codec,
+	}
+}
+
+// Name returns the name of the topic.
+func (t *Topic) Name() string {
+	return t.name
+}
+
+func (t *Topic) check(v interface{}) error {
+	typ := reflect.TypeOf(v)
+	if typ != t.typ && typ != t.typ.Elem() {
+		return fmt.Errorf("rediseventbus: topic %q expects %s, got %T", t.name, t.typ, v)
+	}
+	return nil
+}
+
+// Handler handles a value published to a topic. v is the pointer returned
+// by the newValue of the topic.
+type Handler func(ctx context.Context, v interface{}) error
+
+// HandlerError is sent on the error channel of a Subscription when the
+// handler fails.
+type HandlerError struct {
+	Topic string
+	Value interface{}
+	Err   error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("rediseventbus: handler of topic %q failed: %s", e.Topic, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// Options are used to configure a Bus.
+type Options struct {
+	// Prefix is the prefix of the channels of the topics.
+	// Default is no prefix.
+	Prefix string
+	// ErrorChannelSize is the size of the error channel of the
+	// subscriptions. The errors are dropped when the channel is full.
+	// Default is 100.
+	ErrorChannelSize int
+
+	// Logger logs the dropped errors.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *Options) init() {
+	if opt.ErrorChannelSize == 0 {
+		opt.ErrorChannelSize = 100
+	}
+}
+
+// Bus publishes and subscribes to the topics. It's safe for concurrent use
+// by multiple goroutines.
+type Bus struct {
+	client redis.UniversalClient
+	opt    Options
+}
+
+// New returns a new Bus. opt can be nil to use the default options.
+func New(client redis.UniversalClient, opt *Options) *Bus {
+	b := &Bus{client: client}
+	if opt != nil {
+		b.opt = *opt
+	}
+	b.opt.init()
+	return b
+}
+
+func (b *Bus) channel(topic *Topic) string {
+	return b.opt.Prefix + topic.name
+}
+
+// Publish marshals the value with the codec of the topic and publishes it.
+// The value must be of the type of the topic or a pointer to it. It returns
+// the number of subscribers that received the value.
+func (b *Bus) Publish(ctx context.Context, topic *Topic, v interface{}) (int64, error) {
+	if err := topic.check(v); err != nil {
+		return 0, err
+	}
+	data, err := topic.codec.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return b.client.Publish(ctx, b.channel(topic), data).Result()
+}
+
+// Subscribe subscribes to the topic and calls the handler with the values
+// until the Subscription is closed. ctx is only used to subscribe; the
+// handler is called with a background context by a single goroutine in the
+// order of the messages. The messages that can't be unmarshaled, as
+// *redis.MessageDecodeError, and the failures of the handler, as
+// *HandlerError, are sent on the error channel of the Subscription.
+func (b *Bus) Subscribe(ctx context.Context, topic *Topic, handler Handler) (*Subscription, error) {
+	pubsub := b.client.Subscribe(ctx, b.channel(topic))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	s := &Subscription{
+		bus:    b,
+		topic:  topic,
+		pubsub: pubsub,
+		errCh:  make(chan error, b.opt.ErrorChannelSize),
+		done:   make(chan struct{}),
+	}
+	go s.run(handler)
+	return s, nil
+}
+
+// Subscription is a subscription to a topic.
+type Subscription struct {
+	bus    *Bus
+	topic  *Topic
+	pubsub *redis.PubSub
+	errCh  chan error
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Topic returns the topic of the subscription.
+func (s *Subscription) Topic() *Topic {
+	return s.topic
+}
+
+// Errors returns the error channel of the subscription. It is closed when
+// the subscription is closed.
+func (s *Subscription) Errors() <-chan error {
+	return s.errCh
+}
+
+// Close unsubscribes and waits for the running handler to return.
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.pubsub.Close()
+		<-s.done
+	})
+	return err
+}
+
+func (s *Subscription) run(handler Handler) {
+	defer close(s.done)
+	defer close(s.errCh)
+
+	ctx := context.Background()
+	msgs, errs := s.pubsub.DecodedChannel(s.topic.codec, s.topic.newValue)
+	for msgs != nil || errs != nil {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			if err := handler(ctx, msg.Value); err != nil {
+				s.sendErr(ctx, &HandlerError{Topic: s.topic.name, Value: msg.Value, Err: err})
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			s.sendErr(ctx, err)
+		}
+	}
+}
+
+func (s *Subscription) sendErr(ctx context.Context, err error) {
+	select {
+	case s.errCh <- err:
+	default:
+		if s.bus.opt.Logger != nil {
+			s.bus.opt.Logger.Log(ctx, redis.LogLevelWarn,
+				"rediseventbus: error channel is full (error is dropped)",
+				"topic", s.topic.name, "error", err)
+		}
+	}
+}
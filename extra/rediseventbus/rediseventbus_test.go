@@ -0,0 +1,100 @@
+package rediseventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+type order struct {
+	ID int `json:"id"`
+}
+
+var orderCreated = NewTopic("orders.created", func() interface{} {
+	return new(order)
+}, nil)
+
+func TestBus(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	bus := New(rdb, &Options{Prefix: "events:"})
+	ctx := context.Background()
+
+	values := make(chan *order, 10)
+	sub, err := bus.Subscribe(ctx, orderCreated, func(ctx context.Context, v interface{}) error {
+		o := v.(*order)
+		if o.ID == 0 {
+			return errors.New("no ID")
+		}
+		values <- o
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []interface{}{&order{ID: 1}, order{ID: 2}, order{}} {
+		if n, err := bus.Publish(ctx, orderCreated, v); err != nil || n != 1 {
+			t.Fatalf("got %d, %v", n, err)
+		}
+	}
+	mr.Publish("events:orders.created", "not json")
+
+	for _, want := range []int{1, 2} {
+		select {
+		case o := <-values:
+			if o.ID != want {
+				t.Fatalf("got order %d, want %d", o.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no value")
+		}
+	}
+
+	var handlerErr *HandlerError
+	if err := receiveErr(t, sub); !errors.As(err, &handlerErr) || handlerErr.Topic != "orders.created" {
+		t.Fatalf("got %v, want a HandlerError", err)
+	}
+	var decodeErr *redis.MessageDecodeError
+	if err := receiveErr(t, sub); !errors.As(err, &decodeErr) {
+		t.Fatalf("got %v, want a MessageDecodeError", err)
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-sub.Errors(); ok {
+		t.Fatal("the error channel is not closed")
+	}
+}
+
+func TestPublishTypeMismatch(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	bus := New(rdb, nil)
+
+	if _, err := bus.Publish(context.Background(), orderCreated, "order"); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+}
+
+func receiveErr(t *testing.T, sub *Subscription) error {
+	t.Helper()
+	select {
+	case err := <-sub.Errors():
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no error")
+		return nil
+	}
+}
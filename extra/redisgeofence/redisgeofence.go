@@ -0,0 +1,365 @@
+// Package redisgeofence implements geofences on top of the Redis GEO
+// commands: it tracks the positions of entities and reports when they enter
+// or exit the fences, e.g.
+//
+//	g := redisgeofence.New(rdb, "couriers", nil)
+//
+//	err := g.AddFence(ctx, &redisgeofence.Fence{
+//		Name:      "depot",
+//		Longitude: 13.361389,
+//		Latitude:  38.115556,
+//		Radius:    200,
+//	})
+//
+//	events, err := g.Track(ctx, "courier:1", lon, lat)
+//
+// The events are also published to the subscribers of Watch. All the keys
+// of a Geofence are in the same hash slot.
+package redisgeofence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+var (
+	// ErrFenceNotFound is returned when the fence is not registered.
+	ErrFenceNotFound = errors.New("redisgeofence: fence not found")
+	// ErrInvalidFence is returned by AddFence when the fence has no name or
+	// is neither a circle nor a box.
+	ErrInvalidFence = errors.New("redisgeofence: fence must have a name and either a radius or a width and a height")
+)
+
+// Fence is a circle, with a Radius, or a box, with a Width and a Height,
+// around a center. The distances are in meters.
+type Fence struct {
+	Name      string  `json:"name"`
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+
+	Radius float64 `json:"radius,omitempty"`
+
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+}
+
+// reach returns the distance from the center to the farthest point of the
+// fence.
+func (f *Fence) reach() float64 {
+	if f.Radius > 0 {
+		return f.Radius
+	}
+	return math.Hypot(f.Width/2, f.Height/2)
+}
+
+func (f *Fence) valid() bool {
+	if f.Name == "" {
+		return false
+	}
+	if f.Radius > 0 {
+		return f.Width == 0 && f.Height == 0
+	}
+	return f.Width > 0 && f.Height > 0
+}
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventEnter is reported when an entity enters a fence.
+	EventEnter EventType = "enter"
+	// EventExit is reported when an entity exits a fence, is untracked or
+	// expires, or when the fence is removed.
+	EventExit EventType = "exit"
+)
+
+// Event reports that an entity entered or exited a fence.
+type Event struct {
+	Type   EventType `json:"type"`
+	Fence  string    `json:"fence"`
+	Entity string    `json:"entity"`
+}
+
+// EventHandler handles an Event.
+type EventHandler func(ctx context.Context, event *Event)
+
+// Options are used to configure a Geofence.
+type Options struct {
+	// EntityTTL is how long an entity is tracked after its last position.
+	// The expired entities exit their fences when they are removed by
+	// Watch, which requires keyspace notifications for the expired events,
+	// i.e. notify-keyspace-events must include "Ex".
+	// Default is to track the entities until Untrack.
+	EntityTTL time.Duration
+	// Notifications are the options of the keyspace notifications used by
+	// Watch to remove the expired entities.
+	Notifications *redis.KeyspaceNotificationsOptions
+
+	// Logger logs the errors of Watch.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+// Geofence tracks the entities in the fences. It's safe for concurrent use
+// by multiple goroutines.
+type Geofence struct {
+	client  redis.UniversalClient
+	opt     Options
+	tag     string
+	channel string
+	keys    []string
+}
+
+// New returns a Geofence. The fences and the entities are stored in the keys
+// with the name and the ":fences", ":centers", ":reach", ":positions", ":at",
+// ":inside" and ":entity:<entity>" suffixes, and the events are published to
+// the channel with the ":events" suffix. opt can be nil to use the default
+// options.
+func New(client redis.UniversalClient, name string, opt *Options) *Geofence {
+	g := &Geofence{client: client}
+	if opt != nil {
+		g.opt = *opt
+	}
+
+	g.tag = hashTag(name)
+	g.channel = g.tag + ":events"
+	g.keys = []string{
+		g.tag + ":fences",
+		g.tag + ":centers",
+		g.tag + ":reach",
+		g.tag + ":positions",
+		g.tag + ":at",
+		g.tag + ":inside",
+	}
+	return g
+}
+
+func (g *Geofence) run(ctx context.Context, script *redis.Script, args ...interface{}) *redis.Cmd {
+	return g.runKeys(ctx, script, g.keys, args...)
+}
+
+// runEntity runs the script with the key that expires with the entity.
+func (g *Geofence) runEntity(ctx context.Context, script *redis.Script, entity string, args ...interface{}) *redis.Cmd {
+	keys := append(g.keys[:len(g.keys):len(g.keys)], g.tag+":entity:"+entity)
+	return g.runKeys(ctx, script, keys, append([]interface{}{entity}, args...)...)
+}
+
+func (g *Geofence) runKeys(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) *redis.Cmd {
+	args = append([]interface{}{g.channel}, args...)
+	return script.Run(ctx, g.client, keys, args...)
+}
+
+// AddFence registers the fence or replaces the fence with the same name. The
+// tracked entities are checked against the fence when they move.
+func (g *Geofence) AddFence(ctx context.Context, fence *Fence) error {
+	if !fence.valid() {
+		return ErrInvalidFence
+	}
+	b, err := json.Marshal(fence)
+	if err != nil {
+		return err
+	}
+	return g.run(ctx, addFenceScript,
+		fence.Name, b, fence.Longitude, fence.Latitude, fence.reach()).Err()
+}
+
+// RemoveFence removes the fence and returns the exit events of the entities
+// that were inside. It returns ErrFenceNotFound if there is no such fence.
+func (g *Geofence) RemoveFence(ctx context.Context, name string) ([]*Event, error) {
+	vals, err := g.run(ctx, removeFenceScript, name).Slice()
+	if err == redis.Nil {
+		return nil, ErrFenceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(vals)
+}
+
+// Fences returns the registered fences.
+func (g *Geofence) Fences(ctx context.Context) ([]*Fence, error) {
+	vals, err := g.client.HVals(ctx, g.keys[0]).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	fences := make([]*Fence, 0, len(vals))
+	for _, val := range vals {
+		fence := new(Fence)
+		if err := json.Unmarshal([]byte(val), fence); err != nil {
+			return nil, err
+		}
+		fences = append(fences, fence)
+	}
+	return fences, nil
+}
+
+// Contains reports whether the point is inside the fence. It returns
+// ErrFenceNotFound if there is no such fence.
+func (g *Geofence) Contains(ctx context.Context, fence string, lon, lat float64) (bool, error) {
+	n, err := g.run(ctx, containsScript, fence, lon, lat).Int64()
+	if err != nil {
+		return false, err
+	}
+	if n == -1 {
+		return false, ErrFenceNotFound
+	}
+	return n == 1, nil
+}
+
+// FencesAt returns the names of the fences the point is inside, ordered by
+// the distance to their center.
+func (g *Geofence) FencesAt(ctx context.Context, lon, lat float64) ([]string, error) {
+	return g.run(ctx, fencesAtScript, lon, lat).StringSlice()
+}
+
+// Track sets the position of the entity and returns the exit events of the
+// fences it left, followed by the enter events of the fences it entered.
+func (g *Geofence) Track(ctx context.Context, entity string, lon, lat float64) ([]*Event, error) {
+	vals, err := g.runEntity(ctx, trackScript, entity,
+		lon, lat, g.opt.EntityTTL.Milliseconds()).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(vals)
+}
+
+// Untrack removes the entity and returns the exit events of the fences it
+// was inside.
+func (g *Geofence) Untrack(ctx context.Context, entity string) ([]*Event, error) {
+	return g.untrack(ctx, entity, "")
+}
+
+func (g *Geofence) untrack(ctx context.Context, entity, mode string) ([]*Event, error) {
+	vals, err := g.runEntity(ctx, untrackScript, entity, mode).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(vals)
+}
+
+// Position returns the position of the entity. It returns redis.Nil if the
+// entity is not tracked.
+func (g *Geofence) Position(ctx context.Context, entity string) (lon, lat float64, err error) {
+	pos, err := g.client.GeoPos(ctx, g.keys[3], entity).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(pos) == 0 || pos[0] == nil {
+		return 0, 0, redis.Nil
+	}
+	return pos[0].Longitude, pos[0].Latitude, nil
+}
+
+// Inside returns the entities inside the fence.
+func (g *Geofence) Inside(ctx context.Context, fence string) ([]string, error) {
+	members, err := g.client.ZRangeByLex(ctx, g.keys[5], &redis.ZRangeBy{
+		Min: "[" + fence + "\x00",
+		Max: "(" + fence + "\x01",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, member := range members {
+		members[i] = member[len(fence)+1:]
+	}
+	return members, nil
+}
+
+// Watch calls the handler with the events of all the clients of the
+// Geofence until the context is done. With Options.EntityTTL it also
+// removes the expired entities, so their exit events are delivered.
+//
+// Redis Cluster sends the keyspace notifications only to the clients
+// connected to the node that owns the key, see KeyspaceNotifications.
+func (g *Geofence) Watch(ctx context.Context, handler EventHandler) error {
+	pubsub := g.client.Subscribe(ctx, g.channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	if g.opt.EntityTTL > 0 {
+		notifications, err := redis.NewKeyspaceNotifications(ctx, g.client, g.opt.Notifications)
+		if err != nil {
+			return err
+		}
+		defer notifications.Close()
+
+		// The keys of the notifications have the prefix of the client.
+		prefix := g.tag + ":entity:"
+		if c, ok := g.client.(*redis.Client); ok {
+			prefix = c.Options().KeyPrefix + prefix
+		}
+		notifications.On(redis.KeyspaceEventExpired, func(ctx context.Context, event *redis.KeyspaceEvent) {
+			if !strings.HasPrefix(event.Key, prefix) {
+				return
+			}
+			if _, err := g.untrack(ctx, event.Key[len(prefix):], "expired"); err != nil {
+				g.log(ctx, "redisgeofence: untrack failed", err)
+			}
+		})
+		go func() {
+			_ = notifications.Run(ctx)
+		}()
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			event := new(Event)
+			if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+				g.log(ctx, "redisgeofence: invalid event", err)
+				continue
+			}
+			handler(ctx, event)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (g *Geofence) log(ctx context.Context, msg string, err error) {
+	if g.opt.Logger != nil {
+		g.opt.Logger.Log(ctx, redis.LogLevelWarn, msg, "error", err)
+	}
+}
+
+// parseEvents parses the {type, fence, entity} tuples returned by the
+// scripts.
+func parseEvents(vals []interface{}) ([]*Event, error) {
+	if len(vals)%3 != 0 {
+		return nil, fmt.Errorf("redisgeofence: unexpected script reply: %v", vals)
+	}
+
+	events := make([]*Event, 0, len(vals)/3)
+	for i := 0; i < len(vals); i += 3 {
+		typ, _ := vals[i].(string)
+		fence, _ := vals[i+1].(string)
+		entity, _ := vals[i+2].(string)
+		events = append(events, &Event{Type: EventType(typ), Fence: fence, Entity: entity})
+	}
+	return events, nil
+}
+
+// hashTag returns the name if it has a hash tag or the name in braces, so all
+// the keys of a Geofence are in the same hash slot.
+func hashTag(name string) string {
+	if s := strings.IndexByte(name, '{'); s >= 0 {
+		if e := strings.IndexByte(name[s+1:], '}'); e > 0 {
+			return name
+		}
+	}
+	return "{" + name + "}"
+}
@@ -0,0 +1,215 @@
+package redisgeofence
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+const lon, lat = 13.361389, 38.115556
+
+func addFences(t *testing.T, g *Geofence) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, fence := range []*Fence{
+		{Name: "circle", Longitude: lon, Latitude: lat, Radius: 2000},
+		{Name: "box", Longitude: lon + 0.03, Latitude: lat, Width: 2000, Height: 500},
+	} {
+		if err := g.AddFence(ctx, fence); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	g := New(rdb, "fleet", nil)
+	ctx := context.Background()
+	addFences(t, g)
+
+	for _, test := range []struct {
+		fence    string
+		lon, lat float64
+		want     bool
+	}{
+		{"circle", lon, lat, true},
+		{"circle", lon, lat + 0.005, true},      // ~556m north
+		{"circle", lon, lat + 0.02, false},      // ~2.2km north
+		{"box", lon + 0.03, lat + 0.002, true},  // ~222m north
+		{"box", lon + 0.03, lat + 0.003, false}, // ~334m north
+		{"box", lon + 0.04, lat, true},          // ~876m east
+		{"box", lon + 0.045, lat, false},        // ~1.3km east
+	} {
+		got, err := g.Contains(ctx, test.fence, test.lon, test.lat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("Contains(%s, %f, %f) = %v, want %v", test.fence, test.lon, test.lat, got, test.want)
+		}
+	}
+
+	if _, err := g.Contains(ctx, "missing", lon, lat); err != ErrFenceNotFound {
+		t.Fatalf("got %v, want ErrFenceNotFound", err)
+	}
+
+	names, err := g.FencesAt(ctx, lon+0.02, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"box", "circle"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+
+	fences, err := g.Fences(ctx)
+	if err != nil || len(fences) != 2 {
+		t.Fatalf("got %v, %v", fences, err)
+	}
+
+	if err := g.AddFence(ctx, &Fence{Name: "invalid", Radius: 1, Width: 1}); err != ErrInvalidFence {
+		t.Fatalf("got %v, want ErrInvalidFence", err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	g := New(rdb, "fleet", nil)
+	ctx := context.Background()
+	addFences(t, g)
+
+	events, err := g.Track(ctx, "car", lon, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Event{{Type: EventEnter, Fence: "circle", Entity: "car"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+
+	// No events while the entity stays in the fence.
+	if events, err := g.Track(ctx, "car", lon+0.001, lat); err != nil || len(events) != 0 {
+		t.Fatalf("got %v, %v", events, err)
+	}
+
+	events, err = g.Track(ctx, "car", lon+0.04, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*Event{
+		{Type: EventExit, Fence: "circle", Entity: "car"},
+		{Type: EventEnter, Fence: "box", Entity: "car"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	if inside, err := g.Inside(ctx, "box"); err != nil || !reflect.DeepEqual(inside, []string{"car"}) {
+		t.Fatalf("got %v, %v", inside, err)
+	}
+	if x, _, err := g.Position(ctx, "car"); err != nil || x < lon+0.0399 || x > lon+0.0401 {
+		t.Fatalf("got %f, %v", x, err)
+	}
+
+	events, err = g.RemoveFence(ctx, "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*Event{{Type: EventExit, Fence: "box", Entity: "car"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	if _, err := g.RemoveFence(ctx, "box"); err != ErrFenceNotFound {
+		t.Fatalf("got %v, want ErrFenceNotFound", err)
+	}
+
+	if _, err := g.Track(ctx, "car", lon, lat); err != nil {
+		t.Fatal(err)
+	}
+	events, err = g.Untrack(ctx, "car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*Event{{Type: EventExit, Fence: "circle", Entity: "car"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	if _, _, err := g.Position(ctx, "car"); err != redis.Nil {
+		t.Fatalf("got %v, want redis.Nil", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	// The keys of the client prefix are declared in the scripts.
+	g := New(rdb.WithKeyPrefix("app:"), "fleet", &Options{EntityTTL: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addFences(t, g)
+
+	events := make(chan *Event, 10)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- g.Watch(ctx, func(ctx context.Context, event *Event) {
+			events <- event
+		})
+	}()
+
+	receive := func() *Event {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return nil
+		}
+	}
+
+	// Wait for the subscriptions.
+	for len(mr.PubSubChannels("")) == 0 || mr.PubSubNumPat() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := g.Track(ctx, "car", lon, lat); err != nil {
+		t.Fatal(err)
+	}
+	if event := receive(); *event != (Event{Type: EventEnter, Fence: "circle", Entity: "car"}) {
+		t.Fatalf("got %v", event)
+	}
+	if inside, err := g.Inside(ctx, "circle"); err != nil || !reflect.DeepEqual(inside, []string{"car"}) {
+		t.Fatalf("got %v, %v", inside, err)
+	}
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, "app:") {
+			t.Fatalf("got key %q without the prefix", key)
+		}
+	}
+
+	// miniredis has no keyspace notifications.
+	mr.FastForward(time.Minute)
+	mr.Publish("__keyevent@0__:expired", "app:{fleet}:entity:car")
+	if event := receive(); *event != (Event{Type: EventExit, Fence: "circle", Entity: "car"}) {
+		t.Fatalf("got %v", event)
+	}
+	if inside, err := g.Inside(ctx, "circle"); err != nil || len(inside) != 0 {
+		t.Fatalf("got %v, %v", inside, err)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+}
@@ -0,0 +1,169 @@
+package redisgeofence
+
+import "github.com/farss/redis/v8"
+
+// The fences are stored as JSON in the KEYS[1] hash, their centers in the
+// KEYS[2] geo set and their reach, i.e. the distance from the center to the
+// farthest point of the fence, in the KEYS[3] sorted set. The positions of
+// the entities are in the KEYS[4] geo set. The fences an entity is inside are
+// the "<entity>\0<fence>" members of the KEYS[5] sorted set, and the entities
+// inside a fence are the "<fence>\0<entity>" members of the KEYS[6] sorted
+// set, so they are read with ZRANGEBYLEX and all the keys are declared. The
+// scripts of an entity get its key that expires with it in KEYS[7]. ARGV[1]
+// is the events channel.
+
+// geoLib defines the helpers. The distances are in meters and computed like
+// GEOSEARCH does.
+const geoLib = `
+local channel = ARGV[1]
+local earth_radius = 6372797.560856
+
+local function rad(deg)
+	return deg * math.pi / 180
+end
+
+local function distance(lon1, lat1, lon2, lat2)
+	local u = math.sin(rad(lat2 - lat1) / 2)
+	local v = math.sin(rad(lon2 - lon1) / 2)
+	return 2 * earth_radius * math.asin(math.sqrt(u * u + math.cos(rad(lat1)) * math.cos(rad(lat2)) * v * v))
+end
+
+local function contains(f, lon, lat)
+	if f.radius then
+		return distance(f.longitude, f.latitude, lon, lat) <= f.radius
+	end
+	return earth_radius * math.abs(rad(lat - f.latitude)) <= f.height / 2 and
+		distance(f.longitude, lat, lon, lat) <= f.width / 2
+end
+
+-- fences_at returns the names of the fences the point is inside. The
+-- candidates are the fences whose center is within the largest reach.
+local function fences_at(lon, lat)
+	local top = redis.call("ZREVRANGE", KEYS[3], 0, 0, "WITHSCORES")
+	if #top == 0 then
+		return {}
+	end
+	local names = redis.call("GEOSEARCH", KEYS[2], "FROMLONLAT", lon, lat,
+		"BYRADIUS", tonumber(top[2]) + 1, "m", "ASC")
+	local found = {}
+	for _, name in ipairs(names) do
+		local f = redis.call("HGET", KEYS[1], name)
+		if f and contains(cjson.decode(f), lon, lat) then
+			table.insert(found, name)
+		end
+	end
+	return found
+end
+
+-- emit publishes the event and appends it to the events.
+local function emit(events, typ, fence, entity)
+	redis.call("PUBLISH", channel, cjson.encode({type = typ, fence = fence, entity = entity}))
+	table.insert(events, typ)
+	table.insert(events, fence)
+	table.insert(events, entity)
+end
+
+-- members returns the names paired with the name in the KEYS[5] or KEYS[6]
+-- sorted set.
+local function members(key, name)
+	local names = {}
+	for _, m in ipairs(redis.call("ZRANGEBYLEX", key, "[" .. name .. "\0", "(" .. name .. "\1")) do
+		table.insert(names, string.sub(m, #name + 2))
+	end
+	return names
+end
+
+local function enter(events, fence, entity)
+	redis.call("ZADD", KEYS[5], 0, entity .. "\0" .. fence)
+	redis.call("ZADD", KEYS[6], 0, fence .. "\0" .. entity)
+	emit(events, "enter", fence, entity)
+end
+
+local function exit(events, fence, entity)
+	redis.call("ZREM", KEYS[5], entity .. "\0" .. fence)
+	redis.call("ZREM", KEYS[6], fence .. "\0" .. entity)
+	emit(events, "exit", fence, entity)
+end
+`
+
+var (
+	addFenceScript = redis.NewScript(geoLib + `
+redis.call("HSET", KEYS[1], ARGV[2], ARGV[3])
+redis.call("GEOADD", KEYS[2], ARGV[4], ARGV[5], ARGV[2])
+redis.call("ZADD", KEYS[3], ARGV[6], ARGV[2])
+return 1
+`)
+	removeFenceScript = redis.NewScript(geoLib + `
+local fence = ARGV[2]
+if redis.call("HDEL", KEYS[1], fence) == 0 then
+	return false
+end
+redis.call("ZREM", KEYS[2], fence)
+redis.call("ZREM", KEYS[3], fence)
+local events = {}
+for _, entity in ipairs(members(KEYS[6], fence)) do
+	exit(events, fence, entity)
+end
+return events
+`)
+	containsScript = redis.NewScript(geoLib + `
+local f = redis.call("HGET", KEYS[1], ARGV[2])
+if not f then
+	return -1
+end
+if contains(cjson.decode(f), tonumber(ARGV[3]), tonumber(ARGV[4])) then
+	return 1
+end
+return 0
+`)
+	fencesAtScript = redis.NewScript(geoLib + `
+return fences_at(tonumber(ARGV[2]), tonumber(ARGV[3]))
+`)
+	trackScript = redis.NewScript(geoLib + `
+local entity = ARGV[2]
+local lon = tonumber(ARGV[3])
+local lat = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[5])
+
+redis.call("GEOADD", KEYS[4], lon, lat, entity)
+if ttl > 0 then
+	redis.call("SET", KEYS[7], 1, "PX", ttl)
+end
+
+local found = fences_at(lon, lat)
+local inside = {}
+for _, fence in ipairs(found) do
+	inside[fence] = true
+end
+
+local events = {}
+for _, fence in ipairs(members(KEYS[5], entity)) do
+	if inside[fence] then
+		inside[fence] = false
+	else
+		exit(events, fence, entity)
+	end
+end
+for _, fence in ipairs(found) do
+	if inside[fence] then
+		enter(events, fence, entity)
+	end
+end
+return events
+`)
+	// untrackScript removes the entity. If ARGV[3] is "expired" it is removed
+	// only if it did not move since it expired.
+	untrackScript = redis.NewScript(geoLib + `
+local entity = ARGV[2]
+if ARGV[3] == "expired" and redis.call("EXISTS", KEYS[7]) == 1 then
+	return {}
+end
+redis.call("ZREM", KEYS[4], entity)
+redis.call("DEL", KEYS[7])
+local events = {}
+for _, fence in ipairs(members(KEYS[5], entity)) do
+	exit(events, fence, entity)
+end
+return events
+`)
+)
@@ -0,0 +1,225 @@
+// Package redisidempotency implements idempotency keys: the first request
+// with a key runs the operation and stores its result, and the retries of
+// the request get the stored result instead of running the operation again,
+// e.g.
+//
+//	idem := redisidempotency.New(rdb, nil)
+//
+//	res, replayed, err := idem.Do(ctx, r.Header.Get("Idempotency-Key"), fingerprint,
+//		func(ctx context.Context) ([]byte, error) {
+//			return chargeCard(ctx, req)
+//		})
+//	switch err {
+//	case redisidempotency.ErrInProgress:
+//		w.WriteHeader(http.StatusConflict)
+//	case redisidempotency.ErrFingerprintMismatch:
+//		w.WriteHeader(http.StatusUnprocessableEntity)
+//	}
+package redisidempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+var (
+	// ErrInProgress is returned when the operation of the key is running.
+	ErrInProgress = errors.New("redisidempotency: request in progress")
+	// ErrFingerprintMismatch is returned when the key is reused with a
+	// different request.
+	ErrFingerprintMismatch = errors.New("redisidempotency: fingerprint mismatch")
+	// ErrNotReserved is returned by Complete and Release when the
+	// reservation expired, e.g. because the operation took longer than
+	// Options.LockTTL.
+	ErrNotReserved = errors.New("redisidempotency: key not reserved")
+)
+
+// The key is a hash with the "state" ("pending" or "done"), "fp"
+// (fingerprint), "token" (reservation token) and "result" fields.
+
+var (
+	reserveScript = redis.NewScript(`
+local state = redis.call("HGET", KEYS[1], "state")
+if not state then
+	redis.call("HSET", KEYS[1], "state", "pending", "fp", ARGV[1], "token", ARGV[2])
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	return {"reserved"}
+end
+if redis.call("HGET", KEYS[1], "fp") ~= ARGV[1] then
+	return {"mismatch"}
+end
+if state == "done" then
+	return {"done", redis.call("HGET", KEYS[1], "result")}
+end
+return {"pending"}
+`)
+	completeScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "token") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "state", "done", "result", ARGV[2])
+redis.call("HDEL", KEYS[1], "token")
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+	releaseScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "token") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// Options are used to configure an Idempotency.
+type Options struct {
+	// Prefix is the prefix of the keys.
+	// Default is "idempotency:".
+	Prefix string
+	// TTL is how long the results are stored.
+	// Default is 24 hours.
+	TTL time.Duration
+	// LockTTL is how long a key is reserved for the running operation. The
+	// operation can run again with the key after the reservation expired.
+	// Default is 1 minute.
+	LockTTL time.Duration
+}
+
+func (opt *Options) init() {
+	if opt.Prefix == "" {
+		opt.Prefix = "idempotency:"
+	}
+	if opt.TTL == 0 {
+		opt.TTL = 24 * time.Hour
+	}
+	if opt.LockTTL == 0 {
+		opt.LockTTL = time.Minute
+	}
+}
+
+// Idempotency stores the results of the operations by their idempotency
+// keys. It's safe for concurrent use by multiple goroutines.
+type Idempotency struct {
+	client redis.Scripter
+	opt    Options
+}
+
+// New returns a new Idempotency. opt can be nil to use the default options.
+func New(client redis.Scripter, opt *Options) *Idempotency {
+	i := &Idempotency{client: client}
+	if opt != nil {
+		i.opt = *opt
+	}
+	i.opt.init()
+	return i
+}
+
+// Reservation is a key reserved for the operation.
+type Reservation struct {
+	idem  *Idempotency
+	key   string
+	token string
+}
+
+// Reserve reserves the key for the operation of the request identified by
+// the fingerprint, e.g. a hash of the request body. If the operation is
+// already done it returns a nil Reservation and the stored result. It
+// returns ErrInProgress if the key is reserved and ErrFingerprintMismatch if
+// the key is used by a different request.
+func (i *Idempotency) Reserve(ctx context.Context, key, fingerprint string) (*Reservation, []byte, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	vals, err := reserveScript.Run(ctx, i.client, []string{i.opt.Prefix + key},
+		fingerprint, token, i.opt.LockTTL.Milliseconds()).Slice()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state, _ := vals[0].(string)
+	switch state {
+	case "reserved":
+		return &Reservation{idem: i, key: key, token: token}, nil, nil
+	case "done":
+		result, _ := vals[1].(string)
+		return nil, []byte(result), nil
+	case "pending":
+		return nil, nil, ErrInProgress
+	case "mismatch":
+		return nil, nil, ErrFingerprintMismatch
+	default:
+		return nil, nil, fmt.Errorf("redisidempotency: unexpected script reply: %v", vals)
+	}
+}
+
+// Complete stores the result of the operation for Options.TTL.
+func (r *Reservation) Complete(ctx context.Context, result []byte) error {
+	n, err := completeScript.Run(ctx, r.idem.client, []string{r.idem.opt.Prefix + r.key},
+		r.token, result, r.idem.opt.TTL.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+// Release deletes the reservation without storing a result, so the request
+// can be retried, e.g. after a transient failure.
+func (r *Reservation) Release(ctx context.Context) error {
+	n, err := releaseScript.Run(ctx, r.idem.client, []string{r.idem.opt.Prefix + r.key}, r.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+// Do runs fn once for the key and returns its result, or returns the stored
+// result with replayed set to true. The errors of fn are not stored, so the
+// request can be retried; return a result with a nil error to store a
+// failure, e.g. a declined payment.
+func (i *Idempotency) Do(
+	ctx context.Context, key, fingerprint string, fn func(ctx context.Context) ([]byte, error),
+) (result []byte, replayed bool, err error) {
+	res, result, err := i.Reserve(ctx, key, fingerprint)
+	if err != nil {
+		return nil, false, err
+	}
+	if res == nil {
+		return result, true, nil
+	}
+
+	result, err = fn(ctx)
+
+	// The result is stored even if ctx is done, e.g. the client went away,
+	// because the operation is done. The reservation expires after LockTTL
+	// anyway.
+	storeCtx, cancel := context.WithTimeout(context.Background(), i.opt.LockTTL)
+	defer cancel()
+	if err != nil {
+		_ = res.Release(storeCtx)
+		return nil, false, err
+	}
+	if err := res.Complete(storeCtx, result); err != nil {
+		return result, false, err
+	}
+	return result, false, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package redisidempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestDo(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	idem := New(rdb, nil)
+	ctx := context.Background()
+
+	var calls int
+	fn := func(ctx context.Context) ([]byte, error) {
+		calls++
+		return []byte("charged"), nil
+	}
+
+	res, replayed, err := idem.Do(ctx, "key", "req", fn)
+	if err != nil || replayed || string(res) != "charged" {
+		t.Fatalf("got %q, %v, %v", res, replayed, err)
+	}
+	if ttl := mr.TTL("idempotency:key"); ttl != 24*time.Hour {
+		t.Fatalf("got TTL %s, want 24h", ttl)
+	}
+
+	// The retry gets the stored result.
+	res, replayed, err = idem.Do(ctx, "key", "req", fn)
+	if err != nil || !replayed || string(res) != "charged" {
+		t.Fatalf("got %q, %v, %v", res, replayed, err)
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+
+	if _, _, err := idem.Do(ctx, "key", "other", fn); err != ErrFingerprintMismatch {
+		t.Fatalf("got %v, want ErrFingerprintMismatch", err)
+	}
+}
+
+func TestDoError(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	idem := New(rdb, nil)
+	ctx := context.Background()
+
+	errFailed := errors.New("failed")
+	_, _, err := idem.Do(ctx, "key", "req", func(ctx context.Context) ([]byte, error) {
+		return nil, errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("got %v, want %v", err, errFailed)
+	}
+	if mr.Exists("idempotency:key") {
+		t.Fatal("the failed operation is stored")
+	}
+
+	res, replayed, err := idem.Do(ctx, "key", "req", func(ctx context.Context) ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil || replayed || string(res) != "ok" {
+		t.Fatalf("got %q, %v, %v", res, replayed, err)
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	idem := New(rdb, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The result is stored when ctx is done after the operation.
+	_, _, err := idem.Do(ctx, "key", "req", func(ctx context.Context) ([]byte, error) {
+		cancel()
+		return []byte("charged"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, replayed, err := idem.Do(context.Background(), "key", "req", func(ctx context.Context) ([]byte, error) {
+		t.Fatal("the operation runs again")
+		return nil, nil
+	})
+	if err != nil || !replayed || string(res) != "charged" {
+		t.Fatalf("got %q, %v, %v", res, replayed, err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	idem := New(rdb, &Options{LockTTL: time.Second})
+	ctx := context.Background()
+
+	res, _, err := idem.Reserve(ctx, "key", "req")
+	if err != nil || res == nil {
+		t.Fatalf("got %v, %v", res, err)
+	}
+	if _, _, err := idem.Reserve(ctx, "key", "req"); err != ErrInProgress {
+		t.Fatalf("got %v, want ErrInProgress", err)
+	}
+
+	// The reservation expires and the key is reserved again.
+	mr.FastForward(2 * time.Second)
+	again, _, err := idem.Reserve(ctx, "key", "req")
+	if err != nil || again == nil {
+		t.Fatalf("got %v, %v", again, err)
+	}
+	if err := res.Complete(ctx, []byte("stale")); err != ErrNotReserved {
+		t.Fatalf("got %v, want ErrNotReserved", err)
+	}
+	if err := res.Release(ctx); err != ErrNotReserved {
+		t.Fatalf("got %v, want ErrNotReserved", err)
+	}
+
+	if err := again.Complete(ctx, []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	if res, result, err := idem.Reserve(ctx, "key", "req"); err != nil || res != nil || string(result) != "ok" {
+		t.Fatalf("got %v, %q, %v", res, result, err)
+	}
+}
@@ -0,0 +1,312 @@
+// Package redisleader elects a single leader among the replicas of a
+// service, e.g. to run a background job on one replica at a time:
+//
+//	elector := redisleader.NewLeaderElector(rdb, &redisleader.Options{
+//		Key: "leader:billing-cron",
+//		OnElected: func(ctx context.Context) {
+//			// Run until ctx is done.
+//			runCron(ctx)
+//		},
+//	})
+//	go elector.Run(ctx)
+//
+// The leader holds the key, which is set with SET NX PX and renewed to
+// prove that the leader is alive.
+package redisleader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// errNotLeader is returned by renew when the key is not held by the candidate.
+var errNotLeader = errors.New("redisleader: not the leader")
+
+var (
+	renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	resignScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+)
+
+// Options are used to configure a LeaderElector.
+type Options struct {
+	// Key is the key held by the leader.
+	Key string
+	// ID identifies the candidate.
+	// Default is the hostname and a random suffix.
+	ID string
+
+	// TTL is the time after which the leadership is lost unless it is
+	// renewed, i.e. how long the replicas wait after the leader crashed.
+	// Default is 15 seconds.
+	TTL time.Duration
+	// RenewInterval is the interval between the renewals of the leadership.
+	// Default is a third of TTL.
+	RenewInterval time.Duration
+	// RetryInterval is the interval between the campaigns of a candidate
+	// that is not the leader.
+	// Default is a third of TTL.
+	RetryInterval time.Duration
+
+	// OnElected is called in a new goroutine when the candidate becomes the
+	// leader. The context is done when the leadership is lost or resigned;
+	// OnElected must return then, because the candidate only resigns or
+	// campaigns again after it has returned.
+	OnElected func(ctx context.Context)
+	// OnResigned is called when the candidate is no longer the leader,
+	// after OnElected has returned.
+	OnResigned func()
+
+	// Logger logs the failed campaigns and renewals.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *Options) init() {
+	if opt.Key == "" {
+		panic("redisleader: Key is required")
+	}
+	if opt.ID == "" {
+		opt.ID = defaultID()
+	}
+	if opt.TTL == 0 {
+		opt.TTL = 15 * time.Second
+	}
+	if opt.RenewInterval == 0 {
+		opt.RenewInterval = opt.TTL / 3
+	}
+	if opt.RetryInterval == 0 {
+		opt.RetryInterval = opt.TTL / 3
+	}
+}
+
+func defaultID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// LeaderElector campaigns for the leadership. It's safe for concurrent use
+// by multiple goroutines.
+type LeaderElector struct {
+	client redis.Cmdable
+	opt    Options
+
+	leader int32
+
+	running    int32
+	resign     chan struct{}
+	resignOnce sync.Once
+}
+
+// NewLeaderElector returns a new LeaderElector.
+func NewLeaderElector(client redis.Cmdable, opt *Options) *LeaderElector {
+	e := &LeaderElector{
+		client: client,
+		opt:    *opt,
+		resign: make(chan struct{}),
+	}
+	e.opt.init()
+	return e
+}
+
+// ID returns the ID of the candidate.
+func (e *LeaderElector) ID() string {
+	return e.opt.ID
+}
+
+// IsLeader reports whether the candidate is the leader.
+func (e *LeaderElector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Leader returns the ID of the current leader or redis.Nil if there is no
+// leader.
+func (e *LeaderElector) Leader(ctx context.Context) (string, error) {
+	return e.client.Get(ctx, e.opt.Key).Result()
+}
+
+// Run campaigns for the leadership until the context is done or Resign is
+// called. The leadership is resigned before Run returns, so another
+// candidate is elected without waiting for the TTL. Run can only be called
+// once.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&e.running, 0, 1) {
+		return errors.New("redisleader: Run is already called")
+	}
+
+	var timer *time.Timer
+	for {
+		start := time.Now()
+		elected, err := e.campaign(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.log(ctx, "redisleader: campaign failed", err)
+		}
+		if elected {
+			e.lead(ctx, start)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-e.resign:
+			return nil
+		default:
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(e.opt.RetryInterval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(e.opt.RetryInterval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-e.resign:
+			return nil
+		}
+	}
+}
+
+// Resign resigns the leadership and stops Run.
+func (e *LeaderElector) Resign() {
+	e.resignOnce.Do(func() { close(e.resign) })
+}
+
+func (e *LeaderElector) campaign(ctx context.Context) (bool, error) {
+	ok, err := e.client.SetNX(ctx, e.opt.Key, e.opt.ID, e.opt.TTL).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	// The key is still held by this candidate, e.g. after a renewal failed
+	// because of a network error.
+	if err := e.renew(ctx); err != nil {
+		if err == errNotLeader {
+			err = nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (e *LeaderElector) renew(ctx context.Context) error {
+	n, err := renewScript.Run(ctx, e.client, []string{e.opt.Key}, e.opt.ID, e.opt.TTL.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return errNotLeader
+	}
+	return nil
+}
+
+// lead renews the leadership until it is lost, the context is done or
+// Resign is called. The lease is counted from the time the SET or the
+// renewal was sent, and the leadership is given up a tenth of TTL before
+// the lease can expire, so OnElected stops before another candidate can be
+// elected. start is the time the lease was acquired.
+func (e *LeaderElector) lead(ctx context.Context, start time.Time) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	atomic.StoreInt32(&e.leader, 1)
+
+	elected := make(chan struct{})
+	go func() {
+		defer close(elected)
+		if e.opt.OnElected != nil {
+			e.opt.OnElected(leaderCtx)
+		}
+	}()
+
+	ticker := time.NewTicker(e.opt.RenewInterval)
+	defer ticker.Stop()
+
+	lease := e.opt.TTL - e.opt.TTL/10
+	expires := start.Add(lease)
+	expiry := time.NewTimer(time.Until(expires))
+	defer expiry.Stop()
+
+	resign := true
+loop:
+	for {
+		select {
+		case <-ticker.C:
+		case <-expiry.C:
+			// The lease can expire before the next renewal.
+			resign = false
+			break loop
+		case <-ctx.Done():
+			break loop
+		case <-e.resign:
+			break loop
+		}
+
+		timeout := e.opt.RenewInterval
+		if d := time.Until(expires); d < timeout {
+			timeout = d
+		}
+		start := time.Now()
+		renewCtx, cancelRenew := context.WithTimeout(ctx, timeout)
+		err := e.renew(renewCtx)
+		cancelRenew()
+
+		if err == nil {
+			expires = start.Add(lease)
+			if !expiry.Stop() {
+				<-expiry.C
+			}
+			expiry.Reset(time.Until(expires))
+			continue
+		}
+		if ctx.Err() != nil {
+			break loop
+		}
+		e.log(ctx, "redisleader: renewal failed", err)
+		if err == errNotLeader || !time.Now().Before(expires) {
+			// The key expired or is held by another candidate.
+			resign = false
+			break loop
+		}
+	}
+
+	cancel()
+	<-elected
+	atomic.StoreInt32(&e.leader, 0)
+
+	if resign {
+		resignCtx, cancelResign := context.WithTimeout(context.Background(), e.opt.RenewInterval)
+		err := resignScript.Run(resignCtx, e.client, []string{e.opt.Key}, e.opt.ID).Err()
+		cancelResign()
+		if err != nil {
+			e.log(ctx, "redisleader: resign failed", err)
+		}
+	}
+	if e.opt.OnResigned != nil {
+		e.opt.OnResigned()
+	}
+}
+
+func (e *LeaderElector) log(ctx context.Context, msg string, err error) {
+	if e.opt.Logger != nil {
+		e.opt.Logger.Log(ctx, redis.LogLevelWarn, msg, "key", e.opt.Key, "id", e.opt.ID, "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+package redisleader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+type candidate struct {
+	*LeaderElector
+	elected  chan context.Context
+	resigned chan struct{}
+	done     chan error
+}
+
+func startCandidate(ctx context.Context, rdb *redis.Client, id string) *candidate {
+	c := &candidate{
+		elected:  make(chan context.Context, 1),
+		resigned: make(chan struct{}, 1),
+		done:     make(chan error, 1),
+	}
+	c.LeaderElector = NewLeaderElector(rdb, &Options{
+		Key:           "leader",
+		ID:            id,
+		TTL:           time.Second,
+		RenewInterval: 20 * time.Millisecond,
+		RetryInterval: 20 * time.Millisecond,
+		OnElected: func(ctx context.Context) {
+			c.elected <- ctx
+			<-ctx.Done()
+		},
+		OnResigned: func() {
+			c.resigned <- struct{}{}
+		},
+	})
+	go func() { c.done <- c.Run(ctx) }()
+	return c
+}
+
+func (c *candidate) waitElected(t *testing.T) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-c.elected:
+		return ctx
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for OnElected")
+		return nil
+	}
+}
+
+func (c *candidate) waitResigned(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.resigned:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for OnResigned")
+	}
+}
+
+func TestElection(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	ctx := context.Background()
+
+	a := startCandidate(ctx, rdb, "a")
+	a.waitElected(t)
+	if !a.IsLeader() {
+		t.Fatal("a is not the leader")
+	}
+	if id, err := a.Leader(ctx); err != nil || id != "a" {
+		t.Fatalf("got leader %q, %v", id, err)
+	}
+
+	b := startCandidate(ctx, rdb, "b")
+	time.Sleep(100 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("b is elected while a is the leader")
+	}
+
+	// The resigned leadership is taken over without waiting for the TTL.
+	a.Resign()
+	a.waitResigned(t)
+	if err := <-a.done; err != nil {
+		t.Fatal(err)
+	}
+	b.waitElected(t)
+	if id, err := b.Leader(ctx); err != nil || id != "b" {
+		t.Fatalf("got leader %q, %v", id, err)
+	}
+}
+
+func TestLostLeadership(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	ctx := context.Background()
+
+	a := startCandidate(ctx, rdb, "a")
+	leaderCtx := a.waitElected(t)
+
+	mr.Set("leader", "other")
+	a.waitResigned(t)
+	if leaderCtx.Err() == nil {
+		t.Fatal("the context of OnElected is not done")
+	}
+	if a.IsLeader() {
+		t.Fatal("a is still the leader")
+	}
+	if got, _ := mr.Get("leader"); got != "other" {
+		t.Fatalf("the key of the new leader is deleted: %q", got)
+	}
+
+	// The candidate campaigns again.
+	mr.Del("leader")
+	a.waitElected(t)
+}
+
+func TestUnreachable(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	ctx := context.Background()
+
+	a := startCandidate(ctx, rdb, "a")
+	leaderCtx := a.waitElected(t)
+
+	// The leadership is given up before the key can expire.
+	mr.SetError("ERR unreachable")
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(950 * time.Millisecond):
+		t.Fatal("the context of OnElected is not done before the TTL")
+	}
+	a.waitResigned(t)
+}
+
+func TestRunCanceled(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := startCandidate(ctx, rdb, "a")
+	a.waitElected(t)
+
+	cancel()
+	if err := <-a.done; err != context.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+	if mr.Exists("leader") {
+		t.Fatal("the leadership is not resigned")
+	}
+	if err := a.Run(context.Background()); err == nil {
+		t.Fatal("Run can be called twice")
+	}
+}
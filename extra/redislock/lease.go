@@ -0,0 +1,110 @@
+package redislock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Lease is a resource that is held until it is released or its TTL expires,
+// e.g. a Lock. It extends its TTL in the background when it is created with
+// autoExtend. It's used to build other leased resources, e.g. the permits of
+// redissemaphore.
+type Lease struct {
+	extend     func(ctx context.Context, ttl time.Duration) error
+	release    func(ctx context.Context) error
+	errNotHeld error
+
+	mu  sync.Mutex
+	ttl time.Duration
+
+	done     chan struct{}
+	doneOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLease returns a lease that is extended with extend and released with
+// release. Both must return errNotHeld if the lease expired. With autoExtend
+// the lease is extended every third of the TTL until it is released, and
+// Done is closed if it can't be extended.
+func NewLease(
+	ttl time.Duration,
+	autoExtend bool,
+	errNotHeld error,
+	extend func(ctx context.Context, ttl time.Duration) error,
+	release func(ctx context.Context) error,
+) *Lease {
+	l := &Lease{
+		extend:     extend,
+		release:    release,
+		errNotHeld: errNotHeld,
+		ttl:        ttl,
+		done:       make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+	if autoExtend {
+		go l.watchdog()
+	}
+	return l
+}
+
+// Extend resets the TTL of the lease.
+func (l *Lease) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := l.extend(ctx, ttl); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.ttl = ttl
+	l.mu.Unlock()
+	return nil
+}
+
+// Release releases the lease and stops extending it.
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	err := l.release(ctx)
+	l.lost()
+	return err
+}
+
+// Done returns a channel that is closed when the lease is released or when
+// it is lost because it could not be extended.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *Lease) lost() {
+	l.doneOnce.Do(func() { close(l.done) })
+}
+
+func (l *Lease) watchdog() {
+	extended := time.Now()
+	for {
+		l.mu.Lock()
+		ttl := l.ttl
+		l.mu.Unlock()
+
+		timer := time.NewTimer(ttl / 3)
+		select {
+		case <-timer.C:
+		case <-l.stop:
+			timer.Stop()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+		err := l.Extend(ctx, ttl)
+		cancel()
+
+		switch {
+		case err == nil:
+			extended = time.Now()
+		case err == l.errNotHeld || time.Since(extended) >= ttl:
+			// The lease expired before it could be extended, e.g. while the
+			// server was unavailable.
+			l.lost()
+			return
+		}
+	}
+}
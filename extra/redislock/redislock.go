@@ -0,0 +1,394 @@
+// Package redislock implements distributed locks with fencing tokens, e.g.
+//
+//	locker := redislock.New(rdb)
+//
+//	lock, err := locker.Lock(ctx, "jobs:cleanup", 10*time.Second, &redislock.Options{
+//		AutoExtend: true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Release(ctx)
+//
+//	// Pass lock.Fence() to the storage to reject the writes of stale holders.
+//
+// With NewRedlock the locks are acquired on a majority of independent Redis
+// nodes using the Redlock algorithm.
+package redislock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+var (
+	// ErrNotObtained is returned when the lock is held by someone else.
+	ErrNotObtained = errors.New("redislock: not obtained")
+	// ErrLockNotHeld is returned when the lock expired or was acquired by
+	// someone else.
+	ErrLockNotHeld = errors.New("redislock: lock not held")
+)
+
+var (
+	obtainScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return false
+`)
+	extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+	pttlScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pttl", KEYS[1])
+end
+return -3
+`)
+)
+
+// Options are used to configure a lock.
+type Options struct {
+	// RetryBackoff is the interval between the attempts of Lock.
+	// Default is 100 milliseconds.
+	RetryBackoff time.Duration
+	// AutoExtend extends the lock in the background every third of the TTL
+	// until it is released, so it is not lost while the work takes longer
+	// than the TTL. Lock.Done is closed if the lock can't be extended.
+	AutoExtend bool
+	// Token is the value of the lock key.
+	// Default is a random token.
+	Token string
+}
+
+func (opt *Options) init() {
+	if opt.RetryBackoff == 0 {
+		opt.RetryBackoff = 100 * time.Millisecond
+	}
+}
+
+// Client acquires the locks. It's safe for concurrent use by multiple
+// goroutines.
+type Client struct {
+	nodes  []redis.Scripter
+	quorum int
+}
+
+// New returns a Client that acquires the locks on a single Redis server,
+// a failover client or a cluster.
+func New(client redis.Scripter) *Client {
+	return &Client{
+		nodes:  []redis.Scripter{client},
+		quorum: 1,
+	}
+}
+
+// NewRedlock returns a Client that acquires the locks on the majority of the
+// independent Redis nodes.
+func NewRedlock(nodes ...redis.Scripter) *Client {
+	if len(nodes) == 0 {
+		panic("redislock: at least one node is required")
+	}
+	return &Client{
+		nodes:  nodes,
+		quorum: len(nodes)/2 + 1,
+	}
+}
+
+// TryLock acquires the lock once. It returns ErrNotObtained if the lock is
+// held by someone else. opt can be nil to use the default options.
+func (c *Client) TryLock(ctx context.Context, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	o := new(Options)
+	if opt != nil {
+		*o = *opt
+	}
+	o.init()
+
+	token := o.Token
+	if token == "" {
+		var err error
+		if token, err = randomToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	fence, err := c.obtain(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lock{
+		client: c,
+		key:    key,
+		token:  token,
+		fence:  fence,
+	}
+	l.lease = NewLease(ttl, o.AutoExtend, ErrLockNotHeld, l.extend, l.release)
+	return l, nil
+}
+
+// Lock acquires the lock, retrying every Options.RetryBackoff until the
+// context is done.
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	o.init()
+	backoff := o.RetryBackoff
+
+	var timer *time.Timer
+	for {
+		l, err := c.TryLock(ctx, key, ttl, opt)
+		if err != ErrNotObtained {
+			return l, err
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) obtain(ctx context.Context, key, token string, ttl time.Duration) (int64, error) {
+	keys := []string{key, fenceKey(key)}
+	start := time.Now()
+
+	fences := make([]int64, len(c.nodes))
+	errs := c.forEachNode(ctx, func(ctx context.Context, i int, node redis.Scripter) error {
+		fence, err := obtainScript.Run(ctx, node, keys, token, ttl.Milliseconds()).Int64()
+		if err == redis.Nil {
+			return ErrNotObtained
+		}
+		fences[i] = fence
+		return err
+	})
+
+	var fence int64
+	var n int
+	for i, err := range errs {
+		if err == nil {
+			n++
+			if fences[i] > fence {
+				fence = fences[i]
+			}
+		}
+	}
+
+	// The lock is valid for the TTL minus the time it took to acquire it on
+	// all the nodes and the clock drift.
+	if n >= c.quorum && (len(c.nodes) == 1 || ttl-time.Since(start)-drift(ttl) > 0) {
+		return fence, nil
+	}
+
+	if len(c.nodes) > 1 {
+		// Release the lock on the nodes that granted it or that failed
+		// after acquiring it.
+		_ = c.release(context.Background(), key, token)
+	}
+	if n >= c.quorum {
+		return 0, ErrNotObtained
+	}
+	return 0, c.quorumErr(errs, ErrNotObtained)
+}
+
+// quorumErr returns errQuorum if the quorum is not reached because of it or
+// otherwise the first of the other errors, e.g. a network error.
+func (c *Client) quorumErr(errs []error, errQuorum error) error {
+	var n int
+	var firstErr error
+	for _, err := range errs {
+		if err == errQuorum {
+			n++
+		} else if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if n > len(c.nodes)-c.quorum || firstErr == nil {
+		return errQuorum
+	}
+	return firstErr
+}
+
+func (c *Client) release(ctx context.Context, key, token string) error {
+	return c.quorumRun(ctx, releaseScript, key, token)
+}
+
+// quorumRun runs the script on all the nodes and returns an error unless it
+// returned 1 on the quorum of the nodes.
+func (c *Client) quorumRun(ctx context.Context, script *redis.Script, key string, args ...interface{}) error {
+	errs := c.forEachNode(ctx, func(ctx context.Context, _ int, node redis.Scripter) error {
+		n, err := script.Run(ctx, node, []string{key}, args...).Int64()
+		if err == nil && n != 1 {
+			err = ErrLockNotHeld
+		}
+		return err
+	})
+
+	var n int
+	for _, err := range errs {
+		if err == nil {
+			n++
+		}
+	}
+	if n >= c.quorum {
+		return nil
+	}
+	return c.quorumErr(errs, ErrLockNotHeld)
+}
+
+func (c *Client) forEachNode(
+	ctx context.Context, fn func(ctx context.Context, i int, node redis.Scripter) error,
+) []error {
+	errs := make([]error, len(c.nodes))
+	if len(c.nodes) == 1 {
+		errs[0] = fn(ctx, 0, c.nodes[0])
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node redis.Scripter) {
+			defer wg.Done()
+			errs[i] = fn(ctx, i, node)
+		}(i, node)
+	}
+	wg.Wait()
+	return errs
+}
+
+// drift is the allowed clock drift of the Redlock nodes.
+func drift(ttl time.Duration) time.Duration {
+	return ttl/100 + 2*time.Millisecond
+}
+
+// fenceKey returns the key of the fencing counter. It is in the same hash
+// slot as the lock key and never expires, so the fencing tokens keep
+// increasing.
+func fenceKey(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key + ":fence"
+		}
+	}
+	return "{" + key + "}:fence"
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//------------------------------------------------------------------------------
+
+// Lock is an acquired lock.
+type Lock struct {
+	client *Client
+	key    string
+	token  string
+	fence  int64
+	lease  *Lease
+}
+
+// Key returns the lock key.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the value of the lock key.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence returns the fencing token: a number that is greater than the tokens
+// of the previous holders of the lock. In Redlock mode it is the greatest of
+// the counters of the nodes that granted the lock.
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// TTL returns the remaining time to live of the lock or ErrLockNotHeld.
+// In Redlock mode it is the lowest TTL of the nodes that hold the lock.
+func (l *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	ttls := make([]time.Duration, len(l.client.nodes))
+	errs := l.client.forEachNode(ctx, func(ctx context.Context, i int, node redis.Scripter) error {
+		ms, err := pttlScript.Run(ctx, node, []string{l.key}, l.token).Int64()
+		if err != nil {
+			return err
+		}
+		if ms < 0 {
+			return ErrLockNotHeld
+		}
+		ttls[i] = time.Duration(ms) * time.Millisecond
+		return nil
+	})
+
+	var ttl time.Duration
+	var n int
+	for i, err := range errs {
+		if err == nil {
+			if n == 0 || ttls[i] < ttl {
+				ttl = ttls[i]
+			}
+			n++
+		}
+	}
+	if n < l.client.quorum {
+		return 0, l.client.quorumErr(errs, ErrLockNotHeld)
+	}
+	return ttl, nil
+}
+
+// Extend resets the TTL of the lock. It returns ErrLockNotHeld if the lock
+// expired.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	return l.lease.Extend(ctx, ttl)
+}
+
+// Release releases the lock and stops extending it. It returns
+// ErrLockNotHeld if the lock expired.
+func (l *Lock) Release(ctx context.Context) error {
+	return l.lease.Release(ctx)
+}
+
+// Done returns a channel that is closed when the lock is released or when
+// it is lost because Options.AutoExtend failed to extend it.
+func (l *Lock) Done() <-chan struct{} {
+	return l.lease.Done()
+}
+
+func (l *Lock) extend(ctx context.Context, ttl time.Duration) error {
+	return l.client.quorumRun(ctx, extendScript, l.key, l.token, ttl.Milliseconds())
+}
+
+func (l *Lock) release(ctx context.Context) error {
+	return l.client.release(ctx, l.key, l.token)
+}
@@ -0,0 +1,188 @@
+package redislock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestTryLock(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	locker := New(rdb)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "lock", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Fence() != 1 {
+		t.Fatalf("got fence %d, want 1", lock.Fence())
+	}
+	if got, _ := mr.Get("lock"); got != lock.Token() {
+		t.Fatalf("got value %q, want the token %q", got, lock.Token())
+	}
+
+	if _, err := locker.TryLock(ctx, "lock", time.Minute, nil); err != ErrNotObtained {
+		t.Fatalf("got %v, want ErrNotObtained", err)
+	}
+
+	if ttl, err := lock.TTL(ctx); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("got TTL %s, %v", ttl, err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Done():
+	default:
+		t.Fatal("Done is not closed after Release")
+	}
+	if err := lock.Release(ctx); err != ErrLockNotHeld {
+		t.Fatalf("got %v, want ErrLockNotHeld", err)
+	}
+
+	// The fencing token increases for every new holder.
+	lock, err = locker.TryLock(ctx, "lock", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Fence() != 2 {
+		t.Fatalf("got fence %d, want 2", lock.Fence())
+	}
+}
+
+func TestExpiredLock(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	locker := New(rdb)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "lock", time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+
+	other, err := locker.TryLock(ctx, "lock", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Extend(ctx, time.Minute); err != ErrLockNotHeld {
+		t.Fatalf("got %v, want ErrLockNotHeld", err)
+	}
+	if _, err := lock.TTL(ctx); err != ErrLockNotHeld {
+		t.Fatalf("got %v, want ErrLockNotHeld", err)
+	}
+	if err := lock.Release(ctx); err != ErrLockNotHeld {
+		t.Fatalf("got %v, want ErrLockNotHeld", err)
+	}
+	if err := other.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockWaits(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	locker := New(rdb)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "lock", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = lock.Release(ctx)
+	}()
+
+	opt := &Options{RetryBackoff: 10 * time.Millisecond}
+	if _, err := locker.Lock(ctx, "lock", time.Minute, opt); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "lock", time.Minute, opt); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestAutoExtend(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	locker := New(rdb)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "lock", 300*time.Millisecond, &Options{AutoExtend: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The watchdog extends the lock every 100ms.
+	time.Sleep(150 * time.Millisecond)
+	if ttl := mr.TTL("lock"); ttl <= 200*time.Millisecond {
+		t.Fatalf("got TTL %s, want the extended TTL", ttl)
+	}
+
+	// The lock is lost when it is taken over.
+	mr.Set("lock", "other")
+	select {
+	case <-lock.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done is not closed after the lock is lost")
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	rdb1, _ := newTestClient(t)
+	rdb2, _ := newTestClient(t)
+	rdb3, mr3 := newTestClient(t)
+	locker := NewRedlock(rdb1, rdb2, rdb3)
+	ctx := context.Background()
+
+	// The lock is acquired on the majority of the nodes.
+	mr3.Close()
+	lock, err := locker.TryLock(ctx, "lock", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Extend(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock held on one node is released.
+	if _, err := rdb2.Del(ctx, "lock").Result(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb2.Set(ctx, "lock", "other", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.TryLock(ctx, "lock", time.Minute, nil); err != ErrNotObtained {
+		t.Fatalf("got %v, want ErrNotObtained", err)
+	}
+	if got := rdb1.Get(ctx, "lock").Val(); got != lock.Token() {
+		t.Fatalf("the lock of the holder is released: %q", got)
+	}
+}
+
+func TestFenceKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"lock":        "{lock}:fence",
+		"{user}:lock": "{user}:lock:fence",
+		"{}lock":      "{{}lock}:fence",
+	} {
+		if got := fenceKey(key); got != want {
+			t.Fatalf("fenceKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Package redismsgpack provides a redis.Codec that encodes the values with
+// MessagePack, e.g.
+//
+//	rdb := redis.NewClient(&redis.Options{
+//		Codec: redismsgpack.Codec,
+//	})
+//
+// The codec is used for the values of the types that are not supported
+// natively, e.g. structs and maps, including the values of the struct fields
+// written with HSetStruct and scanned with redis.HGetAllScan.
+package redismsgpack
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/farss/redis/v8"
+)
+
+// Codec encodes the values with msgpack.Marshal and decodes them with
+// msgpack.Unmarshal.
+var Codec redis.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (codec) Unmarshal(b []byte, v interface{}) error {
+	return msgpack.Unmarshal(b, v)
+}
@@ -0,0 +1,27 @@
+package redismsgpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	type item struct {
+		Name string
+		Tags []string
+	}
+
+	in := item{Name: "a", Tags: []string{"x", "y"}}
+	b, err := Codec.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out item
+	if err := Codec.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
@@ -2,6 +2,9 @@ package redisotel
 
 import (
 	"context"
+	"net"
+	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -14,9 +17,12 @@ const (
 	defaultTracerName = "github.com/go-redis/redis/extra/redisotel"
 )
 
+// TracingHook is a redis.Hook that creates a span for every command and
+// pipeline.
 type TracingHook struct {
 	tracer trace.Tracer
 	attrs  []attribute.KeyValue
+	redact bool
 }
 
 func NewTracingHook(opts ...Option) *TracingHook {
@@ -34,7 +40,58 @@ func NewTracingHook(opts ...Option) *TracingHook {
 		defaultTracerName,
 		trace.WithInstrumentationVersion("semver:"+redis.Version()),
 	)
-	return &TracingHook{tracer: tracer, attrs: cfg.attrs}
+	return &TracingHook{tracer: tracer, attrs: cfg.attrs, redact: cfg.redact}
+}
+
+// InstrumentTracing adds a TracingHook to the client. With Client the
+// spans also have the peer address and the database index. With
+// ClusterClient every node additionally gets a TracingHook, so the spans of
+// the commands have child spans with the address of the node that executed
+// them; it must be called before the first command.
+func InstrumentTracing(rdb redis.UniversalClient, opts ...Option) {
+	switch rdb := rdb.(type) {
+	case *redis.Client:
+		rdb.AddHook(NewTracingHook(clientOptions(rdb, opts)...))
+	case *redis.ClusterClient:
+		rdb.AddHook(NewTracingHook(opts...))
+		rdb.OnNewNode(func(node *redis.Client) {
+			node.AddHook(NewTracingHook(clientOptions(node, opts)...))
+		})
+	default:
+		rdb.AddHook(NewTracingHook(opts...))
+	}
+}
+
+func clientOptions(rdb *redis.Client, opts []Option) []Option {
+	opt := rdb.Options()
+	attrs := peerAttrs(opt.Network, opt.Addr)
+	attrs = append(attrs, semconv.DBRedisDBIndexKey.Int(opt.DB))
+
+	// Copy opts, so the nodes don't share the backing array.
+	return append(opts[:len(opts):len(opts)], WithAttributes(attrs...))
+}
+
+func peerAttrs(network, addr string) []attribute.KeyValue {
+	if network == "unix" {
+		return []attribute.KeyValue{
+			semconv.NetTransportUnix,
+			semconv.NetPeerNameKey.String(addr),
+		}
+	}
+
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []attribute.KeyValue{semconv.NetPeerNameKey.String(addr)}
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.NetTransportTCP,
+		semconv.NetPeerNameKey.String(host),
+	}
+	if port, err := strconv.Atoi(portString); err == nil {
+		attrs = append(attrs, semconv.NetPeerPortKey.Int(port))
+	}
+	return attrs
 }
 
 func (th *TracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
@@ -46,7 +103,7 @@ func (th *TracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (cont
 		trace.WithSpanKind(trace.SpanKindClient),
 		trace.WithAttributes(th.attrs...),
 		trace.WithAttributes(
-			semconv.DBStatementKey.String(rediscmd.CmdString(cmd)),
+			semconv.DBStatementKey.String(th.cmdString(cmd)),
 		),
 	}
 
@@ -69,7 +126,7 @@ func (th *TracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.C
 		return ctx, nil
 	}
 
-	summary, cmdsString := rediscmd.CmdsString(cmds)
+	summary, cmdsString := th.cmdsString(cmds)
 
 	opts := []trace.SpanStartOption{
 		trace.WithSpanKind(trace.SpanKindClient),
@@ -87,13 +144,77 @@ func (th *TracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.C
 
 func (th *TracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
 	span := trace.SpanFromContext(ctx)
-	if err := cmds[0].Err(); err != nil {
-		recordError(ctx, span, err)
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			recordError(ctx, span, err)
+			break
+		}
 	}
 	span.End()
 	return nil
 }
 
+func (th *TracingHook) cmdString(cmd redis.Cmder) string {
+	if th.redact {
+		return redactedCmdString(cmd)
+	}
+	return rediscmd.CmdString(cmd)
+}
+
+func (th *TracingHook) cmdsString(cmds []redis.Cmder) (string, string) {
+	if !th.redact {
+		return rediscmd.CmdsString(cmds)
+	}
+
+	const numCmdLimit = 100
+	const numNameLimit = 10
+
+	seen := make(map[string]struct{}, numNameLimit)
+	unqNames := make([]string, 0, numNameLimit)
+
+	b := make([]byte, 0, 16*len(cmds))
+	for i, cmd := range cmds {
+		if i > numCmdLimit {
+			break
+		}
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = appendRedactedCmd(b, cmd)
+
+		if len(unqNames) >= numNameLimit {
+			continue
+		}
+
+		name := cmd.FullName()
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			unqNames = append(unqNames, name)
+		}
+	}
+
+	return strings.Join(unqNames, " "), string(b)
+}
+
+// redactedCmdString returns the command name followed by a "?" for every
+// argument, so keys and values don't end up in the traces.
+func redactedCmdString(cmd redis.Cmder) string {
+	return string(appendRedactedCmd(make([]byte, 0, 32), cmd))
+}
+
+func appendRedactedCmd(b []byte, cmd redis.Cmder) []byte {
+	const numArgLimit = 32
+
+	name := cmd.FullName()
+	b = append(b, name...)
+
+	numName := strings.Count(name, " ") + 1
+	for i := numName; i < len(cmd.Args()) && i <= numArgLimit; i++ {
+		b = append(b, " ?"...)
+	}
+	return b
+}
+
 func recordError(ctx context.Context, span trace.Span, err error) {
 	if err != redis.Nil {
 		span.RecordError(err)
@@ -102,8 +223,9 @@ func recordError(ctx context.Context, span trace.Span, err error) {
 }
 
 type config struct {
-	tp    trace.TracerProvider
-	attrs []attribute.KeyValue
+	tp     trace.TracerProvider
+	attrs  []attribute.KeyValue
+	redact bool
 }
 
 // Option specifies instrumentation configuration options.
@@ -133,3 +255,11 @@ func WithAttributes(attrs ...attribute.KeyValue) Option {
 		cfg.attrs = append(cfg.attrs, attrs...)
 	})
 }
+
+// WithRedactedStatement specifies whether the arguments of the commands are
+// replaced with "?" in the db.statement attribute. It is disabled by default.
+func WithRedactedStatement(on bool) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.redact = on
+	})
+}
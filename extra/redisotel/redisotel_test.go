@@ -2,10 +2,12 @@ package redisotel_test
 
 import (
 	"context"
+	"errors"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"testing"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -64,3 +66,81 @@ func TestNewWithAttributes(t *testing.T) {
 		t.Fatalf("expected attrs[2] to be semconv.DBStatementKey.String(\"ping\"), got: %v", attrs[2])
 	}
 }
+
+func TestRedactedStatement(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("redis-test").Start(context.TODO(), "redis-test")
+	defer span.End()
+
+	tests := []struct {
+		redact bool
+		want   string
+	}{
+		{true, "set ? ?"},
+		{false, "set key value"},
+	}
+	for _, test := range tests {
+		hook := redisotel.NewTracingHook(
+			redisotel.WithTracerProvider(provider),
+			redisotel.WithRedactedStatement(test.redact),
+		)
+		cmd := redis.NewStatusCmd(ctx, "set", "key", "value")
+
+		ctx, err := hook.BeforeProcess(ctx, cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := statement(trace.SpanFromContext(ctx).(sdktrace.ReadOnlySpan))
+		if !ok || got != test.want {
+			t.Fatalf("expected %q, got: %q", test.want, got)
+		}
+		if err := hook.AfterProcess(ctx, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPipelineErrorStatus(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	hook := redisotel.NewTracingHook(
+		redisotel.WithTracerProvider(provider),
+		redisotel.WithRedactedStatement(true),
+	)
+	ctx, span := provider.Tracer("redis-test").Start(context.TODO(), "redis-test")
+	defer span.End()
+
+	get := redis.NewStringCmd(ctx, "get", "key")
+	get.SetErr(redis.Nil)
+	incr := redis.NewIntCmd(ctx, "incr", "key")
+	incr.SetErr(errors.New("ERR value is not an integer or out of range"))
+	cmds := []redis.Cmder{get, incr}
+
+	ctx, err := hook.BeforeProcessPipeline(ctx, cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.AfterProcessPipeline(ctx, cmds); err != nil {
+		t.Fatal(err)
+	}
+
+	s := trace.SpanFromContext(ctx).(sdktrace.ReadOnlySpan)
+	if s.Name() != "pipeline get incr" {
+		t.Fatalf("expected pipeline get incr, got: %s", s.Name())
+	}
+	if got, _ := statement(s); got != "get ?\nincr ?" {
+		t.Fatalf("expected redacted statement, got: %q", got)
+	}
+	if s.Status().Code != codes.Error {
+		t.Fatalf("expected error status, got: %v", s.Status())
+	}
+}
+
+func statement(s sdktrace.ReadOnlySpan) (string, bool) {
+	for _, attr := range s.Attributes() {
+		if attr.Key == semconv.DBStatementKey {
+			return attr.Value.AsString(), true
+		}
+	}
+	return "", false
+}
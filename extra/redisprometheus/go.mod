@@ -0,0 +1,10 @@
+module github.com/go-redis/redis/extra/redisprometheus/v8
+
+go 1.15
+
+replace github.com/farss/redis/v8 => ../..
+
+require (
+	github.com/farss/redis/v8 v8.11.5
+	github.com/prometheus/client_golang v1.12.2
+)
@@ -0,0 +1,248 @@
+package redisprometheus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options are used to configure a Collector.
+type Options struct {
+	// Namespace and Subsystem are prepended to the metric names.
+	// Default namespace is "redis".
+	Namespace string
+	Subsystem string
+	// Buckets of the command duration histograms in seconds.
+	// Default is from 100 microseconds to ~3 seconds.
+	Buckets []float64
+	// ConstLabels are added to all the metrics.
+	ConstLabels prometheus.Labels
+}
+
+func (opt *Options) init() {
+	if opt.Namespace == "" {
+		opt.Namespace = "redis"
+	}
+	if opt.Buckets == nil {
+		opt.Buckets = prometheus.ExponentialBuckets(0.0001, 2, 15)
+	}
+}
+
+// Collector is a prometheus.Collector that exports command and connection
+// pool metrics of the instrumented clients. Every client is identified by
+// the "client" label.
+type Collector struct {
+	commands *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	node     *prometheus.HistogramVec
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+
+	mu      sync.RWMutex
+	clients map[string]redis.UniversalClient
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector. opt can be nil to use the default
+// options.
+func NewCollector(opt *Options) *Collector {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	o.init()
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(o.Namespace, o.Subsystem, name),
+			help, []string{"client"}, o.ConstLabels,
+		)
+	}
+
+	return &Collector{
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.Namespace,
+			Subsystem:   o.Subsystem,
+			Name:        "commands_total",
+			Help:        "Number of processed commands.",
+			ConstLabels: o.ConstLabels,
+		}, []string{"client", "command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.Namespace,
+			Subsystem:   o.Subsystem,
+			Name:        "errors_total",
+			Help:        "Number of failed commands by the error type.",
+			ConstLabels: o.ConstLabels,
+		}, []string{"client", "command", "type"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.Namespace,
+			Subsystem:   o.Subsystem,
+			Name:        "command_duration_seconds",
+			Help:        "Duration of commands and pipelines.",
+			Buckets:     o.Buckets,
+			ConstLabels: o.ConstLabels,
+		}, []string{"client", "command"}),
+		node: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.Namespace,
+			Subsystem:   o.Subsystem,
+			Name:        "node_duration_seconds",
+			Help:        "Duration of commands and pipelines processed by ClusterClient and Ring nodes.",
+			Buckets:     o.Buckets,
+			ConstLabels: o.ConstLabels,
+		}, []string{"client", "node", "role", "status"}),
+
+		hits:       desc("pool_hits_total", "Number of times a free connection was found in the pool."),
+		misses:     desc("pool_misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts:   desc("pool_timeouts_total", "Number of times a wait for a connection timed out."),
+		totalConns: desc("pool_conns", "Number of connections in the pool."),
+		idleConns:  desc("pool_idle_conns", "Number of idle connections in the pool."),
+		staleConns: desc("pool_stale_conns_total", "Number of stale connections removed from the pool."),
+
+		clients: make(map[string]redis.UniversalClient),
+	}
+}
+
+// Instrument adds a hook that records the command metrics of the client
+// and exports the pool metrics of the client. The name is used as the
+// "client" label and must be unique.
+func (c *Collector) Instrument(name string, rdb redis.UniversalClient) {
+	c.mu.Lock()
+	c.clients[name] = rdb
+	c.mu.Unlock()
+
+	rdb.AddHook(&hook{c: c, client: name})
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.commands.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+	c.node.Describe(ch)
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.commands.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+	c.node.Collect(ch)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, rdb := range c.clients {
+		stats := rdb.PoolStats()
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts), name)
+		ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns), name)
+		ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns), name)
+		ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns), name)
+	}
+}
+
+func (c *Collector) record(client string, cmd redis.Cmder) {
+	name := cmd.FullName()
+	c.commands.WithLabelValues(client, name).Inc()
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		c.errors.WithLabelValues(client, name, errorType(err)).Inc()
+	}
+}
+
+// errorType returns the error prefix, e.g. "ERR" or "MOVED", for Redis
+// errors or a short description of the other errors.
+func errorType(err error) string {
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		s := redisErr.Error()
+		if i := strings.IndexByte(s, ' '); i > 0 {
+			return s[:i]
+		}
+		return s
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, redis.ErrClosed):
+		return "closed"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	return "other"
+}
+
+//------------------------------------------------------------------------------
+
+type startKey struct{}
+
+type hook struct {
+	c      *Collector
+	client string
+}
+
+var (
+	_ redis.Hook     = (*hook)(nil)
+	_ redis.NodeHook = (*hook)(nil)
+)
+
+func (h *hook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h *hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		h.c.duration.WithLabelValues(h.client, cmd.FullName()).Observe(time.Since(start).Seconds())
+	}
+	h.c.record(h.client, cmd)
+	return nil
+}
+
+func (h *hook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h *hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		h.c.duration.WithLabelValues(h.client, "pipeline").Observe(time.Since(start).Seconds())
+	}
+	for _, cmd := range cmds {
+		h.c.record(h.client, cmd)
+	}
+	return nil
+}
+
+func (h *hook) AfterProcessNode(ctx context.Context, event *redis.NodeEvent) {
+	status := "ok"
+	if event.Err != nil && event.Err != redis.Nil {
+		status = "error"
+	}
+	h.c.node.WithLabelValues(h.client, event.Addr, event.Role, status).Observe(event.Duration.Seconds())
+}
@@ -0,0 +1,67 @@
+package redisprometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/farss/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{redis.ErrClosed, "closed"},
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "timeout"},
+		{errors.New("oops"), "other"},
+	}
+	for _, test := range tests {
+		if got := errorType(test.err); got != test.want {
+			t.Errorf("errorType(%q) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(nil)
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:1"})
+	defer rdb.Close()
+	c.Instrument("test", rdb)
+
+	ctx := context.Background()
+	h := &hook{c: c, client: "test"}
+
+	get := redis.NewStringCmd(ctx, "get", "key")
+	get.SetErr(redis.Nil)
+	ctx, _ = h.BeforeProcess(ctx, get)
+	_ = h.AfterProcess(ctx, get)
+
+	incr := redis.NewIntCmd(ctx, "incr", "key")
+	incr.SetErr(context.DeadlineExceeded)
+	cmds := []redis.Cmder{get, incr}
+	ctx, _ = h.BeforeProcessPipeline(ctx, cmds)
+	_ = h.AfterProcessPipeline(ctx, cmds)
+
+	if got := testutil.ToFloat64(c.commands.WithLabelValues("test", "get")); got != 2 {
+		t.Errorf("got %v get commands, want 2", got)
+	}
+	if got := testutil.ToFloat64(c.errors.WithLabelValues("test", "incr", "timeout")); got != 1 {
+		t.Errorf("got %v incr errors, want 1", got)
+	}
+	if got := testutil.CollectAndCount(c.errors); got != 1 {
+		t.Errorf("got %v error series, want 1", got)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+// Package redisproto provides a redis.Codec that encodes proto.Message
+// values with the protobuf wire format, e.g.
+//
+//	rdb := redis.NewClient(&redis.Options{
+//		Codec: redisproto.Codec,
+//	})
+//
+//	err := rdb.Set(ctx, "user:1", user, 0).Err()
+//
+//	user := new(pb.User)
+//	err := rdb.Get(ctx, "user:1").Scan(user)
+package redisproto
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/farss/redis/v8"
+)
+
+// Codec encodes proto.Message values with proto.Marshal and decodes them
+// with proto.Unmarshal. The values of other types are an error.
+//
+// Get of a missing key returns redis.Nil and leaves the message unchanged.
+// Nil messages are encoded as empty values, which are decoded as empty
+// messages.
+var Codec redis.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("redisproto: can't marshal %T (not a proto.Message)", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (codec) Unmarshal(b []byte, v interface{}) error {
+	msg, err := message(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, msg)
+}
+
+// message returns v if it is a message or allocates the message if v is
+// a pointer to a nil message pointer, e.g. **pb.User.
+func message(v interface{}) (proto.Message, error) {
+	if msg, ok := v.(proto.Message); ok {
+		if reflect.ValueOf(msg).IsNil() {
+			return nil, fmt.Errorf("redisproto: can't unmarshal into nil %T", v)
+		}
+		return msg, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		elem := rv.Elem()
+		if _, ok := reflect.Zero(elem.Type()).Interface().(proto.Message); ok {
+			if elem.IsNil() {
+				elem.Set(reflect.New(elem.Type().Elem()))
+			}
+			return elem.Interface().(proto.Message), nil
+		}
+	}
+	return nil, fmt.Errorf("redisproto: can't unmarshal into %T (not a proto.Message)", v)
+}
@@ -0,0 +1,70 @@
+package redisproto
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/farss/redis/v8"
+)
+
+func TestCodec(t *testing.T) {
+	b, err := Codec.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := new(wrapperspb.StringValue)
+	if err := Codec.Unmarshal(b, msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Value != "hello" {
+		t.Fatalf("got %q, want hello", msg.Value)
+	}
+
+	// Pointers to nil messages are allocated.
+	var ptr *wrapperspb.StringValue
+	if err := Codec.Unmarshal(b, &ptr); err != nil {
+		t.Fatal(err)
+	}
+	if ptr.GetValue() != "hello" {
+		t.Fatalf("got %q, want hello", ptr.GetValue())
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	if _, err := Codec.Marshal(struct{}{}); err == nil {
+		t.Fatal("marshaled a non-message value")
+	}
+
+	var s string
+	if err := Codec.Unmarshal(nil, &s); err == nil {
+		t.Fatal("unmarshaled into a non-message value")
+	}
+	var msg *wrapperspb.StringValue
+	if err := Codec.Unmarshal(nil, msg); err == nil {
+		t.Fatal("unmarshaled into a nil message")
+	}
+}
+
+func TestCodecNil(t *testing.T) {
+	msg := wrapperspb.Int64(1)
+	if err := redis.NewStringResult("", redis.Nil).Scan(msg); err != redis.Nil {
+		t.Fatalf("got %v, want redis.Nil", err)
+	}
+	if msg.Value != 1 {
+		t.Fatal("message is changed on redis.Nil")
+	}
+
+	var ptr *wrapperspb.Int64Value
+	b, err := Codec.Marshal(ptr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Codec.Unmarshal(b, &ptr); err != nil {
+		t.Fatal(err)
+	}
+	if ptr == nil || ptr.Value != 0 {
+		t.Fatalf("got %v, want an empty message", ptr)
+	}
+}
@@ -0,0 +1,328 @@
+package redisqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// The delayed jobs are the members of the KEYS[1] sorted set scored by the
+// time they are due, and the jobs in flight of the KEYS[2] sorted set scored
+// by the end of their visibility timeout. The failed jobs are moved to the
+// KEYS[5] sorted set scored by the time they failed. The payloads and the
+// attempts are stored in the KEYS[3] and KEYS[4] hashes. The jobs in flight
+// have the token of their delivery in the KEYS[6] hash, so only the consumer
+// the job was delivered to last can acknowledge it. The times are in
+// milliseconds.
+
+var (
+	scheduleScript = redis.NewScript(`
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+redis.call("HSET", KEYS[3], ARGV[1], ARGV[2])
+return 1
+`)
+	popDueScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local n = tonumber(ARGV[2])
+local visibility = tonumber(ARGV[3])
+local max_attempts = tonumber(ARGV[4])
+local token = ARGV[5]
+
+-- Deliver again the jobs whose visibility timeout expired.
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", now)
+for _, id in ipairs(expired) do
+	redis.call("ZREM", KEYS[2], id)
+	redis.call("HDEL", KEYS[6], id)
+	if tonumber(redis.call("HGET", KEYS[4], id) or 0) >= max_attempts then
+		redis.call("ZADD", KEYS[5], now, id)
+	else
+		redis.call("ZADD", KEYS[1], now, id)
+	end
+end
+
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", now, "WITHSCORES", "LIMIT", 0, n)
+local jobs = {}
+for i = 1, #due, 2 do
+	local id = due[i]
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("ZADD", KEYS[2], now + visibility, id)
+	redis.call("HSET", KEYS[6], id, token)
+	local attempts = redis.call("HINCRBY", KEYS[4], id, 1)
+	table.insert(jobs, id)
+	table.insert(jobs, redis.call("HGET", KEYS[3], id) or "")
+	table.insert(jobs, due[i + 1])
+	table.insert(jobs, attempts)
+end
+return jobs
+`)
+	ackScript = redis.NewScript(`
+if redis.call("HGET", KEYS[6], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[6], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+redis.call("HDEL", KEYS[4], ARGV[1])
+return 1
+`)
+	nackScript = redis.NewScript(`
+if redis.call("HGET", KEYS[6], ARGV[1]) ~= ARGV[5] then
+	return 0
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[6], ARGV[1])
+if tonumber(redis.call("HGET", KEYS[4], ARGV[1]) or 0) >= tonumber(ARGV[4]) then
+	redis.call("ZADD", KEYS[5], ARGV[2], ARGV[1])
+	return 2
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+	failedScript = redis.NewScript(`
+local failed = redis.call("ZRANGE", KEYS[5], 0, tonumber(ARGV[1]) - 1, "WITHSCORES")
+local jobs = {}
+for i = 1, #failed, 2 do
+	local id = failed[i]
+	table.insert(jobs, id)
+	table.insert(jobs, redis.call("HGET", KEYS[3], id) or "")
+	table.insert(jobs, failed[i + 1])
+	table.insert(jobs, tonumber(redis.call("HGET", KEYS[4], id) or 0))
+end
+return jobs
+`)
+	retryScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[5], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[4], ARGV[1])
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+	cancelScript = redis.NewScript(`
+local n = 0
+for _, i in ipairs({1, 2, 5}) do
+	n = n + redis.call("ZREM", KEYS[i], ARGV[1])
+end
+redis.call("HDEL", KEYS[3], ARGV[1])
+redis.call("HDEL", KEYS[4], ARGV[1])
+redis.call("HDEL", KEYS[6], ARGV[1])
+return n
+`)
+)
+
+// DelayedQueueOptions are used to configure a DelayedQueue.
+type DelayedQueueOptions struct {
+	// VisibilityTimeout is how long a delivered job is hidden from the other
+	// consumers. The job is delivered again unless it is acknowledged in
+	// time.
+	// Default is 30 seconds.
+	VisibilityTimeout time.Duration
+
+	// Maximum number of times a job is retried before it is moved to the
+	// failed jobs.
+	// Default is 3 retries; -1 (not 0) disables retries.
+	MaxRetries int
+	// Minimum backoff before the first retry. It doubles with every retry.
+	// Default is 1 second; -1 disables backoff.
+	MinRetryBackoff time.Duration
+	// Maximum backoff between each retry.
+	// Default is 10 minutes.
+	MaxRetryBackoff time.Duration
+
+	// BatchSize is the maximum number of jobs delivered by Run at once.
+	// Default is 10.
+	BatchSize int
+	// PollInterval is how often Run checks for due jobs when there are none.
+	// Default is 1 second.
+	PollInterval time.Duration
+
+	// Logger logs the errors of Run.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *DelayedQueueOptions) init() {
+	if opt.VisibilityTimeout == 0 {
+		opt.VisibilityTimeout = 30 * time.Second
+	}
+	switch opt.MaxRetries {
+	case -1:
+		opt.MaxRetries = 0
+	case 0:
+		opt.MaxRetries = 3
+	}
+	if opt.MinRetryBackoff == 0 {
+		opt.MinRetryBackoff = time.Second
+	}
+	if opt.MaxRetryBackoff == 0 {
+		opt.MaxRetryBackoff = 10 * time.Minute
+	}
+	if opt.BatchSize == 0 {
+		opt.BatchSize = 10
+	}
+	if opt.PollInterval == 0 {
+		opt.PollInterval = time.Second
+	}
+}
+
+// DelayedQueue is a queue of jobs that are due at a given time. It's safe
+// for concurrent use by multiple goroutines.
+type DelayedQueue struct {
+	client redis.Scripter
+	opt    DelayedQueueOptions
+	keys   []string
+}
+
+// NewDelayedQueue returns a DelayedQueue. The jobs are stored in the keys
+// with the name and the ":delayed", ":inflight", ":payloads", ":attempts",
+// ":failed" and ":tokens" suffixes, which are in the same hash slot. opt can
+// be nil to use the default options.
+func NewDelayedQueue(client redis.Scripter, name string, opt *DelayedQueueOptions) *DelayedQueue {
+	q := &DelayedQueue{client: client}
+	if opt != nil {
+		q.opt = *opt
+	}
+	q.opt.init()
+
+	tag := hashTag(name)
+	q.keys = []string{
+		tag + ":delayed",
+		tag + ":inflight",
+		tag + ":payloads",
+		tag + ":attempts",
+		tag + ":failed",
+		tag + ":tokens",
+	}
+	return q
+}
+
+// Schedule adds a job that is due at runAt and returns its ID.
+func (q *DelayedQueue) Schedule(ctx context.Context, payload string, runAt time.Time) (string, error) {
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	err = scheduleScript.Run(ctx, q.client, q.keys, id, payload, runAt.UnixMilli()).Err()
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Cancel deletes the job, whether it is delayed, in flight or failed.
+// It returns ErrJobNotFound if there is no such job.
+func (q *DelayedQueue) Cancel(ctx context.Context, id string) error {
+	n, err := cancelScript.Run(ctx, q.client, q.keys, id).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// PopDue delivers at most n due jobs. The jobs are hidden from the other
+// consumers for the visibility timeout and must be acknowledged with Ack or
+// retried with Nack. The jobs whose visibility timeout expired are delivered
+// again, or moved to the failed jobs when they have no retries left.
+func (q *DelayedQueue) PopDue(ctx context.Context, n int) ([]*Job, error) {
+	// The jobs are delivered once by the script, so they can share the token.
+	token, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	vals, err := popDueScript.Run(ctx, q.client, q.keys,
+		time.Now().UnixMilli(), n, q.opt.VisibilityTimeout.Milliseconds(), q.opt.MaxRetries+1, token,
+	).Slice()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := parseJobs(vals)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		job.token = token
+	}
+	return jobs, nil
+}
+
+// Ack acknowledges that the job is done and deletes it. It returns
+// ErrJobNotFound if the job is not in flight, e.g. because it was delivered
+// again.
+func (q *DelayedQueue) Ack(ctx context.Context, job *Job) error {
+	n, err := ackScript.Run(ctx, q.client, q.keys, job.ID, job.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Nack schedules the retry of the failed job after the backoff or moves it
+// to the failed jobs when it has no retries left. It returns ErrJobNotFound
+// if the job is not in flight, e.g. because it was delivered again.
+func (q *DelayedQueue) Nack(ctx context.Context, job *Job) error {
+	now := time.Now()
+	retryAt := now.Add(backoff(job.Attempts, q.opt.MinRetryBackoff, q.opt.MaxRetryBackoff))
+	n, err := nackScript.Run(ctx, q.client, q.keys,
+		job.ID, now.UnixMilli(), retryAt.UnixMilli(), q.opt.MaxRetries+1, job.token,
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Failed returns at most n of the oldest jobs that have no retries left.
+// Their RunAt is the time they failed. They are kept until they are deleted
+// with Cancel or retried with Retry.
+func (q *DelayedQueue) Failed(ctx context.Context, n int) ([]*Job, error) {
+	vals, err := failedScript.Run(ctx, q.client, q.keys, n).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseJobs(vals)
+}
+
+// Retry schedules the failed job now with its attempts reset. It returns
+// ErrJobNotFound if the job is not failed.
+func (q *DelayedQueue) Retry(ctx context.Context, id string) error {
+	n, err := retryScript.Run(ctx, q.client, q.keys, id, time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Run delivers the due jobs to the handler until the context is done. The
+// jobs are acknowledged when the handler returns nil and retried otherwise.
+func (q *DelayedQueue) Run(ctx context.Context, handler Handler) error {
+	return run(ctx, q.opt.PollInterval, q.opt.Logger, func(ctx context.Context) (int, error) {
+		jobs, err := q.PopDue(ctx, q.opt.BatchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, job := range jobs {
+			if err := handler(ctx, job); err != nil {
+				err = q.Nack(ctx, job)
+			} else {
+				err = q.Ack(ctx, job)
+			}
+			if err != nil && err != ErrJobNotFound {
+				return len(jobs), err
+			}
+		}
+		return len(jobs), nil
+	})
+}
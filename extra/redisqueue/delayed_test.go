@@ -0,0 +1,230 @@
+package redisqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestDelayedQueue(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	q := NewDelayedQueue(rdb, "jobs", nil)
+	ctx := context.Background()
+
+	runAt := time.Now().Add(-time.Second).Truncate(time.Millisecond)
+	id, err := q.Schedule(ctx, "due", runAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Schedule(ctx, "later", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := q.PopDue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d jobs, want 1", len(jobs))
+	}
+	job := jobs[0]
+	if job.ID != id || job.Payload != "due" || job.Attempts != 1 || !job.RunAt.Equal(runAt) {
+		t.Fatalf("got %+v", job)
+	}
+
+	// The job in flight is not delivered again.
+	if jobs, err := q.PopDue(ctx, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+
+	if err := q.Ack(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(ctx, job); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+	if got, _ := mr.HKeys("{jobs}:payloads"); len(got) != 1 {
+		t.Fatalf("got payloads %v, want only the later job", got)
+	}
+}
+
+func TestDelayedQueueRetry(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	q := NewDelayedQueue(rdb, "jobs", &DelayedQueueOptions{
+		MaxRetries:      1,
+		MinRetryBackoff: -1,
+	})
+	ctx := context.Background()
+
+	id, err := q.Schedule(ctx, "job", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		jobs, err := q.PopDue(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 || jobs[0].Attempts != attempt {
+			t.Fatalf("got %+v at attempt %d", jobs, attempt)
+		}
+		if err := q.Nack(ctx, jobs[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The job has no retries left.
+	if jobs, err := q.PopDue(ctx, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+	failed, err := q.Failed(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].ID != id || failed[0].Payload != "job" || failed[0].Attempts != 2 {
+		t.Fatalf("got failed %+v", failed)
+	}
+
+	if err := q.Retry(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := q.PopDue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 1 {
+		t.Fatalf("got %+v after Retry", jobs)
+	}
+
+	if err := q.Cancel(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Cancel(ctx, id); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestDelayedQueueVisibilityTimeout(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	q := NewDelayedQueue(rdb, "jobs", &DelayedQueueOptions{
+		VisibilityTimeout: 10 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	if _, err := q.Schedule(ctx, "job", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := q.PopDue(ctx, 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+
+	// The job is delivered again after the visibility timeout.
+	time.Sleep(20 * time.Millisecond)
+	redelivered, err := q.PopDue(ctx, 10)
+	if err != nil || len(redelivered) != 1 || redelivered[0].Attempts != 2 {
+		t.Fatalf("got %v, %v", redelivered, err)
+	}
+	// Only the last delivery can be acknowledged.
+	if err := q.Ack(ctx, jobs[0]); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+	if err := q.Nack(ctx, jobs[0]); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+	if err := q.Ack(ctx, redelivered[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without retries the expired job fails.
+	q = NewDelayedQueue(rdb, "jobs", &DelayedQueueOptions{
+		VisibilityTimeout: 10 * time.Millisecond,
+		MaxRetries:        -1,
+	})
+	if _, err := q.Schedule(ctx, "job", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := q.PopDue(ctx, 10); err != nil || len(jobs) != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if jobs, err := q.PopDue(ctx, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+	if failed, err := q.Failed(ctx, 10); err != nil || len(failed) != 1 {
+		t.Fatalf("got failed %v, %v", failed, err)
+	}
+}
+
+func TestDelayedQueueRun(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	q := NewDelayedQueue(rdb, "jobs", &DelayedQueueOptions{
+		PollInterval:    10 * time.Millisecond,
+		MinRetryBackoff: -1,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, payload := range []string{"a", "b"} {
+		if _, err := q.Schedule(ctx, payload, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan string, 10)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- q.Run(ctx, func(ctx context.Context, job *Job) error {
+			if job.Payload == "b" && job.Attempts == 1 {
+				return errors.New("failed")
+			}
+			done <- job.Payload
+			return nil
+		})
+	}()
+
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case payload := <-done:
+			got[payload] = true
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want a and b", got)
+		}
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, time.Minute},
+	} {
+		if got := backoff(test.attempts, time.Second, time.Minute); got != test.want {
+			t.Fatalf("backoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package redisqueue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// The jobs of a Queue are the IDs in the KEYS[1] list. They are moved with
+// LMOVE to the KEYS[7] processing list of the consumer and added to the
+// KEYS[2] sorted set scored by the end of their visibility timeout, with the
+// consumer in the KEYS[6] hash. KEYS[3], KEYS[4] and KEYS[5] are the same as
+// in a DelayedQueue. ARGV[1] is the prefix of the processing lists.
+//
+// Dequeue removes the expired jobs from the processing lists of their
+// consumers, so the lists are declared in KEYS[8] onwards, with the
+// consumers in ARGV[7] onwards. The lists can't be known before the script
+// runs, so it returns the consumers that are not declared instead, and
+// Dequeue runs it again with their lists.
+
+var (
+	enqueueScript = redis.NewScript(`
+for i = 2, #ARGV, 2 do
+	redis.call("HSET", KEYS[3], ARGV[i], ARGV[i + 1])
+	redis.call("LPUSH", KEYS[1], ARGV[i])
+end
+return 1
+`)
+	dequeueScript = redis.NewScript(`
+local consumer = ARGV[2]
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local visibility = tonumber(ARGV[5])
+local max_attempts = tonumber(ARGV[6])
+
+local lists = {}
+for i = 7, #ARGV do
+	lists[ARGV[i]] = KEYS[i + 1]
+end
+
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", now)
+local missing, seen = {}, {}
+for _, id in ipairs(expired) do
+	local owner = redis.call("HGET", KEYS[6], id)
+	if owner and not lists[owner] and not seen[owner] then
+		seen[owner] = true
+		table.insert(missing, owner)
+	end
+end
+if #missing > 0 then
+	return {{}, missing}
+end
+
+-- Deliver again the jobs whose visibility timeout expired. They are pushed
+-- to the head of the queue.
+for _, id in ipairs(expired) do
+	redis.call("ZREM", KEYS[2], id)
+	local owner = redis.call("HGET", KEYS[6], id)
+	if owner then
+		redis.call("HDEL", KEYS[6], id)
+		redis.call("LREM", lists[owner], 1, id)
+	end
+	if tonumber(redis.call("HGET", KEYS[4], id) or 0) >= max_attempts then
+		redis.call("ZADD", KEYS[5], now, id)
+	else
+		redis.call("RPUSH", KEYS[1], id)
+	end
+end
+
+local jobs = {}
+for i = 1, n do
+	local id = redis.call("LMOVE", KEYS[1], KEYS[7], "RIGHT", "LEFT")
+	if not id then
+		break
+	end
+	redis.call("ZADD", KEYS[2], now + visibility, id)
+	redis.call("HSET", KEYS[6], id, consumer)
+	local attempts = redis.call("HINCRBY", KEYS[4], id, 1)
+	table.insert(jobs, id)
+	table.insert(jobs, redis.call("HGET", KEYS[3], id) or "")
+	table.insert(jobs, "")
+	table.insert(jobs, attempts)
+end
+return {jobs, {}}
+`)
+	// settleScript acknowledges the job if ARGV[4] is "ack" or otherwise
+	// pushes it to the tail of the queue or to the failed jobs.
+	settleScript = redis.NewScript(`
+local id = ARGV[2]
+if redis.call("HGET", KEYS[6], id) ~= ARGV[3] then
+	return 0
+end
+redis.call("ZREM", KEYS[2], id)
+redis.call("HDEL", KEYS[6], id)
+redis.call("LREM", KEYS[7], 1, id)
+
+if ARGV[4] == "ack" then
+	redis.call("HDEL", KEYS[3], id)
+	redis.call("HDEL", KEYS[4], id)
+	return 1
+end
+if tonumber(redis.call("HGET", KEYS[4], id) or 0) >= tonumber(ARGV[6]) then
+	redis.call("ZADD", KEYS[5], ARGV[5], id)
+	return 2
+end
+redis.call("LPUSH", KEYS[1], id)
+return 1
+`)
+	extendScript = redis.NewScript(`
+if redis.call("HGET", KEYS[6], ARGV[2]) ~= ARGV[3] then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[2])
+return 1
+`)
+	recoverScript = redis.NewScript(`
+local n = 0
+while true do
+	local id = redis.call("LPOP", KEYS[7])
+	if not id then
+		break
+	end
+	redis.call("ZREM", KEYS[2], id)
+	redis.call("HDEL", KEYS[6], id)
+	redis.call("RPUSH", KEYS[1], id)
+	n = n + 1
+end
+return n
+`)
+	lenScript     = redis.NewScript(`return redis.call("LLEN", KEYS[1])`)
+	requeueScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[5], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[4], ARGV[2])
+redis.call("LPUSH", KEYS[1], ARGV[2])
+return 1
+`)
+)
+
+// QueueOptions are used to configure a Queue.
+type QueueOptions struct {
+	// Consumer is the name of the consumer. The consumers must have
+	// different names.
+	// Default is <hostname>-<pid>.
+	Consumer string
+
+	// VisibilityTimeout is how long a delivered job is hidden from the other
+	// consumers. The job is delivered again unless it is acknowledged in
+	// time.
+	// Default is 30 seconds.
+	VisibilityTimeout time.Duration
+	// Maximum number of times a job is retried before it is moved to the
+	// failed jobs.
+	// Default is 3 retries; -1 (not 0) disables retries.
+	MaxRetries int
+
+	// BatchSize is the maximum number of jobs delivered by Run at once.
+	// Default is 10.
+	BatchSize int
+	// PollInterval is how often Run checks for jobs when the queue is empty.
+	// Default is 1 second.
+	PollInterval time.Duration
+
+	// Logger logs the errors of Run.
+	// Default is to not log them.
+	Logger redis.Logger
+}
+
+func (opt *QueueOptions) init() {
+	if opt.Consumer == "" {
+		host, _ := os.Hostname()
+		opt.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opt.VisibilityTimeout == 0 {
+		opt.VisibilityTimeout = 30 * time.Second
+	}
+	switch opt.MaxRetries {
+	case -1:
+		opt.MaxRetries = 0
+	case 0:
+		opt.MaxRetries = 3
+	}
+	if opt.BatchSize == 0 {
+		opt.BatchSize = 10
+	}
+	if opt.PollInterval == 0 {
+		opt.PollInterval = time.Second
+	}
+}
+
+// Queue is a FIFO queue of jobs with at-least-once delivery. The delivered
+// jobs are moved to the processing list of the consumer until they are
+// acknowledged. It requires Redis 6.2. It's safe for concurrent use by
+// multiple goroutines.
+type Queue struct {
+	client redis.Scripter
+	opt    QueueOptions
+	tag    string
+	prefix string
+	keys   []string
+}
+
+// NewQueue returns a Queue. The jobs are stored in the keys with the name and
+// the ":pending", ":inflight", ":payloads", ":attempts", ":failed", ":owners"
+// and ":processing:<consumer>" suffixes, which are in the same hash slot.
+// opt can be nil to use the default options.
+func NewQueue(client redis.Scripter, name string, opt *QueueOptions) *Queue {
+	q := &Queue{client: client}
+	if opt != nil {
+		q.opt = *opt
+	}
+	q.opt.init()
+
+	q.tag = hashTag(name)
+	q.prefix = q.tag + ":processing:"
+	q.keys = q.consumerKeys(q.opt.Consumer)
+	return q
+}
+
+func (q *Queue) consumerKeys(consumer string) []string {
+	return []string{
+		q.tag + ":pending",
+		q.tag + ":inflight",
+		q.tag + ":payloads",
+		q.tag + ":attempts",
+		q.tag + ":failed",
+		q.tag + ":owners",
+		q.prefix + consumer,
+	}
+}
+
+// Consumer returns the name of the consumer.
+func (q *Queue) Consumer() string {
+	return q.opt.Consumer
+}
+
+// Enqueue adds the jobs to the tail of the queue and returns their IDs.
+func (q *Queue) Enqueue(ctx context.Context, payloads ...string) ([]string, error) {
+	ids := make([]string, len(payloads))
+	args := make([]interface{}, 0, 1+2*len(payloads))
+	args = append(args, q.prefix)
+	for i, payload := range payloads {
+		id, err := newJobID()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+		args = append(args, id, payload)
+	}
+	if err := enqueueScript.Run(ctx, q.client, q.keys, args...).Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Dequeue delivers at most n jobs from the head of the queue. The jobs are
+// hidden from the other consumers for the visibility timeout and must be
+// acknowledged with Ack or retried with Nack. The jobs whose visibility
+// timeout expired are delivered again, or moved to the failed jobs when they
+// have no retries left.
+func (q *Queue) Dequeue(ctx context.Context, n int) ([]*Job, error) {
+	keys := q.keys
+	var owners []interface{}
+	for {
+		args := []interface{}{
+			q.prefix, q.opt.Consumer, time.Now().UnixMilli(), n,
+			q.opt.VisibilityTimeout.Milliseconds(), q.opt.MaxRetries + 1,
+		}
+		vals, err := dequeueScript.Run(ctx, q.client, keys, append(args, owners...)...).Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) != 2 {
+			return nil, fmt.Errorf("redisqueue: unexpected script reply: %v", vals)
+		}
+
+		missing, _ := vals[1].([]interface{})
+		if len(missing) == 0 {
+			jobs, _ := vals[0].([]interface{})
+			return parseJobs(jobs)
+		}
+		// The expired jobs are in the processing lists of other consumers.
+		if len(owners) == 0 {
+			keys = append([]string(nil), q.keys...)
+		}
+		for _, owner := range missing {
+			consumer, _ := owner.(string)
+			keys = append(keys, q.prefix+consumer)
+			owners = append(owners, consumer)
+		}
+	}
+}
+
+// Ack acknowledges that the job is done and deletes it. It returns
+// ErrJobNotFound if the job is not in flight for this consumer.
+func (q *Queue) Ack(ctx context.Context, job *Job) error {
+	return q.settle(ctx, job, "ack")
+}
+
+// Nack pushes the failed job to the tail of the queue or moves it to the
+// failed jobs when it has no retries left. It returns ErrJobNotFound if the
+// job is not in flight for this consumer.
+func (q *Queue) Nack(ctx context.Context, job *Job) error {
+	return q.settle(ctx, job, "nack")
+}
+
+func (q *Queue) settle(ctx context.Context, job *Job, op string) error {
+	n, err := settleScript.Run(ctx, q.client, q.keys,
+		q.prefix, job.ID, q.opt.Consumer, op, time.Now().UnixMilli(), q.opt.MaxRetries+1,
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Extend resets the visibility timeout of the job, e.g. while a long job is
+// still running. It returns ErrJobNotFound if the job is not in flight for
+// this consumer.
+func (q *Queue) Extend(ctx context.Context, job *Job) error {
+	deadline := time.Now().Add(q.opt.VisibilityTimeout)
+	n, err := extendScript.Run(ctx, q.client, q.keys,
+		q.prefix, job.ID, q.opt.Consumer, deadline.UnixMilli(),
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Recover pushes all the jobs in the processing list of the consumer back
+// to the head of the queue without waiting for their visibility timeout,
+// e.g. on the start of a consumer or when a consumer is known to be dead.
+// It returns the number of recovered jobs.
+func (q *Queue) Recover(ctx context.Context, consumer string) (int, error) {
+	n, err := recoverScript.Run(ctx, q.client, q.consumerKeys(consumer), q.prefix).Int64()
+	return int(n), err
+}
+
+// Len returns the number of jobs waiting in the queue.
+func (q *Queue) Len(ctx context.Context) (int64, error) {
+	return lenScript.Run(ctx, q.client, q.keys[:1]).Int64()
+}
+
+// Failed returns at most n of the oldest jobs that have no retries left.
+// They are kept until they are retried with Retry.
+func (q *Queue) Failed(ctx context.Context, n int) ([]*Job, error) {
+	vals, err := failedScript.Run(ctx, q.client, q.keys, n).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseJobs(vals)
+}
+
+// Retry pushes the failed job to the tail of the queue with its attempts
+// reset. It returns ErrJobNotFound if the job is not failed.
+func (q *Queue) Retry(ctx context.Context, id string) error {
+	n, err := requeueScript.Run(ctx, q.client, q.keys, q.prefix, id).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Run delivers the jobs to the handler until the context is done. The jobs
+// are acknowledged when the handler returns nil and retried otherwise.
+func (q *Queue) Run(ctx context.Context, handler Handler) error {
+	return run(ctx, q.opt.PollInterval, q.opt.Logger, func(ctx context.Context) (int, error) {
+		jobs, err := q.Dequeue(ctx, q.opt.BatchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, job := range jobs {
+			if err := handler(ctx, job); err != nil {
+				err = q.Nack(ctx, job)
+			} else {
+				err = q.Ack(ctx, job)
+			}
+			if err != nil && err != ErrJobNotFound {
+				return len(jobs), err
+			}
+		}
+		return len(jobs), nil
+	})
+}
@@ -0,0 +1,224 @@
+package redisqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func TestQueue(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	q := NewQueue(rdb, "jobs", &QueueOptions{Consumer: "c1"})
+	ctx := context.Background()
+
+	ids, err := q.Enqueue(ctx, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := q.Len(ctx); err != nil || n != 3 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	jobs, err := q.Dequeue(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != ids[0] || jobs[0].Payload != "a" || jobs[1].Payload != "b" {
+		t.Fatalf("got %+v", jobs)
+	}
+	if jobs[0].Attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", jobs[0].Attempts)
+	}
+	if got, _ := mr.List("{jobs}:processing:c1"); len(got) != 2 {
+		t.Fatalf("got processing list %v", got)
+	}
+
+	// Another consumer can't acknowledge the jobs.
+	other := NewQueue(rdb, "jobs", &QueueOptions{Consumer: "c2"})
+	if err := other.Ack(ctx, jobs[0]); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+
+	if err := q.Ack(ctx, jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(ctx, jobs[0]); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+
+	// The failed job is pushed to the tail of the queue.
+	if err := q.Nack(ctx, jobs[1]); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err = q.Dequeue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Payload != "c" || jobs[1].Payload != "b" || jobs[1].Attempts != 2 {
+		t.Fatalf("got %+v", jobs)
+	}
+	if got, _ := mr.List("{jobs}:processing:c1"); len(got) != 2 {
+		t.Fatalf("got processing list %v", got)
+	}
+}
+
+func TestQueueVisibilityTimeout(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	opt := &QueueOptions{Consumer: "c1", VisibilityTimeout: 10 * time.Millisecond, MaxRetries: 1}
+	q1 := NewQueue(rdb, "jobs", opt)
+	opt.Consumer = "c2"
+	q2 := NewQueue(rdb, "jobs", opt)
+	ctx := context.Background()
+
+	if _, err := q1.Enqueue(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := q1.Dequeue(ctx, 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+
+	// The expired job is delivered to another consumer.
+	time.Sleep(20 * time.Millisecond)
+	redelivered, err := q2.Dequeue(ctx, 10)
+	if err != nil || len(redelivered) != 1 || redelivered[0].Attempts != 2 {
+		t.Fatalf("got %v, %v", redelivered, err)
+	}
+	if mr.Exists("{jobs}:processing:c1") {
+		t.Fatal("the job is not removed from the processing list of c1")
+	}
+	if err := q1.Ack(ctx, jobs[0]); err != ErrJobNotFound {
+		t.Fatalf("got %v, want ErrJobNotFound", err)
+	}
+
+	// The job has no retries left.
+	if err := q2.Extend(ctx, redelivered[0]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if jobs, err := q1.Dequeue(ctx, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+	failed, err := q1.Failed(ctx, 10)
+	if err != nil || len(failed) != 1 || failed[0].Payload != "a" {
+		t.Fatalf("got failed %v, %v", failed, err)
+	}
+
+	if err := q1.Retry(ctx, failed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := q1.Dequeue(ctx, 10); err != nil || len(jobs) != 1 || jobs[0].Attempts != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+}
+
+func TestQueueKeyPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), KeyPrefix: "app:"})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	opt := &QueueOptions{Consumer: "c1", VisibilityTimeout: 10 * time.Millisecond}
+	q1 := NewQueue(rdb, "jobs", opt)
+	opt.Consumer = "c2"
+	q2 := NewQueue(rdb, "jobs", opt)
+	ctx := context.Background()
+
+	if _, err := q1.Enqueue(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := q1.Dequeue(ctx, 10); err != nil || len(jobs) != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if jobs, err := q2.Dequeue(ctx, 10); err != nil || len(jobs) != 1 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+	if mr.Exists("app:{jobs}:processing:c1") {
+		t.Fatal("the job is not removed from the processing list of c1")
+	}
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, "app:") {
+			t.Fatalf("got key %q without the prefix", key)
+		}
+	}
+}
+
+func TestQueueRecover(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	q := NewQueue(rdb, "jobs", &QueueOptions{Consumer: "c1"})
+	ctx := context.Background()
+
+	if _, err := q.Enqueue(ctx, "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := q.Dequeue(ctx, 2); err != nil || len(jobs) != 2 {
+		t.Fatalf("got %v, %v", jobs, err)
+	}
+
+	other := NewQueue(rdb, "jobs", &QueueOptions{Consumer: "c2"})
+	if n, err := other.Recover(ctx, "c1"); err != nil || n != 2 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	// The recovered jobs are delivered first in their order.
+	jobs, err := other.Dequeue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, job := range jobs {
+		payloads = append(payloads, job.Payload)
+	}
+	if len(payloads) != 3 || payloads[0] != "a" || payloads[1] != "b" || payloads[2] != "c" {
+		t.Fatalf("got %v, want [a b c]", payloads)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	q := NewQueue(rdb, "jobs", &QueueOptions{PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := q.Enqueue(ctx, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan string, 10)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- q.Run(ctx, func(ctx context.Context, job *Job) error {
+			if job.Payload == "a" && job.Attempts == 1 {
+				return errors.New("failed")
+			}
+			done <- job.Payload
+			return nil
+		})
+	}()
+
+	for _, want := range []string{"b", "a"} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+	if n, err := q.Len(ctx); err != nil || n != 0 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+}
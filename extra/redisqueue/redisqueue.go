@@ -0,0 +1,143 @@
+// Package redisqueue implements job queues on top of Redis with
+// at-least-once delivery: a job that is not acknowledged within the
+// visibility timeout is delivered again, e.g.
+//
+//	q := redisqueue.NewQueue(rdb, "emails", nil)
+//
+//	_, err := q.Enqueue(ctx, payload)
+//
+//	// In the workers.
+//	err := q.Run(ctx, func(ctx context.Context, job *redisqueue.Job) error {
+//		return sendEmail(ctx, job.Payload)
+//	})
+//
+// A DelayedQueue delivers the jobs at the time they are scheduled at.
+package redisqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// ErrJobNotFound is returned when the acknowledged job is not in flight,
+// e.g. because its visibility timeout expired and it was delivered again.
+var ErrJobNotFound = errors.New("redisqueue: job not found")
+
+// Job is a job delivered to a consumer.
+type Job struct {
+	ID      string
+	Payload string
+	// RunAt is the time the job of a DelayedQueue was due.
+	RunAt time.Time
+	// Attempts is the number of deliveries, including this one.
+	Attempts int
+
+	token string // identifies the delivery of a DelayedQueue job
+}
+
+// Handler handles a job. The job is acknowledged when the handler returns
+// nil and retried otherwise.
+type Handler func(ctx context.Context, job *Job) error
+
+// run calls poll until the context is done, waiting for the interval when
+// it returned no jobs or failed.
+func run(
+	ctx context.Context, interval time.Duration, logger redis.Logger,
+	poll func(ctx context.Context) (int, error),
+) error {
+	var timer *time.Timer
+	for {
+		n, err := poll(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && logger != nil {
+			logger.Log(ctx, redis.LogLevelWarn, "redisqueue: poll failed", "error", err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(interval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// parseJobs parses the {id, payload, score, attempts} tuples returned by the
+// scripts. The score is the time in milliseconds.
+func parseJobs(vals []interface{}) ([]*Job, error) {
+	if len(vals)%4 != 0 {
+		return nil, fmt.Errorf("redisqueue: unexpected script reply: %v", vals)
+	}
+
+	jobs := make([]*Job, 0, len(vals)/4)
+	for i := 0; i < len(vals); i += 4 {
+		id, _ := vals[i].(string)
+		payload, _ := vals[i+1].(string)
+		score, _ := vals[i+2].(string)
+		attempts, _ := vals[i+3].(int64)
+
+		job := &Job{
+			ID:       id,
+			Payload:  payload,
+			Attempts: int(attempts),
+		}
+		if ms, err := strconv.ParseFloat(score, 64); err == nil {
+			job.RunAt = time.Unix(0, int64(ms)*int64(time.Millisecond))
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// backoff returns the delay before the retry of a job that failed attempts
+// times.
+func backoff(attempts int, min, max time.Duration) time.Duration {
+	if min < 0 {
+		return 0
+	}
+	d := min
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// hashTag returns the name if it has a hash tag or the name in braces, so all
+// the keys of a queue are in the same hash slot.
+func hashTag(name string) string {
+	if s := strings.IndexByte(name, '{'); s >= 0 {
+		if e := strings.IndexByte(name[s+1:], '}'); e > 0 {
+			return name
+		}
+	}
+	return "{" + name + "}"
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
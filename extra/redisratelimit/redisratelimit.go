@@ -0,0 +1,199 @@
+// Package redisratelimit implements rate limiters that keep their state in
+// Redis, so the limits are shared by all the instances of a service, e.g.
+//
+//	limiter := redisratelimit.NewLimiter(rdb)
+//
+//	res, err := limiter.Allow(ctx, "api:"+userID, redisratelimit.PerMinute(100))
+//	if err != nil {
+//		return err
+//	}
+//	if res.Allowed == 0 {
+//		w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter/time.Second)+1))
+//		w.WriteHeader(http.StatusTooManyRequests)
+//		return nil
+//	}
+//
+// Every call is a single Lua script that uses the time of the server, so the
+// clocks of the clients don't need to be in sync.
+package redisratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// Algorithm is the rate limiting algorithm of a Limit.
+type Algorithm int
+
+const (
+	// TokenBucket allows Burst requests at once and refills the bucket at
+	// Rate requests per Period. It uses a hash per key.
+	TokenBucket Algorithm = iota
+	// SlidingWindowLog allows Rate requests in any Period. It is exact, but
+	// keeps every request of the last Period in a sorted set.
+	SlidingWindowLog
+	// SlidingWindowCounter allows about Rate requests in any Period. It
+	// weighs the count of the previous fixed window by its overlap with the
+	// sliding window, so it uses two counters per key.
+	SlidingWindowCounter
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case TokenBucket:
+		return "token-bucket"
+	case SlidingWindowLog:
+		return "sliding-window-log"
+	case SlidingWindowCounter:
+		return "sliding-window-counter"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", int(a))
+	}
+}
+
+// Limit is the rate limit of a key.
+type Limit struct {
+	Algorithm Algorithm
+	// Rate is the number of requests allowed per Period.
+	Rate   int
+	Period time.Duration
+	// Burst is the size of the token bucket.
+	// Default is Rate.
+	Burst int
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d req/%s (%s)", l.Rate, l.Period, l.Algorithm)
+}
+
+// PerSecond returns a TokenBucket limit of rate requests per second.
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second, Burst: rate}
+}
+
+// PerMinute returns a TokenBucket limit of rate requests per minute.
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute, Burst: rate}
+}
+
+// PerHour returns a TokenBucket limit of rate requests per hour.
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour, Burst: rate}
+}
+
+// Result is the result of Allow and AllowN.
+type Result struct {
+	Limit Limit
+	// Allowed is the number of allowed requests: n or 0.
+	Allowed int
+	// Remaining is the number of requests that are allowed right now.
+	Remaining int
+	// RetryAfter is how long to wait before the request is allowed. It is
+	// -1 if the request is allowed or can never be allowed, i.e. n exceeds
+	// the limit.
+	RetryAfter time.Duration
+	// ResetAfter is how long to wait until the limit is fully available.
+	ResetAfter time.Duration
+}
+
+// Limiter limits the rate of the requests. It's safe for concurrent use by
+// multiple goroutines.
+type Limiter struct {
+	rdb    redis.Cmdable
+	prefix string
+}
+
+// NewLimiter returns a new Limiter. The keys are prefixed with "rate:".
+func NewLimiter(rdb redis.Cmdable) *Limiter {
+	return &Limiter{
+		rdb:    rdb,
+		prefix: "rate:",
+	}
+}
+
+// WithPrefix returns a Limiter that prefixes the keys with prefix.
+func (l *Limiter) WithPrefix(prefix string) *Limiter {
+	clone := *l
+	clone.prefix = prefix
+	return &clone
+}
+
+// Allow is a shortcut for AllowN(ctx, key, limit, 1).
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	return l.AllowN(ctx, key, limit, 1)
+}
+
+// AllowN reports whether n requests may happen now and records them if
+// they are allowed.
+func (l *Limiter) AllowN(ctx context.Context, key string, limit Limit, n int) (*Result, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return nil, fmt.Errorf("redisratelimit: invalid limit: %s", limit)
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.Rate
+	}
+	period := limit.Period.Microseconds()
+
+	var vals []interface{}
+	var err error
+	switch limit.Algorithm {
+	case TokenBucket:
+		vals, err = tokenBucketScript.Run(ctx, l.rdb, []string{l.prefix + key},
+			limit.Rate, period, limit.Burst, n).Slice()
+	case SlidingWindowLog:
+		var id string
+		if id, err = requestID(); err != nil {
+			return nil, err
+		}
+		vals, err = slidingWindowLogScript.Run(ctx, l.rdb, []string{l.prefix + key},
+			limit.Rate, period, n, id).Slice()
+	case SlidingWindowCounter:
+		vals, err = slidingWindowCounterScript.Run(ctx, l.rdb, []string{l.prefix + key},
+			limit.Rate, period, n).Slice()
+	default:
+		return nil, fmt.Errorf("redisratelimit: unknown algorithm: %s", limit.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != 4 {
+		return nil, fmt.Errorf("redisratelimit: unexpected script reply: %v", vals)
+	}
+
+	res := &Result{Limit: limit}
+	res.Allowed = int(toInt64(vals[0]))
+	res.Remaining = int(toInt64(vals[1]))
+	res.RetryAfter = microseconds(toInt64(vals[2]))
+	res.ResetAfter = microseconds(toInt64(vals[3]))
+	return res, nil
+}
+
+// Reset deletes the state of the key, so the limit is fully available.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.rdb.Del(ctx, l.prefix+key).Err()
+}
+
+func toInt64(v interface{}) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+func microseconds(n int64) time.Duration {
+	if n < 0 {
+		return -1
+	}
+	return time.Duration(n) * time.Microsecond
+}
+
+func requestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,105 @@
+package redisratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(start)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewLimiter(rdb), mr
+}
+
+func allow(t *testing.T, l *Limiter, limit Limit, n int) *Result {
+	t.Helper()
+	res, err := l.AllowN(context.Background(), "key", limit, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func expect(t *testing.T, res *Result, allowed, remaining int, retryAfter, resetAfter time.Duration) {
+	t.Helper()
+	if res.Allowed != allowed || res.Remaining != remaining ||
+		res.RetryAfter != retryAfter || res.ResetAfter != resetAfter {
+		t.Fatalf("got allowed=%d remaining=%d retry=%s reset=%s, want %d %d %s %s",
+			res.Allowed, res.Remaining, res.RetryAfter, res.ResetAfter,
+			allowed, remaining, retryAfter, resetAfter)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	limit := PerSecond(10)
+
+	expect(t, allow(t, l, limit, 4), 4, 6, -1, 400*time.Millisecond)
+	expect(t, allow(t, l, limit, 6), 6, 0, -1, time.Second)
+	expect(t, allow(t, l, limit, 1), 0, 0, 100*time.Millisecond, time.Second)
+	expect(t, allow(t, l, limit, 11), 0, 0, -1, time.Second)
+
+	mr.SetTime(start.Add(500 * time.Millisecond))
+	expect(t, allow(t, l, limit, 1), 1, 4, -1, 600*time.Millisecond)
+
+	limit.Burst = 20
+	mr.SetTime(start.Add(10 * time.Second))
+	expect(t, allow(t, l, limit, 15), 15, 5, -1, 1500*time.Millisecond)
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	limit := Limit{Algorithm: SlidingWindowLog, Rate: 3, Period: time.Second}
+
+	expect(t, allow(t, l, limit, 2), 2, 1, -1, time.Second)
+	mr.SetTime(start.Add(400 * time.Millisecond))
+	expect(t, allow(t, l, limit, 1), 1, 0, -1, time.Second)
+	expect(t, allow(t, l, limit, 1), 0, 0, 600*time.Millisecond, time.Second)
+	expect(t, allow(t, l, limit, 3), 0, 0, time.Second, time.Second)
+	expect(t, allow(t, l, limit, 4), 0, 0, -1, time.Second)
+
+	// The first two requests leave the window.
+	mr.SetTime(start.Add(time.Second))
+	expect(t, allow(t, l, limit, 2), 2, 0, -1, time.Second)
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	limit := Limit{Algorithm: SlidingWindowCounter, Rate: 10, Period: time.Second}
+
+	expect(t, allow(t, l, limit, 10), 10, 0, -1, 2*time.Second)
+	expect(t, allow(t, l, limit, 1), 0, 0, 1100*time.Millisecond, 2*time.Second)
+
+	// 75% of the previous window overlaps with the sliding window.
+	mr.SetTime(start.Add(1250 * time.Millisecond))
+	expect(t, allow(t, l, limit, 2), 2, 0, -1, 1750*time.Millisecond)
+	expect(t, allow(t, l, limit, 1), 0, 0, 50*time.Millisecond, 1750*time.Millisecond)
+
+	mr.SetTime(start.Add(1300 * time.Millisecond))
+	expect(t, allow(t, l, limit, 1), 1, 0, -1, 1700*time.Millisecond)
+}
+
+func TestReset(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	limit := PerMinute(1)
+	ctx := context.Background()
+
+	expect(t, allow(t, l, limit, 1), 1, 0, -1, time.Minute)
+	if err := l.Reset(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, allow(t, l, limit, 1), 1, 0, -1, time.Minute)
+
+	if _, err := l.Allow(ctx, "key", Limit{Rate: 1}); err == nil {
+		t.Fatal("got nil, want the invalid limit error")
+	}
+}
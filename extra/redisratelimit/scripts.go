@@ -0,0 +1,140 @@
+package redisratelimit
+
+import "github.com/farss/redis/v8"
+
+// The scripts return {allowed, remaining, retry_after, reset_after} with the
+// durations in microseconds. Redis truncates the returned Lua numbers to
+// integers, but formats the arguments of redis.call with 14 digits, so the
+// timestamps are formatted with "%d".
+
+// nowScript sets now to the server time in microseconds. The scripts are
+// replicated by their effects, so they can write after TIME.
+const nowScript = `
+redis.replicate_commands()
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+`
+
+var tokenBucketScript = redis.NewScript(nowScript + `
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+
+-- Tokens per microsecond.
+local refill = rate / period
+
+local state = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * refill)
+end
+
+local allowed = 0
+local retry_after = -1
+if tokens >= n then
+	tokens = tokens - n
+	allowed = n
+elseif n <= burst then
+	retry_after = math.ceil((n - tokens) / refill)
+end
+
+local reset_after = math.ceil((burst - tokens) / refill)
+redis.call("HSET", key, "tokens", tostring(tokens), "ts", string.format("%d", now))
+redis.call("PEXPIRE", key, math.ceil(reset_after / 1000) + 1)
+
+return {allowed, math.floor(tokens), retry_after, reset_after}
+`)
+
+var slidingWindowLogScript = redis.NewScript(nowScript + `
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local id = ARGV[4]
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", string.format("%d", now - window))
+local count = redis.call("ZCARD", key)
+
+local allowed = 0
+local retry_after = -1
+if count + n <= limit then
+	for i = 1, n do
+		redis.call("ZADD", key, string.format("%d", now), id .. ":" .. i)
+	end
+	count = count + n
+	allowed = n
+elseif n <= limit then
+	-- The request is allowed when the entries before the last limit - n
+	-- entries leave the window.
+	local entry = redis.call("ZRANGE", key, count + n - limit - 1, count + n - limit - 1, "WITHSCORES")
+	retry_after = tonumber(entry[2]) + window - now
+end
+
+local reset_after = 0
+local last = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+if last[2] then
+	reset_after = tonumber(last[2]) + window - now
+	redis.call("PEXPIRE", key, math.ceil(reset_after / 1000) + 1)
+end
+
+return {allowed, limit - count, retry_after, reset_after}
+`)
+
+var slidingWindowCounterScript = redis.NewScript(nowScript + `
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local index = math.floor(now / window)
+local elapsed = now - index * window
+local cur_field = string.format("%d", index)
+local prev_field = string.format("%d", index - 1)
+
+local counts = redis.call("HMGET", key, cur_field, prev_field)
+local cur = tonumber(counts[1]) or 0
+local prev = tonumber(counts[2]) or 0
+
+-- The weight of the previous window is its part in the sliding window.
+local weight = (window - elapsed) / window
+local count = prev * weight + cur
+
+local allowed = 0
+local retry_after = -1
+if count + n <= limit then
+	cur = redis.call("HINCRBY", key, cur_field, n)
+	count = count + n
+	allowed = n
+	for _, field in ipairs(redis.call("HKEYS", key)) do
+		if field ~= cur_field and field ~= prev_field then
+			redis.call("HDEL", key, field)
+		end
+	end
+	redis.call("PEXPIRE", key, math.ceil(2 * window / 1000))
+elseif n <= limit then
+	if prev > 0 and cur + n <= limit then
+		-- The weight of the previous window decreases until the request fits.
+		local w = (limit - cur - n) / prev
+		retry_after = math.ceil((window - elapsed) - w * window)
+	else
+		-- The current window becomes the previous one.
+		local w = 0
+		if cur > 0 then
+			w = math.max(0, (limit - n) / cur)
+		end
+		retry_after = math.ceil((window - elapsed) + (1 - math.min(w, 1)) * window)
+	end
+end
+
+local reset_after = 0
+if cur > 0 then
+	reset_after = (window - elapsed) + window
+elseif prev > 0 then
+	reset_after = window - elapsed
+end
+
+return {allowed, math.max(0, math.floor(limit - count)), retry_after, reset_after}
+`)
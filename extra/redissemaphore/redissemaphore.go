@@ -0,0 +1,290 @@
+// Package redissemaphore implements distributed counting semaphores that
+// limit the number of concurrent holders across the instances of a service,
+// e.g.
+//
+//	sem := redissemaphore.New(rdb, "sem:payments-api", 10)
+//
+//	permit, err := sem.Acquire(ctx, 30*time.Second, &redissemaphore.Options{
+//		Fair: true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer permit.Release(ctx)
+//
+// The permits expire after their TTL, so the slots of crashed holders are
+// reclaimed.
+package redissemaphore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8"
+	"github.com/go-redis/redis/extra/redislock/v8"
+)
+
+var (
+	// ErrNotAcquired is returned when all the permits are held.
+	ErrNotAcquired = errors.New("redissemaphore: not acquired")
+	// ErrPermitNotHeld is returned when the permit expired.
+	ErrPermitNotHeld = errors.New("redissemaphore: permit not held")
+)
+
+// Options are used to configure the acquisition of a permit.
+type Options struct {
+	// RetryBackoff is the interval between the attempts of Acquire.
+	// Default is 100 milliseconds.
+	RetryBackoff time.Duration
+	// Fair grants the permits in the order of the first attempts. The
+	// waiters are queued until they acquire a permit or their context is
+	// done, and are removed from the queue if they stop polling for 3 times
+	// RetryBackoff. TryAcquire doesn't queue and only acquires a permit that
+	// is not claimed by the waiters.
+	//
+	// The waiters that are not fair don't queue and acquire any free permit,
+	// so all the users of a semaphore should use the same setting.
+	Fair bool
+	// AutoExtend extends the permit in the background every third of the
+	// TTL until it is released. Permit.Done is closed if the permit can't be
+	// extended.
+	AutoExtend bool
+	// Token identifies the holder of the permit.
+	// Default is a random token.
+	Token string
+}
+
+func (opt *Options) init() {
+	if opt.RetryBackoff == 0 {
+		opt.RetryBackoff = 100 * time.Millisecond
+	}
+}
+
+// Semaphore is a counting semaphore. It's safe for concurrent use by
+// multiple goroutines.
+type Semaphore struct {
+	client redis.Scripter
+	limit  int
+	keys   []string
+}
+
+// New returns a Semaphore that allows at most limit concurrent holders of
+// the key. The state is stored in the key and in the keys with the ":queue",
+// ":queue:ts" and ":ticket" suffixes, which are in the same hash slot.
+func New(client redis.Scripter, key string, limit int) *Semaphore {
+	if limit <= 0 {
+		panic("redissemaphore: limit must be positive")
+	}
+	tag := hashTag(key)
+	return &Semaphore{
+		client: client,
+		limit:  limit,
+		keys:   []string{key, tag + ":queue", tag + ":queue:ts", tag + ":ticket"},
+	}
+}
+
+// Key returns the key of the semaphore.
+func (s *Semaphore) Key() string {
+	return s.keys[0]
+}
+
+// Limit returns the maximum number of holders.
+func (s *Semaphore) Limit() int {
+	return s.limit
+}
+
+// Count returns the number of holders and fair waiters.
+func (s *Semaphore) Count(ctx context.Context) (holders, waiters int, err error) {
+	vals, err := countScript.Run(ctx, s.client, s.keys).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(vals[0]), int(vals[1]), nil
+}
+
+// TryAcquire acquires a permit once. It returns ErrNotAcquired if all the
+// permits are held. opt can be nil to use the default options.
+func (s *Semaphore) TryAcquire(ctx context.Context, ttl time.Duration, opt *Options) (*Permit, error) {
+	o := new(Options)
+	if opt != nil {
+		*o = *opt
+	}
+	o.init()
+
+	token, err := o.token()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.acquire(ctx, token, ttl, o, 0); err != nil {
+		return nil, err
+	}
+	return s.newPermit(token, ttl, o), nil
+}
+
+// Acquire acquires a permit, retrying every Options.RetryBackoff until the
+// context is done.
+func (s *Semaphore) Acquire(ctx context.Context, ttl time.Duration, opt *Options) (*Permit, error) {
+	o := new(Options)
+	if opt != nil {
+		*o = *opt
+	}
+	o.init()
+
+	token, err := o.token()
+	if err != nil {
+		return nil, err
+	}
+	wait := 3 * o.RetryBackoff
+
+	var timer *time.Timer
+	for {
+		err := s.acquire(ctx, token, ttl, o, wait)
+		if err == nil {
+			return s.newPermit(token, ttl, o), nil
+		}
+		if err != ErrNotAcquired {
+			s.cancel(o, token)
+			return nil, err
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(o.RetryBackoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(o.RetryBackoff)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			s.cancel(o, token)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Semaphore) acquire(ctx context.Context, token string, ttl time.Duration, o *Options, wait time.Duration) error {
+	fair := 0
+	if o.Fair {
+		fair = 1
+	}
+	n, err := acquireScript.Run(ctx, s.client, s.keys,
+		token, ttl.Milliseconds(), s.limit, fair, wait.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrNotAcquired
+	}
+	return nil
+}
+
+// cancel removes the fair waiter from the queue.
+func (s *Semaphore) cancel(o *Options, token string) {
+	if !o.Fair {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.RetryBackoff)
+	defer cancel()
+	_ = cancelScript.Run(ctx, s.client, s.keys, token).Err()
+}
+
+func (s *Semaphore) newPermit(token string, ttl time.Duration, o *Options) *Permit {
+	p := &Permit{
+		sem:   s,
+		token: token,
+	}
+	p.lease = redislock.NewLease(ttl, o.AutoExtend, ErrPermitNotHeld, p.extend, p.release)
+	return p
+}
+
+func (opt *Options) token() (string, error) {
+	if opt.Token != "" {
+		return opt.Token, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashTag returns the key if it has a hash tag or the key in braces, so the
+// keys with a suffix are in the same hash slot as the key.
+func hashTag(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key
+		}
+	}
+	return "{" + key + "}"
+}
+
+//------------------------------------------------------------------------------
+
+// Permit is an acquired permit of a semaphore.
+type Permit struct {
+	sem   *Semaphore
+	token string
+	lease *redislock.Lease
+}
+
+// Token returns the token of the holder.
+func (p *Permit) Token() string {
+	return p.token
+}
+
+// TTL returns the remaining time to live of the permit or ErrPermitNotHeld.
+func (p *Permit) TTL(ctx context.Context) (time.Duration, error) {
+	ms, err := pttlScript.Run(ctx, p.sem.client, p.sem.keys, p.token).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return 0, ErrPermitNotHeld
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Extend resets the TTL of the permit. It returns ErrPermitNotHeld if the
+// permit expired.
+func (p *Permit) Extend(ctx context.Context, ttl time.Duration) error {
+	return p.lease.Extend(ctx, ttl)
+}
+
+// Release releases the permit and stops extending it. It returns
+// ErrPermitNotHeld if the permit expired.
+func (p *Permit) Release(ctx context.Context) error {
+	return p.lease.Release(ctx)
+}
+
+// Done returns a channel that is closed when the permit is released or when
+// it is lost because Options.AutoExtend failed to extend it.
+func (p *Permit) Done() <-chan struct{} {
+	return p.lease.Done()
+}
+
+func (p *Permit) extend(ctx context.Context, ttl time.Duration) error {
+	n, err := extendScript.Run(ctx, p.sem.client, p.sem.keys, p.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrPermitNotHeld
+	}
+	return nil
+}
+
+func (p *Permit) release(ctx context.Context) error {
+	n, err := releaseScript.Run(ctx, p.sem.client, p.sem.keys, p.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrPermitNotHeld
+	}
+	return nil
+}
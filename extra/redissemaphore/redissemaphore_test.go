@@ -0,0 +1,227 @@
+package redissemaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestTryAcquire(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	sem := New(rdb, "sem", 2)
+	ctx := context.Background()
+
+	p1, err := sem.TryAcquire(ctx, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sem.TryAcquire(ctx, time.Minute, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sem.TryAcquire(ctx, time.Minute, nil); err != ErrNotAcquired {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+	if holders, _, err := sem.Count(ctx); err != nil || holders != 2 {
+		t.Fatalf("got %d holders, %v", holders, err)
+	}
+
+	if ttl, err := p1.TTL(ctx); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("got TTL %s, %v", ttl, err)
+	}
+	if err := p1.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p1.Done():
+	default:
+		t.Fatal("Done is not closed after Release")
+	}
+	if err := p1.Release(ctx); err != ErrPermitNotHeld {
+		t.Fatalf("got %v, want ErrPermitNotHeld", err)
+	}
+	if _, err := sem.TryAcquire(ctx, time.Minute, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiredPermit(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	sem := New(rdb, "sem", 1)
+	ctx := context.Background()
+
+	now := time.Now()
+	mr.SetTime(now)
+
+	p, err := sem.TryAcquire(ctx, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.SetTime(now.Add(2 * time.Second))
+
+	// The slot of the expired permit is reclaimed.
+	other, err := sem.TryAcquire(ctx, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Extend(ctx, time.Minute); err != ErrPermitNotHeld {
+		t.Fatalf("got %v, want ErrPermitNotHeld", err)
+	}
+	if _, err := p.TTL(ctx); err != ErrPermitNotHeld {
+		t.Fatalf("got %v, want ErrPermitNotHeld", err)
+	}
+	if err := p.Release(ctx); err != ErrPermitNotHeld {
+		t.Fatalf("got %v, want ErrPermitNotHeld", err)
+	}
+
+	if err := other.Extend(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	mr.SetTime(now.Add(30 * time.Minute))
+	if err := other.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	sem := New(rdb, "sem", 1)
+	ctx := context.Background()
+
+	p, err := sem.TryAcquire(ctx, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = p.Release(ctx)
+	}()
+
+	opt := &Options{RetryBackoff: 10 * time.Millisecond}
+	if _, err := sem.Acquire(ctx, time.Minute, opt); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := sem.Acquire(ctx, time.Minute, opt); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestFair(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	sem := New(rdb, "sem", 1)
+	ctx := context.Background()
+
+	now := time.Now()
+	mr.SetTime(now)
+
+	p, err := sem.TryAcquire(ctx, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first waiter is queued ahead of the second one.
+	first := &Options{Fair: true, Token: "first", RetryBackoff: time.Second}
+	second := &Options{Fair: true, Token: "second", RetryBackoff: time.Second}
+	if err := sem.acquire(ctx, "first", time.Minute, first, 3*time.Second); err != ErrNotAcquired {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+	if err := sem.acquire(ctx, "second", time.Minute, second, 3*time.Second); err != ErrNotAcquired {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+	if _, waiters, err := sem.Count(ctx); err != nil || waiters != 2 {
+		t.Fatalf("got %d waiters, %v", waiters, err)
+	}
+
+	if err := p.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.acquire(ctx, "second", time.Minute, second, 3*time.Second); err != ErrNotAcquired {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+	if _, err := sem.TryAcquire(ctx, time.Minute, &Options{Fair: true}); err != ErrNotAcquired {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+
+	// The first waiter stopped polling and is removed from the queue.
+	mr.SetTime(now.Add(5 * time.Second))
+	if err := sem.acquire(ctx, "second", time.Minute, second, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, waiters, err := sem.Count(ctx); err != nil || waiters != 0 {
+		t.Fatalf("got %d waiters, %v", waiters, err)
+	}
+	if mr.Exists("{sem}:ticket") {
+		t.Fatal("the ticket counter is not deleted with the queue")
+	}
+}
+
+func TestFairCancel(t *testing.T) {
+	rdb, _ := newTestClient(t)
+	sem := New(rdb, "sem", 1)
+	ctx := context.Background()
+
+	if _, err := sem.TryAcquire(ctx, time.Minute, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	opt := &Options{Fair: true, RetryBackoff: 10 * time.Millisecond}
+	if _, err := sem.Acquire(ctx2, time.Minute, opt); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if _, waiters, err := sem.Count(ctx); err != nil || waiters != 0 {
+		t.Fatalf("got %d waiters, %v", waiters, err)
+	}
+}
+
+func TestAutoExtend(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	sem := New(rdb, "sem", 1)
+	ctx := context.Background()
+
+	p, err := sem.TryAcquire(ctx, 300*time.Millisecond, &Options{AutoExtend: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if ttl, err := p.TTL(ctx); err != nil || ttl <= 200*time.Millisecond {
+		t.Fatalf("got TTL %s, %v, want the extended TTL", ttl, err)
+	}
+
+	// The permit is lost when it is removed.
+	if _, err := mr.ZRem("sem", p.Token()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done is not closed after the permit is lost")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for key, want := range map[string]string{
+		"sem":        "{sem}:queue",
+		"{user}:sem": "{user}:sem:queue",
+	} {
+		if got := New(nil, key, 1).keys[1]; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
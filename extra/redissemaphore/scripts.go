@@ -0,0 +1,112 @@
+package redissemaphore
+
+import "github.com/farss/redis/v8"
+
+// The holders are the members of the KEYS[1] sorted set scored by the time
+// their permit expires. The fair waiters are the members of the KEYS[2]
+// sorted set scored by their ticket and of the KEYS[3] sorted set scored by
+// the time they stop waiting unless they poll again. KEYS[4] is the ticket
+// counter.
+
+// nowScript sets now to the server time in milliseconds, removes the expired
+// holders and defines the helpers. The scripts are replicated by their
+// effects, so they can write after TIME.
+const nowScript = `
+redis.replicate_commands()
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", string.format("%d", now))
+
+-- hold adds or extends the permit and expires the key with the last permit.
+local function hold(token, ttl)
+	redis.call("ZADD", KEYS[1], string.format("%d", now + ttl), token)
+	local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	redis.call("PEXPIRE", KEYS[1], math.max(1, tonumber(last[2]) - now))
+end
+
+-- dropStale removes the waiters that stopped polling.
+local function dropStale()
+	local stale = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", string.format("%d", now))
+	for _, member in ipairs(stale) do
+		redis.call("ZREM", KEYS[2], member)
+		redis.call("ZREM", KEYS[3], member)
+	end
+end
+`
+
+var acquireScript = redis.NewScript(nowScript + `
+local token = ARGV[1]
+local ttl = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local fair = ARGV[4] == "1"
+local wait = tonumber(ARGV[5])
+
+if not fair then
+	if redis.call("ZSCORE", KEYS[1], token) or redis.call("ZCARD", KEYS[1]) < limit then
+		hold(token, ttl)
+		return 1
+	end
+	return 0
+end
+
+dropStale()
+if not redis.call("ZSCORE", KEYS[2], token) then
+	redis.call("ZADD", KEYS[2], redis.call("INCR", KEYS[4]), token)
+end
+
+local acquired = 0
+local free = limit - redis.call("ZCARD", KEYS[1])
+if redis.call("ZRANK", KEYS[2], token) < free then
+	hold(token, ttl)
+	redis.call("ZREM", KEYS[2], token)
+	redis.call("ZREM", KEYS[3], token)
+	acquired = 1
+elseif wait > 0 then
+	redis.call("ZADD", KEYS[3], string.format("%d", now + wait), token)
+	for i = 2, 4 do
+		redis.call("PEXPIRE", KEYS[i], wait)
+	end
+else
+	redis.call("ZREM", KEYS[2], token)
+	redis.call("ZREM", KEYS[3], token)
+end
+
+if redis.call("ZCARD", KEYS[2]) == 0 then
+	redis.call("DEL", KEYS[4])
+end
+return acquired
+`)
+
+var cancelScript = redis.NewScript(`
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("ZREM", KEYS[3], ARGV[1])
+if redis.call("ZCARD", KEYS[2]) == 0 then
+	redis.call("DEL", KEYS[4])
+end
+return 1
+`)
+
+var extendScript = redis.NewScript(nowScript + `
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	hold(ARGV[1], tonumber(ARGV[2]))
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(nowScript + `
+return redis.call("ZREM", KEYS[1], ARGV[1])
+`)
+
+var pttlScript = redis.NewScript(nowScript + `
+local deadline = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if deadline then
+	return tonumber(deadline) - now
+end
+return -2
+`)
+
+var countScript = redis.NewScript(nowScript + `
+dropStale()
+return {redis.call("ZCARD", KEYS[1]), redis.call("ZCARD", KEYS[2])}
+`)
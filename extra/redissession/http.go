@@ -0,0 +1,155 @@
+package redissession
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type sessionKey struct{}
+
+// FromContext returns the session of the request stored by
+// Store.Middleware, or nil if there is none.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Middleware loads the session of the request from the cookie and stores it
+// in the request context, see FromContext. It can be used with any router
+// that accepts func(http.Handler) http.Handler middleware.
+//
+// A request without a valid session gets a new session, which is stored and
+// sent in the cookie on its first write.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := s.load(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, sess)))
+	})
+}
+
+func (s *Store) load(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if c, err := r.Cookie(s.opt.Cookie.Name); err == nil && c.Value != "" {
+		err := s.Refresh(r.Context(), c.Value)
+		if err == nil {
+			return &Session{store: s, w: w, id: c.Value}, nil
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{store: s, w: w, id: id, isNew: true}, nil
+}
+
+// Session is the session of a request. The methods that write the session
+// may set the cookie, so they must be called before the response is
+// written. It's not safe for concurrent use.
+type Session struct {
+	store *Store
+	w     http.ResponseWriter
+	id    string
+	isNew bool
+}
+
+// ID returns the ID of the session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Get unmarshals the value of the session into v. It returns ErrNotFound if
+// the session has no value.
+func (s *Session) Get(ctx context.Context, v interface{}) error {
+	return s.store.Get(ctx, s.id, v)
+}
+
+// Set sets the value of the session.
+func (s *Session) Set(ctx context.Context, v interface{}) error {
+	return s.SetField(ctx, dataField, v)
+}
+
+// GetField unmarshals the field of the session into v. It returns
+// ErrNotFound if there is no such field.
+func (s *Session) GetField(ctx context.Context, field string, v interface{}) error {
+	return s.store.GetField(ctx, s.id, field, v)
+}
+
+// SetField sets the field of the session.
+func (s *Session) SetField(ctx context.Context, field string, v interface{}) error {
+	if err := s.store.SetField(ctx, s.id, field, v); err != nil {
+		return err
+	}
+	if s.isNew {
+		s.setCookie(s.id, 0)
+		s.isNew = false
+	}
+	return nil
+}
+
+// DelFields deletes the fields of the session.
+func (s *Session) DelFields(ctx context.Context, fields ...string) error {
+	err := s.store.DelFields(ctx, s.id, fields...)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Renew moves the session to a new ID, e.g. on login to prevent session
+// fixation, and sets the cookie.
+func (s *Session) Renew(ctx context.Context) error {
+	id, err := s.store.Renew(ctx, s.id)
+	if err == ErrNotFound {
+		id, err = NewID()
+		s.isNew = true
+	}
+	if err != nil {
+		return err
+	}
+	s.id = id
+	if !s.isNew {
+		s.setCookie(s.id, 0)
+	}
+	return nil
+}
+
+// Destroy deletes the session, e.g. on logout, and the cookie. The next
+// write creates a new session.
+func (s *Session) Destroy(ctx context.Context) error {
+	if err := s.store.Destroy(ctx, s.id); err != nil {
+		return err
+	}
+	if !s.isNew {
+		s.setCookie("", -1)
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return err
+	}
+	s.id = id
+	s.isNew = true
+	return nil
+}
+
+func (s *Session) setCookie(value string, maxAge int) {
+	c := s.store.opt.Cookie
+	c.Value = value
+	c.MaxAge = maxAge
+	c.Expires = time.Time{}
+	c.HttpOnly = true
+	http.SetCookie(s.w, &c)
+}
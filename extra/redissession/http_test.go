@@ -0,0 +1,84 @@
+package redissession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	store := NewStore(rdb, nil)
+
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		sess := FromContext(ctx)
+
+		var err error
+		switch r.URL.Path {
+		case "/login":
+			if err = sess.Renew(ctx); err == nil {
+				err = sess.SetField(ctx, "user", "alice")
+			}
+		case "/logout":
+			err = sess.Destroy(ctx)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var user string
+		_ = sess.GetField(ctx, "user", &user)
+		_, _ = w.Write([]byte(user))
+	}))
+
+	do := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d %s", w.Code, w.Body)
+		}
+		return w
+	}
+
+	// No cookie and no session without writes.
+	w := do("/", nil)
+	if len(w.Result().Cookies()) != 0 || len(mr.Keys()) != 0 {
+		t.Fatalf("got cookies %v and keys %v", w.Result().Cookies(), mr.Keys())
+	}
+
+	w = do("/login", nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session_id" || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	cookie := cookies[0]
+	if w.Body.String() != "alice" {
+		t.Fatalf("got %q, want alice", w.Body)
+	}
+
+	w = do("/", cookie)
+	if w.Body.String() != "alice" || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("got %q and cookies %v", w.Body, w.Result().Cookies())
+	}
+
+	w = do("/logout", cookie)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge != -1 {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	if len(mr.Keys()) != 0 {
+		t.Fatalf("got keys %v", mr.Keys())
+	}
+
+	// An unknown session is replaced.
+	w = do("/", cookie)
+	if w.Body.String() != "" {
+		t.Fatalf("got %q, want no user", w.Body)
+	}
+}
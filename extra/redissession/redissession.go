@@ -0,0 +1,283 @@
+// Package redissession implements a session store with sliding expiration:
+// a session expires when it is not used for the TTL, e.g.
+//
+//	store := redissession.NewStore(rdb, &redissession.Options{
+//		TTL: 30 * time.Minute,
+//	})
+//
+//	mux.Handle("/", store.Middleware(handler))
+//
+//	// In the handler.
+//	sess := redissession.FromContext(r.Context())
+//	err := sess.SetField(ctx, "user_id", user.ID)
+//
+// The sessions are hashes, so each field can be read and written separately.
+package redissession
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/farss/redis/v8"
+)
+
+// ErrNotFound is returned when the session or its field does not exist,
+// e.g. because the session expired.
+var ErrNotFound = errors.New("redissession: not found")
+
+// The session is the KEYS[1] hash. The "_created" field is when it was
+// created and the "_data" field is the value of Get and Set. ARGV[1] is the
+// current time, ARGV[2] the TTL and ARGV[3] the maximum age of the session in
+// milliseconds.
+
+// touchScript defines touch, which extends the session and returns false
+// when it does not exist or exceeded its maximum age.
+const touchScript = `
+local now = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local max_age = tonumber(ARGV[3])
+
+local function touch()
+	local created = redis.call("HGET", KEYS[1], "_created")
+	if not created then
+		return false
+	end
+	if max_age > 0 then
+		local left = tonumber(created) + max_age - now
+		if left <= 0 then
+			redis.call("DEL", KEYS[1])
+			return false
+		end
+		ttl = math.min(ttl, left)
+	end
+	redis.call("PEXPIRE", KEYS[1], ttl)
+	return true
+end
+`
+
+const dataField = "_data"
+
+var (
+	getScript = redis.NewScript(touchScript + `
+if not touch() then
+	return false
+end
+return redis.call("HGET", KEYS[1], ARGV[4])
+`)
+	setScript = redis.NewScript(touchScript + `
+if not touch() then
+	redis.call("HSET", KEYS[1], "_created", ARGV[1])
+	touch()
+end
+for i = 4, #ARGV, 2 do
+	redis.call("HSET", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+return 1
+`)
+	delFieldsScript = redis.NewScript(touchScript + `
+if not touch() then
+	return 0
+end
+redis.call("HDEL", KEYS[1], unpack(ARGV, 4))
+return 1
+`)
+	refreshScript = redis.NewScript(touchScript + `
+if touch() then
+	return 1
+end
+return 0
+`)
+	dumpScript = redis.NewScript(touchScript + `
+if not touch() then
+	return false
+end
+return redis.call("HGETALL", KEYS[1])
+`)
+	restoreScript = redis.NewScript(touchScript + `
+redis.call("HSET", KEYS[1], unpack(ARGV, 4))
+touch()
+return 1
+`)
+	destroyScript = redis.NewScript(`return redis.call("DEL", KEYS[1])`)
+)
+
+// Options are used to configure a Store.
+type Options struct {
+	// Prefix is the prefix of the keys.
+	// Default is "session:".
+	Prefix string
+	// TTL is how long a session is kept after it was last used.
+	// Default is 30 minutes.
+	TTL time.Duration
+	// MaxAge is how long a session is kept after it was created, however
+	// often it is used.
+	// Default is no maximum age.
+	MaxAge time.Duration
+
+	// Codec marshals the values.
+	// Default is redis.JSONCodec.
+	Codec redis.Codec
+
+	// Cookie is the template of the session cookie of Middleware. Its Value,
+	// MaxAge and Expires are ignored and it's always HttpOnly.
+	// Default is a cookie named "session_id" with the "/" path and the Lax
+	// SameSite mode.
+	Cookie http.Cookie
+}
+
+func (opt *Options) init() {
+	if opt.Prefix == "" {
+		opt.Prefix = "session:"
+	}
+	if opt.TTL == 0 {
+		opt.TTL = 30 * time.Minute
+	}
+	if opt.Codec == nil {
+		opt.Codec = redis.JSONCodec
+	}
+	if opt.Cookie.Name == "" {
+		opt.Cookie.Name = "session_id"
+	}
+	if opt.Cookie.Path == "" {
+		opt.Cookie.Path = "/"
+	}
+	if opt.Cookie.SameSite == 0 {
+		opt.Cookie.SameSite = http.SameSiteLaxMode
+	}
+}
+
+// Store stores the sessions by their IDs. Every read and write extends the
+// session by the TTL. It's safe for concurrent use by multiple goroutines.
+type Store struct {
+	client redis.Scripter
+	opt    Options
+}
+
+// NewStore returns a new Store. opt can be nil to use the default options.
+func NewStore(client redis.Scripter, opt *Options) *Store {
+	s := &Store{client: client}
+	if opt != nil {
+		s.opt = *opt
+	}
+	s.opt.init()
+	return s
+}
+
+// NewID returns a new random session ID.
+func NewID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *Store) run(ctx context.Context, script *redis.Script, id string, args ...interface{}) *redis.Cmd {
+	args = append([]interface{}{
+		time.Now().UnixMilli(), s.opt.TTL.Milliseconds(), s.opt.MaxAge.Milliseconds(),
+	}, args...)
+	return script.Run(ctx, s.client, []string{s.opt.Prefix + id}, args...)
+}
+
+// Get unmarshals the value of the session into v. It returns ErrNotFound if
+// there is no such session or it has no value.
+func (s *Store) Get(ctx context.Context, id string, v interface{}) error {
+	return s.GetField(ctx, id, dataField, v)
+}
+
+// Set sets the value of the session, creating the session if it does not
+// exist.
+func (s *Store) Set(ctx context.Context, id string, v interface{}) error {
+	return s.SetField(ctx, id, dataField, v)
+}
+
+// GetField unmarshals the field of the session into v. It returns
+// ErrNotFound if there is no such session or field.
+func (s *Store) GetField(ctx context.Context, id, field string, v interface{}) error {
+	b, err := s.run(ctx, getScript, id, field).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.opt.Codec.Unmarshal([]byte(b), v)
+}
+
+// SetField sets the field of the session, creating the session if it does
+// not exist. The fields that start with "_" are reserved.
+func (s *Store) SetField(ctx context.Context, id, field string, v interface{}) error {
+	b, err := s.opt.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.run(ctx, setScript, id, field, b).Err()
+}
+
+// DelFields deletes the fields of the session. It returns ErrNotFound if
+// there is no such session.
+func (s *Store) DelFields(ctx context.Context, id string, fields ...string) error {
+	if len(fields) == 0 {
+		return s.Refresh(ctx, id)
+	}
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		args[i] = field
+	}
+	return s.intResult(s.run(ctx, delFieldsScript, id, args...))
+}
+
+// Refresh extends the session by the TTL. It returns ErrNotFound if there is
+// no such session.
+func (s *Store) Refresh(ctx context.Context, id string) error {
+	return s.intResult(s.run(ctx, refreshScript, id))
+}
+
+func (s *Store) intResult(cmd *redis.Cmd) error {
+	n, err := cmd.Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Renew moves the session to a new ID and returns it, e.g. on login to
+// prevent session fixation. It returns ErrNotFound if there is no such
+// session.
+func (s *Store) Renew(ctx context.Context, id string) (string, error) {
+	vals, err := s.run(ctx, dumpScript, id).StringSlice()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	newID, err := NewID()
+	if err != nil {
+		return "", err
+	}
+	args := make([]interface{}, len(vals))
+	for i, val := range vals {
+		args[i] = val
+	}
+	if err := s.run(ctx, restoreScript, newID, args...).Err(); err != nil {
+		return "", err
+	}
+	if err := s.Destroy(ctx, id); err != nil {
+		return "", err
+	}
+	return newID, nil
+}
+
+// Destroy deletes the session.
+func (s *Store) Destroy(ctx context.Context, id string) error {
+	return destroyScript.Run(ctx, s.client, []string{s.opt.Prefix + id}).Err()
+}
@@ -0,0 +1,140 @@
+package redissession
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/farss/redis/v8"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+type user struct {
+	Name string
+}
+
+func TestStore(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	store := NewStore(rdb, &Options{TTL: time.Minute})
+	ctx := context.Background()
+
+	var u user
+	if err := store.Get(ctx, "id", &u); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	if err := store.Set(ctx, "id", &user{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetField(ctx, "id", "theme", "dark"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Get(ctx, "id", &u); err != nil || u.Name != "alice" {
+		t.Fatalf("got %+v, %v", u, err)
+	}
+	var theme string
+	if err := store.GetField(ctx, "id", "theme", &theme); err != nil || theme != "dark" {
+		t.Fatalf("got %q, %v", theme, err)
+	}
+	if err := store.GetField(ctx, "id", "missing", &theme); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	if err := store.DelFields(ctx, "id", "theme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GetField(ctx, "id", "theme", &theme); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	// The reads extend the session.
+	mr.FastForward(50 * time.Second)
+	if err := store.Get(ctx, "id", &u); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("session:id"); ttl != time.Minute {
+		t.Fatalf("got TTL %s, want 1m", ttl)
+	}
+	mr.FastForward(50 * time.Second)
+	if err := store.Refresh(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Minute)
+	if err := store.Refresh(ctx, "id"); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreMaxAge(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	store := NewStore(rdb, &Options{TTL: time.Hour, MaxAge: 2 * time.Hour})
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "id", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TTL is capped by the maximum age.
+	created := time.Now().Add(-90 * time.Minute).UnixMilli()
+	mr.HSet("session:id", "_created", strconv.FormatInt(created, 10))
+	if err := store.Refresh(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("session:id"); ttl > 30*time.Minute || ttl < 29*time.Minute {
+		t.Fatalf("got TTL %s, want 30m", ttl)
+	}
+
+	created = time.Now().Add(-2 * time.Hour).UnixMilli()
+	mr.HSet("session:id", "_created", strconv.FormatInt(created, 10))
+	var v string
+	if err := store.Get(ctx, "id", &v); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if mr.Exists("session:id") {
+		t.Fatal("the expired session is not deleted")
+	}
+}
+
+func TestStoreRenew(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	store := NewStore(rdb, nil)
+	ctx := context.Background()
+
+	if _, err := store.Renew(ctx, "id"); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	if err := store.SetField(ctx, "id", "user_id", 1); err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.Renew(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("session:id") {
+		t.Fatal("the old session is not deleted")
+	}
+	var userID int
+	if err := store.GetField(ctx, id, "user_id", &userID); err != nil || userID != 1 {
+		t.Fatalf("got %d, %v", userID, err)
+	}
+	if ttl := mr.TTL("session:" + id); ttl != 30*time.Minute {
+		t.Fatalf("got TTL %s, want 30m", ttl)
+	}
+
+	if err := store.Destroy(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GetField(ctx, id, "user_id", &userID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,42 @@
+package redisslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/farss/redis/v8"
+)
+
+// Logger is a redis.Logger that logs the messages using log/slog.
+type Logger struct {
+	logger *slog.Logger
+}
+
+var _ redis.Logger = (*Logger)(nil)
+
+// NewLogger returns a redis.Logger that uses the logger.
+// If logger is nil, slog.Default() is used.
+func NewLogger(logger *slog.Logger) *Logger {
+	return &Logger{logger: logger}
+}
+
+func (l *Logger) Log(ctx context.Context, level redis.LogLevel, msg string, keyvals ...interface{}) {
+	logger := l.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Log(ctx, slogLevel(level), msg, keyvals...)
+}
+
+func slogLevel(level redis.LogLevel) slog.Level {
+	switch level {
+	case redis.LogLevelDebug:
+		return slog.LevelDebug
+	case redis.LogLevelInfo:
+		return slog.LevelInfo
+	case redis.LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,28 @@
+package redisslog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/farss/redis/v8"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	})))
+
+	logger.Log(context.Background(), redis.LogLevelWarn, "XREAD failed",
+		"stream", "events", "error", errors.New("ERR oops"))
+
+	got := buf.String()
+	want := `level=WARN msg="XREAD failed" stream=events error="ERR oops"`
+	if !strings.Contains(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,339 @@
+// Package redisssh dials Redis through an SSH jump host, e.g.
+//
+//	dialer, err := redisssh.NewDialer(&redisssh.Options{
+//		Addr:           "bastion.example.com:22",
+//		User:           "ops",
+//		PrivateKeyFile: "/home/ops/.ssh/id_ed25519",
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer dialer.Close()
+//
+//	rdb := redis.NewClient(&redis.Options{
+//		Addr:   "redis.internal:6379",
+//		Dialer: dialer.Dial,
+//	})
+//
+// All the connections are forwarded over a single SSH connection, which is
+// established again when it is lost.
+package redisssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Options are used to configure a Dialer.
+type Options struct {
+	// Addr is the host:port address of the SSH jump host.
+	Addr string
+	// User is the SSH user.
+	User string
+
+	// PrivateKey is the PEM-encoded private key used to authenticate.
+	PrivateKey []byte
+	// PrivateKeyFile is the file with the private key. It is used when
+	// PrivateKey is not set.
+	PrivateKeyFile string
+	// Passphrase decrypts the private key, if it is encrypted.
+	Passphrase []byte
+	// Signers are used to authenticate instead of the private key, e.g.
+	// the keys of an SSH agent.
+	Signers []ssh.Signer
+
+	// HostKeyCallback verifies the host key of the jump host.
+	// Default is to verify it with the KnownHostsFile.
+	HostKeyCallback ssh.HostKeyCallback
+	// KnownHostsFile is the known_hosts file used to verify the host key.
+	// Default is ~/.ssh/known_hosts.
+	KnownHostsFile string
+
+	// DialTimeout is the timeout for establishing the SSH connection.
+	// Default is 5 seconds.
+	DialTimeout time.Duration
+	// KeepAliveInterval is how often the keepalive requests are sent to
+	// detect the lost SSH connection.
+	// Default is 30 seconds. -1 disables the keepalive requests.
+	KeepAliveInterval time.Duration
+}
+
+func (opt *Options) init() error {
+	if len(opt.Signers) == 0 {
+		key := opt.PrivateKey
+		if key == nil {
+			if opt.PrivateKeyFile == "" {
+				return errors.New("redisssh: PrivateKey, PrivateKeyFile or Signers is required")
+			}
+			b, err := os.ReadFile(opt.PrivateKeyFile)
+			if err != nil {
+				return fmt.Errorf("redisssh: can't read the private key: %w", err)
+			}
+			key = b
+		}
+
+		var signer ssh.Signer
+		var err error
+		if opt.Passphrase != nil {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, opt.Passphrase)
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return fmt.Errorf("redisssh: can't parse the private key: %w", err)
+		}
+		opt.Signers = []ssh.Signer{signer}
+	}
+
+	if opt.HostKeyCallback == nil {
+		if opt.KnownHostsFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("redisssh: can't find the known_hosts file: %w", err)
+			}
+			opt.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		cb, err := knownhosts.New(opt.KnownHostsFile)
+		if err != nil {
+			return fmt.Errorf("redisssh: can't read the known_hosts file: %w", err)
+		}
+		opt.HostKeyCallback = cb
+	}
+
+	if _, _, err := net.SplitHostPort(opt.Addr); err != nil {
+		opt.Addr = net.JoinHostPort(opt.Addr, "22")
+	}
+	if opt.DialTimeout == 0 {
+		opt.DialTimeout = 5 * time.Second
+	}
+	if opt.KeepAliveInterval == 0 {
+		opt.KeepAliveInterval = 30 * time.Second
+	}
+	return nil
+}
+
+// Dialer dials the connections through the SSH jump host. It's safe for
+// concurrent use by multiple goroutines.
+type Dialer struct {
+	opt    Options
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// NewDialer returns a new Dialer. The SSH connection is established when
+// the first connection is dialed.
+func NewDialer(opt *Options) (*Dialer, error) {
+	d := &Dialer{opt: *opt}
+	if err := d.opt.init(); err != nil {
+		return nil, err
+	}
+	d.config = &ssh.ClientConfig{
+		User:            d.opt.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(d.opt.Signers...)},
+		HostKeyCallback: d.opt.HostKeyCallback,
+		Timeout:         d.opt.DialTimeout,
+	}
+	return d, nil
+}
+
+// Dial dials addr from the jump host. It is meant to be used as
+// redis.Options.Dialer.
+func (d *Dialer) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := d.sshClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialContext(ctx, client, network, addr)
+	if err == nil {
+		return conn, nil
+	}
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// The SSH connection is lost, so it is established again.
+	d.drop(client)
+	if client, err = d.sshClient(ctx); err != nil {
+		return nil, err
+	}
+	return dialContext(ctx, client, network, addr)
+}
+
+// Close closes the SSH connection and the connections dialed over it.
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+func (d *Dialer) sshClient(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.New("redisssh: dialer is closed")
+	}
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	netDialer := &net.Dialer{
+		Timeout:   d.opt.DialTimeout,
+		KeepAlive: 5 * time.Minute,
+	}
+	conn, err := netDialer.DialContext(ctx, "tcp", d.opt.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, d.opt.Addr, d.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("redisssh: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(c, chans, reqs)
+	d.client = client
+	go d.watch(client)
+	return client, nil
+}
+
+// watch drops the client when the SSH connection is closed or does not
+// reply to the keepalive requests.
+func (d *Dialer) watch(client *ssh.Client) {
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+	}()
+
+	if d.opt.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(d.opt.KeepAliveInterval)
+		defer ticker.Stop()
+
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				if !keepAlive(client, d.opt.KeepAliveInterval) {
+					_ = client.Close()
+					break loop
+				}
+			case <-done:
+				break loop
+			}
+		}
+	}
+
+	<-done
+	d.drop(client)
+}
+
+func (d *Dialer) drop(client *ssh.Client) {
+	d.mu.Lock()
+	if d.client == client {
+		d.client = nil
+	}
+	d.mu.Unlock()
+	_ = client.Close()
+}
+
+func keepAlive(client *ssh.Client, timeout time.Duration) bool {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errc:
+		return err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+func dialContext(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return newConn(res.conn), nil
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.conn != nil {
+				_ = res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// newConn returns a conn that forwards the data to the SSH channel. The
+// SSH channels don't support the deadlines, but the client uses them for
+// the read and write timeouts, so the data is copied through a pipe.
+func newConn(channel net.Conn) net.Conn {
+	conn, pipe := net.Pipe()
+	go func() {
+		_, _ = io.Copy(channel, pipe)
+		_ = channel.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(pipe, channel)
+		_ = pipe.Close()
+	}()
+	return &tunnelConn{Conn: conn, channel: channel}
+}
+
+type tunnelConn struct {
+	net.Conn
+	channel net.Conn
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr  { return c.channel.LocalAddr() }
+func (c *tunnelConn) RemoteAddr() net.Addr { return c.channel.RemoteAddr() }
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.channel.Close()
+	return err
+}
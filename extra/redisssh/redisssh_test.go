@@ -0,0 +1,272 @@
+package redisssh
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/farss/redis/v8"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func listen(t *testing.T, serve func(conn net.Conn)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln
+}
+
+// servePong replies +PONG to every command.
+func servePong(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(line[1 : len(line)-2])
+		for i := 0; i < 2*n; i++ {
+			if _, err := rd.ReadString('\n'); err != nil {
+				return
+			}
+		}
+		if _, err := io.WriteString(conn, "+PONG\r\n"); err != nil {
+			return
+		}
+	}
+}
+
+// sshServer is a jump host that forwards the direct-tcpip channels.
+type sshServer struct {
+	ln      net.Listener
+	hostKey ssh.Signer
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	channels int
+}
+
+func newSSHServer(t *testing.T, user string, clientKey ssh.PublicKey) *sshServer {
+	srv := &sshServer{hostKey: newSigner(t)}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() != user || string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(srv.hostKey)
+
+	srv.ln = listen(t, func(conn net.Conn) {
+		srv.mu.Lock()
+		srv.conns = append(srv.conns, conn)
+		srv.mu.Unlock()
+		srv.serve(conn, config)
+	})
+	return srv
+}
+
+func (s *sshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "direct-tcpip" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		// RFC 4254 7.2: the data starts with the host and the port to connect.
+		data := newCh.ExtraData()
+		n := binary.BigEndian.Uint32(data)
+		host := string(data[4 : 4+n])
+		port := binary.BigEndian.Uint32(data[4+n:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			_ = target.Close()
+			continue
+		}
+		s.mu.Lock()
+		s.channels++
+		s.mu.Unlock()
+
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			_, _ = io.Copy(ch, target)
+			_ = ch.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(target, ch)
+			_ = target.Close()
+		}()
+	}
+}
+
+func (s *sshServer) stats() (conns, channels int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns), s.channels
+}
+
+func (s *sshServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func newTestDialer(t *testing.T) (*Dialer, *sshServer) {
+	key := newSigner(t)
+	srv := newSSHServer(t, "ops", key.PublicKey())
+	d, err := NewDialer(&Options{
+		Addr:            srv.ln.Addr().String(),
+		User:            "ops",
+		Signers:         []ssh.Signer{key},
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	return d, srv
+}
+
+func TestDialer(t *testing.T) {
+	d, srv := newTestDialer(t)
+	redisLn := listen(t, servePong)
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:   redisLn.Addr().String(),
+		Dialer: d.Dial,
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	conn := rdb.Conn(ctx)
+	defer conn.Close()
+	if err := conn.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The connections are forwarded over the same SSH connection.
+	if conns, channels := srv.stats(); conns != 1 || channels != 2 {
+		t.Fatalf("got %d SSH connections and %d channels, want 1 and 2", conns, channels)
+	}
+}
+
+func TestDialerReconnect(t *testing.T) {
+	d, srv := newTestDialer(t)
+	redisLn := listen(t, servePong)
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:   redisLn.Addr().String(),
+		Dialer: d.Dial,
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.closeConns()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if conns, _ := srv.stats(); conns != 2 {
+		t.Fatalf("got %d SSH connections, want 2", conns)
+	}
+}
+
+func TestDialerConnectFailed(t *testing.T) {
+	d, srv := newTestDialer(t)
+
+	// The port of the closed listener refuses the connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	_, err = d.Dial(context.Background(), "tcp", addr)
+	var openErr *ssh.OpenChannelError
+	if !errors.As(err, &openErr) || openErr.Reason != ssh.ConnectionFailed {
+		t.Fatalf("got %v, want ConnectionFailed", err)
+	}
+	if conns, _ := srv.stats(); conns != 1 {
+		t.Fatalf("got %d SSH connections, want 1", conns)
+	}
+}
+
+func TestDialerHostKey(t *testing.T) {
+	key := newSigner(t)
+	srv := newSSHServer(t, "ops", key.PublicKey())
+	d, err := NewDialer(&Options{
+		Addr:            srv.ln.Addr().String(),
+		User:            "ops",
+		Signers:         []ssh.Signer{key},
+		HostKeyCallback: ssh.FixedHostKey(newSigner(t).PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err := d.Dial(context.Background(), "tcp", "127.0.0.1:6379"); err == nil {
+		t.Fatal("got nil, want the host key error")
+	}
+}
+
+func TestNewDialerNoKey(t *testing.T) {
+	if _, err := NewDialer(&Options{Addr: "bastion"}); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+}
@@ -0,0 +1,42 @@
+package redistyped
+
+import "github.com/farss/redis/v8"
+
+// Optional is a result that may not exist, e.g. the value of a missing key.
+type Optional[T any] struct {
+	Val T
+	// Valid reports whether the value exists.
+	Valid bool
+}
+
+// Some returns an Optional with the value.
+func Some[T any](val T) Optional[T] {
+	return Optional[T]{Val: val, Valid: true}
+}
+
+// Or returns the value or def if the value does not exist.
+func (o Optional[T]) Or(def T) T {
+	if o.Valid {
+		return o.Val
+	}
+	return def
+}
+
+// Maybe converts the result of a command into an Optional. redis.Nil is
+// converted into an Optional without a value and a nil error, e.g.
+//
+//	n, err := redistyped.Maybe(redistyped.Get[int64](ctx, rdb, "counter"))
+//	if err != nil {
+//		return err
+//	}
+//	count := n.Or(0)
+func Maybe[T any](val T, err error) (Optional[T], error) {
+	switch err {
+	case nil:
+		return Some(val), nil
+	case redis.Nil:
+		return Optional[T]{}, nil
+	default:
+		return Optional[T]{}, err
+	}
+}
@@ -0,0 +1,82 @@
+// Package redistyped provides generic helpers that return typed results
+// instead of commands, e.g.
+//
+//	user, err := redistyped.Get[User](ctx, rdb, "user:1")
+//
+// Values are scanned like with StringCmd.Scan, so T can be any type
+// supported by Scan, a type implementing encoding.BinaryUnmarshaler or,
+// when the client has Options.Codec, any type supported by the codec.
+package redistyped
+
+import (
+	"context"
+
+	"github.com/farss/redis/v8"
+)
+
+// Get gets the value of the key. It returns redis.Nil when the key does not
+// exist.
+func Get[T any](ctx context.Context, c redis.Cmdable, key string) (T, error) {
+	return scanString[T](c.Get(ctx, key))
+}
+
+// HGet gets the value of the field of the hash. It returns redis.Nil when
+// the field does not exist.
+func HGet[T any](ctx context.Context, c redis.Cmdable, key, field string) (T, error) {
+	return scanString[T](c.HGet(ctx, key, field))
+}
+
+// HGetAll gets all the fields of the hash and scans them into a struct
+// using the `redis:"field"` tags. It returns the zero value when the key does
+// not exist.
+func HGetAll[T any](ctx context.Context, c redis.Cmdable, key string) (T, error) {
+	return scanMap[T](c.HGetAll(ctx, key))
+}
+
+// MGet gets the values of the keys. The keys that do not exist are not
+// included in the returned map.
+func MGet[T any](ctx context.Context, c redis.Cmdable, keys ...string) (map[string]T, error) {
+	return scanSlice[T](c.MGet(ctx, keys...), keys)
+}
+
+func scanString[T any](cmd *redis.StringCmd) (T, error) {
+	var v T
+	if err := cmd.Scan(&v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+func scanMap[T any](cmd *redis.StringStringMapCmd) (T, error) {
+	var v T
+	if err := cmd.Scan(&v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+func scanSlice[T any](cmd *redis.SliceCmd, keys []string) (map[string]T, error) {
+	vals, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]T, len(vals))
+	dst := make([]interface{}, len(vals))
+	for i := range values {
+		dst[i] = &values[i]
+	}
+	if err := cmd.ScanValues(dst...); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]T, len(vals))
+	for i, val := range vals {
+		if val != nil {
+			m[keys[i]] = values[i]
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,70 @@
+package redistyped
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/farss/redis/v8"
+)
+
+func TestScanString(t *testing.T) {
+	n, err := scanString[int](redis.NewStringResult("42", nil))
+	if err != nil || n != 42 {
+		t.Fatalf("got %d, %v, want 42", n, err)
+	}
+
+	if _, err := scanString[int](redis.NewStringResult("", redis.Nil)); err != redis.Nil {
+		t.Fatalf("got %v, want redis.Nil", err)
+	}
+	if _, err := scanString[int](redis.NewStringResult("abc", nil)); err == nil {
+		t.Fatal("got nil error for an invalid int")
+	}
+}
+
+func TestScanMap(t *testing.T) {
+	type user struct {
+		Name string `redis:"name"`
+		Age  int    `redis:"age"`
+	}
+
+	u, err := scanMap[user](redis.NewStringStringMapResult(map[string]string{
+		"name": "alice",
+		"age":  "30",
+	}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (user{Name: "alice", Age: 30}); u != want {
+		t.Fatalf("got %+v, want %+v", u, want)
+	}
+}
+
+func TestScanSlice(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+	m, err := scanSlice[int64](redis.NewSliceResult([]interface{}{"1", nil, "3"}, nil), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"a": 1, "c": 3}; !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %v, want %v", m, want)
+	}
+}
+
+func TestMaybe(t *testing.T) {
+	n, err := Maybe(scanString[int](redis.NewStringResult("42", nil)))
+	if err != nil || n != Some(42) {
+		t.Fatalf("got %+v, %v, want 42", n, err)
+	}
+
+	n, err = Maybe(scanString[int](redis.NewStringResult("", redis.Nil)))
+	if err != nil || n.Valid {
+		t.Fatalf("got %+v, %v, want no value", n, err)
+	}
+	if got := n.Or(1); got != 1 {
+		t.Fatalf("got %d, want 1", got)
+	}
+
+	if _, err := Maybe(scanString[int](redis.NewStringResult("abc", nil))); err == nil {
+		t.Fatal("got nil error for an invalid int")
+	}
+}
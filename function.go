@@ -0,0 +1,276 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var (
+	functionLibraryRe  = regexp.MustCompile(`^#!lua\s+name=([A-Za-z0-9_]+)`)
+	functionRegisterRe = regexp.MustCompile(
+		`redis\.register_function\s*(?:\(\s*|\{[^}]*?function_name\s*=\s*)['"]([A-Za-z0-9_]+)['"]`)
+	functionNoWritesRe = regexp.MustCompile(`flags\s*=\s*\{[^}]*['"]no-writes['"]`)
+)
+
+// FunctionLibrary is a library of Redis functions loaded by FunctionManager.
+type FunctionLibrary struct {
+	// Name is the library name from the "#!lua name=<name>" shebang.
+	Name string
+	// Path is the path of the source in the file system.
+	Path string
+	// Version is the SHA1 of the source.
+	Version string
+	// Functions are the names of the functions registered by the library.
+	Functions []string
+	// ReadOnly are the names of the functions registered with the no-writes
+	// flag. They are called using FCALL_RO.
+	ReadOnly []string
+
+	code string
+}
+
+// FunctionManager loads libraries of Redis functions (Redis >= 7.0) from
+// .lua files and calls the functions. Every file must start with the
+// "#!lua name=<library>" shebang. It's safe for concurrent use by multiple
+// goroutines.
+type FunctionManager struct {
+	client UniversalClient
+	fsys   fs.FS
+
+	mu        sync.RWMutex
+	libs      map[string]*FunctionLibrary
+	functions map[string]*FunctionLibrary
+	loaded    map[string]string // library versions that are loaded
+}
+
+// NewFunctionManager returns a FunctionManager that reads the libraries
+// from the file system, e.g. embed.FS, and loads them using the client.
+func NewFunctionManager(client UniversalClient, fsys fs.FS) *FunctionManager {
+	return &FunctionManager{
+		client:    client,
+		fsys:      fsys,
+		libs:      make(map[string]*FunctionLibrary),
+		functions: make(map[string]*FunctionLibrary),
+		loaded:    make(map[string]string),
+	}
+}
+
+// Load reads the libraries and loads the new and changed ones using
+// FUNCTION LOAD REPLACE. With ClusterClient the libraries are loaded on all
+// the master nodes.
+func (m *FunctionManager) Load(ctx context.Context) error {
+	libs, err := m.readLibraries()
+	if err != nil {
+		return err
+	}
+
+	functions := make(map[string]*FunctionLibrary)
+	for _, lib := range libs {
+		for _, fn := range lib.Functions {
+			if other, ok := functions[fn]; ok {
+				return fmt.Errorf("redis: function %q is registered by %s and %s",
+					fn, other.Path, lib.Path)
+			}
+			functions[fn] = lib
+		}
+	}
+
+	m.mu.RLock()
+	var changed []*FunctionLibrary
+	for _, lib := range libs {
+		if m.loaded[lib.Name] != lib.Version {
+			changed = append(changed, lib)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, lib := range changed {
+		if err := m.loadLibrary(ctx, lib.code); err != nil {
+			return fmt.Errorf("redis: loading %s failed: %w", lib.Path, err)
+		}
+	}
+
+	m.mu.Lock()
+	for _, lib := range changed {
+		m.loaded[lib.Name] = lib.Version
+	}
+	m.libs = libs
+	m.functions = functions
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *FunctionManager) loadLibrary(ctx context.Context, code string) error {
+	// ClusterClient sends FUNCTION LOAD to all the masters, but Ring does not.
+	if ring, ok := m.client.(*Ring); ok {
+		return ring.ForEachShard(ctx, func(ctx context.Context, shard *Client) error {
+			return shard.FunctionLoadReplace(ctx, code).Err()
+		})
+	}
+	return m.client.FunctionLoadReplace(ctx, code).Err()
+}
+
+// Reload forgets which libraries are loaded and loads all of them again,
+// e.g. after Redis was restarted without persistence.
+func (m *FunctionManager) Reload(ctx context.Context) error {
+	m.mu.Lock()
+	m.loaded = make(map[string]string)
+	m.mu.Unlock()
+	return m.Load(ctx)
+}
+
+func (m *FunctionManager) readLibraries() (map[string]*FunctionLibrary, error) {
+	libs := make(map[string]*FunctionLibrary)
+	err := fs.WalkDir(m.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".lua" {
+			return nil
+		}
+
+		b, err := fs.ReadFile(m.fsys, name)
+		if err != nil {
+			return err
+		}
+		lib, err := parseFunctionLibrary(name, string(b))
+		if err != nil {
+			return err
+		}
+
+		if other, ok := libs[lib.Name]; ok {
+			return fmt.Errorf("redis: library %q is defined in %s and %s",
+				lib.Name, other.Path, lib.Path)
+		}
+		libs[lib.Name] = lib
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return libs, nil
+}
+
+func parseFunctionLibrary(name, code string) (*FunctionLibrary, error) {
+	m := functionLibraryRe.FindStringSubmatch(code)
+	if m == nil {
+		return nil, fmt.Errorf(`redis: %s does not start with "#!lua name=<library>"`, name)
+	}
+
+	var functions, readOnly []string
+	matches := functionRegisterRe.FindAllStringSubmatchIndex(code, -1)
+	for i, fm := range matches {
+		fn := code[fm[2]:fm[3]]
+		functions = append(functions, fn)
+
+		// Flags can only be passed with named arguments, so look for them
+		// up to the next registration.
+		end := len(code)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if functionNoWritesRe.MatchString(code[fm[1]:end]) {
+			readOnly = append(readOnly, fn)
+		}
+	}
+	sort.Strings(functions)
+	sort.Strings(readOnly)
+
+	h := sha1.New()
+	_, _ = h.Write([]byte(code))
+
+	return &FunctionLibrary{
+		Name:      m[1],
+		Path:      name,
+		Version:   hex.EncodeToString(h.Sum(nil)),
+		Functions: functions,
+		ReadOnly:  readOnly,
+		code:      code,
+	}, nil
+}
+
+// Libraries returns the libraries read by the last Load sorted by name.
+func (m *FunctionManager) Libraries() []*FunctionLibrary {
+	m.mu.RLock()
+	libs := make([]*FunctionLibrary, 0, len(m.libs))
+	for _, lib := range m.libs {
+		libs = append(libs, lib)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].Name < libs[j].Name
+	})
+	return libs
+}
+
+// Function returns the function registered by one of the libraries or nil.
+// Load must be called first.
+func (m *FunctionManager) Function(name string) *Function {
+	m.mu.RLock()
+	lib := m.functions[name]
+	m.mu.RUnlock()
+	if lib == nil {
+		return nil
+	}
+	return &Function{
+		client:   m.client,
+		name:     name,
+		library:  lib.Name,
+		readOnly: contains(lib.ReadOnly, name),
+	}
+}
+
+// Call calls the function registered by one of the libraries.
+func (m *FunctionManager) Call(ctx context.Context, name string, keys []string, args ...interface{}) *Cmd {
+	fn := m.Function(name)
+	if fn == nil {
+		cmd := NewCmd(ctx)
+		cmd.SetErr(fmt.Errorf("redis: function %q is not registered", name))
+		return cmd
+	}
+	return fn.Call(ctx, keys, args...)
+}
+
+//------------------------------------------------------------------------------
+
+// Function is a Redis function from a library loaded by FunctionManager.
+type Function struct {
+	client   UniversalClient
+	name     string
+	library  string
+	readOnly bool
+}
+
+// Name returns the function name.
+func (f *Function) Name() string {
+	return f.name
+}
+
+// Library returns the name of the library that registers the function.
+func (f *Function) Library() string {
+	return f.library
+}
+
+// ReadOnly reports whether the function is registered with the no-writes
+// flag.
+func (f *Function) ReadOnly() bool {
+	return f.readOnly
+}
+
+// Call invokes the function using FCALL or, for read-only functions, using
+// FCALL_RO, so with ClusterOptions.ReadOnly they can be executed on replicas.
+func (f *Function) Call(ctx context.Context, keys []string, args ...interface{}) *Cmd {
+	if f.readOnly {
+		return f.client.FCallRO(ctx, f.name, keys, args...)
+	}
+	return f.client.FCall(ctx, f.name, keys, args...)
+}
@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgeOptions are used to configure hedged reads of ClusterClient.
+type HedgeOptions struct {
+	// Percentile is the percentage (0-100) of the commands that are
+	// expected to reply before the command is sent to another node, e.g.
+	// 95 hedges the commands that are slower than p95 of the command.
+	// Default is 95.
+	Percentile float64
+	// MinDelay is the minimum time to wait for the reply before the
+	// command is hedged.
+	// Default is 1 millisecond.
+	MinDelay time.Duration
+	// MaxDelay is the maximum time to wait for the reply before the
+	// command is hedged. It is also used until MinSamples latencies of the
+	// command are recorded.
+	// Default is 100 milliseconds.
+	MaxDelay time.Duration
+	// MinSamples is the number of latencies of the command that are
+	// recorded before the delay is calculated from Percentile.
+	// Default is 100.
+	MinSamples int
+}
+
+func (opt *HedgeOptions) init() {
+	if opt.Percentile == 0 {
+		opt.Percentile = 95
+	}
+	if opt.MinDelay == 0 {
+		opt.MinDelay = time.Millisecond
+	}
+	if opt.MaxDelay == 0 {
+		opt.MaxDelay = 100 * time.Millisecond
+	}
+	if opt.MinSamples == 0 {
+		opt.MinSamples = 100
+	}
+}
+
+// hedgeDelayUpdate is how often, in the number of recorded latencies, the
+// delay of a command is calculated again.
+const hedgeDelayUpdate = 64
+
+// hedger records the latencies of the hedged commands by name.
+type hedger struct {
+	opt HedgeOptions
+
+	mu   sync.RWMutex
+	cmds map[string]*hedgeLatency
+}
+
+type hedgeLatency struct {
+	cmdLatency
+	delay int64 // atomic time.Duration, 0 until MinSamples are recorded
+}
+
+func newHedger(opt *HedgeOptions) *hedger {
+	h := &hedger{
+		opt:  *opt,
+		cmds: make(map[string]*hedgeLatency),
+	}
+	h.opt.init()
+	return h
+}
+
+func (h *hedger) latency(name string) *hedgeLatency {
+	h.mu.RLock()
+	l := h.cmds[name]
+	h.mu.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l = h.cmds[name]; l == nil {
+		l = new(hedgeLatency)
+		h.cmds[name] = l
+	}
+	return l
+}
+
+func (h *hedger) record(l *hedgeLatency, d time.Duration) {
+	l.record(d, nil)
+	n := atomic.LoadUint64(&l.count)
+	if n == uint64(h.opt.MinSamples) || (n > uint64(h.opt.MinSamples) && n%hedgeDelayUpdate == 0) {
+		atomic.StoreInt64(&l.delay, int64(l.stats().Percentile(h.opt.Percentile)))
+	}
+}
+
+func (h *hedger) delay(l *hedgeLatency) time.Duration {
+	d := time.Duration(atomic.LoadInt64(&l.delay))
+	switch {
+	case d == 0 || d > h.opt.MaxDelay:
+		return h.opt.MaxDelay
+	case d < h.opt.MinDelay:
+		return h.opt.MinDelay
+	default:
+		return d
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type hedgeResult struct {
+	node *clusterNode
+	cmd  Cmder
+	err  error
+}
+
+// processHedged processes the read-only cmd on the node and, if there is no
+// reply within the hedge delay, also on another node serving the slot. The
+// first reply is copied to cmd and the node that sent it is returned. The
+// slower command is not canceled, so its connection can be reused.
+//
+// The command is processed as usual, without a goroutine and a copy, when
+// there is no other healthy node to hedge it with.
+func (c *ClusterClient) processHedged(
+	ctx context.Context, node *clusterNode, slot int, cmd Cmder,
+) (*clusterNode, error) {
+	other := c.hedgeNode(ctx, node, slot)
+	if other == nil {
+		return node, node.Client.Process(ctx, cmd)
+	}
+
+	l := c.hedger.latency(cmd.Name())
+	timer := time.NewTimer(c.hedger.delay(l))
+	defer timer.Stop()
+
+	ch := make(chan hedgeResult, 2)
+	run := func(node *clusterNode, attempt Cmder) {
+		start := time.Now()
+		err := node.Client.Process(ctx, attempt)
+		c.hedger.record(l, time.Since(start))
+		ch <- hedgeResult{node: node, cmd: attempt, err: err}
+	}
+
+	// Every attempt uses its own copy of the command, because the slower
+	// one keeps reading the reply. The copy for the other node is only
+	// made when the delay elapses.
+	go run(node, copyCmd(cmd))
+	pending := 1
+
+	var res hedgeResult
+	select {
+	case res = <-ch:
+		pending--
+	case <-timer.C:
+		if !other.Failing() {
+			go run(other, copyCmd(cmd))
+			pending++
+		}
+		res = <-ch
+		pending--
+	}
+
+	// Prefer the reply of the other node over a network error.
+	if pending > 0 && res.err != nil && !isRedisError(res.err) {
+		res = <-ch
+	}
+
+	reflect.ValueOf(cmd).Elem().Set(reflect.ValueOf(res.cmd).Elem())
+	return res.node, res.err
+}
+
+// hedgeable reports whether the read-only cmd can be hedged. The commands
+// with a custom read timeout and the commands that pass the reply to a
+// callback, e.g. BytesCmd, are not hedged, because both attempts would call
+// the callback, the slower one after Process returned.
+func hedgeable(cmd Cmder) bool {
+	switch cmd.(type) {
+	case *BytesCmd, *BytesSliceCmd:
+		return false
+	}
+	return cmd.readTimeout() == nil
+}
+
+// hedgeNode returns a random healthy node serving the slot other than the
+// node or nil.
+func (c *ClusterClient) hedgeNode(ctx context.Context, node *clusterNode, slot int) *clusterNode {
+	state, err := c.state.Get(ctx)
+	if err != nil {
+		return nil
+	}
+	nodes := state.slotNodes(slot)
+	if len(nodes) < 2 {
+		return nil
+	}
+	off := rand.Intn(len(nodes))
+	for i := range nodes {
+		if n := nodes[(off+i)%len(nodes)]; n != node && !n.Failing() {
+			return n
+		}
+	}
+	return nil
+}
+
+// copyCmd returns a shallow copy of the unprocessed cmd.
+func copyCmd(cmd Cmder) Cmder {
+	v := reflect.ValueOf(cmd).Elem()
+	cp := reflect.New(v.Type())
+	cp.Elem().Set(v)
+	return cp.Interface().(Cmder)
+}
@@ -0,0 +1,227 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DialHook is an optional interface a Hook can implement to observe new
+// network connections of a Client, including the connections dialed in the
+// background to maintain MinIdleConns.
+type DialHook interface {
+	AfterDial(ctx context.Context, event *DialEvent)
+}
+
+// ConnHook is an optional interface a Hook can implement to observe how a
+// Client takes connections from the pool and returns them back.
+type ConnHook interface {
+	AfterConnAcquire(ctx context.Context, event *ConnAcquireEvent)
+	AfterConnRelease(ctx context.Context, event *ConnReleaseEvent)
+}
+
+// RetryHook is an optional interface a Hook can implement to observe
+// retries. BeforeRetry is called before the backoff, so the time spent in
+// the backoff is not hidden from the hook.
+type RetryHook interface {
+	BeforeRetry(ctx context.Context, event *RetryEvent)
+}
+
+// ReconnectHook is an optional interface a Hook can implement to observe
+// connections that are closed because of an error and are replaced with
+// new ones.
+type ReconnectHook interface {
+	AfterReconnect(ctx context.Context, event *ReconnectEvent)
+}
+
+// NodeHook is an optional interface a Hook added to ClusterClient or Ring
+// can implement to observe the commands and pipelines processed by every
+// node, e.g. to tag metrics with the node address and role. Unlike
+// AfterProcess, AfterProcessNode is called for every attempt, so redirects
+// and retries on other nodes are reported separately.
+type NodeHook interface {
+	AfterProcessNode(ctx context.Context, event *NodeEvent)
+}
+
+// Node roles reported by NodeEvent.
+const (
+	NodeRoleMaster  = "master"
+	NodeRoleReplica = "replica"
+	NodeRoleShard   = "shard" // Ring shard
+)
+
+// NodeEvent describes a command or a pipeline processed by a node.
+type NodeEvent struct {
+	Addr string
+	Role string
+	// Cmd is the processed command. It is nil for pipelines.
+	Cmd Cmder
+	// Cmds are the commands of the pipeline sent to the node.
+	Cmds     []Cmder
+	Duration time.Duration
+	Err      error
+}
+
+// nodeHooksStart returns the current time if there are NodeHook hooks or
+// zero time otherwise.
+func nodeHooksStart(hooks []Hook) time.Time {
+	for _, h := range hooks {
+		if _, ok := h.(NodeHook); ok {
+			return time.Now()
+		}
+	}
+	return time.Time{}
+}
+
+func afterProcessNode(ctx context.Context, hooks []Hook, event *NodeEvent) {
+	for _, h := range hooks {
+		if h, ok := h.(NodeHook); ok {
+			h.AfterProcessNode(ctx, event)
+		}
+	}
+}
+
+// DialEvent describes a dial of a new network connection.
+type DialEvent struct {
+	Network string
+	Addr    string
+	// Duration is how long it took to dial, including the TLS handshake.
+	Duration time.Duration
+	Err      error
+}
+
+// ConnAcquireEvent describes taking a connection from the pool.
+type ConnAcquireEvent struct {
+	Addr string
+	// Wait is how long it took to get the connection, i.e. waiting for
+	// a free connection, dialing a new one and initializing it with AUTH,
+	// SELECT and OnConnect.
+	Wait time.Duration
+	// New reports whether the connection was dialed for this command.
+	New bool
+	Err error
+}
+
+// ConnReleaseEvent describes returning a connection to the pool.
+type ConnReleaseEvent struct {
+	Addr string
+	// Removed reports whether the connection was closed instead of being
+	// returned to the pool because of Err.
+	Removed bool
+	Err     error
+}
+
+// RetryEvent describes a retry of a command or a pipeline.
+type RetryEvent struct {
+	// Cmd is the retried command. It is nil for pipelines.
+	Cmd Cmder
+	// Cmds are the commands of the retried pipeline.
+	Cmds []Cmder
+	// Attempt is the number of the retry starting with 1.
+	Attempt int
+	// Err is the error of the previous attempt that caused the retry.
+	Err error
+	// Backoff is how long the client waits before the retry.
+	Backoff time.Duration
+}
+
+// ReconnectEvent describes a connection that is closed because of an error.
+type ReconnectEvent struct {
+	Addr string
+	// Err is the error that caused the reconnect.
+	Err error
+	// PubSub reports whether it is the connection of a PubSub, which is
+	// reconnected right away. Other connections are dialed again when
+	// needed.
+	PubSub bool
+}
+
+func beforeRetry(ctx context.Context, hooks []Hook, event *RetryEvent) {
+	for _, h := range hooks {
+		if h, ok := h.(RetryHook); ok {
+			h.BeforeRetry(ctx, event)
+		}
+	}
+}
+
+func afterReconnect(ctx context.Context, hooks []Hook, event *ReconnectEvent) {
+	for _, h := range hooks {
+		if h, ok := h.(ReconnectHook); ok {
+			h.AfterReconnect(ctx, event)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// connHooks are the hooks of a Client that observe its connections. They
+// are shared with the connection pool and the clones of the client, because
+// they share the connections.
+type connHooks struct {
+	mu    sync.RWMutex
+	hooks []Hook
+	ids   []uint64
+}
+
+func (hs *connHooks) add(id uint64, hook Hook) {
+	switch hook.(type) {
+	case DialHook, ConnHook, RetryHook, ReconnectHook:
+	default:
+		return
+	}
+	hs.mu.Lock()
+	hs.hooks = append(hs.hooks[:len(hs.hooks):len(hs.hooks)], hook)
+	hs.ids = append(hs.ids, id)
+	hs.mu.Unlock()
+}
+
+func (hs *connHooks) remove(id uint64) {
+	if hs == nil {
+		return
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for i, hookID := range hs.ids {
+		if hookID == id {
+			hooks := make([]Hook, 0, len(hs.hooks)-1)
+			hooks = append(hooks, hs.hooks[:i]...)
+			hs.hooks = append(hooks, hs.hooks[i+1:]...)
+			hs.ids = append(hs.ids[:i], hs.ids[i+1:]...)
+			return
+		}
+	}
+}
+
+func (hs *connHooks) get() []Hook {
+	if hs == nil {
+		return nil
+	}
+	hs.mu.RLock()
+	hooks := hs.hooks
+	hs.mu.RUnlock()
+	return hooks
+}
+
+func (hs *connHooks) afterDial(ctx context.Context, event *DialEvent) {
+	for _, h := range hs.get() {
+		if h, ok := h.(DialHook); ok {
+			h.AfterDial(ctx, event)
+		}
+	}
+}
+
+func (hs *connHooks) afterConnAcquire(ctx context.Context, event *ConnAcquireEvent) {
+	for _, h := range hs.get() {
+		if h, ok := h.(ConnHook); ok {
+			h.AfterConnAcquire(ctx, event)
+		}
+	}
+}
+
+func (hs *connHooks) afterConnRelease(ctx context.Context, event *ConnReleaseEvent) {
+	for _, h := range hs.get() {
+		if h, ok := h.(ConnHook); ok {
+			h.AfterConnRelease(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8/internal/proto"
+)
+
+// Info is the INFO reply parsed into a struct. Only the requested sections
+// are filled, and the fields that are not reported by the Redis version are
+// left empty, so Server.RedisVersion can be used to tell them apart.
+type Info struct {
+	Server      InfoServer
+	Clients     InfoClients
+	Memory      InfoMemory
+	Persistence InfoPersistence
+	Replication InfoReplication
+	// Keyspace contains the keyspace statistics by DB index.
+	Keyspace map[int]InfoKeyspace
+
+	// Raw contains all the fields by section, including the ones that are
+	// parsed into the struct, e.g. Raw["stats"]["total_commands_processed"].
+	// Section names are lower case.
+	Raw map[string]map[string]string
+}
+
+type InfoServer struct {
+	RedisVersion string
+	RedisMode    string
+	OS           string
+	ArchBits     int
+	ProcessID    int
+	RunID        string
+	TCPPort      int
+	Uptime       time.Duration
+	Executable   string
+	ConfigFile   string
+}
+
+type InfoClients struct {
+	ConnectedClients int64
+	BlockedClients   int64
+	TrackingClients  int64
+	MaxClients       int64 // Redis >= 7.0
+}
+
+type InfoMemory struct {
+	UsedMemory            int64
+	UsedMemoryRSS         int64
+	UsedMemoryPeak        int64
+	UsedMemoryLua         int64
+	MaxMemory             int64
+	MaxMemoryPolicy       string
+	MemFragmentationRatio float64
+}
+
+type InfoPersistence struct {
+	Loading                 bool
+	RDBChangesSinceLastSave int64
+	RDBBgsaveInProgress     bool
+	RDBLastSaveTime         time.Time
+	RDBLastBgsaveStatus     string
+	AOFEnabled              bool
+	AOFRewriteInProgress    bool
+	AOFLastBgrewriteStatus  string
+}
+
+type InfoReplication struct {
+	Role             string
+	ConnectedSlaves  int
+	MasterReplID     string
+	MasterReplOffset int64
+
+	// Replica fields.
+	MasterHost       string
+	MasterPort       int
+	MasterLinkStatus string
+
+	// Replicas are the connected replicas of a master.
+	Replicas []InfoReplica
+}
+
+type InfoReplica struct {
+	IP     string
+	Port   int
+	State  string
+	Offset int64
+	Lag    time.Duration
+}
+
+type InfoKeyspace struct {
+	Keys    int64
+	Expires int64
+	AvgTTL  time.Duration
+}
+
+//------------------------------------------------------------------------------
+
+type InfoCmd struct {
+	baseCmd
+
+	val *Info
+}
+
+var _ Cmder = (*InfoCmd)(nil)
+
+func NewInfoCmd(ctx context.Context, args ...interface{}) *InfoCmd {
+	return &InfoCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *InfoCmd) SetVal(val *Info) {
+	cmd.val = val
+}
+
+func (cmd *InfoCmd) Val() *Info {
+	return cmd.val
+}
+
+func (cmd *InfoCmd) Result() (*Info, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *InfoCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *InfoCmd) readReply(rd *proto.Reader) error {
+	s, err := rd.ReadString()
+	if err != nil {
+		return err
+	}
+	cmd.val = parseInfo(s)
+	return nil
+}
+
+// InfoStruct is like Info, but parses the reply into Info. Several sections
+// can be requested with Redis >= 7.0.
+func (c cmdable) InfoStruct(ctx context.Context, sections ...string) *InfoCmd {
+	args := make([]interface{}, 1+len(sections))
+	args[0] = "info"
+	for i, section := range sections {
+		args[1+i] = section
+	}
+	cmd := NewInfoCmd(ctx, args...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
+func parseInfo(s string) *Info {
+	info := &Info{
+		Raw: make(map[string]map[string]string),
+	}
+
+	var section map[string]string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			name := strings.ToLower(strings.TrimSpace(line[1:]))
+			section = make(map[string]string)
+			info.Raw[name] = section
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		if section == nil {
+			section = make(map[string]string)
+			info.Raw[""] = section
+		}
+		section[line[:i]] = line[i+1:]
+	}
+
+	if m, ok := info.Raw["server"]; ok {
+		info.Server = InfoServer{
+			RedisVersion: m["redis_version"],
+			RedisMode:    m["redis_mode"],
+			OS:           m["os"],
+			ArchBits:     infoInt(m, "arch_bits"),
+			ProcessID:    infoInt(m, "process_id"),
+			RunID:        m["run_id"],
+			TCPPort:      infoInt(m, "tcp_port"),
+			Uptime:       time.Duration(infoInt64(m, "uptime_in_seconds")) * time.Second,
+			Executable:   m["executable"],
+			ConfigFile:   m["config_file"],
+		}
+	}
+	if m, ok := info.Raw["clients"]; ok {
+		info.Clients = InfoClients{
+			ConnectedClients: infoInt64(m, "connected_clients"),
+			BlockedClients:   infoInt64(m, "blocked_clients"),
+			TrackingClients:  infoInt64(m, "tracking_clients"),
+			MaxClients:       infoInt64(m, "maxclients"),
+		}
+	}
+	if m, ok := info.Raw["memory"]; ok {
+		info.Memory = InfoMemory{
+			UsedMemory:            infoInt64(m, "used_memory"),
+			UsedMemoryRSS:         infoInt64(m, "used_memory_rss"),
+			UsedMemoryPeak:        infoInt64(m, "used_memory_peak"),
+			UsedMemoryLua:         infoInt64(m, "used_memory_lua"),
+			MaxMemory:             infoInt64(m, "maxmemory"),
+			MaxMemoryPolicy:       m["maxmemory_policy"],
+			MemFragmentationRatio: infoFloat(m, "mem_fragmentation_ratio"),
+		}
+	}
+	if m, ok := info.Raw["persistence"]; ok {
+		info.Persistence = InfoPersistence{
+			Loading:                 infoBool(m, "loading"),
+			RDBChangesSinceLastSave: infoInt64(m, "rdb_changes_since_last_save"),
+			RDBBgsaveInProgress:     infoBool(m, "rdb_bgsave_in_progress"),
+			RDBLastSaveTime:         infoTime(m, "rdb_last_save_time"),
+			RDBLastBgsaveStatus:     m["rdb_last_bgsave_status"],
+			AOFEnabled:              infoBool(m, "aof_enabled"),
+			AOFRewriteInProgress:    infoBool(m, "aof_rewrite_in_progress"),
+			AOFLastBgrewriteStatus:  m["aof_last_bgrewrite_status"],
+		}
+	}
+	if m, ok := info.Raw["replication"]; ok {
+		info.Replication = parseInfoReplication(m)
+	}
+	if m, ok := info.Raw["keyspace"]; ok {
+		info.Keyspace = make(map[int]InfoKeyspace, len(m))
+		for key, value := range m {
+			if !strings.HasPrefix(key, "db") {
+				continue
+			}
+			db, err := strconv.Atoi(key[2:])
+			if err != nil {
+				continue
+			}
+			kv := parseInfoValues(value)
+			info.Keyspace[db] = InfoKeyspace{
+				Keys:    infoInt64(kv, "keys"),
+				Expires: infoInt64(kv, "expires"),
+				AvgTTL:  time.Duration(infoInt64(kv, "avg_ttl")) * time.Millisecond,
+			}
+		}
+	}
+
+	return info
+}
+
+func parseInfoReplication(m map[string]string) InfoReplication {
+	repl := InfoReplication{
+		Role:             m["role"],
+		ConnectedSlaves:  infoInt(m, "connected_slaves"),
+		MasterReplID:     m["master_replid"],
+		MasterReplOffset: infoInt64(m, "master_repl_offset"),
+		MasterHost:       m["master_host"],
+		MasterPort:       infoInt(m, "master_port"),
+		MasterLinkStatus: m["master_link_status"],
+	}
+	for i := 0; i < repl.ConnectedSlaves; i++ {
+		value, ok := m["slave"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		kv := parseInfoValues(value)
+		repl.Replicas = append(repl.Replicas, InfoReplica{
+			IP:     kv["ip"],
+			Port:   infoInt(kv, "port"),
+			State:  kv["state"],
+			Offset: infoInt64(kv, "offset"),
+			Lag:    time.Duration(infoInt64(kv, "lag")) * time.Second,
+		})
+	}
+	return repl
+}
+
+// parseInfoValues parses values like "keys=1,expires=0,avg_ttl=0".
+func parseInfoValues(s string) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if i := strings.IndexByte(kv, '='); i != -1 {
+			m[kv[:i]] = kv[i+1:]
+		}
+	}
+	return m
+}
+
+func infoInt(m map[string]string, key string) int {
+	n, _ := strconv.Atoi(m[key])
+	return n
+}
+
+func infoInt64(m map[string]string, key string) int64 {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	return n
+}
+
+func infoFloat(m map[string]string, key string) float64 {
+	f, _ := strconv.ParseFloat(m[key], 64)
+	return f
+}
+
+func infoTime(m map[string]string, key string) time.Time {
+	if sec := infoInt64(m, key); sec > 0 {
+		return time.Unix(sec, 0)
+	}
+	return time.Time{}
+}
+
+func infoBool(m map[string]string, key string) bool {
+	return m[key] == "1"
+}
@@ -1,10 +1,13 @@
 package hscan
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
+
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 // decoderFunc represents decoding functions for default built-in types.
@@ -44,8 +47,49 @@ var (
 	// struct type that is scanned. This caches the field types and the corresponding
 	// decoder functions to avoid iterating through struct fields on subsequent scans.
 	globalStructMap = newStructMap()
+
+	unmarshalerTypes = []reflect.Type{
+		reflect.TypeOf((*proto.Unmarshaler)(nil)).Elem(),
+		reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem(),
+		reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem(),
+	}
 )
 
+// decoderFor returns the decoder of the fields of the type. Types that
+// implement one of the unmarshaler interfaces are decoded with proto.Scan.
+func decoderFor(t reflect.Type) decoderFunc {
+	if isUnmarshaler(t) {
+		return decodeUnmarshaler
+	}
+	return decoders[t.Kind()]
+}
+
+func isUnmarshaler(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	for _, u := range unmarshalerTypes {
+		if ptr.Implements(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesCodec reports whether the fields of the type are decoded with the
+// codec of the encoding, if any, i.e. the type has no built-in decoder.
+func usesCodec(t reflect.Type) bool {
+	if isUnmarshaler(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Array, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Struct:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	default:
+		return false
+	}
+}
+
 func Struct(dst interface{}) (StructValue, error) {
 	v := reflect.ValueOf(dst)
 
@@ -68,6 +112,12 @@ func Struct(dst interface{}) (StructValue, error) {
 // Scan scans the results from a key-value Redis map result set to a destination struct.
 // The Redis keys are matched to the struct's field with the `redis` tag.
 func Scan(dst interface{}, keys []interface{}, vals []interface{}) error {
+	return ScanEncoding(dst, keys, vals, nil)
+}
+
+// ScanEncoding is like Scan, but the fields of the types without built-in
+// decoders are unmarshaled with the codec of the encoding.
+func ScanEncoding(dst interface{}, keys []interface{}, vals []interface{}, enc *proto.Encoding) error {
 	if len(keys) != len(vals) {
 		return errors.New("args should have the same number of keys and vals")
 	}
@@ -89,7 +139,7 @@ func Scan(dst interface{}, keys []interface{}, vals []interface{}) error {
 			continue
 		}
 
-		if err := strct.Scan(key, val); err != nil {
+		if err := strct.ScanEncoding(key, val, enc); err != nil {
 			return err
 		}
 	}
@@ -196,6 +246,10 @@ func decodeSlice(f reflect.Value, s string) error {
 	return nil
 }
 
+func decodeUnmarshaler(f reflect.Value, s string) error {
+	return proto.Scan([]byte(s), f.Addr().Interface())
+}
+
 func decodeUnsupported(v reflect.Value, s string) error {
 	return fmt.Errorf("redis.Scan(unsupported %s)", v.Type())
 }
@@ -1,12 +1,17 @@
 package hscan
 
 import (
+	"encoding/json"
 	"math"
+	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 type data struct {
@@ -175,4 +180,109 @@ var _ = Describe("Scan", func() {
 		Expect(Scan(&d, i{"bool"}, i{""})).To(HaveOccurred())
 		Expect(Scan(&d, i{"bool"}, i{"123"})).To(HaveOccurred())
 	})
+
+	It("scans embedded structs", func() {
+		type Base struct {
+			ID   int    `redis:"id"`
+			Name string `redis:"name"`
+		}
+		type Meta struct {
+			Tag string `redis:"tag"`
+		}
+		type item struct {
+			Base
+			*Meta
+			Name string `redis:"name"`
+		}
+
+		var it item
+		Expect(Scan(&it, i{"id", "name", "tag"}, i{"1", "outer", "t"})).NotTo(HaveOccurred())
+		Expect(it.ID).To(Equal(1))
+		Expect(it.Name).To(Equal("outer"))
+		Expect(it.Base.Name).To(Equal(""))
+		Expect(it.Meta).To(Equal(&Meta{Tag: "t"}))
+	})
+})
+
+var _ = Describe("Scan unmarshalers", func() {
+	It("scans fields that implement unmarshalers", func() {
+		type item struct {
+			Status status    `redis:"status"`
+			Time   time.Time `redis:"time"`
+		}
+
+		var it item
+		Expect(Scan(&it, i{"status", "time"}, i{"active", "2019-01-01T09:45:10Z"})).NotTo(HaveOccurred())
+		Expect(it.Status).To(Equal(status(1)))
+		Expect(it.Time).To(Equal(time.Date(2019, 1, 1, 9, 45, 10, 0, time.UTC)))
+	})
+})
+
+var _ = Describe("ScanEncoding", func() {
+	It("scans fields without built-in decoders with the codec", func() {
+		type item struct {
+			Name  string            `redis:"name"`
+			Tags  []string          `redis:"tags"`
+			Attrs map[string]string `redis:"attrs"`
+		}
+
+		enc := &proto.Encoding{Codec: jsonCodec{}}
+		var it item
+		Expect(ScanEncoding(&it, i{"name", "tags", "attrs"}, i{"a", `["x","y"]`, `{"k":"v"}`}, enc)).NotTo(HaveOccurred())
+		Expect(it).To(Equal(item{
+			Name:  "a",
+			Tags:  []string{"x", "y"},
+			Attrs: map[string]string{"k": "v"},
+		}))
+
+		// Without the codec the fields are not supported.
+		Expect(Scan(&item{}, i{"attrs"}, i{`{"k":"v"}`})).To(HaveOccurred())
+	})
+})
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+type status int
+
+func (s *status) UnmarshalText(b []byte) error {
+	if string(b) == "active" {
+		*s = 1
+	}
+	return nil
+}
+
+var _ = Describe("AppendFields", func() {
+	It("appends tagged fields", func() {
+		type Base struct {
+			ID int `redis:"id"`
+		}
+		type Meta struct {
+			Tag string `redis:"tag"`
+		}
+		type item struct {
+			Base
+			*Meta
+			Name     string `redis:"name"`
+			Comment  string `redis:"comment,omitempty"`
+			Omit     string `redis:"-"`
+			Untagged string
+		}
+
+		v := item{Base: Base{ID: 1}, Name: "name", Omit: "omit", Untagged: "untagged"}
+		Expect(AppendFields(nil, reflect.ValueOf(v))).To(Equal([]interface{}{"id", 1, "name", "name"}))
+
+		v.Meta = &Meta{Tag: "t"}
+		v.Comment = "comment"
+		Expect(AppendFields([]interface{}{"hset", "key"}, reflect.ValueOf(v))).To(Equal([]interface{}{
+			"hset", "key", "id", 1, "tag", "t", "name", "name", "comment", "comment",
+		}))
+	})
 })
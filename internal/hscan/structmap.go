@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 // structMap contains the map of struct fields for target structs
@@ -32,44 +34,101 @@ func (s *structMap) get(t reflect.Type) *structSpec {
 // structSpec contains the list of all fields in a target struct.
 type structSpec struct {
 	m map[string]*structField
+	// fields are the fields in the order of the struct declaration.
+	fields []*structField
 }
 
 func (s *structSpec) set(tag string, sf *structField) {
+	if old, ok := s.m[tag]; ok {
+		// As in Go, the shallower field wins.
+		if len(old.index) <= len(sf.index) {
+			return
+		}
+		for i, f := range s.fields {
+			if f == old {
+				s.fields = append(s.fields[:i], s.fields[i+1:]...)
+				break
+			}
+		}
+	}
 	s.m[tag] = sf
+	s.fields = append(s.fields, sf)
 }
 
 func newStructSpec(t reflect.Type, fieldTag string) *structSpec {
-	numField := t.NumField()
 	out := &structSpec{
-		m: make(map[string]*structField, numField),
+		m: make(map[string]*structField, t.NumField()),
 	}
+	out.addFields(t, fieldTag, nil)
+	return out
+}
 
-	for i := 0; i < numField; i++ {
+func (s *structSpec) addFields(t reflect.Type, fieldTag string, index []int) {
+	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 
 		tag := f.Tag.Get(fieldTag)
-		if tag == "" || tag == "-" {
+		if tag == "-" {
 			continue
 		}
 
-		tag = strings.Split(tag, ",")[0]
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
 		if tag == "" {
+			// The fields of embedded structs are promoted.
+			if f.Anonymous {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					// Pointers to unexported structs can't be allocated.
+					if f.PkgPath != "" {
+						continue
+					}
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					s.addFields(ft, fieldTag, fieldIndex)
+				}
+			}
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
 			continue
 		}
 
 		// Use the built-in decoder.
-		out.set(tag, &structField{index: i, fn: decoders[f.Type.Kind()]})
+		s.set(name, &structField{
+			name:      name,
+			index:     fieldIndex,
+			fn:        decoderFor(f.Type),
+			codec:     usesCodec(f.Type),
+			omitEmpty: hasOption(opts[1:], "omitempty"),
+		})
 	}
+}
 
-	return out
+func hasOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
 }
 
 //------------------------------------------------------------------------------
 
 // structField represents a single field in a target struct.
 type structField struct {
-	index int
-	fn    decoderFunc
+	name      string
+	index     []int
+	fn        decoderFunc
+	codec     bool
+	omitEmpty bool
 }
 
 //------------------------------------------------------------------------------
@@ -80,14 +139,95 @@ type StructValue struct {
 }
 
 func (s StructValue) Scan(key string, value string) error {
+	return s.ScanEncoding(key, value, nil)
+}
+
+// ScanEncoding is like Scan, but the fields of the types without built-in
+// decoders, e.g. structs and maps, are unmarshaled with the codec of the
+// encoding.
+func (s StructValue) ScanEncoding(key string, value string, enc *proto.Encoding) error {
 	field, ok := s.spec.m[key]
 	if !ok {
 		return nil
 	}
-	if err := field.fn(s.value.Field(field.index), value); err != nil {
+	v := fieldByIndex(s.value, field.index)
+	fn := field.fn
+	if field.codec && enc != nil && enc.Codec != nil {
+		fn = func(v reflect.Value, s string) error {
+			return proto.ScanEncoding([]byte(s), v.Addr().Interface(), enc)
+		}
+	}
+	if err := fn(v, value); err != nil {
 		t := s.value.Type()
 		return fmt.Errorf("cannot scan redis.result %s into struct field %s.%s of type %s, error-%s",
-			value, t.Name(), t.Field(field.index).Name, t.Field(field.index).Type, err.Error())
+			value, t.Name(), t.FieldByIndex(field.index).Name, v.Type(), err.Error())
 	}
 	return nil
 }
+
+// Keys returns the keys of the tagged fields in the order of the struct
+// declaration.
+func (s StructValue) Keys() []string {
+	keys := make([]string, len(s.spec.fields))
+	for i, field := range s.spec.fields {
+		keys[i] = field.name
+	}
+	return keys
+}
+
+// Field returns the field with the key, allocating the nil embedded struct
+// pointers on the way.
+func (s StructValue) Field(key string) (reflect.Value, bool) {
+	field, ok := s.spec.m[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return fieldByIndex(s.value, field.index), true
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but allocates nil
+// embedded struct pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// AppendFields appends the names and the values of the fields of the struct
+// v that have the `redis:"field"` tag, including the fields of embedded
+// structs. Fields with the omitempty option are skipped when they have zero
+// values.
+func AppendFields(dst []interface{}, v reflect.Value) []interface{} {
+	spec := globalStructMap.get(v.Type())
+	for _, field := range spec.fields {
+		f, ok := fieldByIndexNoAlloc(v, field.index)
+		if !ok || !f.CanInterface() {
+			continue
+		}
+		if field.omitEmpty && f.IsZero() {
+			continue
+		}
+		dst = append(dst, field.name, f.Interface())
+	}
+	return dst
+}
+
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
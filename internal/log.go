@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 type Logging interface {
@@ -24,3 +25,73 @@ func (l *logger) Printf(ctx context.Context, format string, v ...interface{}) {
 var Logger Logging = &logger{
 	log: log.New(os.Stderr, "redis: ", log.LstdFlags|log.Lshortfile),
 }
+
+//------------------------------------------------------------------------------
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota - 1
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// StructuredLogging is a logger that supports levels and key/value fields.
+type StructuredLogging interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// Log logs the message using the logger. When the logger is nil, the message
+// is logged using Logger: directly if it supports StructuredLogging, or
+// formatted as "msg key=value ..." otherwise.
+func Log(ctx context.Context, logger StructuredLogging, level LogLevel, msg string, keyvals ...interface{}) {
+	if logger != nil {
+		logger.Log(ctx, level, msg, keyvals...)
+		return
+	}
+	if l, ok := Logger.(StructuredLogging); ok {
+		l.Log(ctx, level, msg, keyvals...)
+		return
+	}
+	Logger.Printf(ctx, "%s", FormatLog(msg, keyvals...))
+}
+
+// FormatLog formats the message and the key/value fields as a single line.
+func FormatLog(msg string, keyvals ...interface{}) string {
+	if len(keyvals) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteByte(' ')
+		fmt.Fprint(&b, keyvals[i])
+		b.WriteByte('=')
+		if i+1 < len(keyvals) {
+			v := fmt.Sprint(keyvals[i+1])
+			if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+				v = fmt.Sprintf("%q", v)
+			}
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
@@ -21,8 +21,13 @@ type Conn struct {
 	wr *proto.Writer
 
 	Inited    bool
+	DB        int    // the DB selected by the client that used the conn last
+	AuthGen   uint64 // the generation of the token the conn is authenticated with
 	pooled    bool
 	createdAt time.Time
+
+	turn        chan struct{} // the pool turn taken by Get
+	ctxDeadline bool          // Options.ContextDeadline
 }
 
 func NewConn(netConn net.Conn) *Conn {
@@ -52,10 +57,29 @@ func (cn *Conn) SetNetConn(netConn net.Conn) {
 	cn.bw.Reset(netConn)
 }
 
+// SetEncoding sets the encoding of the command args and the replies of the
+// connection.
+func (cn *Conn) SetEncoding(enc *proto.Encoding) {
+	cn.wr.SetEncoding(enc)
+	cn.rd.SetEncoding(enc)
+}
+
 func (cn *Conn) Write(b []byte) (int, error) {
 	return cn.netConn.Write(b)
 }
 
+// SetReadDeadline sets the read deadline of the underlying connection.
+// It can be called concurrently with WithReader, e.g. to interrupt
+// a blocked read.
+func (cn *Conn) SetReadDeadline(tm time.Time) error {
+	return cn.netConn.SetReadDeadline(tm)
+}
+
+// NetConn returns the underlying connection.
+func (cn *Conn) NetConn() net.Conn {
+	return cn.netConn
+}
+
 func (cn *Conn) RemoteAddr() net.Addr {
 	if cn.netConn != nil {
 		return cn.netConn.RemoteAddr()
@@ -64,7 +88,7 @@ func (cn *Conn) RemoteAddr() net.Addr {
 }
 
 func (cn *Conn) WithReader(ctx context.Context, timeout time.Duration, fn func(rd *proto.Reader) error) error {
-	if timeout != 0 {
+	if timeout != 0 || cn.ctxDeadline {
 		if err := cn.netConn.SetReadDeadline(cn.deadline(ctx, timeout)); err != nil {
 			return err
 		}
@@ -75,7 +99,7 @@ func (cn *Conn) WithReader(ctx context.Context, timeout time.Duration, fn func(r
 func (cn *Conn) WithWriter(
 	ctx context.Context, timeout time.Duration, fn func(wr *proto.Writer) error,
 ) error {
-	if timeout != 0 {
+	if timeout != 0 || cn.ctxDeadline {
 		if err := cn.netConn.SetWriteDeadline(cn.deadline(ctx, timeout)); err != nil {
 			return err
 		}
@@ -92,6 +116,29 @@ func (cn *Conn) WithWriter(
 	return cn.bw.Flush()
 }
 
+// WithBufferedWriter is like WithWriter, but keeps written data in the buffer
+// until it is full or Flush is called.
+func (cn *Conn) WithBufferedWriter(
+	ctx context.Context, timeout time.Duration, fn func(wr *proto.Writer) error,
+) error {
+	if timeout != 0 || cn.ctxDeadline {
+		if err := cn.netConn.SetWriteDeadline(cn.deadline(ctx, timeout)); err != nil {
+			return err
+		}
+	}
+	return fn(cn.wr)
+}
+
+// Flush writes buffered data to the connection.
+func (cn *Conn) Flush(ctx context.Context, timeout time.Duration) error {
+	if timeout != 0 || cn.ctxDeadline {
+		if err := cn.netConn.SetWriteDeadline(cn.deadline(ctx, timeout)); err != nil {
+			return err
+		}
+	}
+	return cn.bw.Flush()
+}
+
 func (cn *Conn) Close() error {
 	return cn.netConn.Close()
 }
@@ -64,6 +64,12 @@ type Options struct {
 	PoolTimeout        time.Duration
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
+
+	// ContextDeadline also applies the deadline of the context to the
+	// reads and writes of the connections without a timeout.
+	ContextDeadline bool
+
+	Logger internal.StructuredLogging
 }
 
 type lastDialErrorWrap struct {
@@ -77,7 +83,8 @@ type ConnPool struct {
 
 	lastDialError atomic.Value
 
-	queue chan struct{}
+	maxSize int32        // atomic, PoolSize or the size set with SetPoolSize
+	queue   atomic.Value // chan struct{}
 
 	connsMu      sync.Mutex
 	conns        []*Conn
@@ -97,11 +104,12 @@ func NewConnPool(opt *Options) *ConnPool {
 	p := &ConnPool{
 		opt: opt,
 
-		queue:     make(chan struct{}, opt.PoolSize),
+		maxSize:   int32(opt.PoolSize),
 		conns:     make([]*Conn, 0, opt.PoolSize),
 		idleConns: make([]*Conn, 0, opt.PoolSize),
 		closedCh:  make(chan struct{}),
 	}
+	p.queue.Store(make(chan struct{}, opt.PoolSize))
 
 	p.connsMu.Lock()
 	p.checkMinIdleConns()
@@ -118,7 +126,7 @@ func (p *ConnPool) checkMinIdleConns() {
 	if p.opt.MinIdleConns == 0 {
 		return
 	}
-	for p.poolSize < p.opt.PoolSize && p.idleConnsLen < p.opt.MinIdleConns {
+	for p.poolSize < p.size() && p.idleConnsLen < p.opt.MinIdleConns {
 		p.poolSize++
 		p.idleConnsLen++
 
@@ -176,7 +184,7 @@ func (p *ConnPool) newConn(ctx context.Context, pooled bool) (*Conn, error) {
 	p.conns = append(p.conns, cn)
 	if pooled {
 		// If pool is full remove the cn on next Put.
-		if p.poolSize >= p.opt.PoolSize {
+		if p.poolSize >= p.size() {
 			cn.pooled = false
 		} else {
 			p.poolSize++
@@ -191,14 +199,14 @@ func (p *ConnPool) dialConn(ctx context.Context, pooled bool) (*Conn, error) {
 		return nil, ErrClosed
 	}
 
-	if atomic.LoadUint32(&p.dialErrorsNum) >= uint32(p.opt.PoolSize) {
+	if atomic.LoadUint32(&p.dialErrorsNum) >= uint32(p.size()) {
 		return nil, p.getLastDialError()
 	}
 
 	netConn, err := p.opt.Dialer(ctx)
 	if err != nil {
 		p.setLastDialError(err)
-		if atomic.AddUint32(&p.dialErrorsNum, 1) == uint32(p.opt.PoolSize) {
+		if atomic.AddUint32(&p.dialErrorsNum, 1) == uint32(p.size()) {
 			go p.tryDial()
 		}
 		return nil, err
@@ -206,6 +214,7 @@ func (p *ConnPool) dialConn(ctx context.Context, pooled bool) (*Conn, error) {
 
 	cn := NewConn(netConn)
 	cn.pooled = pooled
+	cn.ctxDeadline = p.opt.ContextDeadline
 	return cn, nil
 }
 
@@ -246,7 +255,8 @@ func (p *ConnPool) Get(ctx context.Context) (*Conn, error) {
 		return nil, ErrClosed
 	}
 
-	if err := p.waitTurn(ctx); err != nil {
+	turn, err := p.waitTurn(ctx)
+	if err != nil {
 		return nil, err
 	}
 
@@ -269,6 +279,7 @@ func (p *ConnPool) Get(ctx context.Context) (*Conn, error) {
 		}
 
 		atomic.AddUint32(&p.stats.Hits, 1)
+		cn.turn = turn
 		return cn, nil
 	}
 
@@ -276,27 +287,42 @@ func (p *ConnPool) Get(ctx context.Context) (*Conn, error) {
 
 	newcn, err := p.newConn(ctx, true)
 	if err != nil {
-		p.freeTurn()
+		freeTurn(turn)
 		return nil, err
 	}
 
+	newcn.turn = turn
 	return newcn, nil
 }
 
-func (p *ConnPool) getTurn() {
-	p.queue <- struct{}{}
+func (p *ConnPool) size() int {
+	return int(atomic.LoadInt32(&p.maxSize))
+}
+
+// turns returns the queue of the turns to use a connection. It is replaced
+// by SetPoolSize, so the turns must be freed in the queue they were taken
+// from.
+func (p *ConnPool) turns() chan struct{} {
+	return p.queue.Load().(chan struct{})
+}
+
+func (p *ConnPool) getTurn() chan struct{} {
+	turn := p.turns()
+	turn <- struct{}{}
+	return turn
 }
 
-func (p *ConnPool) waitTurn(ctx context.Context) error {
+func (p *ConnPool) waitTurn(ctx context.Context) (chan struct{}, error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
+	turn := p.turns()
 	select {
-	case p.queue <- struct{}{}:
-		return nil
+	case turn <- struct{}{}:
+		return turn, nil
 	default:
 	}
 
@@ -309,22 +335,32 @@ func (p *ConnPool) waitTurn(ctx context.Context) error {
 			<-timer.C
 		}
 		timers.Put(timer)
-		return ctx.Err()
-	case p.queue <- struct{}{}:
+		return nil, ctx.Err()
+	case turn <- struct{}{}:
 		if !timer.Stop() {
 			<-timer.C
 		}
 		timers.Put(timer)
-		return nil
+		return turn, nil
 	case <-timer.C:
 		timers.Put(timer)
 		atomic.AddUint32(&p.stats.Timeouts, 1)
-		return ErrPoolTimeout
+		return nil, ErrPoolTimeout
 	}
 }
 
-func (p *ConnPool) freeTurn() {
-	<-p.queue
+func freeTurn(turn chan struct{}) {
+	<-turn
+}
+
+// freeConnTurn frees the turn taken by Get for the cn.
+func (p *ConnPool) freeConnTurn(cn *Conn) {
+	turn := cn.turn
+	if turn == nil {
+		turn = p.turns()
+	}
+	cn.turn = nil
+	freeTurn(turn)
 }
 
 func (p *ConnPool) popIdle() (*Conn, error) {
@@ -353,7 +389,7 @@ func (p *ConnPool) popIdle() (*Conn, error) {
 
 func (p *ConnPool) Put(ctx context.Context, cn *Conn) {
 	if cn.rd.Buffered() > 0 {
-		internal.Logger.Printf(ctx, "Conn has unread data")
+		internal.Log(ctx, p.opt.Logger, internal.LogLevelWarn, "Conn has unread data")
 		p.Remove(ctx, cn, BadConnError{})
 		return
 	}
@@ -364,15 +400,21 @@ func (p *ConnPool) Put(ctx context.Context, cn *Conn) {
 	}
 
 	p.connsMu.Lock()
+	// The pool was shrunk with SetPoolSize.
+	if p.poolSize > p.size() {
+		p.connsMu.Unlock()
+		p.Remove(ctx, cn, nil)
+		return
+	}
 	p.idleConns = append(p.idleConns, cn)
 	p.idleConnsLen++
 	p.connsMu.Unlock()
-	p.freeTurn()
+	p.freeConnTurn(cn)
 }
 
 func (p *ConnPool) Remove(ctx context.Context, cn *Conn, reason error) {
 	p.removeConnWithLock(cn)
-	p.freeTurn()
+	p.freeConnTurn(cn)
 	_ = p.closeConn(cn)
 }
 
@@ -436,6 +478,35 @@ func (p *ConnPool) Stats() *Stats {
 	}
 }
 
+// SetPoolSize changes the maximum number of connections. The idle
+// connections above the new size are closed right away and the connections
+// in use when they are returned to the pool. The connections in use do not
+// count towards the new size, so there can be more connections for a while.
+func (p *ConnPool) SetPoolSize(size int) {
+	p.connsMu.Lock()
+	if size == p.size() {
+		p.connsMu.Unlock()
+		return
+	}
+	atomic.StoreInt32(&p.maxSize, int32(size))
+	p.queue.Store(make(chan struct{}, size))
+
+	var closed []*Conn
+	for p.poolSize > size && len(p.idleConns) > 0 {
+		cn := p.idleConns[0]
+		p.idleConns = append(p.idleConns[:0], p.idleConns[1:]...)
+		p.idleConnsLen--
+		p.removeConn(cn)
+		closed = append(closed, cn)
+	}
+	p.checkMinIdleConns()
+	p.connsMu.Unlock()
+
+	for _, cn := range closed {
+		_ = p.closeConn(cn)
+	}
+}
+
 func (p *ConnPool) closed() bool {
 	return atomic.LoadUint32(&p._closed) == 1
 }
@@ -492,7 +563,8 @@ func (p *ConnPool) reaper(frequency time.Duration) {
 			}
 			_, err := p.ReapStaleConns()
 			if err != nil {
-				internal.Logger.Printf(context.Background(), "ReapStaleConns failed: %s", err)
+				internal.Log(context.Background(), p.opt.Logger, internal.LogLevelError,
+					"ReapStaleConns failed", "error", err)
 				continue
 			}
 		case <-p.closedCh:
@@ -504,13 +576,13 @@ func (p *ConnPool) reaper(frequency time.Duration) {
 func (p *ConnPool) ReapStaleConns() (int, error) {
 	var n int
 	for {
-		p.getTurn()
+		turn := p.getTurn()
 
 		p.connsMu.Lock()
 		cn := p.reapStaleConn()
 		p.connsMu.Unlock()
 
-		p.freeTurn()
+		freeTurn(turn)
 
 		if cn != nil {
 			_ = p.closeConn(cn)
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/farss/redis/v8/internal/pool"
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 var _ = Describe("ConnPool", func() {
@@ -110,6 +111,44 @@ var _ = Describe("ConnPool", func() {
 			Fail("Get is not unblocked")
 		}
 
+		for _, cn := range cns {
+			connPool.Put(ctx, cn)
+		}
+	})
+	It("should change pool size", func() {
+		var cns []*pool.Conn
+		for i := 0; i < 10; i++ {
+			cn, err := connPool.Get(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			cns = append(cns, cn)
+		}
+
+		connPool.SetPoolSize(12)
+		for i := 0; i < 2; i++ {
+			cn, err := connPool.Get(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			cns = append(cns, cn)
+		}
+		Expect(connPool.Len()).To(Equal(12))
+
+		connPool.SetPoolSize(5)
+		for _, cn := range cns {
+			connPool.Put(ctx, cn)
+		}
+		Expect(connPool.Len()).To(Equal(5))
+		Expect(connPool.IdleLen()).To(Equal(5))
+
+		cns = cns[:0]
+		for i := 0; i < 5; i++ {
+			cn, err := connPool.Get(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			cns = append(cns, cn)
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := connPool.Get(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
 		for _, cn := range cns {
 			connPool.Put(ctx, cn)
 		}
@@ -453,3 +492,65 @@ var _ = Describe("race", func() {
 		})
 	})
 })
+
+type deadlineConn struct {
+	net.TCPConn
+	readDeadline time.Time
+}
+
+func (cn *deadlineConn) SetReadDeadline(tm time.Time) error {
+	cn.readDeadline = tm
+	return nil
+}
+
+var _ = Describe("ContextDeadline", func() {
+	var netConn *deadlineConn
+
+	newPool := func(ctxDeadline bool) *pool.ConnPool {
+		netConn = &deadlineConn{readDeadline: time.Unix(1, 0)}
+		return pool.NewConnPool(&pool.Options{
+			Dialer: func(context.Context) (net.Conn, error) {
+				return netConn, nil
+			},
+			PoolSize:        1,
+			PoolTimeout:     time.Hour,
+			ContextDeadline: ctxDeadline,
+		})
+	}
+
+	read := func(connPool *pool.ConnPool, ctx context.Context, timeout time.Duration) {
+		cn, err := connPool.Get(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cn.WithReader(ctx, timeout, func(*proto.Reader) error { return nil })).To(Succeed())
+		connPool.Put(ctx, cn)
+	}
+
+	It("uses the deadline of the context without a timeout", func() {
+		connPool := newPool(true)
+		defer connPool.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+
+		read(connPool, ctx, 0)
+		Expect(netConn.readDeadline).To(Equal(deadline))
+
+		read(connPool, context.Background(), 0)
+		Expect(netConn.readDeadline.IsZero()).To(BeTrue())
+
+		read(connPool, ctx, time.Second)
+		Expect(netConn.readDeadline.Before(deadline)).To(BeTrue())
+	})
+
+	It("does not change the deadline without a timeout by default", func() {
+		connPool := newPool(false)
+		defer connPool.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		read(connPool, ctx, 0)
+		Expect(netConn.readDeadline).To(Equal(time.Unix(1, 0)))
+	})
+})
@@ -0,0 +1,110 @@
+package proto
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/farss/redis/v8/internal/util"
+)
+
+// Codec marshals the values of the types that are not supported natively,
+// e.g. structs, and unmarshals them back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// Marshaler is implemented by the types that control how they are written
+// as command args. It takes precedence over encoding.BinaryMarshaler and
+// encoding.TextMarshaler.
+type Marshaler interface {
+	MarshalRedis() ([]byte, error)
+}
+
+// Unmarshaler is implemented by the types that control how they are scanned
+// from replies. It takes precedence over encoding.BinaryUnmarshaler and
+// encoding.TextUnmarshaler.
+type Unmarshaler interface {
+	UnmarshalRedis(b []byte) error
+}
+
+// TimeEncoding is how time.Time and time.Duration values are encoded.
+type TimeEncoding int
+
+const (
+	// TimeRFC3339Nano encodes times with time.RFC3339Nano and durations in
+	// nanoseconds.
+	TimeRFC3339Nano TimeEncoding = iota
+	// TimeRFC3339 encodes times with time.RFC3339 and durations in seconds.
+	TimeRFC3339
+	// TimeUnix encodes times and durations in seconds.
+	TimeUnix
+	// TimeUnixMilli encodes times and durations in milliseconds.
+	TimeUnixMilli
+)
+
+// Encoding configures how the values are encoded. The nil Encoding uses
+// the defaults.
+type Encoding struct {
+	Codec Codec
+	Time  TimeEncoding
+}
+
+func (e *Encoding) codec() Codec {
+	if e == nil {
+		return nil
+	}
+	return e.Codec
+}
+
+func (e *Encoding) timeEncoding() TimeEncoding {
+	if e == nil {
+		return TimeRFC3339Nano
+	}
+	return e.Time
+}
+
+func (e *Encoding) appendTime(b []byte, tm time.Time) []byte {
+	switch e.timeEncoding() {
+	case TimeRFC3339:
+		return tm.AppendFormat(b, time.RFC3339)
+	case TimeUnix:
+		return strconv.AppendInt(b, tm.Unix(), 10)
+	case TimeUnixMilli:
+		return strconv.AppendInt(b, tm.UnixMilli(), 10)
+	default:
+		return tm.AppendFormat(b, time.RFC3339Nano)
+	}
+}
+
+// ParseTime parses the time encoded with the time encoding of e.
+func (e *Encoding) ParseTime(b []byte) (time.Time, error) {
+	switch e.timeEncoding() {
+	case TimeUnix:
+		n, err := util.ParseInt(b, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(n, 0), nil
+	case TimeUnixMilli:
+		n, err := util.ParseInt(b, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(n), nil
+	default:
+		// RFC3339Nano also parses RFC3339 times.
+		return time.Parse(time.RFC3339Nano, util.BytesToString(b))
+	}
+}
+
+func (e *Encoding) durationUnit() time.Duration {
+	switch e.timeEncoding() {
+	case TimeRFC3339, TimeUnix:
+		return time.Second
+	case TimeUnixMilli:
+		return time.Millisecond
+	default:
+		return time.Nanosecond
+	}
+}
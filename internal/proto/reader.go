@@ -34,6 +34,8 @@ type MultiBulkParse func(*Reader, int64) (interface{}, error)
 type Reader struct {
 	rd   *bufio.Reader
 	_buf []byte
+
+	enc *Encoding
 }
 
 func NewReader(rd io.Reader) *Reader {
@@ -43,6 +45,17 @@ func NewReader(rd io.Reader) *Reader {
 	}
 }
 
+// SetEncoding sets the encoding returned by Encoding.
+func (r *Reader) SetEncoding(enc *Encoding) {
+	r.enc = enc
+}
+
+// Encoding returns the encoding used to scan the values read by r. It is nil
+// if the defaults are used.
+func (r *Reader) Encoding() *Encoding {
+	return r.enc
+}
+
 func (r *Reader) Buffered() int {
 	return r.rd.Buffered()
 }
@@ -175,6 +188,13 @@ func (r *Reader) readStringReply(line []byte) (string, error) {
 	return util.BytesToString(b[:replyLen]), nil
 }
 
+// ReadTmpBytes is like ReadString, but returns the reply without copying it.
+// The returned slice is the buffer of the reader: it is only valid until the
+// next read and must not be modified.
+func (r *Reader) ReadTmpBytes() ([]byte, error) {
+	return r.readTmpBytesReply()
+}
+
 func (r *Reader) ReadArrayReply(m MultiBulkParse) (interface{}, error) {
 	line, err := r.ReadLine()
 	if err != nil {
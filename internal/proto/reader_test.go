@@ -43,6 +43,33 @@ func TestReader_ReadLine(t *testing.T) {
 	}
 }
 
+func TestReader_ReadTmpBytes(t *testing.T) {
+	r := proto.NewReader(bytes.NewBufferString("$5\r\nhello\r\n$3\r\nabc\r\n$-1\r\n+OK\r\n-ERR oops\r\n"))
+
+	b, err := r.ReadTmpBytes()
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("got %q, %v, want hello", b, err)
+	}
+	// The buffer is reused by the next read.
+	b2, err := r.ReadTmpBytes()
+	if err != nil || string(b2) != "abc" {
+		t.Fatalf("got %q, %v, want abc", b2, err)
+	}
+	if &b[0] != &b2[0] {
+		t.Fatal("buffer is not reused")
+	}
+
+	if _, err := r.ReadTmpBytes(); err != proto.Nil {
+		t.Fatalf("got %v, want Nil", err)
+	}
+	if b, err := r.ReadTmpBytes(); err != nil || string(b) != "OK" {
+		t.Fatalf("got %q, %v, want OK", b, err)
+	}
+	if _, err := r.ReadTmpBytes(); err == nil || err.Error() != "ERR oops" {
+		t.Fatalf("got %v, want ERR oops", err)
+	}
+}
+
 func benchmarkParseReply(b *testing.B, reply string, m proto.MultiBulkParse, wanterr bool) {
 	buf := new(bytes.Buffer)
 	for i := 0; i < b.N; i++ {
@@ -11,8 +11,14 @@ import (
 )
 
 // Scan parses bytes `b` to `v` with appropriate type.
-//nolint:gocyclo
 func Scan(b []byte, v interface{}) error {
+	return ScanEncoding(b, v, nil)
+}
+
+// ScanEncoding is like Scan, but uses enc, e.g. to unmarshal unsupported
+// types with enc.Codec.
+//nolint:gocyclo
+func ScanEncoding(b []byte, v interface{}, enc *Encoding) error {
 	switch v := v.(type) {
 	case nil:
 		return fmt.Errorf("redis: Scan(nil)")
@@ -105,21 +111,28 @@ func Scan(b []byte, v interface{}) error {
 		return nil
 	case *time.Time:
 		var err error
-		*v, err = time.Parse(time.RFC3339Nano, util.BytesToString(b))
+		*v, err = enc.ParseTime(b)
 		return err
 	case *time.Duration:
 		n, err := util.ParseInt(b, 10, 64)
 		if err != nil {
 			return err
 		}
-		*v = time.Duration(n)
+		*v = time.Duration(n) * enc.durationUnit()
 		return nil
+	case Unmarshaler:
+		return v.UnmarshalRedis(b)
 	case encoding.BinaryUnmarshaler:
 		return v.UnmarshalBinary(b)
 	case *net.IP:
 		*v = b
 		return nil
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText(b)
 	default:
+		if codec := enc.codec(); codec != nil {
+			return codec.Unmarshal(b, v)
+		}
 		return fmt.Errorf(
 			"redis: can't unmarshal %T (consider implementing BinaryUnmarshaler)", v)
 	}
@@ -2,6 +2,7 @@ package proto_test
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/farss/redis/v8/internal/proto"
 )
@@ -45,3 +46,74 @@ var _ = Describe("ScanSlice", func() {
 		}))
 	})
 })
+
+var _ = Describe("ScanEncoding", func() {
+	It("scans time with the encoding", func() {
+		enc := &proto.Encoding{Time: proto.TimeUnixMilli}
+
+		var tm time.Time
+		Expect(proto.ScanEncoding([]byte("1546335910000"), &tm, enc)).NotTo(HaveOccurred())
+		Expect(tm).To(BeTemporally("==", time.Date(2019, 1, 1, 9, 45, 10, 0, time.UTC)))
+
+		var d time.Duration
+		Expect(proto.ScanEncoding([]byte("1500"), &d, enc)).NotTo(HaveOccurred())
+		Expect(d).To(Equal(1500 * time.Millisecond))
+
+		Expect(proto.ScanEncoding([]byte("1500"), &d, nil)).NotTo(HaveOccurred())
+		Expect(d).To(Equal(1500 * time.Nanosecond))
+	})
+
+	It("unmarshals unsupported types with the codec", func() {
+		type user struct {
+			Name string
+		}
+		var u user
+		Expect(proto.Scan([]byte(`{"Name":"alice"}`), &u)).To(HaveOccurred())
+
+		enc := &proto.Encoding{Codec: jsonCodec{}}
+		Expect(proto.ScanEncoding([]byte(`{"Name":"alice"}`), &u, enc)).NotTo(HaveOccurred())
+		Expect(u).To(Equal(user{Name: "alice"}))
+	})
+})
+
+var _ = Describe("Scan", func() {
+	It("scans Unmarshaler and TextUnmarshaler", func() {
+		var u redisUnmarshaler
+		Expect(proto.Scan([]byte("value"), &u)).NotTo(HaveOccurred())
+		Expect(u).To(Equal(redisUnmarshaler("redis:value")))
+
+		var t textUnmarshaler
+		Expect(proto.Scan([]byte("value"), &t)).NotTo(HaveOccurred())
+		Expect(t).To(Equal(textUnmarshaler("text:value")))
+	})
+})
+
+type redisUnmarshaler string
+
+func (u *redisUnmarshaler) UnmarshalRedis(b []byte) error {
+	*u = redisUnmarshaler("redis:" + string(b))
+	return nil
+}
+
+// UnmarshalText is ignored, because UnmarshalRedis takes precedence.
+func (u *redisUnmarshaler) UnmarshalText(b []byte) error {
+	*u = redisUnmarshaler("text:" + string(b))
+	return nil
+}
+
+type textUnmarshaler string
+
+func (u *textUnmarshaler) UnmarshalText(b []byte) error {
+	*u = textUnmarshaler("text:" + string(b))
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
@@ -23,6 +23,8 @@ type Writer struct {
 
 	lenBuf []byte
 	numBuf []byte
+
+	enc *Encoding
 }
 
 func NewWriter(wr writer) *Writer {
@@ -34,6 +36,11 @@ func NewWriter(wr writer) *Writer {
 	}
 }
 
+// SetEncoding sets the encoding of the args, e.g. of time.Time values.
+func (w *Writer) SetEncoding(enc *Encoding) {
+	w.enc = enc
+}
+
 func (w *Writer) WriteArgs(args []interface{}) error {
 	if err := w.WriteByte(ArrayReply); err != nil {
 		return err
@@ -97,10 +104,16 @@ func (w *Writer) WriteArg(v interface{}) error {
 		}
 		return w.int(0)
 	case time.Time:
-		w.numBuf = v.AppendFormat(w.numBuf[:0], time.RFC3339Nano)
+		w.numBuf = w.enc.appendTime(w.numBuf[:0], v)
 		return w.bytes(w.numBuf)
 	case time.Duration:
-		return w.int(v.Nanoseconds())
+		return w.int(int64(v / w.enc.durationUnit()))
+	case Marshaler:
+		b, err := v.MarshalRedis()
+		if err != nil {
+			return err
+		}
+		return w.bytes(b)
 	case encoding.BinaryMarshaler:
 		b, err := v.MarshalBinary()
 		if err != nil {
@@ -109,7 +122,20 @@ func (w *Writer) WriteArg(v interface{}) error {
 		return w.bytes(b)
 	case net.IP:
 		return w.bytes(v)
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		if err != nil {
+			return err
+		}
+		return w.bytes(b)
 	default:
+		if codec := w.enc.codec(); codec != nil {
+			b, err := codec.Marshal(v)
+			if err != nil {
+				return err
+			}
+			return w.bytes(b)
+		}
 		return fmt.Errorf(
 			"redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
 	}
@@ -57,6 +57,25 @@ var _ = Describe("WriteBuffer", func() {
 		Expect(buf.Len()).To(Equal(41))
 	})
 
+	It("should append time with the encoding", func() {
+		tm := time.Date(2019, 1, 1, 9, 45, 10, 222125, time.UTC)
+		args := []interface{}{tm, 90 * time.Second}
+
+		wr.SetEncoding(&proto.Encoding{Time: proto.TimeUnix})
+		Expect(wr.WriteArgs(args)).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("*2\r\n$10\r\n1546335910\r\n$2\r\n90\r\n"))
+
+		buf.Reset()
+		wr.SetEncoding(&proto.Encoding{Time: proto.TimeUnixMilli})
+		Expect(wr.WriteArgs(args)).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("*2\r\n$13\r\n1546335910000\r\n$5\r\n90000\r\n"))
+
+		buf.Reset()
+		wr.SetEncoding(&proto.Encoding{Time: proto.TimeRFC3339})
+		Expect(wr.WriteArgs(args)).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("*2\r\n$20\r\n2019-01-01T09:45:10Z\r\n$2\r\n90\r\n"))
+	})
+
 	It("should append marshalable args", func() {
 		err := wr.WriteArgs([]interface{}{&MyType{}})
 		Expect(err).NotTo(HaveOccurred())
@@ -64,6 +83,12 @@ var _ = Describe("WriteBuffer", func() {
 		Expect(buf.Len()).To(Equal(15))
 	})
 
+	It("should append Marshaler and TextMarshaler args", func() {
+		err := wr.WriteArgs([]interface{}{redisMarshaler{}, textMarshaler{}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("*2\r\n$5\r\nredis\r\n$4\r\ntext\r\n"))
+	})
+
 	It("should append net.IP", func() {
 		ip := net.ParseIP("192.168.1.1")
 		err := wr.WriteArgs([]interface{}{ip})
@@ -72,6 +97,23 @@ var _ = Describe("WriteBuffer", func() {
 	})
 })
 
+type redisMarshaler struct{}
+
+func (redisMarshaler) MarshalRedis() ([]byte, error) {
+	return []byte("redis"), nil
+}
+
+// MarshalBinary is ignored, because MarshalRedis takes precedence.
+func (redisMarshaler) MarshalBinary() ([]byte, error) {
+	return []byte("binary"), nil
+}
+
+type textMarshaler struct{}
+
+func (textMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
 type discard struct{}
 
 func (discard) Write(b []byte) (int, error) {
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMatchGlob(t *testing.T) {
+	RegisterTestingT(t)
+
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "orders.created", true},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "users.created", false},
+		{"orders.*.eu", "orders.created.eu", true},
+		{"orders.*.eu", "orders.created.us", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a/*", "a/b/c", true},
+	}
+
+	for _, test := range tests {
+		Expect(MatchGlob(test.pattern, test.s)).To(Equal(test.match), "%q %q", test.pattern, test.s)
+	}
+}
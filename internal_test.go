@@ -1,8 +1,33 @@
 package redis
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/pool"
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 var _ = Describe("newClusterState", func() {
@@ -65,3 +90,2017 @@ var _ = Describe("newClusterState", func() {
 		})
 	})
 })
+
+var _ = Describe("parseKeyspaceEvent", func() {
+	It("parses keyevent notifications", func() {
+		event, ok := parseKeyspaceEvent(&Message{
+			Channel: "__keyevent@2__:expired",
+			Payload: "mykey",
+		})
+		Expect(ok).To(BeTrue())
+		Expect(event).To(Equal(&KeyspaceEvent{DB: 2, Name: "expired", Key: "mykey"}))
+	})
+
+	It("parses keyspace notifications", func() {
+		event, ok := parseKeyspaceEvent(&Message{
+			Channel: "__keyspace@0__:my:key",
+			Payload: "set",
+		})
+		Expect(ok).To(BeTrue())
+		Expect(event).To(Equal(&KeyspaceEvent{DB: 0, Name: "set", Key: "my:key"}))
+	})
+
+	It("ignores other channels", func() {
+		_, ok := parseKeyspaceEvent(&Message{Channel: "mychannel"})
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("parseFunctionLibrary", func() {
+	It("parses library and function names", func() {
+		lib, err := parseFunctionLibrary("lib/counters.lua", `#!lua name=counters
+redis.register_function('incr_by', function(keys, args)
+	return redis.call('INCRBY', keys[1], args[1])
+end)
+redis.register_function{
+	function_name="get_counter",
+	callback=function(keys) return redis.call('GET', keys[1]) end,
+	flags={'no-writes'}
+}
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lib.Name).To(Equal("counters"))
+		Expect(lib.Path).To(Equal("lib/counters.lua"))
+		Expect(lib.Functions).To(Equal([]string{"get_counter", "incr_by"}))
+		Expect(lib.ReadOnly).To(Equal([]string{"get_counter"}))
+		Expect(lib.Version).To(HaveLen(40))
+	})
+
+	It("requires the shebang", func() {
+		_, err := parseFunctionLibrary("bad.lua", "return 1")
+		Expect(err).To(MatchError(`redis: bad.lua does not start with "#!lua name=<library>"`))
+	})
+})
+
+var _ = Describe("isReadOnlyScript", func() {
+	It("checks the shebang flags", func() {
+		Expect(isReadOnlyScript("return 1")).To(BeFalse())
+		Expect(isReadOnlyScript("#!lua\nreturn 1")).To(BeFalse())
+		Expect(isReadOnlyScript("#!lua flags=no-writes\nreturn 1")).To(BeTrue())
+		Expect(isReadOnlyScript("#!lua flags=allow-stale,no-writes\nreturn 1")).To(BeTrue())
+		Expect(isReadOnlyScript("#!lua flags=allow-stale\n-- flags=no-writes")).To(BeFalse())
+	})
+})
+
+var _ = Describe("CommandStats", func() {
+	It("maps latencies to buckets", func() {
+		for _, d := range []time.Duration{
+			0, 5 * time.Microsecond, 15 * time.Microsecond, 17 * time.Microsecond,
+			100 * time.Microsecond, 3 * time.Millisecond, time.Second, time.Minute,
+		} {
+			got := latencyBucketValue(latencyBucket(d))
+			Expect(float64(got)).To(BeNumerically("~", float64(d), float64(d)/16+float64(time.Microsecond)))
+		}
+		Expect(latencyBucket(24 * time.Hour)).To(Equal(latencyNumBuckets - 1))
+	})
+
+	It("computes percentiles", func() {
+		l := new(cmdLatency)
+		for i := 1; i <= 100; i++ {
+			l.record(time.Duration(i)*time.Millisecond, nil)
+		}
+		l.record(time.Millisecond, Nil)
+		l.record(time.Millisecond, errors.New("ERR"))
+
+		stats := l.stats()
+		Expect(stats.Count).To(Equal(uint64(102)))
+		Expect(stats.Errors).To(Equal(uint64(1)))
+		Expect(stats.Max).To(Equal(100 * time.Millisecond))
+		Expect(float64(stats.Percentile(50))).To(BeNumerically("~", float64(50*time.Millisecond), float64(4*time.Millisecond)))
+		Expect(float64(stats.Percentile(99))).To(BeNumerically("~", float64(99*time.Millisecond), float64(7*time.Millisecond)))
+		Expect(stats.Percentile(100)).To(Equal(100 * time.Millisecond))
+
+		stats.merge(l.stats())
+		Expect(stats.Count).To(Equal(uint64(204)))
+		Expect(float64(stats.Percentile(50))).To(BeNumerically("~", float64(50*time.Millisecond), float64(4*time.Millisecond)))
+	})
+})
+
+var _ = Describe("slowLogHook", func() {
+	format := func(opt *SlowLogOptions, cmd Cmder) string {
+		h := NewSlowLogHook(opt).(*slowLogHook)
+		return string(h.appendCmd(nil, cmd))
+	}
+
+	It("truncates the arguments", func() {
+		cmd := NewCmd(context.Background(), "mset", "key1", strings.Repeat("x", 100), "key2", "value2")
+		Expect(format(&SlowLogOptions{MaxArgs: 3, MaxArgLen: 4}, cmd)).
+			To(Equal("mset key1 xxxx... key2 ..."))
+		Expect(format(&SlowLogOptions{MaxArgs: -1, MaxArgLen: -1}, cmd)).
+			To(Equal("mset key1 " + strings.Repeat("x", 100) + " key2 value2"))
+	})
+
+	It("redacts the arguments", func() {
+		cmd := NewCmd(context.Background(), "cluster", "countkeysinslot", 1)
+		cmd.SetErr(errors.New("ERR oops"))
+		Expect(format(&SlowLogOptions{Redact: true}, cmd)).
+			To(Equal("cluster countkeysinslot ?: ERR oops"))
+	})
+})
+
+var _ = Describe("Logger", func() {
+	It("formats the fields", func() {
+		s := internal.FormatLog("XREAD failed", "stream", "events", "error", errors.New("ERR oops"), "n", 1)
+		Expect(s).To(Equal(`XREAD failed stream=events error="ERR oops" n=1`))
+		Expect(internal.FormatLog("ping")).To(Equal("ping"))
+	})
+
+	It("uses the logger from the options", func() {
+		var msgs []string
+		opt := &Options{
+			Logger: LoggerFunc(func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+				msgs = append(msgs, level.String()+": "+internal.FormatLog(msg, keyvals...))
+			}),
+		}
+		rdb := NewClient(opt)
+		defer rdb.Close()
+
+		internal.Log(context.Background(), universalLogger(rdb), LogLevelWarn, "slow command", "cmd", "get k")
+		Expect(msgs).To(Equal([]string{`warn: slow command cmd="get k"`}))
+	})
+})
+
+var _ = Describe("errorStats", func() {
+	It("classifies the errors", func() {
+		var s errorStats
+		s.record(nil)
+		s.record(Nil)
+		s.record(proto.RedisError("MOVED 3999 127.0.0.1:6381"))
+		s.record(proto.RedisError("ASK 3999 127.0.0.1:6381"))
+		s.record(proto.RedisError("LOADING Redis is loading the dataset in memory"))
+		s.record(proto.RedisError("READONLY You can't write against a read only replica."))
+		s.record(proto.RedisError("OOM command not allowed when used memory > 'maxmemory'."))
+		s.record(proto.RedisError("ERR unknown command"))
+		s.record(pool.ErrPoolTimeout)
+		s.record(io.EOF)
+		s.record(&net.OpError{Op: "dial", Err: errors.New("connection refused")})
+		s.record(&net.DNSError{IsTimeout: true})
+		s.record(context.DeadlineExceeded)
+
+		Expect(s.stats()).To(Equal(&ErrorStats{
+			Timeouts:     1,
+			ConnErrors:   2,
+			PoolTimeouts: 1,
+			Moved:        1,
+			Ask:          1,
+			Loading:      1,
+			ReadOnly:     1,
+			OOM:          1,
+		}))
+	})
+})
+
+var _ = Describe("error helpers", func() {
+	It("classifies the errors", func() {
+		Expect(IsTimeout(context.DeadlineExceeded)).To(BeTrue())
+		Expect(IsTimeout(pool.ErrPoolTimeout)).To(BeTrue())
+		Expect(IsTimeout(&net.DNSError{IsTimeout: true})).To(BeTrue())
+		Expect(IsTimeout(io.EOF)).To(BeFalse())
+		Expect(IsTimeout(nil)).To(BeFalse())
+
+		Expect(IsLoading(proto.RedisError("LOADING Redis is loading the dataset in memory"))).To(BeTrue())
+		Expect(IsReadOnly(proto.RedisError("READONLY You can't write against a read only replica."))).To(BeTrue())
+		Expect(IsClusterDown(proto.RedisError("CLUSTERDOWN The cluster is down"))).To(BeTrue())
+		Expect(IsTryAgain(proto.RedisError("TRYAGAIN Multiple keys request during rehashing of slot"))).To(BeTrue())
+		Expect(IsMaxClients(proto.RedisError("ERR max number of clients reached"))).To(BeTrue())
+		Expect(IsLoading(errors.New("LOADING not a Redis error"))).To(BeFalse())
+		Expect(IsReadOnly(nil)).To(BeFalse())
+	})
+
+	It("parses the redirects", func() {
+		addr, ok := IsMoved(proto.RedisError("MOVED 3999 127.0.0.1:6381"))
+		Expect(ok).To(BeTrue())
+		Expect(addr).To(Equal("127.0.0.1:6381"))
+
+		addr, ok = IsAsk(fmt.Errorf("get: %w", proto.RedisError("ASK 3999 127.0.0.1:6382")))
+		Expect(ok).To(BeTrue())
+		Expect(addr).To(Equal("127.0.0.1:6382"))
+
+		_, ok = IsMoved(proto.RedisError("ASK 3999 127.0.0.1:6381"))
+		Expect(ok).To(BeFalse())
+		_, ok = IsMoved(proto.RedisError("MOVED"))
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("parseMonitorEntry", func() {
+	It("parses the entry", func() {
+		entry, err := parseMonitorEntry(`1339518083.107412 [2 127.0.0.1:60866] "set" "key" "a \"b\"\\\x00\n"`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry).To(Equal(&MonitorEntry{
+			Time: time.Unix(1339518083, 107412000),
+			DB:   2,
+			Addr: "127.0.0.1:60866",
+			Args: []string{"set", "key", "a \"b\"\\\x00\n"},
+		}))
+	})
+
+	It("parses the entry of a script", func() {
+		entry, err := parseMonitorEntry(`1339518083.107412 [0 lua] "get" "key"`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Addr).To(Equal("lua"))
+		Expect(entry.Args).To(Equal([]string{"get", "key"}))
+	})
+
+	It("returns an error for invalid entries", func() {
+		_, err := parseMonitorEntry(`OK`)
+		Expect(err).To(HaveOccurred())
+		_, err = parseMonitorEntry(`1339518083.107412 [0 lua] "get`)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("parseInfo", func() {
+	It("parses the sections", func() {
+		info := parseInfo("# Server\r\nredis_version:7.0.5\r\nuptime_in_seconds:60\r\n\r\n" +
+			"# Persistence\r\nloading:0\r\nrdb_last_save_time:1666000000\r\naof_enabled:1\r\n\r\n" +
+			"# Replication\r\nrole:master\r\nconnected_slaves:1\r\n" +
+			"slave0:ip=127.0.0.1,port=6380,state=online,offset=42,lag=1\r\n\r\n" +
+			"# Stats\r\ntotal_commands_processed:100\r\n\r\n" +
+			"# Keyspace\r\ndb0:keys=2,expires=1,avg_ttl=1500\r\n")
+
+		Expect(info.Server.RedisVersion).To(Equal("7.0.5"))
+		Expect(info.Server.Uptime).To(Equal(time.Minute))
+		Expect(info.Persistence.Loading).To(BeFalse())
+		Expect(info.Persistence.AOFEnabled).To(BeTrue())
+		Expect(info.Persistence.RDBLastSaveTime).To(Equal(time.Unix(1666000000, 0)))
+		Expect(info.Replication.Role).To(Equal("master"))
+		Expect(info.Replication.Replicas).To(Equal([]InfoReplica{{
+			IP:     "127.0.0.1",
+			Port:   6380,
+			State:  "online",
+			Offset: 42,
+			Lag:    time.Second,
+		}}))
+		Expect(info.Keyspace).To(Equal(map[int]InfoKeyspace{
+			0: {Keys: 2, Expires: 1, AvgTTL: 1500 * time.Millisecond},
+		}))
+		Expect(info.Raw["stats"]["total_commands_processed"]).To(Equal("100"))
+		Expect(info.Memory).To(Equal(InfoMemory{}))
+	})
+})
+
+var _ = Describe("auditHook", func() {
+	audit := func(opt *AuditOptions, cmd Cmder) *AuditEntry {
+		var entry *AuditEntry
+		opt.Handler = func(ctx context.Context, e *AuditEntry) {
+			entry = e
+		}
+		hook := NewAuditHook(opt)
+		ctx, _ := hook.BeforeProcess(context.Background(), cmd)
+		Expect(hook.AfterProcess(ctx, cmd)).NotTo(HaveOccurred())
+		return entry
+	}
+
+	It("always redacts passwords", func() {
+		ctx := context.Background()
+		entry := audit(&AuditOptions{}, NewStatusCmd(ctx, "auth", "user", "pass"))
+		Expect(entry.Name).To(Equal("auth"))
+		Expect(entry.Args).To(Equal([]string{"auth", "?", "?"}))
+
+		entry = audit(&AuditOptions{}, NewStatusCmd(ctx, "config", "set", "requirepass", "pass"))
+		Expect(entry.Name).To(Equal("config set"))
+		Expect(entry.Args).To(Equal([]string{"config", "set", "?", "?"}))
+
+		entry = audit(&AuditOptions{}, NewStatusCmd(ctx, "config", "set", "maxmemory", 100))
+		Expect(entry.Args).To(Equal([]string{"config", "set", "maxmemory", "100"}))
+	})
+
+	It("applies the rules", func() {
+		ctx := context.Background()
+		opt := &AuditOptions{
+			Rules: []AuditRule{{KeyPattern: "session:*"}},
+		}
+		entry := audit(opt, NewStatusCmd(ctx, "set", "session:1", "secret", "ex", 10))
+		Expect(entry.Args).To(Equal([]string{"set", "session:1", "?", "?", "?"}))
+		entry = audit(opt, NewStatusCmd(ctx, "set", "key", "value"))
+		Expect(entry.Args).To(Equal([]string{"set", "key", "value"}))
+
+		opt.Rules = []AuditRule{{Commands: []string{"eval"}, RedactKey: true}}
+		entry = audit(opt, NewCmd(ctx, "eval", "return 1", 1, "key", "arg"))
+		Expect(entry.Args).To(Equal([]string{"eval", "?", "?", "?", "?"}))
+	})
+
+	It("filters the commands", func() {
+		ctx := context.Background()
+		opt := &AuditOptions{Commands: []string{"flushall"}}
+		Expect(audit(opt, NewStatusCmd(ctx, "get", "key"))).To(BeNil())
+		Expect(audit(opt, NewStatusCmd(ctx, "flushall"))).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("redaction", func() {
+	ctx := context.Background()
+
+	AfterEach(func() {
+		SetRedactRules()
+	})
+
+	It("always redacts passwords", func() {
+		Expect(NewStatusCmd(ctx, "auth", "user", "pass").String()).To(Equal("auth ? ?: "))
+		Expect(NewCmd(ctx, "hello", 3, "auth", "user", "pass").String()).
+			To(Equal("hello 3 auth ? ?"))
+		Expect(NewStatusCmd(ctx, "config", "set", "requirepass", "pass").String()).
+			To(Equal("config set ? ?: "))
+
+		cmd := NewStatusCmd(ctx, "config", "set", "maxmemory", 100)
+		Expect(cmd.String()).To(Equal("config set maxmemory 100: "))
+		Expect(RedactedArgs(cmd)).To(Equal(cmd.Args()))
+		Expect(RedactedArgs(NewStatusCmd(ctx, "auth", "pass"))).To(Equal([]interface{}{"auth", "?"}))
+	})
+
+	It("applies the rules", func() {
+		SetRedactRules(AuditRule{KeyPattern: "session:*"})
+
+		cmd := NewStatusCmd(ctx, "set", "session:1", "secret", "ex", 10)
+		Expect(cmd.String()).To(Equal("set session:1 ? ? ?: "))
+		Expect(RedactedArgs(cmd)).To(Equal([]interface{}{"set", "session:1", "?", "?", "?"}))
+		Expect(NewStatusCmd(ctx, "set", "key", "value").String()).To(Equal("set key value: "))
+
+		h := NewSlowLogHook(nil).(*slowLogHook)
+		Expect(string(h.appendCmd(nil, cmd))).To(Equal("set session:1 ? ? ?"))
+	})
+
+	It("redacts the quoted arguments in the errors", func() {
+		SetRedactRules(AuditRule{Commands: []string{"vault.get"}})
+
+		cmd := NewCmd(ctx, "vault.get", "key", "secret")
+		cmd.SetErr(proto.RedisError("ERR unknown command 'vault.get', with args beginning with: 'key' 'secret' "))
+		Expect(cmd.String()).
+			To(Equal("vault.get key ?: ERR unknown command 'vault.get', with args beginning with: 'key' '?' "))
+		Expect(RedactedErr(cmd)).
+			To(Equal("ERR unknown command 'vault.get', with args beginning with: 'key' '?' "))
+		Expect(RedactedErr(NewCmd(ctx, "get", "key"))).To(Equal(""))
+	})
+})
+
+var _ = Describe("scanReply", func() {
+	It("scans arrays into slices", func() {
+		var ss []string
+		Expect(scanReply(&ss, []interface{}{"a", "b"}, nil)).NotTo(HaveOccurred())
+		Expect(ss).To(Equal([]string{"a", "b"}))
+
+		var ns []int64
+		Expect(scanReply(&ns, []interface{}{int64(1), "2"}, nil)).NotTo(HaveOccurred())
+		Expect(ns).To(Equal([]int64{1, 2}))
+
+		var ps []*string
+		Expect(scanReply(&ps, []interface{}{"a", nil}, nil)).NotTo(HaveOccurred())
+		Expect(ps).To(HaveLen(2))
+		Expect(*ps[0]).To(Equal("a"))
+		Expect(ps[1]).To(BeNil())
+	})
+
+	It("scans field-value pairs into maps and structs", func() {
+		var m map[string]int
+		Expect(scanReply(&m, []interface{}{"a", "1", "b", int64(2)}, nil)).NotTo(HaveOccurred())
+		Expect(m).To(Equal(map[string]int{"a": 1, "b": 2}))
+
+		type config struct {
+			MaxMemory int64    `redis:"maxmemory"`
+			Policy    string   `redis:"maxmemory-policy"`
+			Tags      []string `redis:"tags"`
+		}
+		var cfg config
+		err := scanReply(&cfg, []interface{}{
+			"maxmemory", "100", "maxmemory-policy", "noeviction", "tags", []interface{}{"a", "b"},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg).To(Equal(config{MaxMemory: 100, Policy: "noeviction", Tags: []string{"a", "b"}}))
+	})
+
+	It("scans nested replies", func() {
+		// XRANGE reply.
+		reply := []interface{}{
+			[]interface{}{"1-0", []interface{}{"name", "alice"}},
+			[]interface{}{"2-0", []interface{}{"name", "bob"}},
+		}
+		var entries []map[string]map[string]string
+		Expect(scanReply(&entries, reply, nil)).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]map[string]map[string]string{
+			{"1-0": {"name": "alice"}},
+			{"2-0": {"name": "bob"}},
+		}))
+
+		var vals []interface{}
+		Expect(scanReply(&vals, reply, nil)).NotTo(HaveOccurred())
+		Expect(vals).To(Equal(reply))
+	})
+
+	It("returns errors", func() {
+		var ss []string
+		Expect(scanReply(ss, []interface{}{"a"}, nil)).To(HaveOccurred())
+		Expect(scanReply(&ss, []interface{}{proto.RedisError("ERR oops")}, nil)).To(MatchError("ERR oops"))
+
+		var n int
+		Expect(scanReply(&n, []interface{}{"a"}, nil)).To(HaveOccurred())
+		Expect(scanReply(&n, "a", nil)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("KvScanIterator", func() {
+	It("decodes values with the codec", func() {
+		type user struct {
+			Name string `json:"name"`
+		}
+
+		cmd := NewKvScanCmd(context.Background(), nil, ScanValue, "scan", "0")
+		cmd.SetVal([]string{"user:1", `{"name":"alice"}`, "user:2", `{"name":"bob"}`}, "0")
+		cmd.enc = newEncoding(JSONCodec, TimeRFC3339Nano)
+
+		users := make(map[string]user)
+		it := cmd.Iterator()
+		for it.Next(context.Background()) {
+			key := it.Val()
+			var u user
+			Expect(it.Decode(&u)).NotTo(HaveOccurred())
+			users[key] = u
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		Expect(users).To(Equal(map[string]user{
+			"user:1": {Name: "alice"},
+			"user:2": {Name: "bob"},
+		}))
+	})
+})
+
+var _ = Describe("RetryPolicy", func() {
+	It("uses MaxRetries and the backoff options by default", func() {
+		opt := &Options{MaxRetries: 2, MinRetryBackoff: time.Millisecond, MaxRetryBackoff: 4 * time.Millisecond}
+
+		for attempt := 1; attempt <= 2; attempt++ {
+			backoff, ok := opt.retry(attempt, io.EOF)
+			Expect(ok).To(BeTrue())
+			Expect(backoff).To(BeNumerically(">=", time.Millisecond))
+			Expect(backoff).To(BeNumerically("<=", 4*time.Millisecond))
+		}
+		_, ok := opt.retry(3, io.EOF)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("limits FullJitterBackoff by Cap", func() {
+		b := &FullJitterBackoff{MaxRetries: 100, Base: time.Millisecond, Cap: 10 * time.Millisecond}
+		for _, attempt := range []int{1, 5, 64, 100} {
+			backoff, ok := b.Retry(attempt, io.EOF)
+			Expect(ok).To(BeTrue())
+			Expect(backoff).To(BeNumerically("<", 10*time.Millisecond))
+		}
+		_, ok := b.Retry(101, io.EOF)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("limits the retries with RetryBudget", func() {
+		b := NewRetryBudget(&ExponentialBackoff{MaxRetries: 10}, 2, time.Hour)
+		for i := 0; i < 2; i++ {
+			_, ok := b.Retry(1, io.EOF)
+			Expect(ok).To(BeTrue())
+		}
+		_, ok := b.Retry(1, io.EOF)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not allow unlimited retries with zero period", func() {
+		b := NewRetryBudget(&ExponentialBackoff{MaxRetries: 10}, 1, 0)
+		_, ok := b.Retry(1, io.EOF)
+		Expect(ok).To(BeTrue())
+		_, ok = b.Retry(1, io.EOF)
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("WithTimeout", func() {
+	It("overrides the client timeouts", func() {
+		c := &baseClient{opt: &Options{ReadTimeout: time.Second}}
+		ctx := context.Background()
+
+		cmd := NewStringCmd(ctx, "get", "key")
+		Expect(c.cmdTimeout(ctx, cmd)).To(Equal(time.Second))
+		Expect(c.cmdTimeout(WithTimeout(ctx, time.Minute), cmd)).To(Equal(time.Minute))
+		Expect(c.cmdTimeout(WithTimeout(ctx, 0), cmd)).To(Equal(time.Duration(0)))
+
+		// Blocking commands use their own timeouts.
+		blpop := NewStringSliceCmd(ctx, "blpop", "list", 5)
+		blpop.setReadTimeout(5 * time.Second)
+		Expect(c.cmdTimeout(WithTimeout(ctx, time.Minute), blpop)).To(Equal(15 * time.Second))
+	})
+})
+
+var _ = Describe("CircuitBreaker", func() {
+	var changes []string
+	var b *CircuitBreaker
+
+	BeforeEach(func() {
+		changes = nil
+		b = NewCircuitBreaker(&CircuitBreakerOptions{
+			MinRequests: 4,
+			OpenTimeout: 10 * time.Millisecond,
+			OnStateChange: func(from, to CircuitState) {
+				changes = append(changes, from.String()+" -> "+to.String())
+			},
+		})
+	})
+
+	It("opens after too many failures", func() {
+		for i := 0; i < 4; i++ {
+			Expect(b.Allow()).NotTo(HaveOccurred())
+			if i%2 == 0 {
+				b.ReportResult(io.EOF)
+			} else {
+				b.ReportResult(nil)
+			}
+		}
+		Expect(b.State()).To(Equal(CircuitOpen))
+		Expect(b.Allow()).To(Equal(ErrCircuitOpen))
+		Expect(changes).To(Equal([]string{"closed -> open"}))
+	})
+
+	It("does not count Redis errors", func() {
+		for i := 0; i < 10; i++ {
+			Expect(b.Allow()).NotTo(HaveOccurred())
+			b.ReportResult(proto.RedisError("WRONGTYPE Operation against a key"))
+		}
+		Expect(b.State()).To(Equal(CircuitClosed))
+	})
+
+	It("closes after the probe succeeds", func() {
+		for i := 0; i < 4; i++ {
+			b.ReportResult(io.EOF)
+		}
+		Expect(b.State()).To(Equal(CircuitOpen))
+
+		time.Sleep(20 * time.Millisecond)
+		Expect(b.State()).To(Equal(CircuitHalfOpen))
+		Expect(b.Allow()).NotTo(HaveOccurred())
+		Expect(b.Allow()).To(Equal(ErrCircuitOpen))
+
+		b.ReportResult(nil)
+		Expect(b.State()).To(Equal(CircuitClosed))
+		Expect(changes).To(Equal([]string{
+			"closed -> open", "open -> half-open", "half-open -> closed",
+		}))
+	})
+
+	It("opens again after the probe fails", func() {
+		for i := 0; i < 4; i++ {
+			b.ReportResult(io.EOF)
+		}
+		time.Sleep(20 * time.Millisecond)
+		Expect(b.Allow()).NotTo(HaveOccurred())
+
+		b.ReportResult(io.EOF)
+		Expect(b.State()).To(Equal(CircuitOpen))
+	})
+
+	It("fails the commands of the client fast", func() {
+		client := NewClient(&Options{
+			Addr:           "127.0.0.1:1",
+			MaxRetries:     -1,
+			CircuitBreaker: &CircuitBreakerOptions{MinRequests: 2},
+		})
+		defer client.Close()
+
+		ctx := context.Background()
+		for i := 0; i < 2; i++ {
+			Expect(client.Ping(ctx).Err()).NotTo(Equal(ErrCircuitOpen))
+		}
+		Expect(client.Ping(ctx).Err()).To(Equal(ErrCircuitOpen))
+	})
+})
+
+var _ = Describe("hedger", func() {
+	It("calculates the delay from the latency percentile", func() {
+		h := newHedger(&HedgeOptions{
+			MinDelay:   2 * time.Millisecond,
+			MaxDelay:   time.Second,
+			MinSamples: 10,
+		})
+		l := h.latency("get")
+		Expect(h.delay(l)).To(Equal(time.Second))
+
+		for i := 0; i < 10; i++ {
+			h.record(l, 10*time.Millisecond)
+		}
+		Expect(h.delay(l)).To(BeNumerically("~", 10*time.Millisecond, time.Millisecond))
+
+		l = h.latency("ping")
+		for i := 0; i < 10; i++ {
+			h.record(l, time.Microsecond)
+		}
+		Expect(h.delay(l)).To(Equal(2 * time.Millisecond))
+	})
+
+	It("copies commands", func() {
+		cmd := NewStringCmd(context.Background(), "get", "key")
+		cp := copyCmd(cmd).(*StringCmd)
+		cp.SetVal("value")
+		Expect(cmd.Val()).To(Equal(""))
+		Expect(cp.Args()).To(Equal(cmd.Args()))
+	})
+})
+
+var _ = Describe("ProcessMiddleware", func() {
+	var hs hooks
+	var processed [][]interface{}
+
+	process := func(ctx context.Context, cmd Cmder) error {
+		processed = append(processed, cmd.Args())
+		return nil
+	}
+	processPipeline := func(ctx context.Context, cmds []Cmder) error {
+		for _, cmd := range cmds {
+			processed = append(processed, cmd.Args())
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		processed = nil
+		hs = hooks{}
+		hs.AddMiddleware(func(ctx context.Context, cmd Cmder) error {
+			if cmd.Name() == "keys" {
+				return errors.New("KEYS is not allowed")
+			}
+			return nil
+		})
+		hs.AddMiddleware(func(ctx context.Context, cmd Cmder) error {
+			if cmd.Name() == "set" {
+				cmd.SetArgs(append(cmd.Args(), "ex", 60)...)
+			}
+			return nil
+		})
+	})
+
+	It("rewrites and rejects commands", func() {
+		ctx := context.Background()
+
+		set := NewStatusCmd(ctx, "set", "key", "value")
+		Expect(hs.process(ctx, set, process)).NotTo(HaveOccurred())
+
+		keys := NewStringSliceCmd(ctx, "keys", "*")
+		Expect(hs.process(ctx, keys, process)).To(MatchError("KEYS is not allowed"))
+		Expect(keys.Err()).To(MatchError("KEYS is not allowed"))
+
+		Expect(processed).To(Equal([][]interface{}{{"set", "key", "value", "ex", 60}}))
+	})
+
+	It("rejects the whole pipeline", func() {
+		ctx := context.Background()
+		cmds := []Cmder{NewStatusCmd(ctx, "set", "key", "value"), NewStringSliceCmd(ctx, "keys", "*")}
+
+		Expect(hs.processPipeline(ctx, cmds, processPipeline)).To(MatchError("KEYS is not allowed"))
+		Expect(cmds[0].Err()).To(MatchError("KEYS is not allowed"))
+		Expect(processed).To(BeEmpty())
+
+		cmds = []Cmder{NewStatusCmd(ctx, "set", "key", "value")}
+		Expect(hs.processTxPipeline(ctx, cmds, processPipeline)).NotTo(HaveOccurred())
+		Expect(processed).To(Equal([][]interface{}{
+			{"multi"}, {"set", "key", "value", "ex", 60}, {"exec"},
+		}))
+	})
+})
+
+var _ = Describe("keyPrefixer", func() {
+	var p *keyPrefixer
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		p = newKeyPrefixer("t1:")
+		p.info.Store(map[string]*CommandInfo{
+			"get":     {Name: "get", FirstKeyPos: 1, LastKeyPos: 1, StepCount: 1},
+			"mset":    {Name: "mset", FirstKeyPos: 1, LastKeyPos: -1, StepCount: 2},
+			"migrate": {Name: "migrate", FirstKeyPos: 3, LastKeyPos: 3, StepCount: 1, Flags: []string{"write", "movablekeys"}},
+		})
+	})
+
+	args := func(cmd Cmder) []interface{} {
+		args, err := p.args(cmd)
+		Expect(err).NotTo(HaveOccurred())
+		return args
+	}
+
+	It("prefixes the keys", func() {
+		Expect(args(NewStringCmd(ctx, "get", "key"))).To(Equal([]interface{}{"get", "t1:key"}))
+		Expect(args(NewStatusCmd(ctx, "mset", "a", 1, "b", 2))).To(Equal([]interface{}{"mset", "t1:a", 1, "t1:b", 2}))
+		Expect(args(NewCmd(ctx, "eval", "return 1", 2, "a", "b", "arg"))).To(Equal([]interface{}{"eval", "return 1", 2, "t1:a", "t1:b", "arg"}))
+		Expect(args(NewCmd(ctx, "xread", "count", 1, "streams", "s1", "s2", "0", "0"))).To(Equal([]interface{}{"xread", "count", 1, "streams", "t1:s1", "t1:s2", "0", "0"}))
+		Expect(args(NewStringSliceCmd(ctx, "keys", "*"))).To(Equal([]interface{}{"keys", "t1:*"}))
+		Expect(args(NewScanCmd(ctx, nil, "scan", 0))).To(Equal([]interface{}{"scan", 0, "match", "t1:*"}))
+		Expect(args(NewScanCmd(ctx, nil, "scan", 0, "match", "user:*"))).To(Equal([]interface{}{"scan", 0, "match", "t1:user:*"}))
+		Expect(args(NewCmd(ctx, "ping"))).To(Equal([]interface{}{"ping"}))
+
+		cmd := NewStringCmd(ctx, "get", "key")
+		args(cmd)
+		Expect(cmd.Args()).To(Equal([]interface{}{"get", "key"}))
+	})
+
+	It("escapes the patterns", func() {
+		p = newKeyPrefixer("t[1]*:")
+		Expect(args(NewStringSliceCmd(ctx, "keys", "*"))).To(Equal([]interface{}{"keys", `t\[1\]\*:*`}))
+	})
+
+	It("rejects the commands with unknown keys", func() {
+		_, err := p.args(NewStatusCmd(ctx, "migrate", "host", 6379, "", 0, 1000, "keys", "a"))
+		Expect(err).To(MatchError(`redis: can't prefix the keys of "migrate"`))
+		_, err = p.args(NewCmd(ctx, "foo", "bar"))
+		Expect(err).To(MatchError(`redis: can't prefix the keys of unknown command "foo"`))
+	})
+
+	It("strips the prefix from the replies", func() {
+		keys := NewStringSliceCmd(ctx, "keys", "*")
+		keys.SetVal([]string{"t1:a", "t1:b"})
+		scan := NewScanCmd(ctx, nil, "scan", 0)
+		scan.SetVal([]string{"t1:c"}, 0)
+		kvScan := NewKvScanCmd(ctx, nil, ScanValue, "scan", "0")
+		kvScan.SetVal([]string{"t1:d", "t1:value"}, "0")
+		p.strip(keys, scan, kvScan)
+		Expect(keys.Val()).To(Equal([]string{"a", "b"}))
+		Expect(scan.Val()).To(Equal([]string{"c"}))
+		kvs, _, err := kvScan.KeyVal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kvs).To(Equal([]*KeyValue{{Key: "d", Value: []byte("t1:value")}}))
+	})
+
+	It("strips the prefix from the popped keys and the streams", func() {
+		blpop := NewStringSliceCmd(ctx, "blpop", "t1:a", 0)
+		blpop.SetVal([]string{"t1:a", "t1:value"})
+		bzpop := NewZWithKeyCmd(ctx, "bzpopmin", "t1:z", 0)
+		bzpop.SetVal(&ZWithKey{Z: Z{Score: 1, Member: "t1:member"}, Key: "t1:z"})
+		nilPop := NewZWithKeyCmd(ctx, "bzpopmax", "t1:z", 0)
+		xread := NewXStreamSliceCmd(ctx, "xread", "streams", "t1:s", "0")
+		xread.SetVal([]XStream{{Stream: "t1:s", Messages: []XMessage{{ID: "1-0"}}}})
+		lmpop := NewCmd(ctx, "lmpop", 1, "t1:l", "left")
+		lmpop.SetVal([]interface{}{"t1:l", []interface{}{"t1:value"}})
+		bzmpop := NewCmd(ctx, "bzmpop", 0, 1, "t1:z", "min")
+		bzmpop.SetVal([]interface{}{"t1:z", []interface{}{[]interface{}{"t1:member", "1"}}})
+		xreadDo := NewCmd(ctx, "xread", "streams", "t1:s", "0")
+		xreadDo.SetVal([]interface{}{[]interface{}{"t1:s", []interface{}{}}})
+		p.strip(blpop, bzpop, nilPop, xread, lmpop, bzmpop, xreadDo)
+		Expect(blpop.Val()).To(Equal([]string{"a", "t1:value"}))
+		Expect(bzpop.Val()).To(Equal(&ZWithKey{Z: Z{Score: 1, Member: "t1:member"}, Key: "z"}))
+		Expect(nilPop.Val()).To(BeNil())
+		Expect(xread.Val()).To(Equal([]XStream{{Stream: "s", Messages: []XMessage{{ID: "1-0"}}}}))
+		Expect(lmpop.Val()).To(Equal([]interface{}{"l", []interface{}{"t1:value"}}))
+		Expect(bzmpop.Val()).To(Equal([]interface{}{"z", []interface{}{[]interface{}{"t1:member", "1"}}}))
+		Expect(xreadDo.Val()).To(Equal([]interface{}{[]interface{}{"s", []interface{}{}}}))
+	})
+
+	It("prefixes the shard channels", func() {
+		Expect(args(NewSliceCmd(ctx, "ssubscribe", "a", "b"))).To(Equal([]interface{}{"ssubscribe", "t1:a", "t1:b"}))
+		Expect(args(NewSliceCmd(ctx, "sunsubscribe", "a"))).To(Equal([]interface{}{"sunsubscribe", "t1:a"}))
+		Expect(args(NewSliceCmd(ctx, "sunsubscribe"))).To(Equal([]interface{}{"sunsubscribe"}))
+		Expect(args(NewSliceCmd(ctx, "subscribe", "a"))).To(Equal([]interface{}{"subscribe", "a"}))
+		Expect(args(NewSliceCmd(ctx, "psubscribe", "a*"))).To(Equal([]interface{}{"psubscribe", "a*"}))
+	})
+
+	It("strips the prefix from the shard channels", func() {
+		c := &PubSub{opt: &Options{prefixer: p}}
+
+		msg, err := c.newMessage([]interface{}{"smessage", "t1:a", "hello"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&Message{Channel: "a", Payload: "hello"}))
+		msg, err = c.newMessage([]interface{}{"ssubscribe", "t1:a", int64(1)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&Subscription{Kind: "ssubscribe", Channel: "a", Count: 1}))
+		msg, err = c.newMessage([]interface{}{"message", "t1:a", "hello"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&Message{Channel: "t1:a", Payload: "hello"}))
+
+		c = &PubSub{opt: &Options{}}
+		msg, err = c.newMessage([]interface{}{"smessage", "t1:a", "hello"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&Message{Channel: "t1:a", Payload: "hello"}))
+	})
+})
+
+var _ = Describe("Tune", func() {
+	It("changes the options of Client", func() {
+		client := NewClient(&Options{ReadTimeout: time.Second})
+		defer client.Close()
+		conn := client.Conn(context.Background())
+		defer conn.Close()
+		timeout := client.WithTimeout(time.Minute)
+
+		Expect(client.Tune(&TuneOptions{
+			PoolSize:     3,
+			ReadTimeout:  2 * time.Second,
+			WriteTimeout: -1,
+		})).To(Succeed())
+		Expect(client.opt.readTimeout()).To(Equal(2 * time.Second))
+		Expect(client.opt.writeTimeout()).To(Equal(time.Duration(0)))
+		Expect(conn.opt.readTimeout()).To(Equal(2 * time.Second))
+		Expect(timeout.opt.readTimeout()).To(Equal(time.Minute))
+		Expect(client.Options().ReadTimeout).To(Equal(time.Second))
+
+		Expect(client.Tune(&TuneOptions{ReadTimeout: 3 * time.Second})).To(Succeed())
+		Expect(client.opt.readTimeout()).To(Equal(3 * time.Second))
+		Expect(client.opt.writeTimeout()).To(Equal(time.Duration(0)))
+
+		Expect(client.Tune(&TuneOptions{PoolSize: -1})).To(MatchError("redis: invalid PoolSize: -1"))
+	})
+
+	It("changes the options of ClusterClient", func() {
+		client := NewClusterClient(&ClusterOptions{
+			Addrs:    []string{":7000"},
+			ReadOnly: true,
+		})
+		defer client.Close()
+		node, err := client.nodes.GetOrCreate(":7000")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Tune(&TuneOptions{PoolSize: 3, ReadTimeout: 2 * time.Second})).To(Succeed())
+		Expect(node.Client.opt.readTimeout()).To(Equal(2 * time.Second))
+
+		node, err = client.nodes.GetOrCreate(":7001")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Client.opt.PoolSize).To(Equal(3))
+		Expect(node.Client.opt.readTimeout()).To(Equal(2 * time.Second))
+
+		Expect(client.SetReadOnly(false)).To(Succeed())
+		Expect(client.opt.readOnly()).To(BeFalse())
+		Expect(client.SetReadOnly(true)).To(Succeed())
+		Expect(client.opt.readOnly()).To(BeTrue())
+	})
+
+	It("does not enable ReadOnly without READONLY connections", func() {
+		client := NewClusterClient(&ClusterOptions{Addrs: []string{":7000"}})
+		defer client.Close()
+
+		Expect(client.SetReadOnly(true)).To(MatchError(
+			"redis: ReadOnly can't be enabled for ClusterClient created without ReadOnly"))
+		Expect(client.opt.readOnly()).To(BeFalse())
+	})
+})
+
+var _ = Describe("derived clients", func() {
+	It("share the pool and override the options", func() {
+		client := NewClient(&Options{KeyPrefix: "t1:"})
+		defer client.Close()
+
+		db := client.WithDB(3)
+		Expect(db.Options().DB).To(Equal(3))
+		Expect(db.connPool).To(BeIdenticalTo(client.connPool))
+		Expect(client.Options().DB).To(Equal(0))
+
+		prefixed := db.WithKeyPrefix("t2:")
+		Expect(prefixed.Options().DB).To(Equal(3))
+		Expect(prefixed.opt.prefixer.prefix).To(Equal("t2:"))
+		Expect(prefixed.opt.prefixer.info).To(BeIdenticalTo(client.opt.prefixer.info))
+		Expect(client.opt.prefixer.prefix).To(Equal("t1:"))
+
+		Expect(client.WithKeyPrefix("").opt.prefixer).To(BeNil())
+
+		other := NewClient(&Options{})
+		defer other.Close()
+		Expect(other.WithKeyPrefix("t3:").opt.prefixer.prefix).To(Equal("t3:"))
+	})
+
+	It("track the DB selected on the connections", func() {
+		ctx := context.Background()
+		client := NewClient(&Options{DB: 1})
+		defer client.Close()
+
+		cn := pool.NewConn(nil)
+		cn.DB = 1
+
+		failed := NewStatusCmd(ctx, "select", 2)
+		failed.SetErr(errors.New("ERR DB index is out of range"))
+		client.trackDB(cn, NewStringCmd(ctx, "get", "key"), failed)
+		Expect(cn.DB).To(Equal(1))
+
+		client.trackDB(cn, NewStatusCmd(ctx, "select", 2))
+		Expect(cn.DB).To(Equal(2))
+		Expect(client.Options().DB).To(Equal(1))
+
+		conn := client.Conn(ctx)
+		defer conn.Close()
+		conn.trackDB(cn, NewStatusCmd(ctx, "select", 3))
+		Expect(cn.DB).To(Equal(3))
+		Expect(conn.opt.DB).To(Equal(3))
+		Expect(client.Options().DB).To(Equal(1))
+	})
+})
+
+type orderHook struct {
+	name  string
+	calls *[]string
+}
+
+func (h orderHook) BeforeProcess(ctx context.Context, cmd Cmder) (context.Context, error) {
+	*h.calls = append(*h.calls, "before "+h.name)
+	return ctx, nil
+}
+
+func (h orderHook) AfterProcess(ctx context.Context, cmd Cmder) error {
+	*h.calls = append(*h.calls, "after "+h.name)
+	return nil
+}
+
+func (h orderHook) BeforeProcessPipeline(ctx context.Context, cmds []Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h orderHook) AfterProcessPipeline(ctx context.Context, cmds []Cmder) error {
+	return nil
+}
+
+var _ = Describe("RegisterHook", func() {
+	var calls []string
+	var hs hooks
+
+	process := func() []string {
+		calls = nil
+		_ = hs.process(context.Background(), NewCmd(context.Background(), "ping"), func(context.Context, Cmder) error {
+			calls = append(calls, "process")
+			return nil
+		})
+		return calls
+	}
+
+	BeforeEach(func() {
+		hs = hooks{}
+	})
+
+	It("orders the hooks by priority", func() {
+		hs.AddHook(orderHook{name: "a", calls: &calls})
+		hs.RegisterHook(orderHook{name: "low", calls: &calls}, &HookOptions{Priority: -1})
+		hs.RegisterHook(orderHook{name: "high", calls: &calls}, &HookOptions{Priority: 10})
+		hs.AddHook(orderHook{name: "b", calls: &calls})
+
+		Expect(process()).To(Equal([]string{
+			"before high", "before a", "before b", "before low",
+			"process",
+			"after low", "after b", "after a", "after high",
+		}))
+	})
+
+	It("removes the hooks", func() {
+		hs.AddHook(orderHook{name: "a", calls: &calls})
+		h := hs.RegisterHook(orderHook{name: "b", calls: &calls}, nil)
+		clone := hs.clone()
+
+		h.Remove()
+		Expect(process()).To(Equal([]string{"before a", "process", "after a"}))
+		Expect(clone.hooks).To(HaveLen(2))
+
+		h.Remove()
+		Expect(hs.hooks).To(HaveLen(1))
+	})
+
+	It("removes the hooks of the connections", func() {
+		client := NewClient(&Options{})
+		defer client.Close()
+
+		h := client.RegisterHook(&dialOrderHook{}, nil)
+		clone := client.WithContext(context.Background())
+		Expect(clone.connHooks.get()).To(HaveLen(1))
+
+		h.Remove()
+		Expect(client.hooks.hooks).To(BeEmpty())
+		Expect(clone.connHooks.get()).To(BeEmpty())
+	})
+})
+
+type dialOrderHook struct {
+	orderHook
+}
+
+func (h *dialOrderHook) AfterDial(ctx context.Context, event *DialEvent) {}
+
+var _ = Describe("dnsDialer", func() {
+	var lns []net.Listener
+	var port string
+
+	BeforeEach(func() {
+		lns = nil
+		for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+			addr := ip + ":0"
+			if port != "" {
+				addr = net.JoinHostPort(ip, port)
+			}
+			ln, err := net.Listen("tcp", addr)
+			Expect(err).NotTo(HaveOccurred())
+			_, port, _ = net.SplitHostPort(ln.Addr().String())
+			lns = append(lns, ln)
+		}
+	})
+
+	AfterEach(func() {
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+		port = ""
+	})
+
+	newDialer := func(expires time.Time) *dnsDialer {
+		d := newDNSDialer(&DNSOptions{CacheTTL: time.Minute})
+		d.hosts["redis.invalid"] = &dnsEntry{
+			addrs:   []string{"127.0.0.1", "127.0.0.2"},
+			expires: expires,
+		}
+		return d
+	}
+
+	dial := func(d *dnsDialer) string {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn, err := d.dial(ctx, &net.Dialer{}, "tcp", net.JoinHostPort("redis.invalid", port), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		return host
+	}
+
+	It("rotates the connections across the addresses", func() {
+		d := newDialer(time.Now().Add(time.Minute))
+		Expect([]string{dial(d), dial(d), dial(d)}).To(Equal([]string{"127.0.0.1", "127.0.0.2", "127.0.0.1"}))
+	})
+
+	It("dials the next address on failure", func() {
+		Expect(lns[0].Close()).To(Succeed())
+		d := newDialer(time.Now().Add(time.Minute))
+		Expect([]string{dial(d), dial(d)}).To(Equal([]string{"127.0.0.2", "127.0.0.2"}))
+	})
+
+	It("uses the expired addresses when the host can't be resolved", func() {
+		d := newDialer(time.Now().Add(-time.Minute))
+		Expect(dial(d)).To(Equal("127.0.0.1"))
+	})
+})
+
+var _ = Describe("endpointsFailover", func() {
+	ctx := context.Background()
+	var healthy map[string]bool
+	var switched []string
+
+	newFailover := func(opt *EndpointsOptions) *endpointsFailover {
+		opt.HealthCheck = func(ctx context.Context, c *Client) error {
+			if healthy[c.opt.Addr] {
+				return nil
+			}
+			return errors.New("unhealthy")
+		}
+		opt.HealthCheckTimeout = time.Second
+		f := newEndpointsFailover(opt, &Options{}, []string{"primary:6379", "backup:6379"})
+		f.onSwitch = func(addr string) {
+			switched = append(switched, addr)
+		}
+		return f
+	}
+
+	BeforeEach(func() {
+		healthy = map[string]bool{"primary:6379": true, "backup:6379": true}
+		switched = nil
+	})
+
+	It("fails over to the backup and falls back to the primary", func() {
+		f := newFailover(&EndpointsOptions{})
+		defer f.Close()
+
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("primary:6379"))
+
+		healthy["primary:6379"] = false
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("backup:6379"))
+
+		healthy["primary:6379"] = true
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("primary:6379"))
+		Expect(switched).To(Equal([]string{"backup:6379", "primary:6379"}))
+	})
+
+	It("keeps the current endpoint when no endpoint is healthy", func() {
+		f := newFailover(&EndpointsOptions{})
+		defer f.Close()
+
+		healthy["primary:6379"] = false
+		healthy["backup:6379"] = false
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("primary:6379"))
+		Expect(switched).To(BeEmpty())
+	})
+
+	It("falls back after FailbackDelay", func() {
+		f := newFailover(&EndpointsOptions{FailbackDelay: 50 * time.Millisecond})
+		defer f.Close()
+
+		healthy["primary:6379"] = false
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("backup:6379"))
+
+		healthy["primary:6379"] = true
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("backup:6379"))
+
+		time.Sleep(50 * time.Millisecond)
+		f.check(ctx)
+		Expect(f.addr()).To(Equal("primary:6379"))
+	})
+})
+
+var _ = Describe("ReadOnlyGuard", func() {
+	ctx := context.Background()
+	var guard *ReadOnlyGuard
+
+	BeforeEach(func() {
+		guard = &ReadOnlyGuard{
+			cmdsInfo: newCmdsInfoCache(func(ctx context.Context) (map[string]*CommandInfo, error) {
+				return map[string]*CommandInfo{
+					"get": {Name: "get", Flags: []string{"readonly", "fast"}},
+					"set": {Name: "set", Flags: []string{"write", "denyoom"}},
+				}, nil
+			}),
+		}
+	})
+
+	It("allows all the commands when disabled", func() {
+		Expect(guard.process(ctx, NewStatusCmd(ctx, "set", "key", "value"))).NotTo(HaveOccurred())
+	})
+
+	It("rejects the write commands when enabled", func() {
+		guard.Enable()
+		Expect(guard.process(ctx, NewStringCmd(ctx, "get", "key"))).NotTo(HaveOccurred())
+
+		err := guard.process(ctx, NewStatusCmd(ctx, "set", "key", "value"))
+		Expect(err).To(Equal(&ReadOnlyGuardError{Command: "set"}))
+		Expect(err.Error()).To(Equal("redis: set is rejected by the read-only guard"))
+
+		Expect(guard.process(ctx, NewCmd(ctx, "eval", "return 1", 0))).To(HaveOccurred())
+		Expect(guard.process(ctx, NewCmd(ctx, "unknown"))).To(HaveOccurred())
+
+		guard.Disable()
+		Expect(guard.process(ctx, NewStatusCmd(ctx, "set", "key", "value"))).NotTo(HaveOccurred())
+	})
+
+	It("rejects the commands of pipelines", func() {
+		guard.Enable()
+		var hs hooks
+		hs.AddMiddleware(guard.process)
+
+		cmds := []Cmder{NewStringCmd(ctx, "get", "key"), NewStatusCmd(ctx, "set", "key", "value")}
+		err := hs.processPipeline(ctx, cmds, func(ctx context.Context, cmds []Cmder) error {
+			panic("not reached")
+		})
+		Expect(err).To(Equal(&ReadOnlyGuardError{Command: "set"}))
+		Expect(cmds[0].Err()).To(Equal(err))
+	})
+})
+
+type cmdLimiter struct {
+	allowed  []string
+	reported []string
+}
+
+func (l *cmdLimiter) Allow() error {
+	panic("not reached")
+}
+
+func (l *cmdLimiter) ReportResult(result error) {
+	panic("not reached")
+}
+
+func (l *cmdLimiter) AllowCmd(ctx context.Context, name string, weight int) error {
+	l.allowed = append(l.allowed, fmt.Sprintf("%s %d", name, weight))
+	return nil
+}
+
+func (l *cmdLimiter) ReportCmdResult(name string, weight int, result error) {
+	l.reported = append(l.reported, fmt.Sprintf("%s %d", name, weight))
+}
+
+var _ = Describe("TokenBucketLimiter", func() {
+	ctx := context.Background()
+
+	It("limits the rate of the commands", func() {
+		l := NewTokenBucketLimiter(&TokenBucketOptions{
+			Rate:       100,
+			Burst:      3,
+			CmdWeights: map[string]int{"keys": 2},
+		})
+		Expect(l.AllowCmd(ctx, "keys", 1)).NotTo(HaveOccurred())
+		Expect(l.AllowCmd(ctx, "get", 1)).NotTo(HaveOccurred())
+		Expect(l.AllowCmd(ctx, "get", 1)).To(Equal(ErrRateLimited))
+
+		time.Sleep(30 * time.Millisecond)
+		// Pipelines with more commands than Burst use the full bucket.
+		Expect(l.AllowCmd(ctx, "pipeline", 10)).NotTo(HaveOccurred())
+		Expect(l.AllowCmd(ctx, "get", 1)).To(Equal(ErrRateLimited))
+	})
+
+	It("waits for the tokens", func() {
+		l := NewTokenBucketLimiter(&TokenBucketOptions{Rate: 100, Burst: 1, Wait: true})
+		Expect(l.AllowCmd(ctx, "get", 1)).NotTo(HaveOccurred())
+
+		start := time.Now()
+		Expect(l.AllowCmd(ctx, "get", 1)).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 5*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		defer cancel()
+		l = NewTokenBucketLimiter(&TokenBucketOptions{Rate: 1, Wait: true})
+		Expect(l.AllowCmd(ctx, "get", 1)).NotTo(HaveOccurred())
+		Expect(l.AllowCmd(ctx, "get", 1)).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("limits the operations in flight", func() {
+		l := NewTokenBucketLimiter(&TokenBucketOptions{MaxConcurrent: 1})
+		Expect(l.AllowCmd(ctx, "pipeline", 5)).NotTo(HaveOccurred())
+		Expect(l.Allow()).To(Equal(ErrRateLimited))
+
+		l.ReportCmdResult("pipeline", 5, nil)
+		Expect(l.Allow()).NotTo(HaveOccurred())
+		l.ReportResult(nil)
+	})
+
+	It("does not limit the commands that set up the connections", func() {
+		for _, wait := range []bool{false, true} {
+			srv := &authServer{password: "p1"}
+			client := NewClient(&Options{
+				Dialer:     srv.dial,
+				Password:   "p1",
+				DB:         1,
+				ClientName: "app",
+				Limiter:    NewTokenBucketLimiter(&TokenBucketOptions{MaxConcurrent: 1, Wait: wait}),
+				MaxRetries: -1,
+			})
+
+			ctx, cancel := context.WithTimeout(ctx, time.Second)
+			Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+			Expect(client.WithDB(2).Get(ctx, "key").Val()).To(Equal("value"))
+			cancel()
+			Expect(client.Close()).To(Succeed())
+		}
+	})
+
+	It("is called with the commands and the pipelines", func() {
+		l := new(cmdLimiter)
+		client := NewClient(&Options{
+			Addr:       "127.0.0.1:1",
+			Limiter:    l,
+			MaxRetries: -1,
+		})
+		defer client.Close()
+
+		_ = client.Get(ctx, "key").Err()
+		_, _ = client.Pipelined(ctx, func(pipe Pipeliner) error {
+			pipe.Get(ctx, "key1")
+			pipe.Get(ctx, "key2")
+			return nil
+		})
+		Expect(l.allowed).To(Equal([]string{"get 1", "pipeline 2"}))
+		Expect(l.reported).To(Equal(l.allowed))
+	})
+})
+
+// authServer serves the connections dialed by the client. The connection
+// noauthConn loses its authentication after AUTH.
+type authServer struct {
+	password   string
+	noauthConn int
+	conns      int
+	auths      []string
+	setInfos   []string
+	getDelay   time.Duration
+}
+
+func (s *authServer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	s.conns++
+	go s.serve(server, s.conns)
+	return client, nil
+}
+
+func (s *authServer) serve(conn net.Conn, n int) {
+	defer conn.Close()
+	rd := proto.NewReader(conn)
+	for {
+		argc, err := rd.ReadArrayLen()
+		if err != nil {
+			return
+		}
+		args := make([]string, argc)
+		for i := range args {
+			if args[i], err = rd.ReadString(); err != nil {
+				return
+			}
+		}
+
+		reply := "+OK\r\n"
+		switch strings.ToLower(args[0]) {
+		case "auth":
+			s.auths = append(s.auths, args[len(args)-1])
+			if s.password != "" && args[len(args)-1] != s.password {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case "client":
+			if strings.ToLower(args[1]) == "setinfo" {
+				s.setInfos = append(s.setInfos, args[2]+"="+args[3])
+			}
+		case "get":
+			time.Sleep(s.getDelay)
+			if n == s.noauthConn {
+				reply = "-NOAUTH Authentication required.\r\n"
+			} else {
+				reply = "$5\r\nvalue\r\n"
+			}
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+var _ = Describe("Client identity", func() {
+	ctx := context.Background()
+
+	It("is only sent when enabled", func() {
+		srv := new(authServer)
+		client := NewClient(&Options{Dialer: srv.dial})
+		Expect(client.Get(ctx, "key").Err()).NotTo(HaveOccurred())
+		Expect(client.Close()).To(Succeed())
+		Expect(srv.setInfos).To(BeEmpty())
+
+		srv = new(authServer)
+		client = NewClient(&Options{Dialer: srv.dial, EnableIdentity: true, IdentitySuffix: "orders"})
+		Expect(client.Get(ctx, "key").Err()).NotTo(HaveOccurred())
+		Expect(client.Close()).To(Succeed())
+		Expect(srv.setInfos).To(Equal([]string{"lib-name=go-redis(orders)", "lib-ver=" + Version()}))
+	})
+})
+
+var _ = Describe("BytesCmd", func() {
+	ctx := context.Background()
+
+	It("passes the read buffer of the connection", func() {
+		srv := new(authServer)
+		client := NewClient(&Options{Dialer: srv.dial, PoolSize: 1})
+		defer client.Close()
+
+		var bufs [][]byte
+		for i := 0; i < 2; i++ {
+			err := client.GetBytes(ctx, "key", func(b []byte) {
+				Expect(string(b)).To(Equal("value"))
+				bufs = append(bufs, b)
+			}).Err()
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(bufs).To(HaveLen(2))
+		Expect(&bufs[0][0]).To(BeIdenticalTo(&bufs[1][0]))
+	})
+
+	It("is not hedged by ClusterClient", func() {
+		servers := map[string]*authServer{
+			"master:6379":  {getDelay: 20 * time.Millisecond},
+			"replica:6379": {getDelay: 20 * time.Millisecond},
+		}
+		client := NewClusterClient(&ClusterOptions{
+			ClusterSlots: func(ctx context.Context) ([]ClusterSlot, error) {
+				return []ClusterSlot{{
+					Start: 0,
+					End:   16383,
+					Nodes: []ClusterNode{{Addr: "master:6379"}, {Addr: "replica:6379"}},
+				}}, nil
+			},
+			Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return servers[addr].dial(ctx, network, addr)
+			},
+			Hedge: &HedgeOptions{MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		})
+		defer client.Close()
+		client.cmdsInfoCache = newCmdsInfoCache(func(ctx context.Context) (map[string]*CommandInfo, error) {
+			return map[string]*CommandInfo{"get": {Name: "get", FirstKeyPos: 1, ReadOnly: true}}, nil
+		})
+
+		var calls int32
+		err := client.GetBytes(ctx, "key", func(b []byte) {
+			atomic.AddInt32(&calls, 1)
+		}).Err()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(servers["master:6379"].conns + servers["replica:6379"].conns).To(Equal(1))
+
+		// GET is hedged and is sent to both nodes.
+		Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+		time.Sleep(50 * time.Millisecond)
+		Expect(servers["master:6379"].conns + servers["replica:6379"].conns).To(Equal(2))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+	})
+})
+
+var _ = Describe("CredentialsProvider", func() {
+	ctx := context.Background()
+
+	It("authenticates the new connections with the current credentials", func() {
+		srv := &authServer{password: "p1", noauthConn: 1}
+		password := "p1"
+		client := NewClient(&Options{
+			Dialer:          srv.dial,
+			MinRetryBackoff: -1,
+			CredentialsProvider: func(ctx context.Context) (string, string, error) {
+				return "user", password, nil
+			},
+		})
+		defer client.Close()
+
+		// The password is rotated before the first connection loses its
+		// authentication.
+		srv.password = "p2"
+		password = "p2"
+
+		Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+		Expect(srv.auths).To(Equal([]string{"p2", "p2"}))
+		Expect(client.PoolStats().TotalConns).To(Equal(uint32(1)))
+	})
+
+	It("returns the error of the provider", func() {
+		client := NewClient(&Options{
+			Dialer:     (&authServer{}).dial,
+			MaxRetries: -1,
+			CredentialsProvider: func(ctx context.Context) (string, string, error) {
+				return "", "", errors.New("token expired")
+			},
+		})
+		defer client.Close()
+
+		Expect(client.Ping(ctx).Err()).To(MatchError("token expired"))
+	})
+
+	It("closes the connections that lost the authentication", func() {
+		err := proto.RedisError("NOAUTH Authentication required.")
+		Expect(isBadConn(err, false, "")).To(BeTrue())
+		Expect(shouldRetry(err, false)).To(BeTrue())
+		Expect(isBadConn(proto.RedisError("ERR wrong number of arguments"), false, "")).To(BeFalse())
+	})
+})
+
+type tokenSource struct {
+	tokens []*Token
+	err    error
+	calls  int32
+}
+
+func (s *tokenSource) Token(ctx context.Context) (*Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.tokens[n-1], nil
+}
+
+var _ = Describe("TokenAuth", func() {
+	ctx := context.Background()
+
+	It("re-authenticates the connections with the refreshed token", func() {
+		src := &tokenSource{tokens: []*Token{
+			{Username: "user", Password: "t1", Expires: time.Now().Add(100 * time.Millisecond)},
+			{Username: "user", Password: "t2", Expires: time.Now().Add(time.Hour)},
+		}}
+		srv := new(authServer)
+		client := NewClient(&Options{
+			Dialer:    srv.dial,
+			PoolSize:  1,
+			TokenAuth: NewTokenAuth(&TokenAuthOptions{Source: src}),
+		})
+		defer client.Close()
+
+		Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+		Expect(srv.auths).To(Equal([]string{"t1"}))
+
+		// The token is refreshed in the background after 70% of its lifetime.
+		time.Sleep(80 * time.Millisecond)
+		Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&src.calls)
+		}).Should(Equal(int32(2)))
+
+		Expect(client.Get(ctx, "key").Val()).To(Equal("value"))
+		Expect(srv.auths).To(Equal([]string{"t1", "t2"}))
+		Expect(srv.conns).To(Equal(1))
+	})
+
+	It("returns the error of the source", func() {
+		client := NewClient(&Options{
+			Dialer:     new(authServer).dial,
+			MaxRetries: -1,
+			TokenAuth: NewTokenAuth(&TokenAuthOptions{
+				Source: &tokenSource{err: errors.New("token expired")},
+			}),
+		})
+		defer client.Close()
+
+		Expect(client.Ping(ctx).Err()).To(MatchError("token expired"))
+	})
+})
+
+// writeTestCert writes a self-signed certificate with the common name cn and
+// its key to the files in dir.
+func writeTestCert(dir, cn string, modTime time.Time) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+	Expect(os.Chtimes(certFile, modTime, modTime)).To(Succeed())
+	Expect(os.Chtimes(keyFile, modTime, modTime)).To(Succeed())
+	return certFile, keyFile
+}
+
+func certCommonName(cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	Expect(err).NotTo(HaveOccurred())
+	return leaf.Subject.CommonName
+}
+
+var _ = Describe("CertReloader", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "redis-tls")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("reloads the modified certificate", func() {
+		now := time.Now()
+		certFile, keyFile := writeTestCert(dir, "first", now)
+
+		certs, err := NewCertReloader(certFile, keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certCommonName(certs.Certificate())).To(Equal("first"))
+
+		writeTestCert(dir, "second", now.Add(time.Second))
+		Expect(certCommonName(certs.Certificate())).To(Equal("second"))
+
+		// The previous certificate is used while the files are being written.
+		Expect(os.WriteFile(keyFile, []byte("partial"), 0o600)).To(Succeed())
+		Expect(os.Chtimes(keyFile, now.Add(2*time.Second), now.Add(2*time.Second))).To(Succeed())
+		Expect(certCommonName(certs.Certificate())).To(Equal("second"))
+	})
+
+	It("returns an error for the missing files", func() {
+		_, err := NewCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("presents the reloaded certificate on the new connections", func() {
+		now := time.Now()
+		serverDir := filepath.Join(dir, "server")
+		Expect(os.Mkdir(serverDir, 0o700)).To(Succeed())
+		serverCert, err := tls.LoadX509KeyPair(writeTestCert(serverDir, "server", now))
+		Expect(err).NotTo(HaveOccurred())
+
+		var mu sync.Mutex
+		var peers []string
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAnyClientCert,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				leaf, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				peers = append(peers, leaf.Subject.CommonName)
+				mu.Unlock()
+				return nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer ln.Close()
+
+		srv := new(authServer)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go srv.serve(conn, 0)
+			}
+		}()
+
+		certs, err := NewCertReloader(writeTestCert(dir, "first", now))
+		Expect(err).NotTo(HaveOccurred())
+
+		var getConfigCalls int32
+		client := NewClient(&Options{
+			Addr: ln.Addr().String(),
+			GetTLSConfig: func(ctx context.Context) (*tls.Config, error) {
+				atomic.AddInt32(&getConfigCalls, 1)
+				return &tls.Config{
+					InsecureSkipVerify:   true,
+					GetClientCertificate: certs.GetClientCertificate,
+				}, nil
+			},
+		})
+		defer client.Close()
+
+		ctx := context.Background()
+		conn := client.Conn(ctx)
+		defer conn.Close()
+		Expect(conn.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		writeTestCert(dir, "second", now.Add(time.Second))
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(peers).To(Equal([]string{"first", "second"}))
+		Expect(atomic.LoadInt32(&getConfigCalls)).To(Equal(int32(2)))
+	})
+
+	It("returns the error of GetTLSConfig", func() {
+		client := NewClient(&Options{
+			Addr:       "127.0.0.1:1",
+			MaxRetries: -1,
+			GetTLSConfig: func(ctx context.Context) (*tls.Config, error) {
+				return nil, errors.New("no certificate")
+			},
+		})
+		defer client.Close()
+
+		Expect(client.Ping(context.Background()).Err()).To(MatchError("no certificate"))
+	})
+})
+
+// aclServer emulates the ACL commands of Redis 7.
+type aclServer struct {
+	mu    sync.Mutex
+	users map[string]*aclUserState
+	cmds  []string
+}
+
+func (s *aclServer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+func (s *aclServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := proto.NewReader(conn)
+	for {
+		argc, err := rd.ReadArrayLen()
+		if err != nil {
+			return
+		}
+		args := make([]string, argc)
+		for i := range args {
+			if args[i], err = rd.ReadString(); err != nil {
+				return
+			}
+		}
+		if _, err := io.WriteString(conn, s.process(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *aclServer) process(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.ToLower(args[0]) != "acl" {
+		return "+OK\r\n"
+	}
+	sub := strings.ToLower(args[1])
+	if sub != "users" && sub != "getuser" {
+		s.cmds = append(s.cmds, strings.Join(args[1:3], " "))
+	}
+
+	bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+	array := func(ss []string) string {
+		b := fmt.Sprintf("*%d\r\n", len(ss))
+		for _, s := range ss {
+			b += bulk(s)
+		}
+		return b
+	}
+
+	switch sub {
+	case "users":
+		var names []string
+		for name := range s.users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return array(names)
+	case "getuser":
+		u := s.users[args[2]]
+		flags := []string{"off"}
+		if u.enabled {
+			flags[0] = "on"
+		}
+		if u.noPass {
+			flags = append(flags, "nopass")
+		}
+		return "*10\r\n" + bulk("flags") + array(flags) +
+			bulk("passwords") + array(u.passwordHashes) +
+			bulk("commands") + bulk(u.commands) +
+			bulk("keys") + bulk(strings.Join(u.keys, " ")) +
+			bulk("channels") + bulk(strings.Join(u.channels, " "))
+	case "setuser":
+		u := s.users[args[2]]
+		if u == nil {
+			u = &aclUserState{commands: "-@all"}
+			s.users[args[2]] = u
+		}
+		for _, rule := range args[3:] {
+			switch {
+			case rule == "reset":
+				*u = aclUserState{commands: "-@all"}
+			case rule == "on" || rule == "off":
+				u.enabled = rule == "on"
+			case rule == "nopass":
+				u.noPass = true
+			case strings.HasPrefix(rule, "#"):
+				u.passwordHashes = append(u.passwordHashes, rule[1:])
+			case strings.HasPrefix(rule, "~") || strings.HasPrefix(rule, "%"):
+				u.keys = append(u.keys, rule)
+			case strings.HasPrefix(rule, "&"):
+				u.channels = append(u.channels, rule)
+			default:
+				u.commands += " " + rule
+			}
+		}
+		return "+OK\r\n"
+	case "deluser":
+		delete(s.users, args[2])
+		return ":1\r\n"
+	}
+	return "+OK\r\n"
+}
+
+var _ = Describe("ACLSync", func() {
+	ctx := context.Background()
+
+	It("parses the ACL GETUSER replies", func() {
+		// Redis 6.2
+		u, err := parseACLUser("app", []interface{}{
+			"flags", []interface{}{"on", "allchannels"},
+			"passwords", []interface{}{"b", "a"},
+			"commands", "+@read",
+			"keys", []interface{}{"app:*"},
+			"channels", []interface{}{},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u).To(Equal(&aclUserState{
+			enabled:        true,
+			passwordHashes: []string{"a", "b"},
+			keys:           []string{"~app:*"},
+			channels:       []string{"&*"},
+			commands:       "-@all +@read",
+		}))
+
+		_, err = parseACLUser("app", "oops")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("syncs the users idempotently", func() {
+		srv := &aclServer{users: map[string]*aclUserState{
+			"default": {enabled: true, noPass: true, keys: []string{"~*"}, commands: "+@all"},
+			"old":     {enabled: true, commands: "+@all"},
+			"ops":     {enabled: true, commands: "+@all"},
+		}}
+		client := NewClient(&Options{Dialer: srv.dial})
+		defer client.Close()
+
+		spec := &ACLSpec{
+			Users: []ACLUser{{
+				Name:      "app",
+				Enabled:   true,
+				Passwords: []string{"secret"},
+				Keys:      []string{"~app:*"},
+				Commands:  "+@read +@write -flushall",
+			}, {
+				Name:     "ops",
+				Enabled:  true,
+				Commands: "allcommands",
+			}},
+			Prune: true,
+		}
+
+		changes, err := ACLSync(ctx, client, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].User).To(Equal("app"))
+		Expect(changes[0].Op).To(Equal(ACLCreate))
+		Expect(changes[0].Rules).To(Equal([]string{
+			"reset", "on",
+			"#2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+			"~app:*", "+@read", "+@write", "-flushall",
+		}))
+		Expect(changes[1]).To(Equal(ACLChange{Addr: client.opt.Addr, User: "old", Op: ACLDelete}))
+		Expect(srv.users).NotTo(HaveKey("old"))
+
+		srv.cmds = nil
+		changes, err = ACLSync(ctx, client, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+		Expect(srv.cmds).To(BeEmpty())
+
+		spec.Users[1].Enabled = false
+		spec.DryRun = true
+		changes, err = ACLSync(ctx, client, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Op).To(Equal(ACLUpdate))
+		Expect(srv.cmds).To(BeEmpty())
+	})
+})
+
+var _ = Describe("PubSub messages", func() {
+	It("parses the invalidation messages of client tracking", func() {
+		c := new(PubSub)
+
+		msg, err := c.newMessage([]interface{}{"message", "__redis__:invalidate", []interface{}{"k1", "k2"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.(*Message).PayloadSlice).To(Equal([]string{"k1", "k2"}))
+
+		msg, err = c.newMessage([]interface{}{"message", "__redis__:invalidate", nil})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&Message{Channel: "__redis__:invalidate"}))
+	})
+})
+
+var _ = Describe("Pipeline scripts", func() {
+	ctx := context.Background()
+	var execs [][]string
+
+	newPipeline := func(tx bool) *Pipeline {
+		execs = nil
+		pipe := &Pipeline{
+			tx: tx,
+			exec: func(ctx context.Context, cmds []Cmder) error {
+				var names []string
+				for _, cmd := range cmds {
+					names = append(names, cmd.Name())
+					switch cmd.Name() {
+					case "evalsha":
+						cmd.SetErr(proto.RedisError("NOSCRIPT No matching script."))
+					case "eval":
+						cmd.(*Cmd).SetVal(int64(len(cmd.Args())))
+					}
+				}
+				execs = append(execs, names)
+				return cmdsFirstErr(cmds)
+			},
+		}
+		pipe.init()
+		return pipe
+	}
+	script := NewScript("return 1")
+
+	It("retries the scripts with EVAL without rewriting the commands", func() {
+		pipe := newPipeline(false)
+		run := script.Run(ctx, pipe, []string{"key"}, "arg")
+		_, err := pipe.Exec(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(execs).To(Equal([][]string{{"evalsha"}, {"eval"}}))
+		Expect(run.Val()).To(Equal(int64(5)))
+		Expect(run.Args()).To(Equal([]interface{}{"evalsha", script.Hash(), 1, "key", "arg"}))
+	})
+
+	It("does not retry the scripts of transactions", func() {
+		pipe := newPipeline(true)
+		run := script.Run(ctx, pipe, []string{"key"}, "arg")
+		_, err := pipe.Exec(ctx)
+		Expect(err).To(MatchError(ContainSubstring("NOSCRIPT")))
+		Expect(execs).To(Equal([][]string{{"evalsha"}}))
+		Expect(run.Err()).To(Equal(err))
+	})
+})
+
+var _ = Describe("Pipeline.Process", func() {
+	ctx := context.Background()
+
+	It("keeps the errors set before the commands are queued", func() {
+		var sent []Cmder
+		pipe := &Pipeline{
+			exec: func(ctx context.Context, cmds []Cmder) error {
+				sent = cmds
+				return nil
+			},
+		}
+		pipe.init()
+
+		errBad := errors.New("bad arguments")
+		bad := NewCmd(ctx, "get", "key")
+		bad.SetErr(errBad)
+		Expect(pipe.Process(ctx, bad)).To(Succeed())
+		get := pipe.Get(ctx, "key")
+		Expect(bad.Err()).To(Equal(errBad))
+		Expect(get.Err()).To(Equal(ErrNotExecuted))
+
+		_, err := pipe.Exec(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(HaveLen(2))
+		Expect(bad.Err()).To(Equal(errBad))
+		Expect(get.Err()).NotTo(HaveOccurred())
+	})
+
+	It("queues the commands while an auto flush is executed", func() {
+		sending := make(chan struct{})
+		release := make(chan struct{})
+		pipe := &Pipeline{
+			exec: func(ctx context.Context, cmds []Cmder) error {
+				close(sending)
+				<-release
+				return nil
+			},
+		}
+		pipe.init()
+		pipe.SetAutoFlush(1, 0)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- pipe.Process(ctx, NewCmd(ctx, "get", "key1"))
+		}()
+		<-sending
+
+		pipe.SetAutoFlush(0, 0)
+		get := pipe.Get(ctx, "key2")
+		Expect(pipe.Len()).To(Equal(1))
+		Expect(get.Err()).To(Equal(ErrNotExecuted))
+
+		close(release)
+		Expect(<-done).To(Succeed())
+	})
+
+	It("auto flushes in Pipelined", func() {
+		client := NewClient(&Options{Dialer: (&authServer{}).dial})
+		defer client.Close()
+
+		var get *StringCmd
+		cmds, err := client.Pipelined(ctx, func(pipe Pipeliner) error {
+			pipe.SetAutoFlush(1, 0)
+			get = pipe.Get(ctx, "key")
+			Expect(pipe.Len()).To(Equal(0))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmds).To(BeEmpty())
+		Expect(get.Val()).To(Equal("value"))
+	})
+
+	It("discards the commands on error in TxPipelined", func() {
+		srv := new(authServer)
+		client := NewClient(&Options{Dialer: srv.dial})
+		defer client.Close()
+
+		var get *StringCmd
+		_, err := client.TxPipelined(ctx, func(pipe Pipeliner) error {
+			pipe.SetDiscardOnError(true)
+			get = pipe.Get(ctx, "key")
+			Expect(pipe.Set(ctx, "key", struct{}{}, 0).Err()).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).To(MatchError(ContainSubstring("can't marshal")))
+		Expect(get.Err()).To(Equal(err))
+		Expect(srv.conns).To(Equal(0))
+	})
+})
+
+var _ = Describe("GetCollapser", func() {
+	It("collects the keys per shard of Ring", func() {
+		ring := NewRing(&RingOptions{
+			Addrs: map[string]string{"a": ":6390", "b": ":6391"},
+		})
+		defer ring.Close()
+		collapser := NewGetCollapser(ring, nil)
+
+		shards := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("key%d", i)
+			Expect(collapser.batchKey(key)).To(Equal(ring.shards.Hash(key)))
+			shards[collapser.batchKey(key)] = true
+		}
+		Expect(shards).To(HaveLen(2))
+	})
+})
@@ -11,6 +11,9 @@ type ScanIterator struct {
 	mu  sync.Mutex // protects Scanner and pos
 	cmd *ScanCmd
 	pos int
+
+	prefetch bool
+	next     chan *ScanCmd // next page fetched in the background
 }
 
 // Err returns the last iterator error, if any.
@@ -31,6 +34,10 @@ func (it *ScanIterator) Next(ctx context.Context) bool {
 		return false
 	}
 
+	if it.prefetch && it.next == nil {
+		it.startPrefetch(ctx)
+	}
+
 	// Advance cursor, check if we are still within range.
 	if it.pos < len(it.cmd.page) {
 		it.pos++
@@ -43,17 +50,22 @@ func (it *ScanIterator) Next(ctx context.Context) bool {
 			return false
 		}
 
-		// Fetch next page.
-		switch it.cmd.args[0] {
-		case "scan", "qscan":
-			it.cmd.args[1] = it.cmd.cursor
-		default:
-			it.cmd.args[2] = it.cmd.cursor
-		}
+		if it.next != nil {
+			// Wait for the page fetched in the background.
+			it.cmd = <-it.next
+			it.next = nil
+			if it.cmd.Err() != nil {
+				return false
+			}
+			it.startPrefetch(ctx)
+		} else {
+			// Fetch next page.
+			setScanCursor(it.cmd.args, it.cmd.cursor)
 
-		err := it.cmd.process(ctx, it.cmd)
-		if err != nil {
-			return false
+			err := it.cmd.process(ctx, it.cmd)
+			if err != nil {
+				return false
+			}
 		}
 
 		it.pos = 1
@@ -75,3 +87,33 @@ func (it *ScanIterator) Val() string {
 	it.mu.Unlock()
 	return v
 }
+
+// startPrefetch starts fetching the page after the current one in a separate
+// goroutine. The result is picked up by Next once the current page is consumed.
+func (it *ScanIterator) startPrefetch(ctx context.Context) {
+	if it.cmd.cursor == 0 {
+		return
+	}
+
+	args := make([]interface{}, len(it.cmd.args))
+	copy(args, it.cmd.args)
+	setScanCursor(args, it.cmd.cursor)
+
+	cmd := NewScanCmd(ctx, it.cmd.process, args...)
+	next := make(chan *ScanCmd, 1)
+	it.next = next
+
+	go func() {
+		_ = cmd.process(ctx, cmd)
+		next <- cmd
+	}()
+}
+
+func setScanCursor(args []interface{}, cursor interface{}) {
+	switch args[0] {
+	case "scan", "qscan":
+		args[1] = cursor
+	default:
+		args[2] = cursor
+	}
+}
@@ -79,6 +79,20 @@ var _ = Describe("ScanIterator", func() {
 		Expect(vals).To(ContainElement("K71"))
 	})
 
+	It("should prefetch pages", func() {
+		Expect(seed(71)).NotTo(HaveOccurred())
+
+		var vals []string
+		iter := client.Scan(ctx, 0, "", 10).PrefetchIterator()
+		for iter.Next(ctx) {
+			vals = append(vals, iter.Val())
+		}
+		Expect(iter.Err()).NotTo(HaveOccurred())
+		Expect(vals).To(HaveLen(71))
+		Expect(vals).To(ContainElement("K01"))
+		Expect(vals).To(ContainElement("K71"))
+	})
+
 	It("should hscan across multiple pages", func() {
 		Expect(hashSeed(71)).NotTo(HaveOccurred())
 
@@ -0,0 +1,385 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/proto"
+)
+
+// keyPrefixer adds Options.KeyPrefix to the keys of the commands when they
+// are written and removes it from the keys in the replies, e.g. of KEYS,
+// SCAN, BLPOP or XREAD, and from the shard channels of SSUBSCRIBE. The key
+// positions are taken from COMMAND, which is loaded before the first command
+// is sent.
+type keyPrefixer struct {
+	prefix string
+
+	// The commands info is shared with the prefixers created with withPrefix.
+	once *internal.Once
+	info *atomic.Value // map[string]*CommandInfo
+}
+
+// keyPrefixLoadingKey marks the context used to load COMMAND, so the
+// commands that initialize the connection do not wait for it.
+type keyPrefixLoadingKey struct{}
+
+func newKeyPrefixer(prefix string) *keyPrefixer {
+	return &keyPrefixer{
+		prefix: prefix,
+		once:   new(internal.Once),
+		info:   new(atomic.Value),
+	}
+}
+
+// withPrefix returns a prefixer with another prefix, which reuses the
+// commands info loaded by p. p can be nil.
+func (p *keyPrefixer) withPrefix(prefix string) *keyPrefixer {
+	if prefix == "" {
+		return nil
+	}
+	if p == nil {
+		return newKeyPrefixer(prefix)
+	}
+	return &keyPrefixer{
+		prefix: prefix,
+		once:   p.once,
+		info:   p.info,
+	}
+}
+
+// prepare loads the commands info and checks that the keys of the cmds can
+// be prefixed, so writing the cmds does not fail.
+func (p *keyPrefixer) prepare(ctx context.Context, c *baseClient, cmds []Cmder) error {
+	if ctx.Value(keyPrefixLoadingKey{}) == nil {
+		err := p.once.Do(func() error {
+			ctx := context.WithValue(ctx, keyPrefixLoadingKey{}, true)
+			cmd := NewCommandsInfoCmd(ctx, "command")
+			if _, err := c._process(ctx, cmd); err != nil {
+				return err
+			}
+			p.info.Store(cmd.val)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, cmd := range cmds {
+		if _, err := p.args(cmd); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *keyPrefixer) cmdInfo(name string) *CommandInfo {
+	info, _ := p.info.Load().(map[string]*CommandInfo)
+	return info[name]
+}
+
+// args returns the arguments of the cmd with the prefixed keys.
+func (p *keyPrefixer) args(cmd Cmder) ([]interface{}, error) {
+	args := cmd.Args()
+	name := cmd.Name()
+	if len(args) < 2 {
+		return args, nil
+	}
+
+	switch name {
+	case "command", "multi", "exec", "auth", "hello", "select", "readonly", "client", "ping":
+		return args, nil
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe":
+		// The channels are not keys.
+		return args, nil
+	case "ssubscribe", "sunsubscribe":
+		return p.prefixArgs(args, p.prefixKey, argRange(1, len(args)-1)...), nil
+	case "keys":
+		return p.prefixArgs(args, p.prefixPattern, 1), nil
+	case "scan":
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(cmd.stringArg(i), "match") {
+				return p.prefixArgs(args, p.prefixPattern, i+1), nil
+			}
+		}
+		out := make([]interface{}, len(args), len(args)+2)
+		copy(out, args)
+		return append(out, "match", escapeGlob(p.prefix)+"*"), nil
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		return p.prefixNumKeys(cmd, args, 2)
+	case "zunion", "zinter", "zdiff", "sintercard", "lmpop", "zmpop":
+		return p.prefixNumKeys(cmd, args, 1)
+	case "blmpop", "bzmpop":
+		return p.prefixNumKeys(cmd, args, 2)
+	case "zunionstore", "zinterstore", "zdiffstore":
+		args, err := p.prefixNumKeys(cmd, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return p.prefixArgs(args, p.prefixKey, 1), nil
+	case "xread", "xreadgroup":
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(cmd.stringArg(i), "streams") {
+				n := (len(args) - i - 1) / 2
+				return p.prefixArgs(args, p.prefixKey, argRange(i+1, n)...), nil
+			}
+		}
+		return args, nil
+	case "object", "xinfo", "xgroup", "memory":
+		if len(args) < 3 {
+			return args, nil
+		}
+		return p.prefixArgs(args, p.prefixKey, 2), nil
+	case "sort", "sort_ro":
+		pos := []int{1}
+		for i := 2; i+1 < len(args); i++ {
+			switch strings.ToLower(cmd.stringArg(i)) {
+			case "store":
+				pos = append(pos, i+1)
+				i++
+			case "by", "get":
+				if arg := cmd.stringArg(i + 1); arg != "#" && !strings.EqualFold(arg, "nosort") {
+					pos = append(pos, i+1)
+				}
+				i++
+			case "limit":
+				i += 2
+			}
+		}
+		return p.prefixArgs(args, p.prefixKey, pos...), nil
+	case "georadius", "georadiusbymember":
+		// The options follow the longitude, latitude or member, the radius
+		// and the unit.
+		start := 6
+		if name == "georadiusbymember" {
+			start = 5
+		}
+		pos := []int{1}
+		for i := start; i+1 < len(args); i++ {
+			switch strings.ToLower(cmd.stringArg(i)) {
+			case "store", "storedist":
+				pos = append(pos, i+1)
+				i++
+			}
+		}
+		return p.prefixArgs(args, p.prefixKey, pos...), nil
+	}
+
+	info := p.cmdInfo(name)
+	if info == nil {
+		return nil, fmt.Errorf("redis: can't prefix the keys of unknown command %q", name)
+	}
+	if contains(info.Flags, "movablekeys") {
+		return nil, fmt.Errorf("redis: can't prefix the keys of %q", name)
+	}
+	if info.FirstKeyPos <= 0 || int(info.FirstKeyPos) >= len(args) {
+		return args, nil
+	}
+
+	last := int(info.LastKeyPos)
+	if last < 0 {
+		last += len(args)
+	}
+	step := int(info.StepCount)
+	if step <= 0 {
+		step = 1
+	}
+	var pos []int
+	for i := int(info.FirstKeyPos); i <= last && i < len(args); i += step {
+		pos = append(pos, i)
+	}
+	return p.prefixArgs(args, p.prefixKey, pos...), nil
+}
+
+// prefixNumKeys prefixes the keys that follow the number of keys at the
+// position numKeysPos.
+func (p *keyPrefixer) prefixNumKeys(cmd Cmder, args []interface{}, numKeysPos int) ([]interface{}, error) {
+	n, err := strconv.Atoi(cmd.stringArg(numKeysPos))
+	if err != nil || n < 0 || numKeysPos+n >= len(args) {
+		return nil, fmt.Errorf("redis: can't prefix the keys of %q: invalid number of keys", cmd.Name())
+	}
+	return p.prefixArgs(args, p.prefixKey, argRange(numKeysPos+1, n)...), nil
+}
+
+// prefixArgs returns a copy of the args with fn applied to the args at the
+// positions.
+func (p *keyPrefixer) prefixArgs(args []interface{}, fn func(string) string, pos ...int) []interface{} {
+	if len(pos) == 0 {
+		return args
+	}
+	out := make([]interface{}, len(args))
+	copy(out, args)
+	for _, i := range pos {
+		if i < len(out) {
+			out[i] = fn(internal.String(internal.AppendArg(nil, out[i])))
+		}
+	}
+	return out
+}
+
+func (p *keyPrefixer) prefixKey(key string) string {
+	return p.prefix + key
+}
+
+func (p *keyPrefixer) prefixPattern(pattern string) string {
+	return escapeGlob(p.prefix) + pattern
+}
+
+// strip removes the prefix from the keys in the replies of the cmds.
+func (p *keyPrefixer) strip(cmds ...Cmder) {
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			continue
+		}
+		switch cmd := cmd.(type) {
+		case *StringSliceCmd:
+			switch cmd.Name() {
+			case "keys":
+				p.stripKeys(cmd.val)
+			case "blpop", "brpop":
+				// The key is followed by the value.
+				if len(cmd.val) > 0 {
+					cmd.val[0] = p.stripKey(cmd.val[0])
+				}
+			}
+		case *ScanCmd:
+			if cmd.Name() == "scan" {
+				p.stripKeys(cmd.page)
+			}
+		case *KvScanCmd:
+			if cmd.Name() != "scan" {
+				break
+			}
+			if cmd.flag&ScanValue == 0 {
+				p.stripKeys(cmd.page)
+				break
+			}
+			// The keys are followed by their values.
+			for i := 0; i < len(cmd.page); i += 2 {
+				cmd.page[i] = p.stripKey(cmd.page[i])
+			}
+		case *StringCmd:
+			if cmd.Name() == "randomkey" {
+				cmd.val = p.stripKey(cmd.val)
+			}
+		case *ZWithKeyCmd:
+			if cmd.val != nil {
+				cmd.val.Key = p.stripKey(cmd.val.Key)
+			}
+		case *XStreamSliceCmd:
+			for i := range cmd.val {
+				cmd.val[i].Stream = p.stripKey(cmd.val[i].Stream)
+			}
+		case *Cmd:
+			cmd.val = p.stripCmdVal(cmd.Name(), cmd.val)
+		}
+	}
+}
+
+// stripCmdVal removes the prefix from the keys in the reply of a command
+// sent with Do.
+func (p *keyPrefixer) stripCmdVal(name string, val interface{}) interface{} {
+	switch name {
+	case "randomkey":
+		if key, ok := val.(string); ok {
+			return p.stripKey(key)
+		}
+	case "keys":
+		vals, _ := val.([]interface{})
+		for i, v := range vals {
+			if key, ok := v.(string); ok {
+				vals[i] = p.stripKey(key)
+			}
+		}
+	case "blpop", "brpop", "bzpopmin", "bzpopmax", "lmpop", "blmpop", "zmpop", "bzmpop":
+		// The key is the first element of the reply.
+		if vals, _ := val.([]interface{}); len(vals) > 0 {
+			if key, ok := vals[0].(string); ok {
+				vals[0] = p.stripKey(key)
+			}
+		}
+	case "xread", "xreadgroup":
+		// The reply is a list of the streams and their messages.
+		streams, _ := val.([]interface{})
+		for _, stream := range streams {
+			if vals, _ := stream.([]interface{}); len(vals) > 0 {
+				if key, ok := vals[0].(string); ok {
+					vals[0] = p.stripKey(key)
+				}
+			}
+		}
+	}
+	return val
+}
+
+// stripChannel removes the prefix from the shard channel of the Pub/Sub
+// message or subscription of the kind.
+func (p *keyPrefixer) stripChannel(kind, channel string) string {
+	switch kind {
+	case "ssubscribe", "sunsubscribe", "smessage":
+		return p.stripKey(channel)
+	}
+	return channel
+}
+
+func (p *keyPrefixer) stripKey(key string) string {
+	return strings.TrimPrefix(key, p.prefix)
+}
+
+func (p *keyPrefixer) stripKeys(keys []string) {
+	for i, key := range keys {
+		keys[i] = p.stripKey(key)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func (c *baseClient) writeCmd(wr *proto.Writer, cmd Cmder) error {
+	if c.opt.prefixer == nil {
+		return writeCmd(wr, cmd)
+	}
+	args, err := c.opt.prefixer.args(cmd)
+	if err != nil {
+		return err
+	}
+	return wr.WriteArgs(args)
+}
+
+func (c *baseClient) writeCmds(wr *proto.Writer, cmds []Cmder) error {
+	for _, cmd := range cmds {
+		if err := c.writeCmd(wr, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func argRange(start, n int) []int {
+	pos := make([]int, n)
+	for i := range pos {
+		pos[i] = start + i
+	}
+	return pos
+}
+
+// escapeGlob escapes the special characters of glob-style patterns.
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
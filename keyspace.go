@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Keyspace events as reported by Redis, see
+// https://redis.io/topics/notifications for the full list.
+const (
+	KeyspaceEventDel     = "del"
+	KeyspaceEventExpire  = "expire"
+	KeyspaceEventExpired = "expired"
+	KeyspaceEventEvicted = "evicted"
+	KeyspaceEventSet     = "set"
+	KeyspaceEventRename  = "rename_to"
+	KeyspaceEventNew     = "new"
+)
+
+// KeyspaceEvent is a keyspace notification.
+type KeyspaceEvent struct {
+	// DB is the database the key belongs to.
+	DB int
+	// Name is the name of the event, e.g. KeyspaceEventExpired.
+	Name string
+	// Key is the affected key.
+	Key string
+}
+
+// KeyspaceHandler handles a keyspace notification.
+type KeyspaceHandler func(ctx context.Context, event *KeyspaceEvent)
+
+// KeyspaceNotificationsOptions are used to configure KeyspaceNotifications.
+type KeyspaceNotificationsOptions struct {
+	// Config, when not empty, is set as notify-keyspace-events using
+	// CONFIG SET, e.g. "Ex" for expired events. By default the server
+	// configuration is not changed.
+	Config string
+	// DB limits notifications to the database. Default is all databases.
+	DB *int
+}
+
+// KeyspaceNotifications subscribes to keyspace (__keyspace@<db>__:<key>)
+// and keyevent (__keyevent@<db>__:<event>) channels and delivers the
+// notifications as KeyspaceEvent to the registered handlers. When both
+// keyspace and keyevent notifications are enabled on the server, each
+// event is delivered twice.
+//
+// Redis Cluster sends notifications only to the clients connected to the
+// node that owns the key, so with ClusterClient it must be created
+// for every master node, e.g. using ForEachMaster.
+type KeyspaceNotifications struct {
+	pubsub *PubSub
+
+	mu       sync.RWMutex
+	handlers map[string][]KeyspaceHandler
+}
+
+// NewKeyspaceNotifications subscribes to keyspace notifications using
+// the client. opt can be nil to use the default options.
+func NewKeyspaceNotifications(
+	ctx context.Context, client UniversalClient, opt *KeyspaceNotificationsOptions,
+) (*KeyspaceNotifications, error) {
+	if opt == nil {
+		opt = new(KeyspaceNotificationsOptions)
+	}
+
+	if opt.Config != "" {
+		if err := client.ConfigSet(ctx, "notify-keyspace-events", opt.Config).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	db := "*"
+	if opt.DB != nil {
+		db = strconv.Itoa(*opt.DB)
+	}
+
+	pubsub := client.PSubscribe(ctx,
+		"__keyspace@"+db+"__:*",
+		"__keyevent@"+db+"__:*",
+	)
+	// Wait for confirmation that subscriptions are created.
+	for i := 0; i < 2; i++ {
+		if _, err := pubsub.Receive(ctx); err != nil {
+			_ = pubsub.Close()
+			return nil, err
+		}
+	}
+
+	return &KeyspaceNotifications{
+		pubsub:   pubsub,
+		handlers: make(map[string][]KeyspaceHandler),
+	}, nil
+}
+
+// On registers the handler for the event, e.g. KeyspaceEventExpired.
+// Use "*" to receive all events.
+func (n *KeyspaceNotifications) On(event string, handler KeyspaceHandler) {
+	n.mu.Lock()
+	n.handlers[event] = append(n.handlers[event], handler)
+	n.mu.Unlock()
+}
+
+// Run receives notifications and calls the handlers until ctx is done
+// or KeyspaceNotifications is closed.
+func (n *KeyspaceNotifications) Run(ctx context.Context, opts ...ChannelOption) error {
+	ch := n.pubsub.Channel(opts...)
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if event, ok := parseKeyspaceEvent(msg); ok {
+				n.handle(ctx, event)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (n *KeyspaceNotifications) handle(ctx context.Context, event *KeyspaceEvent) {
+	n.mu.RLock()
+	handlers := n.handlers[event.Name]
+	all := n.handlers["*"]
+	n.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+	for _, handler := range all {
+		handler(ctx, event)
+	}
+}
+
+// Close closes the underlying PubSub.
+func (n *KeyspaceNotifications) Close() error {
+	return n.pubsub.Close()
+}
+
+func parseKeyspaceEvent(msg *Message) (*KeyspaceEvent, bool) {
+	var keyspace bool
+	var rest string
+	switch {
+	case strings.HasPrefix(msg.Channel, "__keyspace@"):
+		keyspace = true
+		rest = msg.Channel[len("__keyspace@"):]
+	case strings.HasPrefix(msg.Channel, "__keyevent@"):
+		rest = msg.Channel[len("__keyevent@"):]
+	default:
+		return nil, false
+	}
+
+	i := strings.Index(rest, "__:")
+	if i == -1 {
+		return nil, false
+	}
+	db, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return nil, false
+	}
+	rest = rest[i+len("__:"):]
+
+	event := &KeyspaceEvent{DB: db}
+	if keyspace {
+		event.Key = rest
+		event.Name = msg.Payload
+	} else {
+		event.Name = rest
+		event.Key = msg.Payload
+	}
+	return event, true
+}
@@ -0,0 +1,57 @@
+package redis_test
+
+import (
+	"context"
+)
+
+var _ = Describe("KeyspaceNotifications", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.ConfigSet(ctx, "notify-keyspace-events", "").Err()).NotTo(HaveOccurred())
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("delivers typed events", func() {
+		db := redisOptions().DB
+		notifications, err := redis.NewKeyspaceNotifications(ctx, client, &redis.KeyspaceNotificationsOptions{
+			Config: "Eg$",
+			DB:     &db,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer notifications.Close()
+
+		events := make(chan *redis.KeyspaceEvent, 10)
+		notifications.On(redis.KeyspaceEventSet, func(ctx context.Context, event *redis.KeyspaceEvent) {
+			events <- event
+		})
+		notifications.On(redis.KeyspaceEventDel, func(ctx context.Context, event *redis.KeyspaceEvent) {
+			events <- event
+		})
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_ = notifications.Run(ctx)
+		}()
+
+		Expect(client.Set(ctx, "key", "value", 0).Err()).NotTo(HaveOccurred())
+		Expect(client.Del(ctx, "key").Err()).NotTo(HaveOccurred())
+
+		Eventually(events).Should(Receive(Equal(&redis.KeyspaceEvent{
+			DB:   db,
+			Name: redis.KeyspaceEventSet,
+			Key:  "key",
+		})))
+		Eventually(events).Should(Receive(Equal(&redis.KeyspaceEvent{
+			DB:   db,
+			Name: redis.KeyspaceEventDel,
+			Key:  "key",
+		})))
+	})
+})
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by TokenBucketLimiter when an operation exceeds
+// the limits and TokenBucketOptions.Wait is not set.
+var ErrRateLimited = errors.New("redis: rate limit exceeded")
+
+// TokenBucketOptions are used to configure a TokenBucketLimiter.
+type TokenBucketOptions struct {
+	// Rate is the number of commands allowed per second. Every command of a
+	// pipeline uses a token.
+	// Default is no rate limit.
+	Rate float64
+	// Burst is the maximum number of tokens, i.e. the number of commands
+	// that can be sent at once after an idle period. Pipelines with more
+	// commands than Burst wait for the full bucket.
+	// Default is Rate rounded up.
+	Burst int
+	// CmdWeights are the numbers of tokens used by the commands, e.g. by
+	// expensive commands like KEYS.
+	// Default weight is 1.
+	CmdWeights map[string]int
+
+	// MaxConcurrent is the maximum number of commands and pipelines in
+	// flight.
+	// Default is no concurrency limit.
+	MaxConcurrent int
+
+	// Wait makes the operations wait for the tokens and the concurrency
+	// limit until the context is done instead of failing with
+	// ErrRateLimited.
+	Wait bool
+}
+
+func (opt *TokenBucketOptions) init() {
+	if opt.Burst == 0 {
+		opt.Burst = int(math.Ceil(opt.Rate))
+	}
+	if opt.Burst < 1 {
+		opt.Burst = 1
+	}
+}
+
+// TokenBucketLimiter is a Limiter that limits the rate of the commands with
+// a token bucket and the number of the operations in flight. It can be
+// shared by multiple clients, e.g. to limit all the nodes of a
+// ClusterClient together.
+type TokenBucketLimiter struct {
+	opt TokenBucketOptions
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// sem limits the operations in flight. It is nil without MaxConcurrent.
+	sem chan struct{}
+}
+
+var (
+	_ Limiter    = (*TokenBucketLimiter)(nil)
+	_ CmdLimiter = (*TokenBucketLimiter)(nil)
+)
+
+// NewTokenBucketLimiter returns a new limiter with the full bucket.
+func NewTokenBucketLimiter(opt *TokenBucketOptions) *TokenBucketLimiter {
+	l := new(TokenBucketLimiter)
+	if opt != nil {
+		l.opt = *opt
+	}
+	l.opt.init()
+	l.tokens = float64(l.opt.Burst)
+	l.last = time.Now()
+	if l.opt.MaxConcurrent > 0 {
+		l.sem = make(chan struct{}, l.opt.MaxConcurrent)
+	}
+	return l
+}
+
+// Allow allows a single command.
+func (l *TokenBucketLimiter) Allow() error {
+	return l.AllowCmd(context.Background(), "", 1)
+}
+
+// ReportResult reports the result of the command allowed with Allow.
+func (l *TokenBucketLimiter) ReportResult(result error) {
+	l.ReportCmdResult("", 1, result)
+}
+
+func (l *TokenBucketLimiter) AllowCmd(ctx context.Context, name string, weight int) error {
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	if l.opt.Rate > 0 {
+		if w, ok := l.opt.CmdWeights[name]; ok {
+			weight *= w
+		}
+		if err := l.take(ctx, weight); err != nil {
+			l.release()
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *TokenBucketLimiter) ReportCmdResult(name string, weight int, result error) {
+	l.release()
+}
+
+func (l *TokenBucketLimiter) acquire(ctx context.Context) error {
+	if l.sem == nil {
+		return nil
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if !l.opt.Wait {
+		return ErrRateLimited
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *TokenBucketLimiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (l *TokenBucketLimiter) take(ctx context.Context, weight int) error {
+	n := math.Min(float64(weight), float64(l.opt.Burst))
+
+	l.mu.Lock()
+	l.refill(time.Now())
+	if l.tokens >= n {
+		l.tokens -= n
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.opt.Wait {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+
+	// The tokens are reserved, so the operations waiting for the tokens
+	// are allowed in order.
+	wait := time.Duration((n - l.tokens) / l.opt.Rate * float64(time.Second))
+	l.tokens -= n
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.refill(time.Now())
+		l.tokens = math.Min(l.tokens+n, float64(l.opt.Burst))
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *TokenBucketLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.opt.Rate
+	if burst := float64(l.opt.Burst); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+}
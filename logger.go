@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel = internal.LogLevel
+
+const (
+	LogLevelDebug = internal.LogLevelDebug
+	LogLevelInfo  = internal.LogLevelInfo
+	LogLevelWarn  = internal.LogLevelWarn
+	LogLevelError = internal.LogLevelError
+)
+
+// Logger is a structured logger with levels and key/value fields, e.g.
+// an adapter for log/slog, zap or logrus. keyvals are alternating keys and
+// values; keys are strings and errors are logged with the "error" key.
+//
+// The clients use Options.Logger and similar options. When it is not set,
+// the messages are logged using the logger set with SetLogger, which is also
+// used by the code that is not tied to a client.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc is an adapter to use an ordinary function as a Logger.
+type LoggerFunc func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+
+func (fn LoggerFunc) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	fn(ctx, level, msg, keyvals...)
+}
+
+// universalLogger returns the logger from the options of the client.
+func universalLogger(rdb UniversalClient) Logger {
+	switch rdb := rdb.(type) {
+	case *Client:
+		return rdb.opt.Logger
+	case *ClusterClient:
+		return rdb.opt.Logger
+	case *Ring:
+		return rdb.opt.Logger
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/pool"
+	"github.com/farss/redis/v8/internal/proto"
+)
+
+// MonitorEntry is a command processed by the server and received with
+// MONITOR.
+type MonitorEntry struct {
+	Time time.Time
+	DB   int
+	// Addr is the address of the client that sent the command, "lua" for
+	// commands executed by scripts or "unix:<path>" for unix sockets.
+	Addr string
+	Args []string
+}
+
+// Monitor sends MONITOR using a dedicated connection and returns a Go
+// channel for receiving the commands processed by the server. The channel
+// is closed when ctx is done or the connection fails; the failures are
+// logged. MONITOR severely reduces the server throughput, so it should
+// only be used for debugging.
+func (c *Client) Monitor(ctx context.Context) (<-chan *MonitorEntry, error) {
+	cn, err := c.newConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := NewStatusCmd(ctx, "monitor")
+	err = cn.WithWriter(ctx, c.opt.writeTimeout(), func(wr *proto.Writer) error {
+		return writeCmd(wr, cmd)
+	})
+	if err == nil {
+		err = cn.WithReader(ctx, c.opt.readTimeout(), cmd.readReply)
+	}
+	if err != nil {
+		_ = c.connPool.CloseConn(cn)
+		return nil, err
+	}
+
+	// The reply was read with ReadTimeout, but the entries can arrive at
+	// any time.
+	if err := cn.SetReadDeadline(time.Time{}); err != nil {
+		_ = c.connPool.CloseConn(cn)
+		return nil, err
+	}
+
+	ch := make(chan *MonitorEntry, 100)
+	go c.monitor(ctx, cn, ch)
+	return ch, nil
+}
+
+func (c *Client) monitor(ctx context.Context, cn *pool.Conn, ch chan<- *MonitorEntry) {
+	defer close(ch)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		// Unblock the reader.
+		_ = c.connPool.CloseConn(cn)
+	}()
+
+	for {
+		var line string
+		err := cn.WithReader(ctx, 0, func(rd *proto.Reader) error {
+			var err error
+			line, err = rd.ReadString()
+			return err
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				internal.Log(ctx, c.opt.Logger, internal.LogLevelError,
+					"MONITOR failed", "error", err)
+			}
+			return
+		}
+
+		entry, err := parseMonitorEntry(line)
+		if err != nil {
+			internal.Log(ctx, c.opt.Logger, internal.LogLevelError,
+				"parsing MONITOR entry failed", "error", err)
+			continue
+		}
+
+		select {
+		case ch <- entry:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseMonitorEntry parses lines like
+//
+//	1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value"
+func parseMonitorEntry(line string) (*MonitorEntry, error) {
+	invalid := func() (*MonitorEntry, error) {
+		return nil, fmt.Errorf("redis: can't parse MONITOR entry %.100q", line)
+	}
+
+	i := strings.IndexByte(line, ' ')
+	if i == -1 {
+		return invalid()
+	}
+	tm, err := parseMonitorTime(line[:i])
+	if err != nil {
+		return invalid()
+	}
+	s := line[i+1:]
+
+	if !strings.HasPrefix(s, "[") {
+		return invalid()
+	}
+	end := strings.IndexByte(s, ']')
+	if end == -1 {
+		return invalid()
+	}
+	client := s[1:end]
+	s = s[end+1:]
+
+	i = strings.IndexByte(client, ' ')
+	if i == -1 {
+		return invalid()
+	}
+	db, err := strconv.Atoi(client[:i])
+	if err != nil {
+		return invalid()
+	}
+
+	entry := &MonitorEntry{
+		Time: tm,
+		DB:   db,
+		Addr: client[i+1:],
+	}
+
+	for s != "" {
+		if !strings.HasPrefix(s, ` "`) {
+			return invalid()
+		}
+		s = s[1:]
+
+		n := quotedLen(s)
+		if n == -1 {
+			return invalid()
+		}
+		arg, err := strconv.Unquote(s[:n])
+		if err != nil {
+			return invalid()
+		}
+		entry.Args = append(entry.Args, arg)
+		s = s[n:]
+	}
+
+	return entry, nil
+}
+
+func parseMonitorTime(s string) (time.Time, error) {
+	sec, usec := s, "0"
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		sec, usec = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	us, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(n, us*int64(time.Microsecond)), nil
+}
+
+// quotedLen returns the length of the double-quoted string at the start
+// of s including the quotes or -1.
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -1,14 +1,23 @@
 package redis
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
 	"sync"
 
 	"github.com/farss/redis/v8/internal/pool"
+	"github.com/farss/redis/v8/internal/proto"
 )
 
 type pipelineExecer func(context.Context, []Cmder) error
 
+// ErrNotExecuted is the error of a queued command until the pipeline
+// containing the command is executed.
+var ErrNotExecuted = errors.New("redis: pipeline is not executed")
+
 // Pipeliner is an mechanism to realise Redis Pipeline technique.
 //
 // Pipelining is a technique to extremely speed up processing by packing
@@ -22,6 +31,15 @@ type pipelineExecer func(context.Context, []Cmder) error
 // can be retransmitted and commands can be executed more then once.
 // To avoid this: it is good idea to use reasonable bigger read/write timeouts
 // depends of your batch size and/or use TxPipeline.
+//
+// Every queued command is returned as a typed handle, e.g. *StringCmd for Get,
+// which can be kept instead of inspecting the Cmder slice returned by Exec.
+// Results of the handle are valid after Exec; before that the handle reports
+// ErrNotExecuted:
+//
+//	get := pipe.Get(ctx, "key")
+//	_, _ = pipe.Exec(ctx)
+//	val, err := get.Result()
 type Pipeliner interface {
 	StatefulCmdable
 	Len() int
@@ -30,6 +48,9 @@ type Pipeliner interface {
 	Close() error
 	Discard() error
 	Exec(ctx context.Context) ([]Cmder, error)
+	Flush(ctx context.Context) error
+	SetAutoFlush(maxCmds, maxBytes int)
+	SetDiscardOnError(on bool)
 }
 
 var _ Pipeliner = (*Pipeline)(nil)
@@ -47,6 +68,18 @@ type Pipeline struct {
 	mu     sync.Mutex
 	cmds   []Cmder
 	closed bool
+
+	maxCmds  int
+	maxBytes int
+	size     int // approximate size of the queued commands in bytes
+
+	discardOnError bool
+	wr             *proto.Writer // validates commands when discardOnError is set
+	enc            *proto.Encoding
+	err            error // first error of a rejected command
+
+	tx      bool              // commands are wrapped with MULTI/EXEC
+	scripts map[Cmder]*Script // EVALSHA commands queued by Script.Run
 }
 
 func (c *Pipeline) init() {
@@ -69,12 +102,126 @@ func (c *Pipeline) Do(ctx context.Context, args ...interface{}) *Cmd {
 	return cmd
 }
 
-// Process queues the cmd for later execution.
+// Process queues the cmd for later execution. If auto flush is enabled
+// and the cmd makes the pipeline reach one of the thresholds, the queued
+// commands are executed and the error of the first failed command is returned.
 func (c *Pipeline) Process(ctx context.Context, cmd Cmder) error {
+	flush, err := c.queue(cmd)
+	if err != nil || !flush {
+		return err
+	}
+	_, err = c.Exec(ctx)
+	return err
+}
+
+// queue queues the cmd and reports whether the pipeline reached one of the
+// auto flush thresholds.
+func (c *Pipeline) queue(cmd Cmder) (bool, error) {
 	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discardOnError {
+		if c.err != nil {
+			cmd.SetErr(c.err)
+			return false, c.err
+		}
+		if err := c.validate(cmd); err != nil {
+			cmd.SetErr(err)
+			setCmdsErr(c.cmds, err)
+			_ = c.discard()
+			c.err = err
+			return false, err
+		}
+	}
+
+	// An error set before, e.g. by invalid arguments, is kept.
+	if cmd.Err() == nil {
+		cmd.SetErr(ErrNotExecuted)
+	}
 	c.cmds = append(c.cmds, cmd)
+	if c.maxBytes > 0 {
+		c.size += cmdSize(cmd)
+	}
+
+	return (c.maxCmds > 0 && len(c.cmds) >= c.maxCmds) ||
+		(c.maxBytes > 0 && c.size >= c.maxBytes), nil
+}
+
+// SetAutoFlush makes the pipeline execute queued commands as soon as
+// it accumulates maxCmds commands or approximately maxBytes bytes of
+// arguments. Zero disables the corresponding threshold.
+//
+// Commands that were flushed automatically are not returned by Exec,
+// so use values returned when queueing commands to access the results.
+// For TxPipeline each flush is executed as a separate MULTI/EXEC transaction.
+// It can also be enabled in Pipelined, e.g.
+//
+//	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+//		pipe.SetAutoFlush(1000, 0)
+//		for _, key := range keys {
+//			pipe.Del(ctx, key)
+//		}
+//		return nil
+//	})
+func (c *Pipeline) SetAutoFlush(maxCmds, maxBytes int) {
+	c.mu.Lock()
+	c.maxCmds = maxCmds
+	c.maxBytes = maxBytes
+	c.size = 0
+	if maxBytes > 0 {
+		for _, cmd := range c.cmds {
+			c.size += cmdSize(cmd)
+		}
+	}
 	c.mu.Unlock()
-	return nil
+}
+
+// SetDiscardOnError makes the pipeline check commands when they are queued.
+// If a command can't be queued, e.g. because one of its arguments can't be
+// marshaled, Process returns the error right away, the previously queued
+// commands are discarded with the same error and all following commands are
+// rejected until Exec or Discard is called. Exec returns the error without
+// sending anything to Redis. Like SetAutoFlush, it can be enabled in
+// Pipelined and TxPipelined.
+func (c *Pipeline) SetDiscardOnError(on bool) {
+	c.mu.Lock()
+	c.discardOnError = on
+	if !on {
+		c.err = nil
+	}
+	c.mu.Unlock()
+}
+
+func (c *Pipeline) validate(cmd Cmder) error {
+	if err := cmd.Err(); err != nil && err != ErrNotExecuted {
+		return err
+	}
+	if c.wr == nil {
+		c.wr = proto.NewWriter(bufio.NewWriter(ioutil.Discard))
+		c.wr.SetEncoding(c.enc)
+	}
+	return c.wr.WriteArgs(cmd.Args())
+}
+
+// cmdSize returns the approximate number of bytes used to write the cmd.
+func cmdSize(cmd Cmder) int {
+	// "*<argc>\r\n" and "$<len>\r\n<arg>\r\n" framing is roughly
+	// 8 bytes per argument.
+	const framing = 8
+
+	size := framing
+	for _, arg := range cmd.Args() {
+		switch arg := arg.(type) {
+		case string:
+			size += len(arg)
+		case []byte:
+			size += len(arg)
+		default:
+			size += 8
+		}
+		size += framing
+	}
+	return size
 }
 
 // Close closes the pipeline, releasing any open resources.
@@ -99,6 +246,9 @@ func (c *Pipeline) discard() error {
 		return pool.ErrClosed
 	}
 	c.cmds = c.cmds[:0]
+	c.size = 0
+	c.err = nil
+	c.scripts = nil
 	return nil
 }
 
@@ -109,20 +259,118 @@ func (c *Pipeline) discard() error {
 // command if any.
 func (c *Pipeline) Exec(ctx context.Context) ([]Cmder, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.closed {
+		c.mu.Unlock()
 		return nil, pool.ErrClosed
 	}
+	cmds, scripts, err := c.take()
+	c.mu.Unlock()
 
-	if len(c.cmds) == 0 {
-		return nil, nil
+	// The commands are executed without the lock, so the commands queued
+	// meanwhile wait for the next Exec.
+	if err != nil || len(cmds) == 0 {
+		return nil, err
 	}
+	return c.execCmds(ctx, cmds, scripts)
+}
 
-	cmds := c.cmds
+// Flush executes all previously queued commands like Exec does, but
+// without returning them. It is useful together with SetAutoFlush to send
+// the remaining commands.
+func (c *Pipeline) Flush(ctx context.Context) error {
+	_, err := c.Exec(ctx)
+	return err
+}
+
+// take removes the queued commands and their scripts for execution. It
+// returns the error of the rejected command instead if the commands were
+// discarded.
+func (c *Pipeline) take() ([]Cmder, map[Cmder]*Script, error) {
+	if err := c.err; err != nil {
+		c.err = nil
+		return nil, nil, err
+	}
+
+	cmds, scripts := c.cmds, c.scripts
 	c.cmds = nil
+	c.size = 0
+	c.scripts = nil
+	return cmds, scripts, nil
+}
+
+func (c *Pipeline) execCmds(ctx context.Context, cmds []Cmder, scripts map[Cmder]*Script) ([]Cmder, error) {
+	// Commands are executed from now on, so hooks see them as usual.
+	for _, cmd := range cmds {
+		if cmd.Err() == ErrNotExecuted {
+			cmd.SetErr(nil)
+		}
+	}
 
-	return cmds, c.exec(ctx, cmds)
+	err := c.exec(ctx, cmds)
+	if scripts != nil {
+		err = c.retryScripts(ctx, cmds, scripts, err)
+	}
+	return cmds, err
+}
+
+func (c *Pipeline) addScript(cmd Cmder, script *Script) {
+	c.mu.Lock()
+	if c.scripts == nil {
+		c.scripts = make(map[Cmder]*Script)
+	}
+	c.scripts[cmd] = script
+	c.mu.Unlock()
+}
+
+// retryScripts retries EVALSHA commands that failed with NOSCRIPT using EVAL.
+// The EVAL commands are executed separately and their replies are copied
+// to the EVALSHA commands.
+func (c *Pipeline) retryScripts(
+	ctx context.Context, cmds []Cmder, scripts map[Cmder]*Script, err error,
+) error {
+	var retry []Cmder
+	var orig []*Cmd
+	for _, cmder := range cmds {
+		script, ok := scripts[cmder]
+		if !ok {
+			continue
+		}
+
+		cmd, ok := cmder.(*Cmd)
+		if !ok {
+			continue
+		}
+		if err := cmd.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+			args := make([]interface{}, len(cmd.args))
+			copy(args, cmd.args)
+			if args[0] == "evalsha_ro" {
+				args[0] = "eval_ro"
+			} else {
+				args[0] = "eval"
+			}
+			args[1] = script.src
+
+			eval := &Cmd{baseCmd: cmd.baseCmd, enc: cmd.enc}
+			eval.args = args
+			eval.err = nil
+			retry = append(retry, eval)
+			orig = append(orig, cmd)
+		}
+	}
+
+	if len(retry) == 0 {
+		return err
+	}
+	err = c.exec(ctx, retry)
+	for i, cmd := range orig {
+		eval := retry[i].(*Cmd)
+		cmd.val = eval.val
+		cmd.SetErr(eval.Err())
+	}
+	if err != nil && !isRedisError(err) {
+		return err
+	}
+	return cmdsFirstErr(cmds)
 }
 
 func (c *Pipeline) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/farss/redis/v8/internal/pool"
+	"github.com/farss/redis/v8/internal/proto"
+)
+
+const (
+	// streamPipelineBatch is the number of commands written to the connection
+	// before they are flushed.
+	streamPipelineBatch = 128
+	// streamPipelineInFlight is the maximum number of sent commands
+	// waiting for replies. Process blocks when the limit is reached.
+	streamPipelineInFlight = 16 * 1024
+)
+
+// streamPipelineLimitOp is passed to Limiter for StreamPipeline, which is
+// allowed as a whole before any command is queued.
+var streamPipelineLimitOp = limitOp{name: "pipeline", weight: 1}
+
+// StreamPipeline is a pipeline that sends commands to Redis as soon as they
+// are queued and reads the replies in a separate goroutine. Unlike Pipeline
+// it does not buffer the whole batch before sending the first command, which
+// makes it suitable for exporting or importing large amounts of data.
+//
+// StreamPipeline uses a dedicated connection until Exec is called. Results
+// of the commands are available after Exec; hooks are not called for the
+// commands. It's safe for concurrent use by multiple goroutines.
+type StreamPipeline struct {
+	cmdable
+
+	ctx    context.Context
+	client *baseClient
+	cn     *pool.Conn
+
+	mu      sync.Mutex
+	pending []Cmder // written, but not flushed yet
+	closed  bool
+
+	inFlight chan Cmder
+	done     chan struct{}
+
+	errMu    sync.Mutex
+	err      error // first network error
+	firstErr error // first command error
+}
+
+// StreamPipeline returns a pipeline that sends commands as soon as they are
+// queued. The pipeline must be finished with Exec.
+func (c *Client) StreamPipeline(ctx context.Context) (*StreamPipeline, error) {
+	cn, err := c.getConn(ctx, streamPipelineLimitOp)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := &StreamPipeline{
+		ctx:      ctx,
+		client:   c.baseClient,
+		cn:       cn,
+		inFlight: make(chan Cmder, streamPipelineInFlight),
+		done:     make(chan struct{}),
+	}
+	pipe.cmdable = pipe.Process
+	go pipe.readReplies()
+	return pipe, nil
+}
+
+// Do sends the custom command to Redis.
+func (c *StreamPipeline) Do(ctx context.Context, args ...interface{}) *Cmd {
+	cmd := NewCmd(ctx, args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// Process sends the cmd to Redis. The reply is read in the background and
+// is available after Exec.
+func (c *StreamPipeline) Process(ctx context.Context, cmd Cmder) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		cmd.SetErr(ErrClosed)
+		return ErrClosed
+	}
+	if err := c.getErr(); err != nil {
+		cmd.SetErr(err)
+		return err
+	}
+
+	if p := c.client.opt.prefixer; p != nil {
+		if err := p.prepare(ctx, c.client, []Cmder{cmd}); err != nil {
+			return err
+		}
+	}
+
+	// An error set before, e.g. by invalid arguments, is kept.
+	if cmd.Err() == nil {
+		cmd.SetErr(ErrNotExecuted)
+	}
+	err := c.cn.WithBufferedWriter(ctx, timeoutFromContext(ctx, c.client.opt.writeTimeout()), func(wr *proto.Writer) error {
+		return c.client.writeCmd(wr, cmd)
+	})
+	if err != nil {
+		// The command could be written partially, so the connection
+		// can't be used anymore.
+		cmd.SetErr(err)
+		c.setErr(err)
+		return err
+	}
+	c.pending = append(c.pending, cmd)
+
+	if len(c.pending) >= streamPipelineBatch {
+		return c.flush()
+	}
+	return nil
+}
+
+// Flush sends the commands that are buffered by the pipeline.
+func (c *StreamPipeline) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	return c.flush()
+}
+
+func (c *StreamPipeline) flush() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	if err := c.cn.Flush(c.ctx, timeoutFromContext(c.ctx, c.client.opt.writeTimeout())); err != nil {
+		c.setErr(err)
+		setCmdsErr(c.pending, err)
+		c.pending = c.pending[:0]
+		return err
+	}
+
+	for _, cmd := range c.pending {
+		c.inFlight <- cmd
+	}
+	c.pending = c.pending[:0]
+	return nil
+}
+
+// Exec sends the remaining commands, waits for all the replies and releases
+// the connection. It returns the error of the first failed command if any.
+func (c *StreamPipeline) Exec(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	_ = c.flush()
+	c.closed = true
+	close(c.inFlight)
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		// Unblock the reader.
+		_ = c.cn.Close()
+		<-c.done
+		c.setErr(ctx.Err())
+	}
+
+	c.errMu.Lock()
+	err, firstErr := c.err, c.firstErr
+	c.errMu.Unlock()
+
+	c.client.releaseConn(c.ctx, c.cn, streamPipelineLimitOp, err)
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+func (c *StreamPipeline) readReplies() {
+	defer close(c.done)
+
+	for cmd := range c.inFlight {
+		if err := c.getErr(); err != nil {
+			cmd.SetErr(err)
+			continue
+		}
+
+		err := c.cn.WithReader(c.ctx, c.client.cmdTimeout(c.ctx, cmd), cmd.readReply)
+		cmd.SetErr(err)
+		if err == nil {
+			if p := c.client.opt.prefixer; p != nil {
+				p.strip(cmd)
+			}
+			continue
+		}
+
+		if !isRedisError(err) {
+			c.setErr(err)
+			continue
+		}
+
+		c.errMu.Lock()
+		if c.firstErr == nil {
+			c.firstErr = err
+		}
+		c.errMu.Unlock()
+	}
+}
+
+func (c *StreamPipeline) getErr() error {
+	c.errMu.Lock()
+	err := c.err
+	c.errMu.Unlock()
+	return err
+}
+
+func (c *StreamPipeline) setErr(err error) {
+	c.errMu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	if c.firstErr == nil {
+		c.firstErr = err
+	}
+	c.errMu.Unlock()
+}
@@ -2,6 +2,7 @@ package redis_test
 
 import (
 	"strconv"
+	"strings"
 )
 
 var _ = Describe("pipelining", func() {
@@ -58,6 +59,19 @@ var _ = Describe("pipelining", func() {
 			Expect(val).To(Equal("value"))
 		})
 
+		It("reports commands that are not executed", func() {
+			get := pipe.Get(ctx, "key")
+			Expect(get.Err()).To(Equal(redis.ErrNotExecuted))
+
+			_, err := pipe.Exec(ctx)
+			Expect(err).To(Equal(redis.Nil))
+			Expect(get.Err()).To(Equal(redis.Nil))
+
+			set := pipe.Set(ctx, "key", "value", 0)
+			Expect(pipe.Discard()).NotTo(HaveOccurred())
+			Expect(set.Err()).To(Equal(redis.ErrNotExecuted))
+		})
+
 		It("supports custom command", func() {
 			pipe.Do(ctx, "ping")
 			cmds, err := pipe.Exec(ctx)
@@ -79,14 +93,125 @@ var _ = Describe("pipelining", func() {
 				}
 			}
 		})
+
+		It("discards commands on error", func() {
+			pipe.SetDiscardOnError(true)
+
+			set := pipe.Set(ctx, "key1", "value1", 0)
+			bad := pipe.Set(ctx, "key2", struct{}{}, 0)
+			Expect(bad.Err()).To(MatchError("redis: can't marshal struct {} (implement encoding.BinaryMarshaler)"))
+			Expect(set.Err()).To(Equal(bad.Err()))
+			Expect(pipe.Len()).To(Equal(0))
+
+			get := pipe.Get(ctx, "key1")
+			Expect(get.Err()).To(Equal(bad.Err()))
+
+			_, err := pipe.Exec(ctx)
+			Expect(err).To(Equal(bad.Err()))
+			Expect(client.Exists(ctx, "key1").Val()).To(Equal(int64(0)))
+
+			get = pipe.Get(ctx, "key1")
+			_, err = pipe.Exec(ctx)
+			Expect(err).To(Equal(redis.Nil))
+			Expect(get.Err()).To(Equal(redis.Nil))
+		})
+
+		It("auto flushes by number of commands", func() {
+			pipe.SetAutoFlush(2, 0)
+
+			set1 := pipe.Set(ctx, "key1", "value1", 0)
+			Expect(pipe.Len()).To(Equal(1))
+
+			set2 := pipe.Set(ctx, "key2", "value2", 0)
+			Expect(pipe.Len()).To(Equal(0))
+			Expect(set1.Val()).To(Equal("OK"))
+			Expect(set2.Val()).To(Equal("OK"))
+
+			get := pipe.Get(ctx, "key1")
+			cmds, err := pipe.Exec(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmds).To(HaveLen(1))
+			Expect(get.Val()).To(Equal("value1"))
+		})
+
+		It("auto flushes by size of commands", func() {
+			pipe.SetAutoFlush(0, 1024)
+
+			value := strings.Repeat("x", 512)
+			pipe.Set(ctx, "key1", value, 0)
+			Expect(pipe.Len()).To(Equal(1))
+			pipe.Set(ctx, "key2", value, 0)
+			Expect(pipe.Len()).To(Equal(0))
+
+			get := pipe.Get(ctx, "key2")
+			Expect(pipe.Flush(ctx)).NotTo(HaveOccurred())
+			Expect(pipe.Len()).To(Equal(0))
+			Expect(get.Val()).To(Equal(value))
+		})
 	}
 
+	Describe("StreamPipeline", func() {
+		It("sends commands while they are queued", func() {
+			pipe, err := client.StreamPipeline(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			var incr *redis.IntCmd
+			for i := 0; i < 1000; i++ {
+				incr = pipe.Incr(ctx, "key")
+			}
+			get := pipe.Get(ctx, "key")
+			Expect(pipe.Exec(ctx)).NotTo(HaveOccurred())
+			Expect(incr.Val()).To(Equal(int64(1000)))
+			Expect(get.Val()).To(Equal("1000"))
+
+			Expect(pipe.Exec(ctx)).To(Equal(redis.ErrClosed))
+			Expect(client.PoolStats().TotalConns).To(Equal(uint32(1)))
+		})
+
+		It("returns the error of the first failed command", func() {
+			pipe, err := client.StreamPipeline(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			bad := pipe.Do(ctx, "set", "key")
+			ping := pipe.Ping(ctx)
+			err = pipe.Exec(ctx)
+			Expect(err).To(MatchError(ContainSubstring("wrong number of arguments")))
+			Expect(bad.Err()).To(Equal(err))
+			Expect(ping.Val()).To(Equal("PONG"))
+		})
+	})
+
 	Describe("Pipeline", func() {
 		BeforeEach(func() {
 			pipe = client.Pipeline().(*redis.Pipeline)
 		})
 
 		assertPipeline()
+
+		It("retries scripts that are not loaded", func() {
+			Expect(client.ScriptFlush(ctx).Err()).NotTo(HaveOccurred())
+			script := redis.NewScript(`return redis.call('INCRBY', KEYS[1], ARGV[1])`)
+
+			incr1 := script.Run(ctx, pipe, []string{"counter"}, 2)
+			get := pipe.Get(ctx, "counter")
+			incr2 := script.Run(ctx, pipe, []string{"counter"}, 3)
+			_, err := pipe.Exec(ctx)
+			Expect(err).To(Equal(redis.Nil))
+
+			// Retried scripts are executed after the other commands.
+			Expect(get.Err()).To(Equal(redis.Nil))
+			Expect(incr1.Val()).To(Equal(int64(2)))
+			Expect(incr2.Val()).To(Equal(int64(5)))
+			// The EVALSHA commands are not rewritten.
+			Expect(incr1.Args()[0]).To(Equal("evalsha"))
+
+			// The script is loaded now, so EVALSHA succeeds.
+			incr := script.Run(ctx, pipe, []string{"counter"}, 1)
+			_, err = pipe.Exec(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(incr.Args()[0]).To(Equal("evalsha"))
+			Expect(incr.Val()).To(Equal(int64(6)))
+		})
 	})
 
 	Describe("TxPipeline", func() {
@@ -95,5 +220,21 @@ var _ = Describe("pipelining", func() {
 		})
 
 		assertPipeline()
+
+		It("does not retry scripts that are not loaded", func() {
+			Expect(client.ScriptFlush(ctx).Err()).NotTo(HaveOccurred())
+			script := redis.NewScript(`return redis.call('INCRBY', KEYS[1], ARGV[1])`)
+
+			incr := script.Run(ctx, pipe, []string{"counter"}, 2)
+			_, err := pipe.Exec(ctx)
+			Expect(err).To(MatchError(ContainSubstring("NOSCRIPT")))
+			Expect(incr.Args()[0]).To(Equal("evalsha"))
+
+			Expect(script.Load(ctx, client).Err()).NotTo(HaveOccurred())
+			incr = script.Run(ctx, pipe, []string{"counter"}, 3)
+			_, err = pipe.Exec(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(incr.Val()).To(Equal(int64(3)))
+		})
 	})
 })
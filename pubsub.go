@@ -2,9 +2,11 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/farss/redis/v8/internal"
@@ -19,19 +21,29 @@ import (
 // PubSub automatically reconnects to Redis Server and resubscribes
 // to the channels in case of network errors.
 type PubSub struct {
+	dropped uint64 // atomic
+
 	opt *Options
 
 	newConn   func(ctx context.Context, channels []string) (*pool.Conn, error)
 	closeConn func(*pool.Conn) error
+	hooks     hooks
 
-	mu       sync.Mutex
-	cn       *pool.Conn
-	channels map[string]struct{}
-	patterns map[string]struct{}
+	mu        sync.Mutex
+	cn        *pool.Conn
+	channels  map[string]struct{}
+	patterns  map[string]struct{}
+	schannels map[string]struct{}
 
 	closed bool
 	exit   chan struct{}
 
+	callbacks PubSubCallbacks
+	hadConn   bool // whether a connection was established before
+
+	routesMu sync.RWMutex
+	routes   []pubSubRoute
+
 	cmd *Cmd
 
 	chOnce sync.Once
@@ -46,6 +58,7 @@ func (c *PubSub) init() {
 func (c *PubSub) String() string {
 	channels := mapKeys(c.channels)
 	channels = append(channels, mapKeys(c.patterns)...)
+	channels = append(channels, mapKeys(c.schannels)...)
 	return fmt.Sprintf("PubSub(%s)", strings.Join(channels, ", "))
 }
 
@@ -64,7 +77,10 @@ func (c *PubSub) conn(ctx context.Context, newChannels []string) (*pool.Conn, er
 		return c.cn, nil
 	}
 
-	channels := mapKeys(c.channels)
+	// Shard channels go first, because they determine the node
+	// for ClusterClient.
+	channels := mapKeys(c.schannels)
+	channels = append(channels, mapKeys(c.channels)...)
 	channels = append(channels, newChannels...)
 
 	cn, err := c.newConn(ctx, channels)
@@ -72,17 +88,37 @@ func (c *PubSub) conn(ctx context.Context, newChannels []string) (*pool.Conn, er
 		return nil, err
 	}
 
+	if c.callbacks.OnConnect != nil {
+		c.callbacks.OnConnect(ctx)
+	}
+
 	if err := c.resubscribe(ctx, cn); err != nil {
 		_ = c.closeConn(cn)
 		return nil, err
 	}
 
 	c.cn = cn
+	if c.hadConn && c.callbacks.OnResubscribe != nil &&
+		(len(c.channels) > 0 || len(c.patterns) > 0 || len(c.schannels) > 0) {
+		channels := mapKeys(c.channels)
+		channels = append(channels, mapKeys(c.schannels)...)
+		c.callbacks.OnResubscribe(ctx, channels, mapKeys(c.patterns))
+	}
+	c.hadConn = true
 	return cn, nil
 }
 
 func (c *PubSub) writeCmd(ctx context.Context, cn *pool.Conn, cmd Cmder) error {
-	return cn.WithWriter(ctx, c.opt.WriteTimeout, func(wr *proto.Writer) error {
+	return cn.WithWriter(ctx, c.opt.writeTimeout(), func(wr *proto.Writer) error {
+		if p := c.opt.prefixer; p != nil {
+			// The shard channels are keys, so they are prefixed like in
+			// SPUBLISH.
+			args, err := p.args(cmd)
+			if err != nil {
+				return err
+			}
+			return wr.WriteArgs(args)
+		}
 		return writeCmd(wr, cmd)
 	})
 }
@@ -101,6 +137,13 @@ func (c *PubSub) resubscribe(ctx context.Context, cn *pool.Conn) error {
 		}
 	}
 
+	if len(c.schannels) > 0 {
+		err := c._subscribe(ctx, cn, "ssubscribe", mapKeys(c.schannels))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
 	return firstErr
 }
 
@@ -123,7 +166,9 @@ func (c *PubSub) _subscribe(
 		args = append(args, channel)
 	}
 	cmd := NewSliceCmd(ctx, args...)
-	return c.writeCmd(ctx, cn, cmd)
+	return c.hooks.process(ctx, cmd, func(ctx context.Context, cmd Cmder) error {
+		return c.writeCmd(ctx, cn, cmd)
+	})
 }
 
 func (c *PubSub) releaseConnWithLock(
@@ -156,13 +201,82 @@ func (c *PubSub) closeTheCn(reason error) error {
 		return nil
 	}
 	if !c.closed {
-		internal.Logger.Printf(c.getContext(), "redis: discarding bad PubSub connection: %s", reason)
+		internal.Log(c.getContext(), c.opt.Logger, internal.LogLevelWarn,
+			"discarding bad PubSub connection", "error", reason)
 	}
+	addr := c.cn.RemoteAddr().String()
 	err := c.closeConn(c.cn)
 	c.cn = nil
+	if !c.closed {
+		ctx := c.getContext()
+		c.forEachPubSubHook(func(hook PubSubHook) {
+			hook.PubSubReconnect(ctx, reason)
+		})
+		afterReconnect(ctx, c.hooks.hooks, &ReconnectEvent{
+			Addr:   addr,
+			Err:    reason,
+			PubSub: true,
+		})
+		if c.callbacks.OnDisconnect != nil {
+			c.callbacks.OnDisconnect(ctx, reason)
+		}
+	}
 	return err
 }
 
+// PubSubHook is an optional interface a Hook can implement to observe
+// PubSub traffic. Subscribe, unsubscribe and ping commands sent by PubSub
+// are passed to BeforeProcess and AfterProcess like other commands, but
+// their replies arrive later as messages.
+type PubSubHook interface {
+	// PubSubMessage is called for every received *Message,
+	// *Subscription or *Pong.
+	PubSubMessage(ctx context.Context, msg interface{})
+	// PubSubReconnect is called when a bad connection is discarded.
+	PubSubReconnect(ctx context.Context, reason error)
+	// PubSubPingError is called when the health check ping
+	// of the Go channel fails.
+	PubSubPingError(ctx context.Context, err error)
+}
+
+func (c *PubSub) forEachPubSubHook(fn func(hook PubSubHook)) {
+	for _, hook := range c.hooks.hooks {
+		if hook, ok := hook.(PubSubHook); ok {
+			fn(hook)
+		}
+	}
+}
+
+// PubSubCallbacks are called when the connection used by PubSub changes.
+// Messages published between OnDisconnect and OnResubscribe are lost,
+// so the callbacks can be used to detect such windows.
+//
+// The callbacks are called while PubSub is locked, so they must not
+// call PubSub methods.
+type PubSubCallbacks struct {
+	// OnConnect is called when a new connection is established,
+	// before the subscriptions are restored.
+	OnConnect func(ctx context.Context)
+	// OnDisconnect is called when a bad connection is discarded.
+	OnDisconnect func(ctx context.Context, reason error)
+	// OnResubscribe is called when the channels and patterns
+	// are subscribed again using a new connection.
+	OnResubscribe func(ctx context.Context, channels, patterns []string)
+}
+
+// SetCallbacks sets the callbacks that are called when the connection
+// changes. To observe the first connection, create PubSub without
+// channels, set callbacks and subscribe afterwards:
+//
+//	pubsub := rdb.Subscribe(ctx)
+//	pubsub.SetCallbacks(redis.PubSubCallbacks{...})
+//	err := pubsub.Subscribe(ctx, "mychannel")
+func (c *PubSub) SetCallbacks(callbacks PubSubCallbacks) {
+	c.mu.Lock()
+	c.callbacks = callbacks
+	c.mu.Unlock()
+}
+
 func (c *PubSub) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -208,6 +322,22 @@ func (c *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
 	return err
 }
 
+// SSubscribe the client to the specified shard channels. It returns
+// empty subscription if there are no channels.
+func (c *PubSub) SSubscribe(ctx context.Context, channels ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.subscribe(ctx, "ssubscribe", channels...)
+	if c.schannels == nil {
+		c.schannels = make(map[string]struct{})
+	}
+	for _, s := range channels {
+		c.schannels[s] = struct{}{}
+	}
+	return err
+}
+
 // Unsubscribe the client from the given channels, or from all of
 // them if none is given.
 func (c *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
@@ -234,6 +364,19 @@ func (c *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
 	return err
 }
 
+// SUnsubscribe the client from the given shard channels, or from all of
+// them if none is given.
+func (c *PubSub) SUnsubscribe(ctx context.Context, channels ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, channel := range channels {
+		delete(c.schannels, channel)
+	}
+	err := c.subscribe(ctx, "sunsubscribe", channels...)
+	return err
+}
+
 func (c *PubSub) subscribe(ctx context.Context, redisCmd string, channels ...string) error {
 	cn, err := c.conn(ctx, channels)
 	if err != nil {
@@ -260,14 +403,17 @@ func (c *PubSub) Ping(ctx context.Context, payload ...string) error {
 		return err
 	}
 
-	err = c.writeCmd(ctx, cn, cmd)
+	err = c.hooks.process(ctx, cmd, func(ctx context.Context, cmd Cmder) error {
+		return c.writeCmd(ctx, cn, cmd)
+	})
 	c.releaseConn(ctx, cn, err, false)
 	return err
 }
 
 // Subscription received after a successful subscription to channel.
 type Subscription struct {
-	// Can be "subscribe", "unsubscribe", "psubscribe" or "punsubscribe".
+	// Can be "subscribe", "unsubscribe", "psubscribe", "punsubscribe",
+	// "ssubscribe" or "sunsubscribe".
 	Kind string
 	// Channel name we have subscribed to.
 	Channel string
@@ -303,6 +449,13 @@ func (p *Pong) String() string {
 	return "Pong"
 }
 
+func (c *PubSub) stripChannel(kind, channel string) string {
+	if c.opt == nil || c.opt.prefixer == nil {
+		return channel
+	}
+	return c.opt.prefixer.stripChannel(kind, channel)
+}
+
 func (c *PubSub) newMessage(reply interface{}) (interface{}, error) {
 	switch reply := reply.(type) {
 	case string:
@@ -311,19 +464,20 @@ func (c *PubSub) newMessage(reply interface{}) (interface{}, error) {
 		}, nil
 	case []interface{}:
 		switch kind := reply[0].(string); kind {
-		case "subscribe", "unsubscribe", "psubscribe", "punsubscribe":
+		case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ssubscribe", "sunsubscribe":
 			// Can be nil in case of "unsubscribe".
 			channel, _ := reply[1].(string)
 			return &Subscription{
 				Kind:    kind,
-				Channel: channel,
+				Channel: c.stripChannel(kind, channel),
 				Count:   int(reply[2].(int64)),
 			}, nil
-		case "message":
+		case "message", "smessage":
+			channel := c.stripChannel(kind, reply[1].(string))
 			switch payload := reply[2].(type) {
 			case string:
 				return &Message{
-					Channel: reply[1].(string),
+					Channel: channel,
 					Payload: payload,
 				}, nil
 			case []interface{}:
@@ -332,9 +486,15 @@ func (c *PubSub) newMessage(reply interface{}) (interface{}, error) {
 					ss[i] = s.(string)
 				}
 				return &Message{
-					Channel:      reply[1].(string),
+					Channel:      channel,
 					PayloadSlice: ss,
 				}, nil
+			case nil:
+				// Client tracking sends a nil payload when the whole
+				// keyspace is invalidated, e.g. after FLUSHALL.
+				return &Message{
+					Channel: channel,
+				}, nil
 			default:
 				return nil, fmt.Errorf("redis: unsupported pubsub message payload: %T", payload)
 			}
@@ -371,9 +531,7 @@ func (c *PubSub) ReceiveTimeout(ctx context.Context, timeout time.Duration) (int
 		return nil, err
 	}
 
-	err = cn.WithReader(ctx, timeout, func(rd *proto.Reader) error {
-		return c.cmd.readReply(rd)
-	})
+	err = c.readReply(ctx, cn, timeout)
 
 	c.releaseConnWithLock(ctx, cn, err, timeout > 0)
 
@@ -381,7 +539,49 @@ func (c *PubSub) ReceiveTimeout(ctx context.Context, timeout time.Duration) (int
 		return nil, err
 	}
 
-	return c.newMessage(c.cmd.Val())
+	msg, err := c.newMessage(c.cmd.Val())
+	if err != nil {
+		return nil, err
+	}
+
+	c.forEachPubSubHook(func(hook PubSubHook) {
+		hook.PubSubMessage(ctx, msg)
+	})
+	return msg, nil
+}
+
+// readReply reads a reply into c.cmd. The read is interrupted when the ctx
+// is done, in which case the connection is discarded, because the reply
+// could be read partially.
+func (c *PubSub) readReply(ctx context.Context, cn *pool.Conn, timeout time.Duration) error {
+	done := ctx.Done()
+	if done == nil {
+		return cn.WithReader(ctx, timeout, c.cmd.readReply)
+	}
+
+	stop := make(chan struct{})
+	exited := make(chan bool)
+	go func() {
+		select {
+		case <-done:
+			_ = cn.SetReadDeadline(time.Now())
+			exited <- true
+		case <-stop:
+			exited <- false
+		}
+	}()
+
+	err := cn.WithReader(ctx, timeout, c.cmd.readReply)
+	close(stop)
+	if interrupted := <-exited; interrupted {
+		if err == nil {
+			// The reply was read before the deadline was changed.
+			_ = cn.SetReadDeadline(time.Time{})
+			return nil
+		}
+		return ctx.Err()
+	}
+	return err
 }
 
 // Receive returns a message as a Subscription, Message, Pong or error.
@@ -426,7 +626,8 @@ func (c *PubSub) getContext() context.Context {
 
 // Channel returns a Go channel for concurrently receiving messages.
 // The channel is closed together with the PubSub. If the Go channel
-// is blocked full for 30 seconds the message is dropped.
+// is blocked full for 30 seconds the message is dropped; use
+// WithChannelOverflow to change that.
 // Receive* APIs can not be used after channel is created.
 //
 // go-redis periodically sends ping messages to test connection health
@@ -468,6 +669,74 @@ func (c *PubSub) ChannelWithSubscriptions(_ context.Context, size int) <-chan in
 	return c.allCh.allCh
 }
 
+// DecodedMessage is a Message with the payload decoded by a Codec.
+type DecodedMessage struct {
+	*Message
+	// Value is the decoded payload.
+	Value interface{}
+}
+
+// MessageDecodeError is sent by DecodedChannel when the payload
+// of a message can't be decoded.
+type MessageDecodeError struct {
+	Message *Message
+	Err     error
+}
+
+func (e *MessageDecodeError) Error() string {
+	return fmt.Sprintf("redis: can't decode message from %s: %s", e.Message.Channel, e.Err)
+}
+
+func (e *MessageDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodedChannel is like Channel, but decodes payloads of the messages
+// with the codec. newValue must return a pointer to a new value the payload
+// is decoded into, e.g.
+//
+//	msgs, errs := pubsub.DecodedChannel(redis.JSONCodec, func() interface{} {
+//		return new(Order)
+//	})
+//
+// Messages that can't be decoded are reported as *MessageDecodeError on
+// the error channel. The errors are dropped if nobody reads the error
+// channel. Both channels are closed together with the PubSub.
+func (c *PubSub) DecodedChannel(
+	codec Codec, newValue func() interface{}, opts ...ChannelOption,
+) (<-chan *DecodedMessage, <-chan error) {
+	ch := c.Channel(opts...)
+	chanSize := c.msgCh.chanSize
+
+	msgCh := make(chan *DecodedMessage, chanSize)
+	errCh := make(chan error, chanSize)
+
+	go func() {
+		defer close(msgCh)
+		defer close(errCh)
+
+		for msg := range ch {
+			v := newValue()
+			if err := codec.Unmarshal([]byte(msg.Payload), v); err != nil {
+				select {
+				case errCh <- &MessageDecodeError{Message: msg, Err: err}:
+				default:
+					internal.Log(c.getContext(), c.opt.Logger, internal.LogLevelWarn,
+						"PubSub error channel is full (error is dropped)", "error", err)
+				}
+				continue
+			}
+			select {
+			case msgCh <- &DecodedMessage{Message: msg, Value: v}:
+			case <-c.exit:
+				return
+			}
+		}
+	}()
+
+	return msgCh, errCh
+}
+
 type ChannelOption func(c *channel)
 
 // WithChannelSize specifies the Go chan size that is used to buffer incoming messages.
@@ -490,6 +759,18 @@ func WithChannelHealthCheckInterval(d time.Duration) ChannelOption {
 	}
 }
 
+// WithChannelReconnectBackoff specifies the minimum and maximum time to wait
+// before retrying when receiving fails, e.g. because Redis Server is down.
+// The time grows exponentially with every failed attempt and is randomized.
+//
+// The default is 100 milliseconds for both values.
+func WithChannelReconnectBackoff(minBackoff, maxBackoff time.Duration) ChannelOption {
+	return func(c *channel) {
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
 // WithChannelSendTimeout specifies the channel send timeout after which
 // the message is dropped.
 //
@@ -500,8 +781,51 @@ func WithChannelSendTimeout(d time.Duration) ChannelOption {
 	}
 }
 
+// WithChannelContext specifies the context used to receive messages.
+// When the context is done, receiving is interrupted and the Go channel
+// is closed. The PubSub itself stays open and must still be closed.
+//
+// The default is context.TODO().
+func WithChannelContext(ctx context.Context) ChannelOption {
+	return func(c *channel) {
+		c.ctx = ctx
+	}
+}
+
+// ChannelOverflowPolicy specifies what happens to a message
+// when the Go channel is full.
+type ChannelOverflowPolicy int
+
+const (
+	// ChannelBlock waits for the channel send timeout
+	// and drops the message afterwards.
+	ChannelBlock ChannelOverflowPolicy = iota
+	// ChannelDropOldest drops the oldest buffered message
+	// to make room for the new one.
+	ChannelDropOldest
+	// ChannelDropNewest drops the new message.
+	ChannelDropNewest
+)
+
+// WithChannelOverflow specifies what happens to a message when the Go channel
+// is full. Dropped messages are counted by PubSub.DroppedMessages.
+//
+// The default is ChannelBlock.
+func WithChannelOverflow(policy ChannelOverflowPolicy) ChannelOption {
+	return func(c *channel) {
+		c.overflow = policy
+	}
+}
+
+// DroppedMessages returns the number of messages dropped
+// because the Go channel returned by Channel was full.
+func (c *PubSub) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
 type channel struct {
 	pubSub *PubSub
+	ctx    context.Context
 
 	msgCh chan *Message
 	allCh chan interface{}
@@ -509,16 +833,22 @@ type channel struct {
 
 	chanSize        int
 	chanSendTimeout time.Duration
+	overflow        ChannelOverflowPolicy
 	checkInterval   time.Duration
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
 }
 
 func newChannel(pubSub *PubSub, opts ...ChannelOption) *channel {
 	c := &channel{
 		pubSub: pubSub,
+		ctx:    context.TODO(),
 
 		chanSize:        100,
 		chanSendTimeout: time.Minute,
 		checkInterval:   3 * time.Second,
+		minBackoff:      100 * time.Millisecond,
+		maxBackoff:      100 * time.Millisecond,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -530,7 +860,7 @@ func newChannel(pubSub *PubSub, opts ...ChannelOption) *channel {
 }
 
 func (c *channel) initHealthCheck() {
-	ctx := context.TODO()
+	ctx := c.ctx
 	c.ping = make(chan struct{}, 1)
 
 	go func() {
@@ -546,20 +876,29 @@ func (c *channel) initHealthCheck() {
 				}
 			case <-timer.C:
 				if pingErr := c.pubSub.Ping(ctx); pingErr != nil {
+					c.pubSub.forEachPubSubHook(func(hook PubSubHook) {
+						hook.PubSubPingError(ctx, pingErr)
+					})
 					c.pubSub.mu.Lock()
 					c.pubSub.reconnect(ctx, pingErr)
 					c.pubSub.mu.Unlock()
 				}
 			case <-c.pubSub.exit:
 				return
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
+func (c *channel) drop() {
+	atomic.AddUint64(&c.pubSub.dropped, 1)
+}
+
 // initMsgChan must be in sync with initAllChan.
 func (c *channel) initMsgChan() {
-	ctx := context.TODO()
+	ctx := c.ctx
 	c.msgCh = make(chan *Message, c.chanSize)
 
 	go func() {
@@ -570,12 +909,12 @@ func (c *channel) initMsgChan() {
 		for {
 			msg, err := c.pubSub.Receive(ctx)
 			if err != nil {
-				if err == pool.ErrClosed {
+				if err == pool.ErrClosed || ctx.Err() != nil {
 					close(c.msgCh)
 					return
 				}
 				if errCount > 0 {
-					time.Sleep(100 * time.Millisecond)
+					time.Sleep(internal.RetryBackoff(errCount-1, c.minBackoff, c.maxBackoff))
 				}
 				errCount++
 				continue
@@ -595,19 +934,43 @@ func (c *channel) initMsgChan() {
 			case *Pong:
 				// Ignore.
 			case *Message:
-				timer.Reset(c.chanSendTimeout)
-				select {
-				case c.msgCh <- msg:
-					if !timer.Stop() {
-						<-timer.C
+				switch c.overflow {
+				case ChannelDropOldest:
+					for sent := false; !sent; {
+						select {
+						case c.msgCh <- msg:
+							sent = true
+						default:
+							select {
+							case <-c.msgCh:
+								c.drop()
+							default:
+							}
+						}
+					}
+				case ChannelDropNewest:
+					select {
+					case c.msgCh <- msg:
+					default:
+						c.drop()
+					}
+				default:
+					timer.Reset(c.chanSendTimeout)
+					select {
+					case c.msgCh <- msg:
+						if !timer.Stop() {
+							<-timer.C
+						}
+					case <-timer.C:
+						c.drop()
+						internal.Log(ctx, c.pubSub.opt.Logger, internal.LogLevelWarn,
+							"channel is full (message is dropped)",
+							"pubsub", c.pubSub, "timeout", c.chanSendTimeout)
 					}
-				case <-timer.C:
-					internal.Logger.Printf(
-						ctx, "redis: %s channel is full for %s (message is dropped)",
-						c, c.chanSendTimeout)
 				}
 			default:
-				internal.Logger.Printf(ctx, "redis: unknown message type: %T", msg)
+				internal.Log(ctx, c.pubSub.opt.Logger, internal.LogLevelError,
+					"unknown message type", "type", fmt.Sprintf("%T", msg))
 			}
 		}
 	}()
@@ -615,7 +978,7 @@ func (c *channel) initMsgChan() {
 
 // initAllChan must be in sync with initMsgChan.
 func (c *channel) initAllChan() {
-	ctx := context.TODO()
+	ctx := c.ctx
 	c.allCh = make(chan interface{}, c.chanSize)
 
 	go func() {
@@ -626,12 +989,12 @@ func (c *channel) initAllChan() {
 		for {
 			msg, err := c.pubSub.Receive(ctx)
 			if err != nil {
-				if err == pool.ErrClosed {
+				if err == pool.ErrClosed || ctx.Err() != nil {
 					close(c.allCh)
 					return
 				}
 				if errCount > 0 {
-					time.Sleep(100 * time.Millisecond)
+					time.Sleep(internal.RetryBackoff(errCount-1, c.minBackoff, c.maxBackoff))
 				}
 				errCount++
 				continue
@@ -649,20 +1012,85 @@ func (c *channel) initAllChan() {
 			case *Pong:
 				// Ignore.
 			case *Subscription, *Message:
-				timer.Reset(c.chanSendTimeout)
-				select {
-				case c.allCh <- msg:
-					if !timer.Stop() {
-						<-timer.C
+				switch c.overflow {
+				case ChannelDropOldest:
+					for sent := false; !sent; {
+						select {
+						case c.allCh <- msg:
+							sent = true
+						default:
+							select {
+							case <-c.allCh:
+								c.drop()
+							default:
+							}
+						}
+					}
+				case ChannelDropNewest:
+					select {
+					case c.allCh <- msg:
+					default:
+						c.drop()
+					}
+				default:
+					timer.Reset(c.chanSendTimeout)
+					select {
+					case c.allCh <- msg:
+						if !timer.Stop() {
+							<-timer.C
+						}
+					case <-timer.C:
+						c.drop()
+						internal.Log(ctx, c.pubSub.opt.Logger, internal.LogLevelWarn,
+							"channel is full (message is dropped)",
+							"pubsub", c.pubSub, "timeout", c.chanSendTimeout)
 					}
-				case <-timer.C:
-					internal.Logger.Printf(
-						ctx, "redis: %s channel is full for %s (message is dropped)",
-						c, c.chanSendTimeout)
 				}
 			default:
-				internal.Logger.Printf(ctx, "redis: unknown message type: %T", msg)
+				internal.Log(ctx, c.pubSub.opt.Logger, internal.LogLevelError,
+					"unknown message type", "type", fmt.Sprintf("%T", msg))
 			}
 		}
 	}()
 }
+
+//------------------------------------------------------------------------------
+
+// ErrNotEnoughReceivers is returned by PublishAndConfirm when the message
+// was not received by the required number of subscribers.
+var ErrNotEnoughReceivers = errors.New("redis: message is not received by enough subscribers")
+
+const (
+	minPublishConfirmBackoff = 8 * time.Millisecond
+	maxPublishConfirmBackoff = 512 * time.Millisecond
+)
+
+// publishAndConfirm publishes the message until it is received by at least
+// minReceivers subscribers or the timeout expires.
+func publishAndConfirm(
+	ctx context.Context,
+	c Cmdable,
+	channel string,
+	message interface{},
+	minReceivers int64,
+	timeout time.Duration,
+) (int64, error) {
+	deadline := time.Now().Add(timeout)
+	for attempt := 0; ; attempt++ {
+		n, err := c.Publish(ctx, channel, message).Result()
+		if err != nil {
+			return n, err
+		}
+		if n >= minReceivers {
+			return n, nil
+		}
+
+		backoff := internal.RetryBackoff(attempt, minPublishConfirmBackoff, maxPublishConfirmBackoff)
+		if time.Until(deadline) < backoff {
+			return n, ErrNotEnoughReceivers
+		}
+		if err := internal.Sleep(ctx, backoff); err != nil {
+			return n, err
+		}
+	}
+}
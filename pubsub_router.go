@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/util"
+)
+
+// MessageHandler handles a message received by PubSub.
+type MessageHandler func(ctx context.Context, msg *Message)
+
+type pubSubRoute struct {
+	pattern string
+	handler MessageHandler
+}
+
+// Handle registers the handler for messages from channels matching
+// the pattern. Patterns use the same glob-style syntax as PSUBSCRIBE,
+// e.g. "orders.*". When several patterns match a channel, the handler
+// that was registered first is used.
+//
+// Handle does not subscribe to the channels; use Subscribe or PSubscribe
+// for that. Messages are dispatched to the handlers by Serve.
+func (c *PubSub) Handle(pattern string, handler MessageHandler) {
+	c.routesMu.Lock()
+	c.routes = append(c.routes, pubSubRoute{
+		pattern: pattern,
+		handler: handler,
+	})
+	c.routesMu.Unlock()
+}
+
+func (c *PubSub) handler(channel string) MessageHandler {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+
+	for _, route := range c.routes {
+		if util.MatchGlob(route.pattern, channel) {
+			return route.handler
+		}
+	}
+	return nil
+}
+
+// Serve receives messages using Channel and dispatches them to the handlers
+// registered with Handle using the given number of worker goroutines.
+// Messages without a handler are dropped. Messages from the same channel may
+// be handled concurrently unless a single worker is used.
+//
+// Serve returns nil when the PubSub is closed and ctx.Err() when the ctx
+// is done. In both cases it waits for the running handlers to return.
+func (c *PubSub) Serve(ctx context.Context, workers int, opts ...ChannelOption) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ch := c.Channel(opts...)
+	jobs := make(chan *Message)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				if handler := c.handler(msg.Channel); handler != nil {
+					handler(ctx, msg)
+				} else {
+					internal.Log(ctx, c.opt.Logger, internal.LogLevelWarn,
+						"no handler for message (message is dropped)", "channel", msg.Channel)
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			select {
+			case jobs <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Consume receives messages using Channel and passes them to fn using the
+// given number of worker goroutines. Messages from the same channel are
+// always handled by the same worker in the order they were received, so a
+// slow handler delays only the channels assigned to its worker.
+//
+// Consume returns nil when the PubSub is closed and ctx.Err() when the ctx
+// is done. In both cases it waits for the running handlers to return.
+func (c *PubSub) Consume(
+	ctx context.Context, workers int, fn MessageHandler, opts ...ChannelOption,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ch := c.Channel(opts...)
+
+	var wg sync.WaitGroup
+	queues := make([]chan *Message, workers)
+	for i := range queues {
+		queue := make(chan *Message, c.msgCh.chanSize)
+		queues[i] = queue
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range queue {
+				fn(ctx, msg)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(msg.Channel))
+			queue := queues[h.Sum32()%uint32(workers)]
+
+			select {
+			case queue <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -103,6 +105,55 @@ var _ = Describe("PubSub", func() {
 		Expect(len(channels)).To(BeNumerically(">=", 2))
 	})
 
+	It("should pub/sub shard channels", func() {
+		if err := client.SPublish(ctx, "mychannel", "hello").Err(); err != nil {
+			Skip("sharded pub/sub requires Redis 7: " + err.Error())
+		}
+
+		pubsub := client.SSubscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		subscr, err := pubsub.ReceiveTimeout(ctx, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subscr).To(Equal(&redis.Subscription{
+			Kind:    "ssubscribe",
+			Channel: "mychannel",
+			Count:   1,
+		}))
+
+		channels, err := client.PubSubShardChannels(ctx, "*").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(channels).To(Equal([]string{"mychannel"}))
+
+		n, err := client.SPublish(ctx, "mychannel", "hello").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(1)))
+
+		msg, err := pubsub.ReceiveMessage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Channel).To(Equal("mychannel"))
+		Expect(msg.Payload).To(Equal("hello"))
+
+		// Shard channels are restored after reconnect.
+		pubsub.SetNetConn(&badConn{
+			readErr:  io.EOF,
+			writeErr: io.EOF,
+		})
+		_, err = pubsub.ReceiveMessage(ctx)
+		Expect(err).To(Equal(io.EOF))
+
+		Eventually(func() int64 {
+			return client.PubSubShardNumSub(ctx, "mychannel").Val()["mychannel"]
+		}).Should(Equal(int64(1)))
+
+		err = client.SPublish(ctx, "mychannel", "world").Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		msg, err = pubsub.ReceiveMessage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Payload).To(Equal("world"))
+	})
+
 	It("should return the numbers of subscribers", func() {
 		pubsub := client.Subscribe(ctx, "mychannel", "mychannel2")
 		defer pubsub.Close()
@@ -341,6 +392,36 @@ var _ = Describe("PubSub", func() {
 		expectReceiveMessageOnError(pubsub)
 	})
 
+	It("calls callbacks on reconnect", func() {
+		var events []string
+		pubsub := client.Subscribe(ctx)
+		defer pubsub.Close()
+
+		pubsub.SetCallbacks(redis.PubSubCallbacks{
+			OnConnect: func(ctx context.Context) {
+				events = append(events, "connect")
+			},
+			OnDisconnect: func(ctx context.Context, reason error) {
+				events = append(events, "disconnect: "+reason.Error())
+			},
+			OnResubscribe: func(ctx context.Context, channels, patterns []string) {
+				events = append(events, "resubscribe: "+strings.Join(channels, ","))
+			},
+		})
+
+		err := pubsub.Subscribe(ctx, "mychannel")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(Equal([]string{"connect"}))
+
+		expectReceiveMessageOnError(pubsub)
+		Expect(events).To(Equal([]string{
+			"connect",
+			"disconnect: EOF",
+			"connect",
+			"resubscribe: mychannel",
+		}))
+	})
+
 	It("should return on Close", func() {
 		pubsub := client.Subscribe(ctx, "mychannel")
 		defer pubsub.Close()
@@ -487,4 +568,277 @@ var _ = Describe("PubSub", func() {
 		Expect(msg.Channel).To(Equal("mychannel"))
 		Expect(msg.Payload).To(Equal(text))
 	})
+
+	It("should decode messages", func() {
+		type order struct {
+			ID int `json:"id"`
+		}
+
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		msgs, errs := pubsub.DecodedChannel(redis.JSONCodec, func() interface{} {
+			return new(order)
+		})
+
+		err := client.Publish(ctx, "mychannel", "not json").Err()
+		Expect(err).NotTo(HaveOccurred())
+		err = client.Publish(ctx, "mychannel", `{"id":42}`).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		var decodeErr error
+		Eventually(errs).Should(Receive(&decodeErr))
+		Expect(decodeErr).To(BeAssignableToTypeOf(&redis.MessageDecodeError{}))
+		Expect(decodeErr.(*redis.MessageDecodeError).Message.Payload).To(Equal("not json"))
+
+		var msg *redis.DecodedMessage
+		Eventually(msgs).Should(Receive(&msg))
+		Expect(msg.Channel).To(Equal("mychannel"))
+		Expect(msg.Value).To(Equal(&order{ID: 42}))
+	})
+
+	It("should close decoded channels when the messages are not read", func() {
+		pubsub := client.Subscribe(ctx, "mychannel")
+		_, err := pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		msgs, _ := pubsub.DecodedChannel(redis.JSONCodec, func() interface{} {
+			return new(int)
+		}, redis.WithChannelSize(1))
+
+		for i := 0; i < 5; i++ {
+			err := client.Publish(ctx, "mychannel", strconv.Itoa(i)).Err()
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Eventually(func() int { return len(msgs) }).Should(Equal(1))
+
+		Expect(pubsub.Close()).NotTo(HaveOccurred())
+		Eventually(msgs).Should(BeClosed())
+	})
+
+	It("should drop messages when channel is full", func() {
+		for _, policy := range []redis.ChannelOverflowPolicy{
+			redis.ChannelDropOldest,
+			redis.ChannelDropNewest,
+		} {
+			pubsub := client.Subscribe(ctx, "mychannel")
+
+			_, err := pubsub.Receive(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			ch := pubsub.Channel(
+				redis.WithChannelSize(1),
+				redis.WithChannelOverflow(policy),
+			)
+
+			for _, payload := range []string{"1", "2", "3"} {
+				err := client.Publish(ctx, "mychannel", payload).Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Eventually(pubsub.DroppedMessages).Should(Equal(uint64(2)))
+
+			var msg *redis.Message
+			Eventually(ch).Should(Receive(&msg))
+			if policy == redis.ChannelDropOldest {
+				Expect(msg.Payload).To(Equal("3"))
+			} else {
+				Expect(msg.Payload).To(Equal("1"))
+			}
+
+			Expect(pubsub.Close()).NotTo(HaveOccurred())
+		}
+	})
+
+	It("should route messages to handlers", func() {
+		pubsub := client.PSubscribe(ctx, "orders.*", "users.*")
+		defer pubsub.Close()
+
+		_, err := pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		orders := make(chan string, 10)
+		users := make(chan string, 10)
+		pubsub.Handle("orders.*", func(ctx context.Context, msg *redis.Message) {
+			orders <- msg.Payload
+		})
+		pubsub.Handle("*", func(ctx context.Context, msg *redis.Message) {
+			users <- msg.Payload
+		})
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- pubsub.Serve(ctx, 2)
+		}()
+
+		Expect(client.Publish(ctx, "orders.created", "order").Err()).NotTo(HaveOccurred())
+		Expect(client.Publish(ctx, "users.created", "user").Err()).NotTo(HaveOccurred())
+
+		Eventually(orders).Should(Receive(Equal("order")))
+		Eventually(users).Should(Receive(Equal("user")))
+
+		cancel()
+		Eventually(done).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("should call hooks", func() {
+		var mu sync.Mutex
+		var cmds []string
+		var msgs []interface{}
+		hook := &pubSubHook{
+			hook: hook{
+				beforeProcess: func(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+					mu.Lock()
+					cmds = append(cmds, cmd.Name())
+					mu.Unlock()
+					return ctx, nil
+				},
+			},
+			pubSubMessage: func(ctx context.Context, msg interface{}) {
+				mu.Lock()
+				msgs = append(msgs, msg)
+				mu.Unlock()
+			},
+		}
+		client.AddHook(hook)
+
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		_, err := pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Publish(ctx, "mychannel", "hello").Err()).NotTo(HaveOccurred())
+		_, err = pubsub.ReceiveMessage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(cmds).To(Equal([]string{"subscribe", "publish"}))
+		Expect(msgs).To(Equal([]interface{}{
+			&redis.Subscription{Kind: "subscribe", Channel: "mychannel", Count: 1},
+			&redis.Message{Channel: "mychannel", Payload: "hello"},
+		}))
+	})
+
+	It("should consume messages in order per channel", func() {
+		pubsub := client.Subscribe(ctx, "mychannel1", "mychannel2")
+		defer pubsub.Close()
+
+		for i := 0; i < 2; i++ {
+			_, err := pubsub.Receive(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var mu sync.Mutex
+		received := make(map[string][]string)
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- pubsub.Consume(ctx, 4, func(ctx context.Context, msg *redis.Message) {
+				mu.Lock()
+				received[msg.Channel] = append(received[msg.Channel], msg.Payload)
+				mu.Unlock()
+			})
+		}()
+
+		var expected []string
+		for i := 0; i < 50; i++ {
+			payload := strconv.Itoa(i)
+			expected = append(expected, payload)
+			Expect(client.Publish(ctx, "mychannel1", payload).Err()).NotTo(HaveOccurred())
+			Expect(client.Publish(ctx, "mychannel2", payload).Err()).NotTo(HaveOccurred())
+		}
+
+		Eventually(func() map[string][]string {
+			mu.Lock()
+			defer mu.Unlock()
+			m := make(map[string][]string, len(received))
+			for k, v := range received {
+				m[k] = append([]string(nil), v...)
+			}
+			return m
+		}).Should(Equal(map[string][]string{
+			"mychannel1": expected,
+			"mychannel2": expected,
+		}))
+
+		cancel()
+		Eventually(done).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("should interrupt ReceiveMessage when context is canceled", func() {
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		_, err := pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = pubsub.ReceiveMessage(cancelCtx)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		// PubSub reconnects and resubscribes.
+		Expect(pubsub.Ping(ctx)).NotTo(HaveOccurred())
+		Expect(client.Publish(ctx, "mychannel", "hello").Err()).NotTo(HaveOccurred())
+		msg, err := pubsub.ReceiveMessage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Payload).To(Equal("hello"))
+	})
+
+	It("should close Go channel when context is canceled", func() {
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		ch := pubsub.Channel(redis.WithChannelContext(cancelCtx))
+		cancel()
+
+		Eventually(ch).Should(BeClosed())
+	})
+
+	It("should publish and confirm", func() {
+		n, err := client.PublishAndConfirm(ctx, "mychannel", "hello", 1, 50*time.Millisecond)
+		Expect(err).To(Equal(redis.ErrNotEnoughReceivers))
+		Expect(n).To(Equal(int64(0)))
+
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		_, err = pubsub.Receive(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		n, err = client.PublishAndConfirm(ctx, "mychannel", "hello", 1, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(1)))
+
+		msg, err := pubsub.ReceiveMessage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Payload).To(Equal("hello"))
+	})
 })
+
+type pubSubHook struct {
+	hook
+
+	pubSubMessage func(ctx context.Context, msg interface{})
+}
+
+var _ redis.PubSubHook = (*pubSubHook)(nil)
+
+func (h *pubSubHook) PubSubMessage(ctx context.Context, msg interface{}) {
+	if h.pubSubMessage != nil {
+		h.pubSubMessage(ctx, msg)
+	}
+}
+
+func (h *pubSubHook) PubSubReconnect(ctx context.Context, reason error) {}
+
+func (h *pubSubHook) PubSubPingError(ctx context.Context, err error) {}
@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// ReadOnlyGuardError is returned by the commands rejected by ReadOnlyGuard.
+type ReadOnlyGuardError struct {
+	// Command is the name of the rejected command.
+	Command string
+}
+
+func (e *ReadOnlyGuardError) Error() string {
+	return fmt.Sprintf("redis: %s is rejected by the read-only guard", e.Command)
+}
+
+// ReadOnlyGuard rejects the write commands of a client while it is enabled,
+// e.g. to keep a service running in a degraded read-only mode during a
+// maintenance window. The commands are rejected with *ReadOnlyGuardError
+// without being sent.
+//
+// The commands are classified with the flags returned by COMMAND, which is
+// loaded when the guard is used for the first time: the commands with the
+// write flag and the commands that are not listed are rejected. EVAL,
+// EVALSHA and FCALL are also rejected, because the scripts can write, so
+// the read-only variants EVAL_RO, EVALSHA_RO and FCALL_RO must be used.
+type ReadOnlyGuard struct {
+	enabled uint32 // atomic
+
+	cmdsInfo *cmdsInfoCache
+}
+
+// NewReadOnlyGuard adds a disabled guard to the client. The guard applies to
+// all the commands of the client, including pipelines and transactions.
+func NewReadOnlyGuard(c UniversalClient) *ReadOnlyGuard {
+	g := &ReadOnlyGuard{
+		cmdsInfo: newCmdsInfoCache(func(ctx context.Context) (map[string]*CommandInfo, error) {
+			return c.Command(ctx).Result()
+		}),
+	}
+	c.AddMiddleware(g.process)
+	return g
+}
+
+// Enable starts rejecting the write commands.
+func (g *ReadOnlyGuard) Enable() {
+	atomic.StoreUint32(&g.enabled, 1)
+}
+
+// Disable stops rejecting the write commands.
+func (g *ReadOnlyGuard) Disable() {
+	atomic.StoreUint32(&g.enabled, 0)
+}
+
+// Enabled reports whether the write commands are rejected.
+func (g *ReadOnlyGuard) Enabled() bool {
+	return atomic.LoadUint32(&g.enabled) == 1
+}
+
+func (g *ReadOnlyGuard) process(ctx context.Context, cmd Cmder) error {
+	if !g.Enabled() {
+		return nil
+	}
+
+	name := cmd.Name()
+	switch name {
+	case "command":
+		// COMMAND is used to load the commands info.
+		return nil
+	case "eval", "evalsha", "fcall":
+		return &ReadOnlyGuardError{Command: name}
+	}
+
+	cmdsInfo, err := g.cmdsInfo.Get(ctx)
+	if err != nil {
+		return err
+	}
+	info := cmdsInfo[name]
+	if info == nil || contains(info.Flags, "write") {
+		return &ReadOnlyGuardError{Command: name}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package redis
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+var redactRules atomic.Value // []AuditRule
+
+// SetRedactRules sets the rules that redact the arguments of the commands
+// whenever the commands are formatted, i.e. in Cmd.String, RedactedArgs,
+// the slow log and the audit entries, so the sensitive values don't end up
+// in the logs. Passwords of AUTH, HELLO, MIGRATE, ACL SETUSER and CONFIG SET
+// are always redacted.
+func SetRedactRules(rules ...AuditRule) {
+	redactRules.Store(append([]AuditRule(nil), rules...))
+}
+
+func getRedactRules() []AuditRule {
+	rules, _ := redactRules.Load().([]AuditRule)
+	return rules
+}
+
+// RedactedArgs returns the arguments of the cmd with the redacted arguments
+// replaced with "?". It is meant to be used by the hooks that log or trace
+// the commands. The returned slice must not be modified.
+func RedactedArgs(cmd Cmder) []interface{} {
+	args := cmd.Args()
+	mask := redactMask(cmd, auditCmdName(cmd), formatArgs(args), nil)
+	if mask == nil {
+		return args
+	}
+
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if mask[i] {
+			out[i] = "?"
+		} else {
+			out[i] = arg
+		}
+	}
+	return out
+}
+
+// RedactedErr returns the error message of the cmd with the quoted values of
+// the redacted arguments replaced with "?", e.g. in the unknown command
+// errors that include the arguments. It returns "" if the cmd has no error.
+func RedactedErr(cmd Cmder) string {
+	err := cmd.Err()
+	if err == nil {
+		return ""
+	}
+	args := formatArgs(cmd.Args())
+	return redactErrString(err.Error(), args, redactMask(cmd, auditCmdName(cmd), args, nil))
+}
+
+func formatArgs(args []interface{}) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = internal.String(internal.AppendArg(nil, arg))
+	}
+	return out
+}
+
+// redactMask returns which args are redacted by the global rules and the
+// rules or nil if no args are redacted.
+func redactMask(cmd Cmder, name string, args []string, rules []AuditRule) []bool {
+	var mask []bool
+	redact := func(start, end int) {
+		if mask == nil {
+			mask = make([]bool, len(args))
+		}
+		for i := start; i < end && i < len(args); i++ {
+			mask[i] = true
+		}
+	}
+
+	// Arguments that are always redacted.
+	if i := sensitiveArgPos(name, args); i > 0 {
+		redact(i, len(args))
+	}
+
+	global := getRedactRules()
+	if len(global) == 0 && len(rules) == 0 {
+		return mask
+	}
+
+	// The arguments after the name (and the subcommand).
+	nameLen := strings.Count(name, " ") + 1
+	keyPos := cmdFirstKeyPos(cmd, nil)
+	if keyPos == 0 {
+		keyPos = nameLen
+	}
+	if keyPos >= len(args) {
+		return mask
+	}
+	key := args[keyPos]
+
+	for _, rules := range [][]AuditRule{global, rules} {
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.match(name, key) {
+				continue
+			}
+			redact(nameLen, keyPos)
+			redact(keyPos+1, len(args))
+			if rule.RedactKey {
+				redact(keyPos, keyPos+1)
+			}
+		}
+	}
+	return mask
+}
+
+// sensitiveArgPos returns the position of the first argument that contains
+// a password or 0.
+func sensitiveArgPos(name string, args []string) int {
+	switch name {
+	case "auth":
+		return 1
+	case "acl setuser":
+		return 3
+	case "hello", "migrate":
+		for i, arg := range args {
+			if s := strings.ToLower(arg); s == "auth" || s == "auth2" {
+				return i + 1
+			}
+		}
+	case "config set":
+		for _, arg := range args[1:] {
+			if s := strings.ToLower(arg); s == "requirepass" || s == "masterauth" {
+				return 2
+			}
+		}
+	}
+	return 0
+}
+
+// redactErrString replaces the redacted args that are quoted in the error
+// message, as Redis quotes the arguments with ' or `.
+func redactErrString(msg string, args []string, mask []bool) string {
+	for i, redacted := range mask {
+		if !redacted || args[i] == "" {
+			continue
+		}
+		msg = strings.ReplaceAll(msg, "'"+args[i]+"'", "'?'")
+		msg = strings.ReplaceAll(msg, "`"+args[i]+"`", "`?`")
+	}
+	return msg
+}
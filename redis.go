@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -29,12 +31,68 @@ type Hook interface {
 	AfterProcessPipeline(ctx context.Context, cmds []Cmder) error
 }
 
+// PipelineCmdHook is an optional interface a Hook can implement to observe
+// every command of a pipeline individually, e.g. to create a tracing span per
+// command. BeforeProcessPipelineCmd is called for every command before the
+// pipeline is sent and AfterProcessPipelineCmd as soon as the reply of the
+// command is read, so the time between the calls includes waiting for the
+// replies of the preceding commands. The calls for different commands may
+// happen concurrently when the pipeline is sent to several nodes.
+type PipelineCmdHook interface {
+	BeforeProcessPipelineCmd(ctx context.Context, cmd Cmder) context.Context
+	AfterProcessPipelineCmd(ctx context.Context, cmd Cmder)
+}
+
+// ProcessMiddleware is called for every command before the hooks, e.g. to
+// enforce a policy. It can inspect the command, rewrite it with SetArgs or
+// reject it by returning an error, which is then returned by the command
+// without sending it. The commands of pipelines and transactions are passed
+// one by one, and a rejected command fails the whole pipeline.
+type ProcessMiddleware func(ctx context.Context, cmd Cmder) error
+
+// HookOptions are used to configure how RegisterHook adds a hook.
+type HookOptions struct {
+	// Priority orders the hooks. The hooks with a higher priority are called
+	// before the hooks with a lower priority in BeforeProcess and after them
+	// in AfterProcess, i.e. they wrap them. The hooks with the same priority
+	// are called in the order they are added. AddHook uses priority 0.
+	Priority int
+}
+
+// HookHandle is returned by RegisterHook to remove the hook.
+type HookHandle struct {
+	id        uint64
+	hooks     *hooks
+	connHooks *connHooks
+}
+
+// Remove removes the hook from the client it was registered with. The
+// clones of the client created before, e.g. with WithContext, keep the
+// hook, but the hooks of the connections are removed from all the clones.
+// Like AddHook, it should not be called concurrently with the commands.
+func (h *HookHandle) Remove() {
+	h.hooks.removeHook(h.id)
+	h.connHooks.remove(h.id)
+}
+
+// hookID is the last id of a registered hook.
+var hookID uint64
+
 type hooks struct {
-	hooks []Hook
+	hooks       []Hook
+	regs        []hookReg // the registrations of the hooks
+	middlewares []ProcessMiddleware
+}
+
+type hookReg struct {
+	id       uint64
+	priority int
 }
 
 func (hs *hooks) lock() {
 	hs.hooks = hs.hooks[:len(hs.hooks):len(hs.hooks)]
+	hs.regs = hs.regs[:len(hs.regs):len(hs.regs)]
+	hs.middlewares = hs.middlewares[:len(hs.middlewares):len(hs.middlewares)]
 }
 
 func (hs hooks) clone() hooks {
@@ -44,12 +102,90 @@ func (hs hooks) clone() hooks {
 }
 
 func (hs *hooks) AddHook(hook Hook) {
-	hs.hooks = append(hs.hooks, hook)
+	hs.addHook(hook, 0)
+}
+
+// RegisterHook adds the hook like AddHook, but in the order of the
+// priority, and returns a handle to remove it.
+func (hs *hooks) RegisterHook(hook Hook, opt *HookOptions) *HookHandle {
+	return &HookHandle{
+		id:    hs.addHook(hook, hookPriority(opt)),
+		hooks: hs,
+	}
+}
+
+func hookPriority(opt *HookOptions) int {
+	if opt == nil {
+		return 0
+	}
+	return opt.Priority
+}
+
+// addHook inserts the hook after the hooks with the same or a higher
+// priority. The slices are copied, because they can be shared with clones.
+func (hs *hooks) addHook(hook Hook, priority int) uint64 {
+	id := atomic.AddUint64(&hookID, 1)
+
+	i := len(hs.regs)
+	for i > 0 && hs.regs[i-1].priority < priority {
+		i--
+	}
+
+	hooks := make([]Hook, 0, len(hs.hooks)+1)
+	hooks = append(hooks, hs.hooks[:i]...)
+	hooks = append(hooks, hook)
+	hs.hooks = append(hooks, hs.hooks[i:]...)
+
+	regs := make([]hookReg, 0, len(hs.regs)+1)
+	regs = append(regs, hs.regs[:i]...)
+	regs = append(regs, hookReg{id: id, priority: priority})
+	hs.regs = append(regs, hs.regs[i:]...)
+
+	return id
+}
+
+func (hs *hooks) removeHook(id uint64) {
+	for i, reg := range hs.regs {
+		if reg.id != id {
+			continue
+		}
+
+		hooks := make([]Hook, 0, len(hs.hooks)-1)
+		hooks = append(hooks, hs.hooks[:i]...)
+		hs.hooks = append(hooks, hs.hooks[i+1:]...)
+
+		regs := make([]hookReg, 0, len(hs.regs)-1)
+		regs = append(regs, hs.regs[:i]...)
+		hs.regs = append(regs, hs.regs[i+1:]...)
+		return
+	}
+}
+
+// AddMiddleware adds the middleware that is called for every command before
+// the hooks. Middlewares are called in the order they are added.
+func (hs *hooks) AddMiddleware(mw ProcessMiddleware) {
+	hs.middlewares = append(hs.middlewares, mw)
+}
+
+func (hs hooks) processMiddlewares(ctx context.Context, cmds ...Cmder) error {
+	for _, mw := range hs.middlewares {
+		for _, cmd := range cmds {
+			if err := mw(ctx, cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (hs hooks) process(
 	ctx context.Context, cmd Cmder, fn func(context.Context, Cmder) error,
 ) error {
+	if err := hs.processMiddlewares(ctx, cmd); err != nil {
+		cmd.SetErr(err)
+		return err
+	}
+
 	if len(hs.hooks) == 0 {
 		err := fn(ctx, cmd)
 		cmd.SetErr(err)
@@ -83,6 +219,16 @@ func (hs hooks) process(
 
 func (hs hooks) processPipeline(
 	ctx context.Context, cmds []Cmder, fn func(context.Context, []Cmder) error,
+) error {
+	if err := hs.processMiddlewares(ctx, cmds...); err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+	return hs._processPipeline(ctx, cmds, fn)
+}
+
+func (hs hooks) _processPipeline(
+	ctx context.Context, cmds []Cmder, fn func(context.Context, []Cmder) error,
 ) error {
 	if len(hs.hooks) == 0 {
 		err := fn(ctx, cmds)
@@ -100,7 +246,13 @@ func (hs hooks) processPipeline(
 	}
 
 	if retErr == nil {
-		retErr = fn(ctx, cmds)
+		cmdHooks := hs.pipelineCmdHooks(ctx, cmds)
+		if cmdHooks != nil {
+			retErr = fn(context.WithValue(ctx, pipelineCmdHooksKey{}, cmdHooks), cmds)
+			cmdHooks.afterAll()
+		} else {
+			retErr = fn(ctx, cmds)
+		}
 	}
 
 	for hookIndex--; hookIndex >= 0; hookIndex-- {
@@ -113,27 +265,115 @@ func (hs hooks) processPipeline(
 	return retErr
 }
 
+func (hs hooks) pipelineCmdHooks(ctx context.Context, cmds []Cmder) *pipelineCmdHooks {
+	var cmdHooks []PipelineCmdHook
+	for _, h := range hs.hooks {
+		if h, ok := h.(PipelineCmdHook); ok {
+			cmdHooks = append(cmdHooks, h)
+		}
+	}
+	if len(cmdHooks) == 0 {
+		return nil
+	}
+
+	h := &pipelineCmdHooks{
+		parent: pipelineCmdHooksFromContext(ctx),
+		hooks:  cmdHooks,
+		index:  make(map[Cmder]int, len(cmds)),
+		cmds:   cmds,
+		ctxs:   make([]context.Context, len(cmds)),
+		done:   make([]uint32, len(cmds)),
+	}
+	for i, cmd := range cmds {
+		h.index[cmd] = i
+		cmdCtx := ctx
+		for _, hook := range cmdHooks {
+			cmdCtx = hook.BeforeProcessPipelineCmd(cmdCtx, cmd)
+		}
+		h.ctxs[i] = cmdCtx
+	}
+	return h
+}
+
 func (hs hooks) processTxPipeline(
 	ctx context.Context, cmds []Cmder, fn func(context.Context, []Cmder) error,
 ) error {
+	if err := hs.processMiddlewares(ctx, cmds...); err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
 	cmds = wrapMultiExec(ctx, cmds)
-	return hs.processPipeline(ctx, cmds, fn)
+	return hs._processPipeline(ctx, cmds, fn)
+}
+
+type pipelineCmdHooksKey struct{}
+
+// pipelineCmdHooks calls PipelineCmdHook methods for the commands
+// of a single pipeline.
+type pipelineCmdHooks struct {
+	parent *pipelineCmdHooks // hooks of the enclosing client, e.g. ClusterClient
+
+	hooks []PipelineCmdHook
+	index map[Cmder]int
+	cmds  []Cmder
+	ctxs  []context.Context
+	done  []uint32
+}
+
+func pipelineCmdHooksFromContext(ctx context.Context) *pipelineCmdHooks {
+	h, _ := ctx.Value(pipelineCmdHooksKey{}).(*pipelineCmdHooks)
+	return h
+}
+
+// after is called when the reply of the cmd is read.
+func (h *pipelineCmdHooks) after(cmd Cmder) {
+	for ; h != nil; h = h.parent {
+		if i, ok := h.index[cmd]; ok {
+			h.afterAt(i)
+		}
+	}
+}
+
+// afterAll is called for the commands whose replies were never read,
+// e.g. because of a network error.
+func (h *pipelineCmdHooks) afterAll() {
+	for i := range h.cmds {
+		h.afterAt(i)
+	}
+}
+
+func (h *pipelineCmdHooks) afterAt(i int) {
+	if !atomic.CompareAndSwapUint32(&h.done[i], 0, 1) {
+		return
+	}
+	for j := len(h.hooks) - 1; j >= 0; j-- {
+		h.hooks[j].AfterProcessPipelineCmd(h.ctxs[i], h.cmds[i])
+	}
 }
 
 //------------------------------------------------------------------------------
 
 type baseClient struct {
-	opt      *Options
-	connPool pool.Pooler
+	opt       *Options
+	connPool  pool.Pooler
+	cmdStats  *commandStats
+	errStats  *errorStats
+	connHooks *connHooks
 
 	onClose func() error // hook called when client is closed
 }
 
-func newBaseClient(opt *Options, connPool pool.Pooler) *baseClient {
-	return &baseClient{
-		opt:      opt,
-		connPool: connPool,
+func newBaseClient(opt *Options, connPool pool.Pooler, connHooks *connHooks) *baseClient {
+	c := &baseClient{
+		opt:       opt,
+		connPool:  connPool,
+		errStats:  new(errorStats),
+		connHooks: connHooks,
+	}
+	if opt.CommandStats {
+		c.cmdStats = newCommandStats()
 	}
+	return c
 }
 
 func (c *baseClient) clone() *baseClient {
@@ -145,6 +385,28 @@ func (c *baseClient) withTimeout(timeout time.Duration) *baseClient {
 	opt := c.opt.clone()
 	opt.ReadTimeout = timeout
 	opt.WriteTimeout = timeout
+	opt.timeouts = newSocketTimeouts(timeout, timeout)
+
+	clone := c.clone()
+	clone.opt = opt
+
+	return clone
+}
+
+func (c *baseClient) withDB(db int) *baseClient {
+	opt := c.opt.clone()
+	opt.DB = db
+
+	clone := c.clone()
+	clone.opt = opt
+
+	return clone
+}
+
+func (c *baseClient) withKeyPrefix(prefix string) *baseClient {
+	opt := c.opt.clone()
+	opt.KeyPrefix = prefix
+	opt.prefixer = c.opt.prefixer.withPrefix(prefix)
 
 	clone := c.clone()
 	clone.opt = opt
@@ -171,44 +433,125 @@ func (c *baseClient) newConn(ctx context.Context) (*pool.Conn, error) {
 	return cn, nil
 }
 
-func (c *baseClient) getConn(ctx context.Context) (*pool.Conn, error) {
+func (c *baseClient) getConn(ctx context.Context, op limitOp) (*pool.Conn, error) {
+	if err := c.allow(ctx, op); err != nil {
+		return nil, err
+	}
+
+	cn, err := c._getConn(ctx)
+	if err != nil {
+		c.reportResult(op, err)
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// limitOp is the operation that is allowed by Limiter, i.e. a command or
+// a pipeline.
+type limitOp struct {
+	name   string
+	weight int
+}
+
+func cmdLimitOp(cmd Cmder) limitOp {
+	return limitOp{name: cmd.Name(), weight: 1}
+}
+
+func pipelineLimitOp(cmds []Cmder) limitOp {
+	return limitOp{name: "pipeline", weight: len(cmds)}
+}
+
+// allow calls Allow of Limiter and the circuit breaker.
+func (c *baseClient) allow(ctx context.Context, op limitOp) error {
+	if c.opt.breaker != nil {
+		if err := c.opt.breaker.Allow(); err != nil {
+			return err
+		}
+	}
 	if c.opt.Limiter != nil {
-		err := c.opt.Limiter.Allow()
+		var err error
+		if l, ok := c.opt.Limiter.(CmdLimiter); ok {
+			err = l.AllowCmd(ctx, op.name, op.weight)
+		} else {
+			err = c.opt.Limiter.Allow()
+		}
 		if err != nil {
-			return nil, err
+			if c.opt.breaker != nil {
+				c.opt.breaker.cancel()
+			}
+			return err
 		}
 	}
+	return nil
+}
 
-	cn, err := c._getConn(ctx)
-	if err != nil {
-		if c.opt.Limiter != nil {
+// reportResult calls ReportResult of Limiter and the circuit breaker.
+func (c *baseClient) reportResult(op limitOp, err error) {
+	if c.opt.Limiter != nil {
+		if l, ok := c.opt.Limiter.(CmdLimiter); ok {
+			l.ReportCmdResult(op.name, op.weight, err)
+		} else {
 			c.opt.Limiter.ReportResult(err)
 		}
-		return nil, err
+	}
+	if c.opt.breaker != nil {
+		c.opt.breaker.ReportResult(err)
+	}
+}
+
+func (c *baseClient) _getConn(ctx context.Context) (*pool.Conn, error) {
+	if len(c.connHooks.get()) == 0 {
+		return c.getInitedConn(ctx)
 	}
 
+	start := time.Now()
+	var isNew bool
+	cn, err := c.connPool.Get(ctx)
+	if err == nil {
+		isNew = !cn.Inited
+		err = c.initPooledConn(ctx, cn)
+	}
+	c.connHooks.afterConnAcquire(ctx, &ConnAcquireEvent{
+		Addr: c.getAddr(),
+		Wait: time.Since(start),
+		New:  isNew,
+		Err:  err,
+	})
+	if err != nil {
+		return nil, err
+	}
 	return cn, nil
 }
 
-func (c *baseClient) _getConn(ctx context.Context) (*pool.Conn, error) {
+func (c *baseClient) getInitedConn(ctx context.Context) (*pool.Conn, error) {
 	cn, err := c.connPool.Get(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.initPooledConn(ctx, cn); err != nil {
+		return nil, err
+	}
+	return cn, nil
+}
 
+func (c *baseClient) initPooledConn(ctx context.Context, cn *pool.Conn) error {
 	if cn.Inited {
-		return cn, nil
+		if err := c.reauth(ctx, cn); err != nil {
+			return err
+		}
+		return c.selectDB(ctx, cn)
 	}
 
 	if err := c.initConn(ctx, cn); err != nil {
 		c.connPool.Remove(ctx, cn, err)
 		if err := errors.Unwrap(err); err != nil {
-			return nil, err
+			return err
 		}
-		return nil, err
+		return err
 	}
 
-	return cn, nil
+	return nil
 }
 
 func (c *baseClient) initConn(ctx context.Context, cn *pool.Conn) error {
@@ -216,23 +559,47 @@ func (c *baseClient) initConn(ctx context.Context, cn *pool.Conn) error {
 		return nil
 	}
 	cn.Inited = true
+	cn.DB = c.opt.DB
+
+	if enc := newEncoding(c.opt.Codec, c.opt.TimeEncoding); enc != nil {
+		cn.SetEncoding(enc)
+	}
+
+	username, password := c.opt.Username, c.opt.Password
+	switch {
+	case c.opt.TokenAuth != nil:
+		token, gen, err := c.opt.TokenAuth.credentials(ctx)
+		if err != nil {
+			return err
+		}
+		username, password = token.Username, token.Password
+		cn.AuthGen = gen
+	case c.opt.CredentialsProvider != nil:
+		var err error
+		username, password, err = c.opt.CredentialsProvider(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
-	if c.opt.Password == "" &&
+	if password == "" &&
 		c.opt.DB == 0 &&
 		!c.opt.readOnly &&
+		c.opt.ClientName == "" &&
+		!c.opt.EnableIdentity &&
 		c.opt.OnConnect == nil {
 		return nil
 	}
 
-	connPool := pool.NewSingleConnPool(c.connPool, cn)
-	conn := newConn(ctx, c.opt, connPool)
+	conn := c.newSetupConn(ctx, cn)
 
-	_, err := conn.Pipelined(ctx, func(pipe Pipeliner) error {
-		if c.opt.Password != "" {
-			if c.opt.Username != "" {
-				pipe.AuthACL(ctx, c.opt.Username, c.opt.Password)
+	var setInfo []Cmder
+	cmds, err := conn.Pipelined(ctx, func(pipe Pipeliner) error {
+		if password != "" {
+			if username != "" {
+				pipe.AuthACL(ctx, username, password)
 			} else {
-				pipe.Auth(ctx, c.opt.Password)
+				pipe.Auth(ctx, password)
 			}
 		}
 
@@ -244,10 +611,29 @@ func (c *baseClient) initConn(ctx context.Context, cn *pool.Conn) error {
 			pipe.ReadOnly(ctx)
 		}
 
+		if c.opt.ClientName != "" {
+			pipe.ClientSetName(ctx, c.opt.ClientName)
+		}
+
+		if c.opt.EnableIdentity {
+			libName := "go-redis"
+			if c.opt.IdentitySuffix != "" {
+				libName += "(" + c.opt.IdentitySuffix + ")"
+			}
+			setInfo = append(setInfo,
+				pipe.ClientSetInfo(ctx, "lib-name", libName),
+				pipe.ClientSetInfo(ctx, "lib-ver", Version()))
+		}
+
 		return nil
 	})
 	if err != nil {
-		return err
+		// CLIENT SETINFO is not supported by Redis < 7.2.
+		for _, cmd := range cmds {
+			if err := cmd.Err(); err != nil && (!isRedisError(err) || !cmdIn(cmd, setInfo)) {
+				return err
+			}
+		}
 	}
 
 	if c.opt.OnConnect != nil {
@@ -256,28 +642,98 @@ func (c *baseClient) initConn(ctx context.Context, cn *pool.Conn) error {
 	return nil
 }
 
-func (c *baseClient) releaseConn(ctx context.Context, cn *pool.Conn, err error) {
-	if c.opt.Limiter != nil {
-		c.opt.Limiter.ReportResult(err)
+// selectDB selects the DB of the client on the cn that was used last by
+// a client with another DB, e.g. created with WithDB.
+func (c *baseClient) selectDB(ctx context.Context, cn *pool.Conn) error {
+	if cn.DB == c.opt.DB {
+		return nil
+	}
+	cn.DB = c.opt.DB
+
+	conn := c.newSetupConn(ctx, cn)
+	if err := conn.Select(ctx, c.opt.DB).Err(); err != nil {
+		c.connPool.Remove(ctx, cn, err)
+		return err
+	}
+	return nil
+}
+
+// newSetupConn returns a Conn for the commands that set up the cn, e.g.
+// AUTH and SELECT. They bypass Limiter and the circuit breaker, which
+// already allowed the operation the cn is acquired for.
+func (c *baseClient) newSetupConn(ctx context.Context, cn *pool.Conn) *Conn {
+	opt := *c.opt
+	opt.Limiter = nil
+	opt.breaker = nil
+	return newConn(ctx, &opt, pool.NewSingleConnPool(c.connPool, cn))
+}
+
+// trackDB records the DB selected on the cn by the SELECT cmds, e.g. sent
+// with Conn.Select, so selectDB selects the DB of the client again when the
+// cn is used next by another client. Conn and Tx keep using the selected DB.
+func (c *baseClient) trackDB(cn *pool.Conn, cmds ...Cmder) {
+	for _, cmd := range cmds {
+		if cmd.Name() != "select" || cmd.Err() != nil {
+			continue
+		}
+		db, err := strconv.Atoi(cmd.stringArg(1))
+		if err != nil {
+			continue
+		}
+		cn.DB = db
+
+		if _, ok := c.connPool.(*pool.StickyConnPool); ok && c.opt.DB != db {
+			opt := *c.opt
+			opt.DB = db
+			c.opt = &opt
+		}
 	}
+}
 
-	if isBadConn(err, false, c.opt.Addr) {
+func cmdIn(cmd Cmder, cmds []Cmder) bool {
+	for _, c := range cmds {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *baseClient) releaseConn(ctx context.Context, cn *pool.Conn, op limitOp, err error) {
+	c.reportResult(op, err)
+
+	removed := isBadConn(err, false, c.opt.Addr)
+	if removed {
 		c.connPool.Remove(ctx, cn, err)
 	} else {
 		c.connPool.Put(ctx, cn)
 	}
+
+	if hooks := c.connHooks.get(); len(hooks) > 0 {
+		c.connHooks.afterConnRelease(ctx, &ConnReleaseEvent{
+			Addr:    c.getAddr(),
+			Removed: removed,
+			Err:     err,
+		})
+		if removed {
+			afterReconnect(ctx, hooks, &ReconnectEvent{
+				Addr: c.getAddr(),
+				Err:  err,
+			})
+		}
+	}
 }
 
 func (c *baseClient) withConn(
-	ctx context.Context, fn func(context.Context, *pool.Conn) error,
+	ctx context.Context, op limitOp, fn func(context.Context, *pool.Conn) error,
 ) error {
-	cn, err := c.getConn(ctx)
+	cn, err := c.getConn(ctx, op)
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		c.releaseConn(ctx, cn, err)
+		c.releaseConn(ctx, cn, op, err)
 	}()
 
 	done := ctx.Done() //nolint:ifshort
@@ -304,37 +760,68 @@ func (c *baseClient) withConn(
 }
 
 func (c *baseClient) process(ctx context.Context, cmd Cmder) error {
-	var lastErr error
-	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
-		attempt := attempt
+	if c.cmdStats == nil {
+		return c.processWithRetries(ctx, cmd)
+	}
 
-		retry, err := c._process(ctx, cmd, attempt)
+	start := time.Now()
+	err := c.processWithRetries(ctx, cmd)
+	c.cmdStats.record(cmd.FullName(), time.Since(start), err)
+	return err
+}
+
+func (c *baseClient) processWithRetries(ctx context.Context, cmd Cmder) error {
+	if p := c.opt.prefixer; p != nil {
+		if err := p.prepare(ctx, c, []Cmder{cmd}); err != nil {
+			return err
+		}
+		defer p.strip(cmd)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := c._process(ctx, cmd)
+		c.errStats.record(err)
 		if err == nil || !retry {
 			return err
 		}
 
-		lastErr = err
+		if ok, err := c.retrySleep(ctx, &RetryEvent{
+			Cmd:     cmd,
+			Attempt: attempt,
+			Err:     err,
+		}); !ok {
+			return err
+		}
 	}
-	return lastErr
 }
 
-func (c *baseClient) _process(ctx context.Context, cmd Cmder, attempt int) (bool, error) {
-	if attempt > 0 {
-		if err := internal.Sleep(ctx, c.retryBackoff(attempt)); err != nil {
-			return false, err
-		}
+// retrySleep asks the retry policy whether to retry after event.Err and, if
+// so, calls RetryHook hooks and waits for the retry backoff. It returns
+// event.Err or the context error if the command should not be retried.
+func (c *baseClient) retrySleep(ctx context.Context, event *RetryEvent) (bool, error) {
+	backoff, ok := c.opt.retry(event.Attempt, event.Err)
+	if !ok {
+		return false, event.Err
 	}
+	event.Backoff = backoff
+	beforeRetry(ctx, c.connHooks.get(), event)
+	if err := internal.Sleep(ctx, event.Backoff); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
+func (c *baseClient) _process(ctx context.Context, cmd Cmder) (bool, error) {
 	retryTimeout := uint32(1)
-	err := c.withConn(ctx, func(ctx context.Context, cn *pool.Conn) error {
-		err := cn.WithWriter(ctx, c.opt.WriteTimeout, func(wr *proto.Writer) error {
-			return writeCmd(wr, cmd)
+	err := c.withConn(ctx, cmdLimitOp(cmd), func(ctx context.Context, cn *pool.Conn) error {
+		err := cn.WithWriter(ctx, timeoutFromContext(ctx, c.opt.writeTimeout()), func(wr *proto.Writer) error {
+			return c.writeCmd(wr, cmd)
 		})
 		if err != nil {
 			return err
 		}
 
-		err = cn.WithReader(ctx, c.cmdTimeout(cmd), cmd.readReply)
+		err = cn.WithReader(ctx, c.cmdTimeout(ctx, cmd), cmd.readReply)
 		if err != nil {
 			if cmd.readTimeout() == nil {
 				atomic.StoreUint32(&retryTimeout, 1)
@@ -342,6 +829,7 @@ func (c *baseClient) _process(ctx context.Context, cmd Cmder, attempt int) (bool
 			return err
 		}
 
+		c.trackDB(cn, cmd)
 		return nil
 	})
 	if err == nil {
@@ -352,11 +840,7 @@ func (c *baseClient) _process(ctx context.Context, cmd Cmder, attempt int) (bool
 	return retry, err
 }
 
-func (c *baseClient) retryBackoff(attempt int) time.Duration {
-	return internal.RetryBackoff(attempt, c.opt.MinRetryBackoff, c.opt.MaxRetryBackoff)
-}
-
-func (c *baseClient) cmdTimeout(cmd Cmder) time.Duration {
+func (c *baseClient) cmdTimeout(ctx context.Context, cmd Cmder) time.Duration {
 	if timeout := cmd.readTimeout(); timeout != nil {
 		t := *timeout
 		if t == 0 {
@@ -364,7 +848,30 @@ func (c *baseClient) cmdTimeout(cmd Cmder) time.Duration {
 		}
 		return t + 10*time.Second
 	}
-	return c.opt.ReadTimeout
+	return timeoutFromContext(ctx, c.opt.readTimeout())
+}
+
+type timeoutKey struct{}
+
+// WithTimeout returns a copy of ctx that overrides ReadTimeout and
+// WriteTimeout of the client for the commands and the pipelines processed
+// with the context, e.g. for a single heavy command:
+//
+//	vals, err := rdb.ZRangeByScore(redis.WithTimeout(ctx, time.Minute), "zset", opt).Result()
+//
+// Unlike context.WithTimeout, the timeout applies to every network read and
+// write, including the retries. Zero timeout disables the timeouts. The
+// timeouts of blocking commands, e.g. BLPOP, are not changed.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// timeoutFromContext returns the timeout set with WithTimeout or def.
+func timeoutFromContext(ctx context.Context, def time.Duration) time.Duration {
+	if timeout, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return def
 }
 
 // Close closes the client, releasing any open resources.
@@ -401,7 +908,16 @@ type pipelineProcessor func(context.Context, *pool.Conn, []Cmder) (bool, error)
 func (c *baseClient) generalProcessPipeline(
 	ctx context.Context, cmds []Cmder, p pipelineProcessor,
 ) error {
+	if prefixer := c.opt.prefixer; prefixer != nil {
+		if err := prefixer.prepare(ctx, c, cmds); err != nil {
+			setCmdsErr(cmds, err)
+			return err
+		}
+		defer prefixer.strip(cmds...)
+	}
+
 	err := c._generalProcessPipeline(ctx, cmds, p)
+	c.errStats.recordCmds(cmds)
 	if err != nil {
 		setCmdsErr(cmds, err)
 		return err
@@ -412,47 +928,55 @@ func (c *baseClient) generalProcessPipeline(
 func (c *baseClient) _generalProcessPipeline(
 	ctx context.Context, cmds []Cmder, p pipelineProcessor,
 ) error {
-	var lastErr error
-	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
-		if attempt > 0 {
-			if err := internal.Sleep(ctx, c.retryBackoff(attempt)); err != nil {
-				return err
-			}
-		}
-
+	for attempt := 1; ; attempt++ {
 		var canRetry bool
-		lastErr = c.withConn(ctx, func(ctx context.Context, cn *pool.Conn) error {
+		lastErr := c.withConn(ctx, pipelineLimitOp(cmds), func(ctx context.Context, cn *pool.Conn) error {
 			var err error
 			canRetry, err = p(ctx, cn, cmds)
 			return err
 		})
+		if !isRedisError(lastErr) {
+			c.errStats.record(lastErr)
+		}
 		if lastErr == nil || !canRetry || !shouldRetry(lastErr, true) {
 			return lastErr
 		}
+
+		if ok, err := c.retrySleep(ctx, &RetryEvent{
+			Cmds:    cmds,
+			Attempt: attempt,
+			Err:     lastErr,
+		}); !ok {
+			return err
+		}
 	}
-	return lastErr
 }
 
 func (c *baseClient) pipelineProcessCmds(
 	ctx context.Context, cn *pool.Conn, cmds []Cmder,
 ) (bool, error) {
-	err := cn.WithWriter(ctx, c.opt.WriteTimeout, func(wr *proto.Writer) error {
-		return writeCmds(wr, cmds)
+	err := cn.WithWriter(ctx, timeoutFromContext(ctx, c.opt.writeTimeout()), func(wr *proto.Writer) error {
+		return c.writeCmds(wr, cmds)
 	})
 	if err != nil {
 		return true, err
 	}
 
-	err = cn.WithReader(ctx, c.opt.ReadTimeout, func(rd *proto.Reader) error {
-		return pipelineReadCmds(rd, cmds)
+	err = cn.WithReader(ctx, timeoutFromContext(ctx, c.opt.readTimeout()), func(rd *proto.Reader) error {
+		return pipelineReadCmds(ctx, rd, cmds)
 	})
+	if err == nil {
+		c.trackDB(cn, cmds...)
+	}
 	return true, err
 }
 
-func pipelineReadCmds(rd *proto.Reader, cmds []Cmder) error {
+func pipelineReadCmds(ctx context.Context, rd *proto.Reader, cmds []Cmder) error {
+	cmdHooks := pipelineCmdHooksFromContext(ctx)
 	for _, cmd := range cmds {
 		err := cmd.readReply(rd)
 		cmd.SetErr(err)
+		cmdHooks.after(cmd)
 		if err != nil && !isRedisError(err) {
 			return err
 		}
@@ -463,14 +987,14 @@ func pipelineReadCmds(rd *proto.Reader, cmds []Cmder) error {
 func (c *baseClient) txPipelineProcessCmds(
 	ctx context.Context, cn *pool.Conn, cmds []Cmder,
 ) (bool, error) {
-	err := cn.WithWriter(ctx, c.opt.WriteTimeout, func(wr *proto.Writer) error {
-		return writeCmds(wr, cmds)
+	err := cn.WithWriter(ctx, timeoutFromContext(ctx, c.opt.writeTimeout()), func(wr *proto.Writer) error {
+		return c.writeCmds(wr, cmds)
 	})
 	if err != nil {
 		return true, err
 	}
 
-	err = cn.WithReader(ctx, c.opt.ReadTimeout, func(rd *proto.Reader) error {
+	err = cn.WithReader(ctx, timeoutFromContext(ctx, c.opt.readTimeout()), func(rd *proto.Reader) error {
 		statusCmd := cmds[0].(*StatusCmd)
 		// Trim multi and exec.
 		cmds = cmds[1 : len(cmds)-1]
@@ -480,8 +1004,11 @@ func (c *baseClient) txPipelineProcessCmds(
 			return err
 		}
 
-		return pipelineReadCmds(rd, cmds)
+		return pipelineReadCmds(ctx, rd, cmds)
 	})
+	if err == nil {
+		c.trackDB(cn, cmds...)
+	}
 	return false, err
 }
 
@@ -502,12 +1029,21 @@ func txPipelineReadQueued(rd *proto.Reader, statusCmd *StatusCmd, cmds []Cmder)
 		return err
 	}
 
-	for range cmds {
-		if err := statusCmd.readReply(rd); err != nil && !isRedisError(err) {
-			return err
+	for _, cmd := range cmds {
+		if err := statusCmd.readReply(rd); err != nil {
+			if !isRedisError(err) {
+				return err
+			}
+			// Keep the reason why the command was rejected.
+			cmd.SetErr(err)
 		}
 	}
 
+	return txPipelineReadExec(rd)
+}
+
+// txPipelineReadExec reads the header of the EXEC reply.
+func txPipelineReadExec(rd *proto.Reader) error {
 	// Parse number of replies.
 	line, err := rd.ReadLine()
 	if err != nil {
@@ -519,7 +1055,11 @@ func txPipelineReadQueued(rd *proto.Reader, statusCmd *StatusCmd, cmds []Cmder)
 
 	switch line[0] {
 	case proto.ErrorReply:
-		return proto.ParseErrorReply(line)
+		err := proto.ParseErrorReply(line)
+		if strings.HasPrefix(err.Error(), "EXECABORT ") {
+			return TxAbortedErr
+		}
+		return err
 	case proto.ArrayReply:
 		// ok
 	default:
@@ -546,8 +1086,9 @@ type Client struct {
 func NewClient(opt *Options) *Client {
 	opt.init()
 
+	connHooks := new(connHooks)
 	c := Client{
-		baseClient: newBaseClient(opt, newConnPool(opt)),
+		baseClient: newBaseClient(opt, newConnPool(opt, connHooks), connHooks),
 		ctx:        context.Background(),
 	}
 	c.cmdable = c.Process
@@ -568,6 +1109,47 @@ func (c *Client) WithTimeout(timeout time.Duration) *Client {
 	return clone
 }
 
+// WithDB returns a copy of the client that uses the DB. The copy shares the
+// connection pool with the client, and SELECT is sent on the connections
+// that were used last with another DB, including the DB selected with
+// Conn.Select or Do. Closing either client closes the pool.
+func (c *Client) WithDB(db int) *Client {
+	clone := c.clone()
+	clone.baseClient = c.baseClient.withDB(db)
+	return clone
+}
+
+// WithKeyPrefix returns a copy of the client that uses the prefix instead
+// of Options.KeyPrefix, e.g. to serve a tenant. The copy shares the
+// connection pool with the client. Empty prefix disables the prefix.
+func (c *Client) WithKeyPrefix(prefix string) *Client {
+	clone := c.clone()
+	clone.baseClient = c.baseClient.withKeyPrefix(prefix)
+	return clone
+}
+
+// AddHook adds the hook to the client. Hooks that implement DialHook,
+// ConnHook, RetryHook or ReconnectHook are also added to the clones of the
+// client created with WithContext and WithTimeout, because they share the
+// connection pool. To observe the connections of ClusterClient and Ring,
+// add the hooks to the node clients, e.g. using ClusterOptions.OnNewNode.
+func (c *Client) AddHook(hook Hook) {
+	id := c.hooks.addHook(hook, 0)
+	c.connHooks.add(id, hook)
+}
+
+// RegisterHook adds the hook like AddHook, but in the order of the
+// priority, and returns a handle to remove it.
+func (c *Client) RegisterHook(hook Hook, opt *HookOptions) *HookHandle {
+	id := c.hooks.addHook(hook, hookPriority(opt))
+	c.connHooks.add(id, hook)
+	return &HookHandle{
+		id:        id,
+		hooks:     &c.hooks,
+		connHooks: c.connHooks,
+	}
+}
+
 func (c *Client) Context() context.Context {
 	return c.ctx
 }
@@ -582,7 +1164,11 @@ func (c *Client) WithContext(ctx context.Context) *Client {
 }
 
 func (c *Client) Conn(ctx context.Context) *Conn {
-	return newConn(ctx, c.opt, pool.NewStickyConnPool(c.connPool))
+	cn := newConn(ctx, c.opt, pool.NewStickyConnPool(c.connPool))
+	cn.cmdStats = c.cmdStats
+	cn.errStats = c.errStats
+	cn.connHooks = c.connHooks
+	return cn
 }
 
 // Do creates a Cmd from the args and processes the cmd.
@@ -617,6 +1203,21 @@ func (c *Client) PoolStats() *PoolStats {
 	return (*PoolStats)(stats)
 }
 
+// ErrorStats returns the number of errors by type.
+func (c *Client) ErrorStats() *ErrorStats {
+	return c.errStats.stats()
+}
+
+// CommandStats returns latency statistics by command name, e.g. "get" or
+// "cluster info". Commands executed in pipelines are not included. It
+// returns nil unless Options.CommandStats is enabled.
+func (c *Client) CommandStats() map[string]*CommandStats {
+	if c.cmdStats == nil {
+		return nil
+	}
+	return c.cmdStats.stats()
+}
+
 func (c *Client) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
 	return c.Pipeline().Pipelined(ctx, fn)
 }
@@ -625,6 +1226,7 @@ func (c *Client) Pipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
 	}
 	pipe.init()
 	return &pipe
@@ -639,6 +1241,8 @@ func (c *Client) TxPipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processTxPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
+		tx:   true,
 	}
 	pipe.init()
 	return &pipe
@@ -652,6 +1256,7 @@ func (c *Client) pubSub() *PubSub {
 			return c.newConn(ctx)
 		},
 		closeConn: c.connPool.CloseConn,
+		hooks:     c.hooks.clone(),
 	}
 	pubsub.init()
 	return pubsub
@@ -701,6 +1306,27 @@ func (c *Client) PSubscribe(ctx context.Context, channels ...string) *PubSub {
 	return pubsub
 }
 
+// SSubscribe subscribes the client to the specified shard channels.
+// Channels can be omitted to create empty subscription.
+func (c *Client) SSubscribe(ctx context.Context, channels ...string) *PubSub {
+	pubsub := c.pubSub()
+	if len(channels) > 0 {
+		_ = pubsub.SSubscribe(ctx, channels...)
+	}
+	return pubsub
+}
+
+// PublishAndConfirm posts the message to the channel and checks that it is
+// received by at least minReceivers subscribers. Otherwise the message is
+// published again with a backoff until the timeout expires, so subscribers
+// can receive it more than once. It returns the number of receivers and
+// ErrNotEnoughReceivers if there are not enough receivers after the timeout.
+func (c *Client) PublishAndConfirm(
+	ctx context.Context, channel string, message interface{}, minReceivers int64, timeout time.Duration,
+) (int64, error) {
+	return publishAndConfirm(ctx, c, channel, message, minReceivers, timeout)
+}
+
 //------------------------------------------------------------------------------
 
 type conn struct {
@@ -753,6 +1379,7 @@ func (c *Conn) Pipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
 	}
 	pipe.init()
 	return &pipe
@@ -767,6 +1394,8 @@ func (c *Conn) TxPipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processTxPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
+		tx:   true,
 	}
 	pipe.init()
 	return &pipe
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -87,6 +91,31 @@ var _ = Describe("Client", func() {
 		Expect(client.PoolStats()).To(BeAssignableToTypeOf(&redis.PoolStats{}))
 	})
 
+	It("should return command stats", func() {
+		Expect(client.CommandStats()).To(BeNil())
+
+		opt := redisOptions()
+		opt.CommandStats = true
+		client := redis.NewClient(opt)
+		defer client.Close()
+
+		for i := 0; i < 10; i++ {
+			Expect(client.Set(ctx, "key", i, 0).Err()).NotTo(HaveOccurred())
+		}
+		Expect(client.Get(ctx, "missing").Err()).To(Equal(redis.Nil))
+		Expect(client.Incr(ctx, "list").Err()).NotTo(HaveOccurred())
+		Expect(client.LPush(ctx, "list", "a").Err()).To(HaveOccurred())
+
+		stats := client.CommandStats()
+		Expect(stats["set"].Count).To(Equal(uint64(10)))
+		Expect(stats["set"].Errors).To(BeZero())
+		Expect(stats["set"].Percentile(99)).To(BeNumerically(">", 0))
+		Expect(stats["set"].Percentile(99)).To(BeNumerically("<=", stats["set"].Max))
+		Expect(stats["set"].Mean()).To(BeNumerically("<=", stats["set"].Max))
+		Expect(stats["get"].Errors).To(BeZero())
+		Expect(stats["lpush"].Errors).To(Equal(uint64(1)))
+	})
+
 	It("should support custom dialers", func() {
 		custom := redis.NewClient(&redis.Options{
 			Network: "tcp",
@@ -430,6 +459,37 @@ var _ = Describe("Client OnConnect", func() {
 	})
 })
 
+var _ = Describe("Client identity", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		opt := redisOptions()
+		opt.ClientName = "orders-worker"
+		opt.EnableIdentity = true
+		opt.IdentitySuffix = "orders"
+		client = redis.NewClient(opt)
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("sets the client name", func() {
+		name, err := client.ClientGetName(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("orders-worker"))
+	})
+
+	It("sets the library name if supported", func() {
+		list, err := client.ClientList(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ContainSubstring("name=orders-worker"))
+		if strings.Contains(list, "lib-name=") {
+			Expect(list).To(ContainSubstring("lib-name=go-redis(orders) lib-ver=" + redis.Version()))
+		}
+	})
+})
+
 var _ = Describe("Client context cancelation", func() {
 	var opt *redis.Options
 	var client *redis.Client
@@ -454,3 +514,179 @@ var _ = Describe("Client context cancelation", func() {
 		Expect(err).To(BeIdenticalTo(context.Canceled))
 	})
 })
+
+type connEventsHook struct {
+	hook
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *connEventsHook) add(event string) {
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	h.mu.Unlock()
+}
+
+func (h *connEventsHook) Events() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events
+}
+
+func (h *connEventsHook) AfterDial(ctx context.Context, event *redis.DialEvent) {
+	h.add("dial")
+}
+
+func (h *connEventsHook) AfterConnAcquire(ctx context.Context, event *redis.ConnAcquireEvent) {
+	h.add(fmt.Sprintf("acquire new=%t", event.New))
+}
+
+func (h *connEventsHook) AfterConnRelease(ctx context.Context, event *redis.ConnReleaseEvent) {
+	h.add(fmt.Sprintf("release removed=%t", event.Removed))
+}
+
+func (h *connEventsHook) BeforeRetry(ctx context.Context, event *redis.RetryEvent) {
+	h.add(fmt.Sprintf("retry %d: %s", event.Attempt, event.Err))
+}
+
+func (h *connEventsHook) AfterReconnect(ctx context.Context, event *redis.ReconnectEvent) {
+	h.add("reconnect")
+}
+
+var _ = Describe("Client connection hooks", func() {
+	var client *redis.Client
+	var hook *connEventsHook
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		hook = new(connEventsHook)
+		client.AddHook(hook)
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("observes the connection lifecycle", func() {
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		Expect(hook.Events()).To(Equal([]string{
+			"dial",
+			"acquire new=true",
+			"release removed=false",
+			"acquire new=false",
+			"release removed=false",
+		}))
+	})
+
+	It("observes retries and reconnects", func() {
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		// Close the connection on the server side.
+		id, err := client.ClientID(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		killer := redis.NewClient(redisOptions())
+		defer killer.Close()
+		Expect(killer.ClientKillByFilter(ctx, "ID", strconv.FormatInt(id, 10)).Err()).NotTo(HaveOccurred())
+
+		hook.mu.Lock()
+		hook.events = nil
+		hook.mu.Unlock()
+
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+		Expect(hook.Events()).To(Equal([]string{
+			"acquire new=false",
+			"release removed=true",
+			"reconnect",
+			"retry 1: EOF",
+			"dial",
+			"acquire new=true",
+			"release removed=false",
+		}))
+	})
+})
+
+var _ = Describe("Client Monitor", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("streams the processed commands", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Initialize the pooled connection, so SELECT is not monitored.
+		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		ch, err := client.Monitor(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Set(ctx, "monitor-key", "hello world", 0).Err()).NotTo(HaveOccurred())
+
+		var entry *redis.MonitorEntry
+		Eventually(ch).Should(Receive(&entry))
+		Expect(entry.DB).To(Equal(redisOptions().DB))
+		Expect(entry.Args).To(Equal([]string{"set", "monitor-key", "hello world"}))
+		Expect(entry.Time).To(BeTemporally("~", time.Now(), time.Second))
+
+		cancel()
+		Eventually(ch).Should(BeClosed())
+	})
+})
+
+var _ = Describe("Client Codec", func() {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	var client *redis.Client
+
+	BeforeEach(func() {
+		opt := redisOptions()
+		opt.Codec = redis.JSONCodec
+		client = redis.NewClient(opt)
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("marshals and unmarshals values", func() {
+		err := client.Set(ctx, "user", &user{Name: "alice", Age: 30}, 0).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		val, err := client.Get(ctx, "user").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(val).To(Equal(`{"Name":"alice","Age":30}`))
+
+		var u user
+		Expect(client.Get(ctx, "user").Scan(&u)).NotTo(HaveOccurred())
+		Expect(u).To(Equal(user{Name: "alice", Age: 30}))
+	})
+
+	It("supports pipelines and MGET", func() {
+		_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "user1", user{Name: "alice"}, 0)
+			pipe.Set(ctx, "user2", user{Name: "bob"}, 0)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var u1, u2, u3 user
+		err = client.MGet(ctx, "user1", "user2", "user3").ScanValues(&u1, &u2, &u3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u1.Name).To(Equal("alice"))
+		Expect(u2.Name).To(Equal("bob"))
+		Expect(u3).To(Equal(user{}))
+	})
+})
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/farss/redis/v8/internal/hscan"
+	"github.com/farss/redis/v8/internal/proto"
+	"github.com/farss/redis/v8/internal/util"
+)
+
+// scanReply scans the reply val read with sliceParser into dst, which must be
+// a non-nil pointer:
+//   - arrays are scanned into slices, e.g. []string or [][]interface{};
+//   - arrays of field-value pairs, e.g. the replies of CONFIG GET, are
+//     scanned into maps with string keys or into structs using the
+//     `redis:"field"` tags;
+//   - other values are scanned like with StringCmd.Scan;
+//   - nil values leave the destinations unchanged.
+func scanReply(dst interface{}, val interface{}, enc *proto.Encoding) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("redis: Scan(non-pointer %T)", dst)
+	}
+	return scanReplyValue(v.Elem(), val, enc)
+}
+
+func scanReplyValue(v reflect.Value, val interface{}, enc *proto.Encoding) error {
+	if err, ok := val.(error); ok {
+		return err
+	}
+	if val == nil {
+		return nil
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(val))
+		return nil
+	}
+
+	switch val := val.(type) {
+	case string:
+		return scanReplyBytes(v, util.StringToBytes(val), enc)
+	case int64:
+		return scanReplyBytes(v, strconv.AppendInt(nil, val, 10), enc)
+	case []interface{}:
+		return scanReplyArray(v, val, enc)
+	default:
+		return fmt.Errorf("redis: can't scan %T into %s", val, v.Type())
+	}
+}
+
+func scanReplyBytes(v reflect.Value, b []byte, enc *proto.Encoding) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	// Copy the bytes, because the destination can retain them.
+	return proto.ScanEncoding(append([]byte(nil), b...), v.Addr().Interface(), enc)
+}
+
+func scanReplyArray(v reflect.Value, vals []interface{}, enc *proto.Encoding) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return scanReplyArray(v.Elem(), vals, enc)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := scanReplyValue(slice.Index(i), val, enc); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		for i := 0; i < v.Len() && i < len(vals); i++ {
+			if err := scanReplyValue(v.Index(i), vals[i], enc); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || len(vals)%2 != 0 {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(vals)/2))
+		}
+		for i := 0; i < len(vals); i += 2 {
+			key, ok := vals[i].(string)
+			if !ok {
+				return fmt.Errorf("redis: can't scan key of type %T into %s", vals[i], v.Type())
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := scanReplyValue(elem, vals[i+1], enc); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Struct:
+		if len(vals)%2 != 0 {
+			break
+		}
+		strct, err := hscan.Struct(v.Addr().Interface())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(vals); i += 2 {
+			key, ok := vals[i].(string)
+			if !ok {
+				return fmt.Errorf("redis: can't scan key of type %T into %s", vals[i], v.Type())
+			}
+			if field, ok := strct.Field(key); ok {
+				if err := scanReplyValue(field, vals[i+1], enc); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("redis: can't scan array of %d values into %s", len(vals), v.Type())
+}
@@ -0,0 +1,126 @@
+package redis
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// RetryPolicy decides whether and when a failed command or pipeline is
+// retried. It is only called for the errors that are safe to retry, e.g.
+// network errors and LOADING, so it can stop the retries, but can't make
+// the client retry other errors, e.g. WRONGTYPE. It must be safe for
+// concurrent use.
+//
+// The default policy is ExponentialBackoff configured with MaxRetries,
+// MinRetryBackoff and MaxRetryBackoff.
+type RetryPolicy interface {
+	// Retry is called after the attempt failed with err, where attempt is
+	// the number of the retry starting with 1. It returns how long to wait
+	// before the retry and whether to retry at all.
+	Retry(attempt int, err error) (backoff time.Duration, retry bool)
+}
+
+// ExponentialBackoff retries up to MaxRetries times and doubles the backoff
+// after every retry, adding random jitter between MinBackoff and the
+// doubled MinBackoff, up to MaxBackoff. It is the default policy.
+type ExponentialBackoff struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+var _ RetryPolicy = (*ExponentialBackoff)(nil)
+
+func (b *ExponentialBackoff) Retry(attempt int, err error) (time.Duration, bool) {
+	if attempt > b.MaxRetries {
+		return 0, false
+	}
+	return internal.RetryBackoff(attempt, b.MinBackoff, b.MaxBackoff), true
+}
+
+// FullJitterBackoff retries up to MaxRetries times and waits a random
+// duration between 0 and Base doubled after every retry, but not more than
+// Cap. It spreads the retries of many clients better than
+// ExponentialBackoff, e.g. after a failover.
+type FullJitterBackoff struct {
+	MaxRetries int
+	Base       time.Duration
+	Cap        time.Duration
+}
+
+var _ RetryPolicy = (*FullJitterBackoff)(nil)
+
+func (b *FullJitterBackoff) Retry(attempt int, err error) (time.Duration, bool) {
+	if attempt > b.MaxRetries {
+		return 0, false
+	}
+
+	d := b.Cap
+	if shift := uint(attempt - 1); shift < 63 && b.Base <= b.Cap>>shift {
+		d = b.Base << shift
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(d))), true
+}
+
+// RetryBudget limits the retries of the wrapped policy to Retries per
+// Period for all the commands of the client, e.g. to avoid overloading the
+// server with retries when it is down. The unused budget accumulates up to
+// Retries.
+type RetryBudget struct {
+	policy RetryPolicy
+	rate   float64 // retries per nanosecond
+	max    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ RetryPolicy = (*RetryBudget)(nil)
+
+// NewRetryBudget returns a policy that allows up to retries retries of
+// policy per period. Period defaults to 1 second when it is not positive.
+func NewRetryBudget(policy RetryPolicy, retries int, period time.Duration) *RetryBudget {
+	if period <= 0 {
+		period = time.Second
+	}
+	return &RetryBudget{
+		policy: policy,
+		rate:   float64(retries) / float64(period),
+		max:    float64(retries),
+		tokens: float64(retries),
+		last:   time.Now(),
+	}
+}
+
+func (b *RetryBudget) Retry(attempt int, err error) (time.Duration, bool) {
+	backoff, ok := b.policy.Retry(attempt, err)
+	if !ok || !b.take() {
+		return 0, false
+	}
+	return backoff, true
+}
+
+func (b *RetryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += float64(now.Sub(b.last)) * b.rate
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
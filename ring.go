@@ -67,17 +67,45 @@ type RingOptions struct {
 	Dialer    func(ctx context.Context, network, addr string) (net.Conn, error)
 	OnConnect func(ctx context.Context, cn *Conn) error
 
+	// DNS makes the default dialer resolve the host names on every dial
+	// and rotate the new connections across the addresses.
+	DNS *DNSOptions
+
+	// ClientName is set with CLIENT SETNAME on every new connection, so the
+	// connections can be identified in CLIENT LIST.
+	ClientName string
+	// IdentitySuffix is appended to the library name that is set with
+	// CLIENT SETINFO when EnableIdentity is set, e.g. the service name:
+	// "go-redis(orders)".
+	IdentitySuffix string
+	// EnableIdentity sends CLIENT SETINFO on every new connection to report
+	// the library name and version to Redis >= 7.2.
+	// Default is to not send it.
+	EnableIdentity bool
+
 	Username string
 	Password string
 	DB       int
+	// CredentialsProvider is used instead of Username and Password to get
+	// the credentials of every new connection, e.g. short-lived tokens.
+	CredentialsProvider func(ctx context.Context) (username, password string, err error)
+	// TokenAuth authenticates the connections with the tokens that expire.
+	// See Options.TokenAuth.
+	TokenAuth *TokenAuth
 
 	MaxRetries      int
 	MinRetryBackoff time.Duration
 	MaxRetryBackoff time.Duration
+	// RetryPolicy decides whether and when to retry instead of MaxRetries,
+	// MinRetryBackoff and MaxRetryBackoff.
+	RetryPolicy RetryPolicy
 
 	DialTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// ContextDeadline also applies the deadline of the context to the
+	// socket reads and writes without a timeout.
+	ContextDeadline bool
 
 	// PoolFIFO uses FIFO mode for each node connection pool GET/PUT (default LIFO).
 	PoolFIFO bool
@@ -90,7 +118,33 @@ type RingOptions struct {
 	IdleCheckFrequency time.Duration
 
 	TLSConfig *tls.Config
-	Limiter   Limiter
+	// GetTLSConfig is called on every new connection to get the TLS config.
+	// See Options.GetTLSConfig.
+	GetTLSConfig func(ctx context.Context) (*tls.Config, error)
+
+	Limiter Limiter
+
+	// CircuitBreaker enables a CircuitBreaker for every shard, so the
+	// commands sent to an unhealthy shard fail fast with ErrCircuitOpen.
+	CircuitBreaker *CircuitBreakerOptions
+
+	// CommandStats enables latency histograms of the commands that are
+	// returned by Ring.CommandStats.
+	CommandStats bool
+
+	// Logger is used to log the messages of the client and the shards.
+	// Default is the logger set with SetLogger.
+	Logger Logger
+	// Codec is used to marshal the command arguments of the types that
+	// are not supported natively, e.g. structs, and to unmarshal the values
+	// scanned into such types with StringCmd.Scan and SliceCmd.ScanValues.
+	// Default is to return an error for such types.
+	Codec Codec
+	// TimeEncoding is how time.Time and time.Duration args are encoded and
+	// how the replies are scanned into them, e.g. to share the keys with
+	// clients in other languages.
+	// Default is TimeRFC3339Nano.
+	TimeEncoding TimeEncoding
 }
 
 func (opt *RingOptions) init() {
@@ -127,20 +181,42 @@ func (opt *RingOptions) init() {
 	}
 }
 
+// retry is like Options.retry.
+func (opt *RingOptions) retry(attempt int, err error) (time.Duration, bool) {
+	if opt.RetryPolicy != nil {
+		return opt.RetryPolicy.Retry(attempt, err)
+	}
+	b := ExponentialBackoff{
+		MaxRetries: opt.MaxRetries,
+		MinBackoff: opt.MinRetryBackoff,
+		MaxBackoff: opt.MaxRetryBackoff,
+	}
+	return b.Retry(attempt, err)
+}
+
 func (opt *RingOptions) clientOptions() *Options {
 	return &Options{
 		Dialer:    opt.Dialer,
+		DNS:       opt.DNS,
 		OnConnect: opt.OnConnect,
 
+		ClientName:     opt.ClientName,
+		IdentitySuffix: opt.IdentitySuffix,
+		EnableIdentity: opt.EnableIdentity,
+
 		Username: opt.Username,
 		Password: opt.Password,
 		DB:       opt.DB,
 
+		CredentialsProvider: opt.CredentialsProvider,
+		TokenAuth:           opt.TokenAuth,
+
 		MaxRetries: -1,
 
-		DialTimeout:  opt.DialTimeout,
-		ReadTimeout:  opt.ReadTimeout,
-		WriteTimeout: opt.WriteTimeout,
+		DialTimeout:     opt.DialTimeout,
+		ReadTimeout:     opt.ReadTimeout,
+		WriteTimeout:    opt.WriteTimeout,
+		ContextDeadline: opt.ContextDeadline,
 
 		PoolFIFO:           opt.PoolFIFO,
 		PoolSize:           opt.PoolSize,
@@ -150,8 +226,16 @@ func (opt *RingOptions) clientOptions() *Options {
 		IdleTimeout:        opt.IdleTimeout,
 		IdleCheckFrequency: opt.IdleCheckFrequency,
 
-		TLSConfig: opt.TLSConfig,
-		Limiter:   opt.Limiter,
+		TLSConfig:    opt.TLSConfig,
+		GetTLSConfig: opt.GetTLSConfig,
+		Limiter:      opt.Limiter,
+
+		CircuitBreaker: opt.CircuitBreaker,
+
+		CommandStats: opt.CommandStats,
+		Logger:       opt.Logger,
+		Codec:        opt.Codec,
+		TimeEncoding: opt.TimeEncoding,
 	}
 }
 
@@ -322,7 +406,7 @@ func (c *ringShards) Heartbeat(frequency time.Duration) {
 			err := shard.Client.Ping(ctx).Err()
 			isUp := err == nil || err == pool.ErrPoolTimeout
 			if shard.Vote(isUp) {
-				internal.Logger.Printf(context.Background(), "ring shard state changed: %s", shard)
+				internal.Log(ctx, c.opt.Logger, internal.LogLevelInfo, "ring shard state changed", "shard", shard)
 				rebalance = true
 			}
 		}
@@ -463,8 +547,35 @@ func (c *Ring) Options() *RingOptions {
 	return c.opt
 }
 
-func (c *Ring) retryBackoff(attempt int) time.Duration {
-	return internal.RetryBackoff(attempt, c.opt.MinRetryBackoff, c.opt.MaxRetryBackoff)
+// afterProcessNode calls NodeHook hooks unless start is zero.
+func (c *Ring) afterProcessNode(
+	ctx context.Context, start time.Time, shard *ringShard, cmd Cmder, cmds []Cmder, err error,
+) {
+	if start.IsZero() {
+		return
+	}
+	afterProcessNode(ctx, c.hooks.hooks, &NodeEvent{
+		Addr:     shard.Client.opt.Addr,
+		Role:     NodeRoleShard,
+		Cmd:      cmd,
+		Cmds:     cmds,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// retrySleep is like baseClient.retrySleep.
+func (c *Ring) retrySleep(ctx context.Context, event *RetryEvent) (bool, error) {
+	backoff, ok := c.opt.retry(event.Attempt, event.Err)
+	if !ok {
+		return false, event.Err
+	}
+	event.Backoff = backoff
+	beforeRetry(ctx, c.hooks.hooks, event)
+	if err := internal.Sleep(ctx, event.Backoff); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // PoolStats returns accumulated connection pool stats.
@@ -482,6 +593,29 @@ func (c *Ring) PoolStats() *PoolStats {
 	return &acc
 }
 
+// CommandStats returns latency statistics by command name of all the
+// shards. It returns nil unless RingOptions.CommandStats is enabled.
+func (c *Ring) CommandStats() map[string]*CommandStats {
+	if !c.opt.CommandStats {
+		return nil
+	}
+
+	stats := make(map[string]*CommandStats)
+	for _, shard := range c.shards.List() {
+		mergeCommandStats(stats, shard.Client.CommandStats())
+	}
+	return stats
+}
+
+// ErrorStats returns the number of errors by type of all the shards.
+func (c *Ring) ErrorStats() *ErrorStats {
+	var acc ErrorStats
+	for _, shard := range c.shards.List() {
+		acc.add(shard.Client.ErrorStats())
+	}
+	return &acc
+}
+
 // Len returns the current number of shards in the ring.
 func (c *Ring) Len() int {
 	return c.shards.Len()
@@ -515,6 +649,27 @@ func (c *Ring) PSubscribe(ctx context.Context, channels ...string) *PubSub {
 	return shard.Client.PSubscribe(ctx, channels...)
 }
 
+// SSubscribe subscribes the client to the specified shard channels.
+func (c *Ring) SSubscribe(ctx context.Context, channels ...string) *PubSub {
+	if len(channels) == 0 {
+		panic("at least one channel is required")
+	}
+
+	shard, err := c.shards.GetByKey(channels[0])
+	if err != nil {
+		// TODO: return PubSub with sticky error
+		panic(err)
+	}
+	return shard.Client.SSubscribe(ctx, channels...)
+}
+
+// PublishAndConfirm is like Client.PublishAndConfirm for the shard that owns the channel.
+func (c *Ring) PublishAndConfirm(
+	ctx context.Context, channel string, message interface{}, minReceivers int64, timeout time.Duration,
+) (int64, error) {
+	return publishAndConfirm(ctx, c, channel, message, minReceivers, timeout)
+}
+
 // ForEachShard concurrently calls the fn on each live shard in the ring.
 // It returns the first error if any.
 func (c *Ring) ForEachShard(
@@ -576,7 +731,7 @@ func (c *Ring) cmdInfo(ctx context.Context, name string) *CommandInfo {
 	}
 	info := cmdsInfo[name]
 	if info == nil {
-		internal.Logger.Printf(ctx, "info for cmd=%s not found", name)
+		internal.Log(ctx, c.opt.Logger, internal.LogLevelDebug, "info for cmd not found", "cmd", name)
 	}
 	return info
 }
@@ -592,25 +747,27 @@ func (c *Ring) cmdShard(ctx context.Context, cmd Cmder) (*ringShard, error) {
 }
 
 func (c *Ring) process(ctx context.Context, cmd Cmder) error {
-	var lastErr error
-	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
-		if attempt > 0 {
-			if err := internal.Sleep(ctx, c.retryBackoff(attempt)); err != nil {
-				return err
-			}
-		}
-
+	for attempt := 1; ; attempt++ {
 		shard, err := c.cmdShard(ctx, cmd)
 		if err != nil {
 			return err
 		}
 
-		lastErr = shard.Client.Process(ctx, cmd)
+		start := nodeHooksStart(c.hooks.hooks)
+		lastErr := shard.Client.Process(ctx, cmd)
+		c.afterProcessNode(ctx, start, shard, cmd, nil, lastErr)
 		if lastErr == nil || !shouldRetry(lastErr, cmd.readTimeout() == nil) {
 			return lastErr
 		}
+
+		if ok, err := c.retrySleep(ctx, &RetryEvent{
+			Cmd:     cmd,
+			Attempt: attempt,
+			Err:     lastErr,
+		}); !ok {
+			return err
+		}
 	}
-	return lastErr
 }
 
 func (c *Ring) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
@@ -621,6 +778,7 @@ func (c *Ring) Pipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
 	}
 	pipe.init()
 	return &pipe
@@ -640,6 +798,8 @@ func (c *Ring) TxPipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx:  c.ctx,
 		exec: c.processTxPipeline,
+		enc:  newEncoding(c.opt.Codec, c.opt.TimeEncoding),
+		tx:   true,
 	}
 	pipe.init()
 	return &pipe
@@ -688,10 +848,14 @@ func (c *Ring) processShardPipeline(
 		return err
 	}
 
+	start := nodeHooksStart(c.hooks.hooks)
 	if tx {
-		return shard.Client.processTxPipeline(ctx, cmds)
+		err = shard.Client.processTxPipeline(ctx, cmds)
+	} else {
+		err = shard.Client.processPipeline(ctx, cmds)
 	}
-	return shard.Client.processPipeline(ctx, cmds)
+	c.afterProcessNode(ctx, start, shard, nil, cmds, err)
+	return err
 }
 
 func (c *Ring) Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error {
@@ -727,6 +891,14 @@ func (c *Ring) Watch(ctx context.Context, fn func(*Tx) error, keys ...string) er
 	return shards[0].Client.Watch(ctx, fn, keys...)
 }
 
+// WatchRetry is like Watch, but retries the transaction when it fails
+// with TxFailedErr. See Client.WatchRetry for details.
+func (c *Ring) WatchRetry(
+	ctx context.Context, fn func(*Tx) error, opt *WatchRetryOptions, keys ...string,
+) error {
+	return watchRetry(ctx, c.Watch, fn, opt, keys)
+}
+
 // Close closes the ring client, releasing any open resources.
 //
 // It is rare to Close a Ring, as the Ring is meant to be long-lived
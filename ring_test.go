@@ -339,9 +339,52 @@ var _ = Describe("Redis Ring", func() {
 				"ring.AfterProcessPipeline",
 			}))
 		})
+
+		It("supports node hook", func() {
+			hook := &nodeEventsHook{}
+			ring.AddHook(hook)
+
+			err := ring.Set(ctx, "key", "value", 0).Err()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = ring.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Get(ctx, "key")
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			events := hook.Events()
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Cmd.Name()).To(Equal("set"))
+			Expect(events[1].Cmd).To(BeNil())
+			Expect(events[1].Cmds).To(HaveLen(1))
+			for _, event := range events {
+				Expect(event.Role).To(Equal(redis.NodeRoleShard))
+				Expect(event.Addr).To(Equal(events[0].Addr))
+				Expect(event.Err).NotTo(HaveOccurred())
+			}
+		})
 	})
 })
 
+type nodeEventsHook struct {
+	hook
+
+	mu     sync.Mutex
+	events []*redis.NodeEvent
+}
+
+func (h *nodeEventsHook) AfterProcessNode(ctx context.Context, event *redis.NodeEvent) {
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	h.mu.Unlock()
+}
+
+func (h *nodeEventsHook) Events() []*redis.NodeEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events
+}
+
 var _ = Describe("empty Redis Ring", func() {
 	var ring *redis.Ring
 
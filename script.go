@@ -4,13 +4,20 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/farss/redis/v8/internal"
 )
 
 type Scripter interface {
 	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd
 	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd
+	EvalRO(ctx context.Context, script string, keys []string, args ...interface{}) *Cmd
+	EvalShaRO(ctx context.Context, sha1 string, keys []string, args ...interface{}) *Cmd
 	ScriptExists(ctx context.Context, hashes ...string) *BoolSliceCmd
 	ScriptLoad(ctx context.Context, script string) *StringCmd
 }
@@ -23,21 +30,51 @@ var (
 
 type Script struct {
 	src, hash string
+	readOnly  bool
 }
 
+// NewScript returns a Script. Scripts that start with a shebang with the
+// no-writes flag, e.g. "#!lua flags=no-writes", are read-only.
 func NewScript(src string) *Script {
 	h := sha1.New()
 	_, _ = io.WriteString(h, src)
 	return &Script{
-		src:  src,
-		hash: hex.EncodeToString(h.Sum(nil)),
+		src:      src,
+		hash:     hex.EncodeToString(h.Sum(nil)),
+		readOnly: isReadOnlyScript(src),
+	}
+}
+
+func isReadOnlyScript(src string) bool {
+	if !strings.HasPrefix(src, "#!") {
+		return false
+	}
+	shebang := src
+	if i := strings.IndexByte(src, '\n'); i >= 0 {
+		shebang = src[:i]
 	}
+	for _, f := range strings.Fields(shebang) {
+		if !strings.HasPrefix(f, "flags=") {
+			continue
+		}
+		for _, flag := range strings.Split(f[len("flags="):], ",") {
+			if flag == "no-writes" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (s *Script) Hash() string {
 	return s.hash
 }
 
+// ReadOnly reports whether the script is declared with the no-writes flag.
+func (s *Script) ReadOnly() bool {
+	return s.readOnly
+}
+
 func (s *Script) Load(ctx context.Context, c Scripter) *StringCmd {
 	return c.ScriptLoad(ctx, s.src)
 }
@@ -54,12 +91,272 @@ func (s *Script) EvalSha(ctx context.Context, c Scripter, keys []string, args ..
 	return c.EvalSha(ctx, s.hash, keys, args...)
 }
 
+func (s *Script) EvalRO(ctx context.Context, c Scripter, keys []string, args ...interface{}) *Cmd {
+	return c.EvalRO(ctx, s.src, keys, args...)
+}
+
+func (s *Script) EvalShaRO(ctx context.Context, c Scripter, keys []string, args ...interface{}) *Cmd {
+	return c.EvalShaRO(ctx, s.hash, keys, args...)
+}
+
 // Run optimistically uses EVALSHA to run the script. If script does not exist
-// it is retried using EVAL.
+// it is retried using EVAL. Read-only scripts are run using RunRO.
+//
+// With Pipeline EVALSHA is queued and the commands that fail with NOSCRIPT
+// are retried using EVAL after the pipeline is executed. With TxPipeline
+// they are not retried, because the retried commands would be executed
+// outside of the transaction; use Load before queuing the script.
 func (s *Script) Run(ctx context.Context, c Scripter, keys []string, args ...interface{}) *Cmd {
+	if s.readOnly {
+		return s.RunRO(ctx, c, keys, args...)
+	}
+
+	if pipe, ok := c.(*Pipeline); ok && !pipe.tx {
+		return cmdable(func(ctx context.Context, cmd Cmder) error {
+			pipe.addScript(cmd, s)
+			return pipe.Process(ctx, cmd)
+		}).EvalSha(ctx, s.hash, keys, args...)
+	}
+
 	r := s.EvalSha(ctx, c, keys, args...)
 	if err := r.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
 		return s.Eval(ctx, c, keys, args...)
 	}
 	return r
 }
+
+// RunRO is like Run, but uses EVALSHA_RO and EVAL_RO, so with
+// ClusterOptions.ReadOnly the script can be executed on replicas. It
+// requires Redis >= 7.0.
+func (s *Script) RunRO(ctx context.Context, c Scripter, keys []string, args ...interface{}) *Cmd {
+	if pipe, ok := c.(*Pipeline); ok && !pipe.tx {
+		return cmdable(func(ctx context.Context, cmd Cmder) error {
+			pipe.addScript(cmd, s)
+			return pipe.Process(ctx, cmd)
+		}).EvalShaRO(ctx, s.hash, keys, args...)
+	}
+
+	r := s.EvalShaRO(ctx, c, keys, args...)
+	if err := r.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+		return s.EvalRO(ctx, c, keys, args...)
+	}
+	return r
+}
+
+//------------------------------------------------------------------------------
+
+// NamedScript is a script that refers to its keys and arguments by names,
+// e.g. @key or @window, instead of KEYS[1] and ARGV[1]. The names are
+// replaced with KEYS and ARGV in the order they are declared and the script
+// is invoked with a map of names to values.
+type NamedScript struct {
+	script *Script
+	keys   []string
+	args   []string
+}
+
+// NewNamedScript returns a NamedScript with the keys and args declared.
+// Names in src that are not declared are left as is; declared names are
+// replaced everywhere, including string literals.
+func NewNamedScript(src string, keys, args []string) *NamedScript {
+	names := make(map[string]string, len(keys)+len(args))
+	for i, name := range keys {
+		names[name] = "KEYS[" + strconv.Itoa(i+1) + "]"
+	}
+	for i, name := range args {
+		names[name] = "ARGV[" + strconv.Itoa(i+1) + "]"
+	}
+
+	return &NamedScript{
+		script: NewScript(replaceScriptNames(src, names)),
+		keys:   keys,
+		args:   args,
+	}
+}
+
+func replaceScriptNames(src string, names map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		if src[i] != '@' {
+			b.WriteByte(src[i])
+			continue
+		}
+
+		j := i + 1
+		for j < len(src) && isScriptNameChar(src[j]) {
+			j++
+		}
+		if s, ok := names[src[i+1:j]]; ok {
+			b.WriteString(s)
+			i = j - 1
+		} else {
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+func isScriptNameChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Script returns the script with positional KEYS and ARGV.
+func (s *NamedScript) Script() *Script {
+	return s.script
+}
+
+// Run runs the script with the keys and args from params. All the declared
+// keys and args must be present. Keys must be strings.
+func (s *NamedScript) Run(ctx context.Context, c Scripter, params map[string]interface{}) *Cmd {
+	keys, args, err := s.params(params)
+	if err != nil {
+		cmd := NewCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return s.script.Run(ctx, c, keys, args...)
+}
+
+func (s *NamedScript) params(params map[string]interface{}) ([]string, []interface{}, error) {
+	keys := make([]string, len(s.keys))
+	for i, name := range s.keys {
+		v, ok := params[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("redis: script key %q is missing", name)
+		}
+		key, ok := v.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("redis: script key %q is %T, not a string", name, v)
+		}
+		keys[i] = key
+	}
+
+	args := make([]interface{}, len(s.args))
+	for i, name := range s.args {
+		v, ok := params[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("redis: script arg %q is missing", name)
+		}
+		args[i] = v
+	}
+
+	return keys, args, nil
+}
+
+//------------------------------------------------------------------------------
+
+// ScriptRegistry keeps named scripts and loads them into Redis. With
+// ClusterClient and Ring the scripts are loaded on every node, and with
+// ClusterClient also on nodes that are discovered later. Scripts are run
+// using EVALSHA with a fallback to EVAL, so they work even if Redis
+// flushed the script cache. It's safe for concurrent use by multiple
+// goroutines.
+type ScriptRegistry struct {
+	client Scripter
+
+	mu      sync.RWMutex
+	scripts map[string]*Script
+	named   map[string]*NamedScript
+}
+
+// NewScriptRegistry returns a ScriptRegistry that runs the scripts using
+// the client.
+func NewScriptRegistry(client Scripter) *ScriptRegistry {
+	r := &ScriptRegistry{
+		client:  client,
+		scripts: make(map[string]*Script),
+		named:   make(map[string]*NamedScript),
+	}
+	if cluster, ok := client.(*ClusterClient); ok {
+		cluster.OnNewNode(func(node *Client) {
+			go func() {
+				if err := r.loadScripts(context.Background(), node); err != nil {
+					internal.Log(context.Background(), node.opt.Logger, internal.LogLevelError,
+						"loading scripts failed", "node", node.opt.Addr, "error", err)
+				}
+			}()
+		})
+	}
+	return r
+}
+
+// Register registers the script with the name, replacing the existing
+// script with the same name. The script is not loaded until Load is called.
+func (r *ScriptRegistry) Register(name, src string) *Script {
+	script := NewScript(src)
+	r.mu.Lock()
+	r.scripts[name] = script
+	delete(r.named, name)
+	r.mu.Unlock()
+	return script
+}
+
+// RegisterNamed registers the NamedScript with the name like Register does.
+func (r *ScriptRegistry) RegisterNamed(name, src string, keys, args []string) *NamedScript {
+	script := NewNamedScript(src, keys, args)
+	r.mu.Lock()
+	r.scripts[name] = script.script
+	r.named[name] = script
+	r.mu.Unlock()
+	return script
+}
+
+// Get returns the script registered with the name or nil. For named
+// scripts it returns the script with positional KEYS and ARGV.
+func (r *ScriptRegistry) Get(name string) *Script {
+	r.mu.RLock()
+	script := r.scripts[name]
+	r.mu.RUnlock()
+	return script
+}
+
+// Load loads all the registered scripts using SCRIPT LOAD on every node.
+func (r *ScriptRegistry) Load(ctx context.Context) error {
+	// ClusterClient sends SCRIPT LOAD to all the nodes, but Ring does not.
+	if ring, ok := r.client.(*Ring); ok {
+		return ring.ForEachShard(ctx, func(ctx context.Context, shard *Client) error {
+			return r.loadScripts(ctx, shard)
+		})
+	}
+	return r.loadScripts(ctx, r.client)
+}
+
+func (r *ScriptRegistry) loadScripts(ctx context.Context, c Scripter) error {
+	r.mu.RLock()
+	scripts := make([]*Script, 0, len(r.scripts))
+	for _, script := range r.scripts {
+		scripts = append(scripts, script)
+	}
+	r.mu.RUnlock()
+
+	for _, script := range scripts {
+		if err := script.Load(ctx, c).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run runs the script registered with the name.
+func (r *ScriptRegistry) Run(ctx context.Context, name string, keys []string, args ...interface{}) *Cmd {
+	script := r.Get(name)
+	if script == nil {
+		cmd := NewCmd(ctx)
+		cmd.SetErr(fmt.Errorf("redis: script %q is not registered", name))
+		return cmd
+	}
+	return script.Run(ctx, r.client, keys, args...)
+}
+
+// RunNamed runs the named script registered with the name.
+func (r *ScriptRegistry) RunNamed(ctx context.Context, name string, params map[string]interface{}) *Cmd {
+	r.mu.RLock()
+	script := r.named[name]
+	r.mu.RUnlock()
+	if script == nil {
+		cmd := NewCmd(ctx)
+		cmd.SetErr(fmt.Errorf("redis: named script %q is not registered", name))
+		return cmd
+	}
+	return script.Run(ctx, r.client, params)
+}
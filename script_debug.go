@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/farss/redis/v8/internal/pool"
+)
+
+// Lua debugger modes used with ScriptDebug and Conn.DebugScript.
+const (
+	// ScriptDebugYes starts asynchronous sessions: the script runs in
+	// a forked server, changes to the dataset are rolled back, and the
+	// server closes the connection when the session ends.
+	ScriptDebugYes = "yes"
+	// ScriptDebugSync starts synchronous sessions: the server is blocked
+	// while the script is debugged and changes to the dataset are kept.
+	ScriptDebugSync = "sync"
+	// ScriptDebugNo disables debugging.
+	ScriptDebugNo = "no"
+)
+
+var errScriptDebugEnded = errors.New("redis: script debugging session has ended")
+
+var scriptDebugStopRe = regexp.MustCompile(`^\* Stopped at (\d+), stop reason = (.+)$`)
+
+// ScriptDebugLine is a line of the Lua debugger output.
+type ScriptDebugLine struct {
+	// Kind is the tag the line starts with without the angle brackets,
+	// e.g. "redis", "reply", "value", "error", "debug" or "endsession".
+	// It is empty for the other lines, e.g. source lines.
+	Kind string
+	// Text is the rest of the line.
+	Text string
+}
+
+func parseScriptDebugLine(s string) ScriptDebugLine {
+	if strings.HasPrefix(s, "<") {
+		if i := strings.IndexByte(s, '>'); i > 0 {
+			return ScriptDebugLine{
+				Kind: s[1:i],
+				Text: strings.TrimPrefix(s[i+1:], " "),
+			}
+		}
+	}
+	return ScriptDebugLine{Text: s}
+}
+
+// ScriptDebugger is a session of the Lua debugger (LDB) started by
+// Conn.DebugScript. It's not safe for concurrent use by multiple goroutines.
+type ScriptDebugger struct {
+	conn *Conn
+	args []interface{} // EVAL arguments
+
+	output []ScriptDebugLine
+	line   int
+	reason string
+
+	result *Cmd
+}
+
+// DebugScript enables the Lua debugger on the connection using the mode,
+// i.e. ScriptDebugYes or ScriptDebugSync, and starts debugging the script.
+// The script is stopped at the first line. With ScriptDebugYes the
+// connection can't be used after the session ends and should be closed.
+func (c *Conn) DebugScript(
+	ctx context.Context, mode, script string, keys []string, args ...interface{},
+) (*ScriptDebugger, error) {
+	if err := c.ScriptDebug(ctx, mode).Err(); err != nil {
+		return nil, err
+	}
+
+	d := &ScriptDebugger{conn: c}
+	cmd := cmdable(d.process).Eval(ctx, script, keys, args...)
+	d.args = cmd.Args()
+	if err := d.readOutput(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Output returns the output of the last debugger command.
+func (d *ScriptDebugger) Output() []ScriptDebugLine {
+	return d.output
+}
+
+// Line returns the line the script is stopped at.
+func (d *ScriptDebugger) Line() int {
+	return d.line
+}
+
+// StopReason returns why the script is stopped, e.g. "step over" or
+// "break point".
+func (d *ScriptDebugger) StopReason() string {
+	return d.reason
+}
+
+// Ended reports whether the session has ended, i.e. the script returned,
+// failed or was aborted.
+func (d *ScriptDebugger) Ended() bool {
+	return d.result != nil
+}
+
+// Result returns the reply of the script after the session has ended
+// or nil.
+func (d *ScriptDebugger) Result() *Cmd {
+	return d.result
+}
+
+// Step runs the current line and stops at the next one.
+func (d *ScriptDebugger) Step(ctx context.Context) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "step")
+}
+
+// Continue runs the script until the next break point or the end.
+func (d *ScriptDebugger) Continue(ctx context.Context) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "continue")
+}
+
+// Break adds a break point at the line.
+func (d *ScriptDebugger) Break(ctx context.Context, line int) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "break", line)
+}
+
+// RemoveBreak removes the break point at the line.
+func (d *ScriptDebugger) RemoveBreak(ctx context.Context, line int) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "break", -line)
+}
+
+// Print shows the value of the local variable or, when name is empty,
+// of all the local variables.
+func (d *ScriptDebugger) Print(ctx context.Context, name string) ([]ScriptDebugLine, error) {
+	if name == "" {
+		return d.Do(ctx, "print")
+	}
+	return d.Do(ctx, "print", name)
+}
+
+// Eval runs the Lua code in the context of the current frame.
+func (d *ScriptDebugger) Eval(ctx context.Context, code string) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "eval", code)
+}
+
+// Redis runs the Redis command from the script.
+func (d *ScriptDebugger) Redis(ctx context.Context, args ...interface{}) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, append([]interface{}{"redis"}, args...)...)
+}
+
+// Abort stops the script with an error. The session ends.
+func (d *ScriptDebugger) Abort(ctx context.Context) ([]ScriptDebugLine, error) {
+	return d.Do(ctx, "abort")
+}
+
+// Do sends the debugger command, e.g. "list" or "trace", and returns its
+// output.
+func (d *ScriptDebugger) Do(ctx context.Context, args ...interface{}) ([]ScriptDebugLine, error) {
+	if d.Ended() {
+		return nil, errScriptDebugEnded
+	}
+	cmd := NewCmd(ctx, args...)
+	_ = d.process(ctx, cmd)
+	if err := d.readOutput(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return d.output, nil
+}
+
+// process sends the command without retries, because debugger commands
+// change the state of the session.
+func (d *ScriptDebugger) process(ctx context.Context, cmd Cmder) error {
+	return d.conn.hooks.process(ctx, cmd, func(ctx context.Context, cmd Cmder) error {
+		_, err := d.conn.baseClient._process(ctx, cmd)
+		return err
+	})
+}
+
+func (d *ScriptDebugger) readOutput(ctx context.Context, cmd *Cmd) error {
+	lines, err := cmd.StringSlice()
+	if err != nil {
+		return err
+	}
+
+	d.output = make([]ScriptDebugLine, len(lines))
+	var ended bool
+	for i, s := range lines {
+		line := parseScriptDebugLine(s)
+		d.output[i] = line
+
+		switch {
+		case line.Kind == "endsession":
+			ended = true
+		case line.Kind == "":
+			if m := scriptDebugStopRe.FindStringSubmatch(s); m != nil {
+				d.line, _ = strconv.Atoi(m[1])
+				d.reason = m[2]
+			}
+		}
+	}
+	if !ended {
+		return nil
+	}
+
+	// The reply of the script follows the end of the session.
+	result := NewCmd(ctx, d.args...)
+	err = d.conn.withConn(ctx, cmdLimitOp(result), func(ctx context.Context, cn *pool.Conn) error {
+		return cn.WithReader(ctx, d.conn.cmdTimeout(ctx, result), result.readReply)
+	})
+	result.SetErr(err)
+	d.result = result
+	d.line = 0
+	d.reason = ""
+	return nil
+}
@@ -0,0 +1,62 @@
+package redis_test
+
+import (
+	"context"
+)
+
+var _ = Describe("ScriptDebugger", func() {
+	ctx := context.TODO()
+	var client *redis.Client
+	var conn *redis.Conn
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+		conn = client.Conn(ctx)
+	})
+
+	AfterEach(func() {
+		Expect(conn.Close()).NotTo(HaveOccurred())
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("steps through the script", func() {
+		d, err := conn.DebugScript(ctx, redis.ScriptDebugSync, `
+local a = redis.call('INCRBY', KEYS[1], ARGV[1])
+local b = a * 2
+return b`, []string{"key"}, 21)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Line()).To(Equal(2))
+		Expect(d.StopReason()).To(Equal("step over"))
+
+		lines, err := d.Step(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lines).To(ContainElement(redis.ScriptDebugLine{Kind: "redis", Text: "INCRBY key 21"}))
+		Expect(d.Line()).To(Equal(3))
+
+		lines, err = d.Print(ctx, "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lines).To(Equal([]redis.ScriptDebugLine{{Kind: "value", Text: "21"}}))
+
+		_, err = d.Continue(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Ended()).To(BeTrue())
+		Expect(d.Result().Int()).To(Equal(42))
+
+		_, err = d.Step(ctx)
+		Expect(err).To(MatchError("redis: script debugging session has ended"))
+
+		// Changes are kept in the synchronous mode.
+		Expect(conn.Get(ctx, "key").Int()).To(Equal(21))
+	})
+
+	It("aborts the script", func() {
+		d, err := conn.DebugScript(ctx, redis.ScriptDebugSync, "return 1", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = d.Abort(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Ended()).To(BeTrue())
+		Expect(d.Result().Err()).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// Singleflight collapses concurrent GET and HGETALL commands for the same key
+// into a single in-flight request whose reply is shared by all the callers,
+// which protects hot keys when many goroutines miss the same cache entry at
+// once. Unlike GetCollapser it does not wait for other commands, so the
+// commands are only collapsed while a request for the key is in flight.
+// It's safe for concurrent use by multiple goroutines.
+type Singleflight struct {
+	client Cmdable
+
+	mu    sync.Mutex
+	calls map[flightKey]*flightCall
+}
+
+type flightKey struct {
+	name string
+	key  string
+}
+
+type flightCall struct {
+	done chan struct{}
+	cmd  Cmder
+}
+
+// NewSingleflight returns a Singleflight that sends the commands using client.
+func NewSingleflight(client Cmdable) *Singleflight {
+	return &Singleflight{
+		client: client,
+		calls:  make(map[flightKey]*flightCall),
+	}
+}
+
+// Get returns the value of the key like Client.Get does, but shares the
+// reply with the concurrent calls for the same key.
+func (s *Singleflight) Get(ctx context.Context, key string) *StringCmd {
+	cmd := NewStringCmd(ctx, "get", key)
+	shared, ok := s.do(ctx, cmd, key, func(ctx context.Context) Cmder {
+		return s.client.Get(ctx, key)
+	})
+	if !ok {
+		return cmd
+	}
+
+	res := shared.(*StringCmd)
+	cmd.SetVal(res.Val())
+	cmd.SetErr(res.Err())
+	return cmd
+}
+
+// HGetAll returns all the fields of the hash like Client.HGetAll does, but
+// shares the reply with the concurrent calls for the same key. Every caller
+// gets its own copy of the map.
+func (s *Singleflight) HGetAll(ctx context.Context, key string) *StringStringMapCmd {
+	cmd := NewStringStringMapCmd(ctx, "hgetall", key)
+	shared, ok := s.do(ctx, cmd, key, func(ctx context.Context) Cmder {
+		return s.client.HGetAll(ctx, key)
+	})
+	if !ok {
+		return cmd
+	}
+
+	res := shared.(*StringStringMapCmd)
+	if val := res.Val(); val != nil {
+		m := make(map[string]string, len(val))
+		for k, v := range val {
+			m[k] = v
+		}
+		cmd.SetVal(m)
+	}
+	cmd.SetErr(res.Err())
+	return cmd
+}
+
+// do returns the reply of the in-flight request for the key or starts a
+// new one with fn. The request is not canceled when the caller that started
+// it gives up, because other callers may still wait for it. It returns false
+// and sets the error of the cmd when ctx is done before the reply.
+func (s *Singleflight) do(
+	ctx context.Context, cmd Cmder, key string, fn func(ctx context.Context) Cmder,
+) (Cmder, bool) {
+	k := flightKey{name: cmd.Name(), key: key}
+
+	s.mu.Lock()
+	call := s.calls[k]
+	if call == nil {
+		call = &flightCall{done: make(chan struct{})}
+		s.calls[k] = call
+		go s.run(detachedContext{ctx}, k, call, fn)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.cmd, true
+	case <-ctx.Done():
+		cmd.SetErr(ctx.Err())
+		return nil, false
+	}
+}
+
+func (s *Singleflight) run(ctx context.Context, k flightKey, call *flightCall, fn func(ctx context.Context) Cmder) {
+	call.cmd = fn(ctx)
+
+	s.mu.Lock()
+	delete(s.calls, k)
+	s.mu.Unlock()
+
+	close(call.done)
+}
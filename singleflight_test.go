@@ -0,0 +1,84 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ = Describe("Singleflight", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("collapses concurrent GETs and HGETALLs of the same key", func() {
+		Expect(client.Set(ctx, "key", "value", 0).Err()).NotTo(HaveOccurred())
+		Expect(client.HSet(ctx, "hash", "field", "value").Err()).NotTo(HaveOccurred())
+
+		var mu sync.Mutex
+		var cmds []redis.Cmder
+		client.AddHook(&hook{
+			beforeProcess: func(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+				mu.Lock()
+				cmds = append(cmds, cmd)
+				mu.Unlock()
+				// Keep the request in flight until all the calls are made.
+				time.Sleep(50 * time.Millisecond)
+				return ctx, nil
+			},
+		})
+
+		sf := redis.NewSingleflight(client)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				val, err := sf.Get(ctx, "key").Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value"))
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				val, err := sf.HGetAll(ctx, "hash").Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal(map[string]string{"field": "value"}))
+				val["field"] = "changed"
+			}()
+		}
+		wg.Wait()
+
+		Expect(cmds).To(HaveLen(2))
+	})
+
+	It("returns redis.Nil for missing keys", func() {
+		sf := redis.NewSingleflight(client)
+		Expect(sf.Get(ctx, "missing").Err()).To(Equal(redis.Nil))
+	})
+
+	It("returns when the context is done", func() {
+		client.AddHook(&hook{
+			beforeProcess: func(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+				time.Sleep(100 * time.Millisecond)
+				return ctx, nil
+			},
+		})
+		sf := redis.NewSingleflight(client)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		Expect(sf.Get(ctx, "key").Err()).To(Equal(context.DeadlineExceeded))
+	})
+})
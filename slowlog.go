@@ -0,0 +1,165 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// SlowLogOptions are used to configure the hook returned by NewSlowLogHook.
+type SlowLogOptions struct {
+	// Threshold is the duration after which the command is logged.
+	// Default is 100 milliseconds.
+	Threshold time.Duration
+	// SampleRate is the fraction of the slow commands that are logged,
+	// e.g. 0.1 logs every 10th of them on average.
+	// Default is 1, i.e. all the slow commands are logged.
+	SampleRate float64
+
+	// MaxArgs is the maximum number of logged arguments of a command.
+	// Default is 16; -1 logs all the arguments.
+	MaxArgs int
+	// MaxArgLen is the maximum length of a logged argument.
+	// Default is 64; -1 logs the arguments as is.
+	MaxArgLen int
+	// Redact replaces the arguments with "?", so only the command names
+	// are logged.
+	Redact bool
+
+	// Logger is used to log the slow commands with the warn level.
+	// Default is the logger set with SetLogger.
+	Logger Logger
+}
+
+func (opt *SlowLogOptions) init() {
+	if opt.Threshold == 0 {
+		opt.Threshold = 100 * time.Millisecond
+	}
+	if opt.SampleRate == 0 {
+		opt.SampleRate = 1
+	}
+	switch opt.MaxArgs {
+	case -1:
+		opt.MaxArgs = 0
+	case 0:
+		opt.MaxArgs = 16
+	}
+	switch opt.MaxArgLen {
+	case -1:
+		opt.MaxArgLen = 0
+	case 0:
+		opt.MaxArgLen = 64
+	}
+}
+
+type slowLogStartKey struct{}
+
+type slowLogHook struct {
+	opt SlowLogOptions
+}
+
+var _ Hook = (*slowLogHook)(nil)
+
+// NewSlowLogHook returns a hook that logs the commands and pipelines that
+// take longer than the threshold, so they can be correlated with the
+// server SLOWLOG. The duration includes the network round trip, waiting for
+// a connection and retries. opt can be nil to use the default options.
+func NewSlowLogHook(opt *SlowLogOptions) Hook {
+	h := new(slowLogHook)
+	if opt != nil {
+		h.opt = *opt
+	}
+	h.opt.init()
+	return h
+}
+
+func (h *slowLogHook) BeforeProcess(ctx context.Context, cmd Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+func (h *slowLogHook) AfterProcess(ctx context.Context, cmd Cmder) error {
+	if d, ok := h.slow(ctx); ok {
+		b := make([]byte, 0, 64)
+		b = h.appendCmd(b, cmd)
+		internal.Log(ctx, h.opt.Logger, internal.LogLevelWarn, "slow command",
+			"duration", d, "cmd", internal.String(b))
+	}
+	return nil
+}
+
+func (h *slowLogHook) BeforeProcessPipeline(ctx context.Context, cmds []Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+func (h *slowLogHook) AfterProcessPipeline(ctx context.Context, cmds []Cmder) error {
+	const numCmdLimit = 10
+
+	if d, ok := h.slow(ctx); ok {
+		b := make([]byte, 0, 64*len(cmds))
+		for i, cmd := range cmds {
+			if i == numCmdLimit {
+				b = append(b, "; ..."...)
+				break
+			}
+			if i > 0 {
+				b = append(b, "; "...)
+			}
+			b = h.appendCmd(b, cmd)
+		}
+		internal.Log(ctx, h.opt.Logger, internal.LogLevelWarn, "slow pipeline",
+			"duration", d, "num_cmd", len(cmds), "cmds", internal.String(b))
+	}
+	return nil
+}
+
+func (h *slowLogHook) slow(ctx context.Context) (time.Duration, bool) {
+	start, ok := ctx.Value(slowLogStartKey{}).(time.Time)
+	if !ok {
+		return 0, false
+	}
+	d := time.Since(start)
+	if d < h.opt.Threshold {
+		return d, false
+	}
+	if h.opt.SampleRate < 1 && rand.Float64() >= h.opt.SampleRate {
+		return d, false
+	}
+	return d, true
+}
+
+func (h *slowLogHook) appendCmd(b []byte, cmd Cmder) []byte {
+	name := cmd.FullName()
+	b = append(b, name...)
+
+	args := formatArgs(cmd.Args())
+	mask := redactMask(cmd, auditCmdName(cmd), args, nil)
+	// Skip the command name, e.g. "get" or "cluster info".
+	i := strings.Count(name, " ") + 1
+	for n := 0; i < len(args); i, n = i+1, n+1 {
+		if h.opt.MaxArgs > 0 && n == h.opt.MaxArgs {
+			b = append(b, " ..."...)
+			break
+		}
+
+		b = append(b, ' ')
+		if h.opt.Redact || (mask != nil && mask[i]) {
+			b = append(b, '?')
+			continue
+		}
+
+		start := len(b)
+		b = append(b, args[i]...)
+		if h.opt.MaxArgLen > 0 && len(b)-start > h.opt.MaxArgLen {
+			b = append(b[:start+h.opt.MaxArgLen], "..."...)
+		}
+	}
+
+	if err := cmd.Err(); err != nil && err != Nil {
+		b = append(b, ": "...)
+		b = append(b, redactErrString(err.Error(), args, mask)...)
+	}
+	return b
+}
@@ -0,0 +1,320 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// StreamHandler handles a message read from the stream. The message is
+// acknowledged when the handler returns nil.
+type StreamHandler func(ctx context.Context, stream string, msg XMessage) error
+
+// StreamConsumerOptions are used to configure a StreamConsumer.
+type StreamConsumerOptions struct {
+	// Streams to read the messages from.
+	Streams []string
+	// Group is the name of the consumer group. The group is created for
+	// every stream if it does not exist.
+	Group string
+	// Consumer is the name of the consumer in the group.
+	// Default is <hostname>-<pid>.
+	Consumer string
+	// StartID is the ID the consumer group is created with.
+	// Default is "$", i.e. only new messages are delivered.
+	StartID string
+
+	// Handler is called for every message.
+	Handler StreamHandler
+	// Concurrency is the number of messages handled at the same time.
+	// Default is 1.
+	Concurrency int
+
+	// Block is how long XREADGROUP waits for new messages. It also limits
+	// how long it takes to stop the consumer.
+	// Default is 1 second.
+	Block time.Duration
+
+	// Maximum number of times the handler is retried before giving up on
+	// the message. The message stays in the pending entries list and can
+	// be claimed later.
+	// Default is 3 retries; -1 (not 0) disables retries.
+	MaxRetries int
+	// Minimum backoff between each retry.
+	// Default is 100 milliseconds; -1 disables backoff.
+	MinRetryBackoff time.Duration
+	// Maximum backoff between each retry.
+	// Default is 1 second; -1 disables backoff.
+	MaxRetryBackoff time.Duration
+
+	// Dedupe, when set, is used to skip messages that were already
+	// processed, but not acknowledged.
+	Dedupe StreamDedupeStore
+
+	// AckBatchSize is the maximum number of messages acknowledged by
+	// a single XACK. Messages that are not acknowledged yet are delivered
+	// again if the consumer crashes.
+	// Default is 1, i.e. every message is acknowledged right away.
+	AckBatchSize int
+	// AckInterval is how long acknowledgements can be delayed when
+	// AckBatchSize is greater than 1.
+	// Default is 100 milliseconds.
+	AckInterval time.Duration
+}
+
+func (opt *StreamConsumerOptions) init() {
+	if opt.Consumer == "" {
+		host, _ := os.Hostname()
+		opt.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opt.StartID == "" {
+		opt.StartID = "$"
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = 1
+	}
+	if opt.Block == 0 {
+		opt.Block = time.Second
+	}
+	if opt.AckBatchSize <= 0 {
+		opt.AckBatchSize = 1
+	}
+	if opt.AckInterval == 0 {
+		opt.AckInterval = 100 * time.Millisecond
+	}
+
+	switch opt.MaxRetries {
+	case -1:
+		opt.MaxRetries = 0
+	case 0:
+		opt.MaxRetries = 3
+	}
+	switch opt.MinRetryBackoff {
+	case -1:
+		opt.MinRetryBackoff = 0
+	case 0:
+		opt.MinRetryBackoff = 100 * time.Millisecond
+	}
+	switch opt.MaxRetryBackoff {
+	case -1:
+		opt.MaxRetryBackoff = 0
+	case 0:
+		opt.MaxRetryBackoff = time.Second
+	}
+}
+
+// StreamConsumer reads messages from streams as a member of a consumer
+// group and passes them to the handler. It creates the consumer groups,
+// runs XREADGROUP for every stream, acknowledges handled messages and
+// retries failed ones.
+type StreamConsumer struct {
+	client UniversalClient
+	opt    StreamConsumerOptions
+
+	ackMu    sync.Mutex
+	acks     map[string][]string // message IDs by stream
+	ackTimer *time.Timer
+}
+
+// NewStreamConsumer returns a StreamConsumer that uses the client.
+func NewStreamConsumer(client UniversalClient, opt *StreamConsumerOptions) *StreamConsumer {
+	c := &StreamConsumer{
+		client: client,
+		opt:    *opt,
+		acks:   make(map[string][]string),
+	}
+	c.opt.init()
+	return c
+}
+
+type streamJob struct {
+	stream string
+	msg    XMessage
+}
+
+// Run reads and handles the messages until ctx is done. On shutdown it
+// stops reading new messages and waits for the handlers that are running;
+// the handlers get a context that is not canceled, so they can finish
+// and the messages can be acknowledged.
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if len(c.opt.Streams) == 0 {
+		return errors.New("redis: StreamConsumer requires at least one stream")
+	}
+	for _, stream := range c.opt.Streams {
+		if err := c.createGroup(ctx, stream); err != nil {
+			return err
+		}
+	}
+
+	jobs := make(chan streamJob)
+
+	var readers sync.WaitGroup
+	for _, stream := range c.opt.Streams {
+		readers.Add(1)
+		go func(stream string) {
+			defer readers.Done()
+			c.read(ctx, stream, jobs)
+		}(stream)
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < c.opt.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				_ = c.handle(detachedContext{ctx}, job)
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(jobs)
+	workers.Wait()
+	c.flushAcks(detachedContext{ctx})
+
+	return ctx.Err()
+}
+
+func (c *StreamConsumer) createGroup(ctx context.Context, stream string) error {
+	err := c.client.XGroupCreateMkStream(ctx, stream, c.opt.Group, c.opt.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP ") {
+		return err
+	}
+	return nil
+}
+
+func (c *StreamConsumer) read(ctx context.Context, stream string, jobs chan<- streamJob) {
+	for attempt := 0; ctx.Err() == nil; {
+		streams, err := c.client.XReadGroup(ctx, &XReadGroupArgs{
+			Group:    c.opt.Group,
+			Consumer: c.opt.Consumer,
+			Streams:  []string{stream, ">"},
+			Count:    int64(c.opt.Concurrency),
+			Block:    c.opt.Block,
+		}).Result()
+		if err != nil {
+			if err == Nil {
+				attempt = 0
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+				"XREADGROUP failed", "stream", stream, "error", err)
+			if strings.HasPrefix(err.Error(), "NOGROUP ") {
+				// The stream or the group was deleted.
+				_ = c.createGroup(ctx, stream)
+			}
+
+			_ = internal.Sleep(ctx, internal.RetryBackoff(attempt, 100*time.Millisecond, time.Second))
+			attempt++
+			continue
+		}
+		attempt = 0
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				// Messages that are read are handled even on shutdown,
+				// otherwise they stay pending until claimed.
+				jobs <- streamJob{stream: s.Stream, msg: msg}
+			}
+		}
+	}
+}
+
+// handle calls the handler with retries and acknowledges the message.
+// It returns the last handler error if the message is not handled.
+func (c *StreamConsumer) handle(ctx context.Context, job streamJob) error {
+	if c.opt.Dedupe != nil {
+		processed, err := c.opt.Dedupe.IsProcessed(ctx, job.stream, c.opt.Group, job.msg.ID)
+		if err != nil {
+			// Leave the message pending rather than risk processing it twice.
+			internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+				"checking message failed", "stream", job.stream, "id", job.msg.ID, "error", err)
+			return err
+		}
+		if processed {
+			c.ack(ctx, job.stream, job.msg.ID)
+			return nil
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.opt.Handler(ctx, job.stream, job.msg)
+		if err == nil {
+			break
+		}
+		if attempt >= c.opt.MaxRetries {
+			internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+				"handling message failed", "stream", job.stream, "id", job.msg.ID, "error", err)
+			return err
+		}
+		time.Sleep(internal.RetryBackoff(attempt, c.opt.MinRetryBackoff, c.opt.MaxRetryBackoff))
+	}
+
+	if c.opt.Dedupe != nil {
+		if err := c.opt.Dedupe.MarkProcessed(ctx, job.stream, c.opt.Group, job.msg.ID); err != nil {
+			internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+				"marking message failed", "stream", job.stream, "id", job.msg.ID, "error", err)
+		}
+	}
+	c.ack(ctx, job.stream, job.msg.ID)
+	return nil
+}
+
+func (c *StreamConsumer) ack(ctx context.Context, stream, id string) {
+	if c.opt.AckBatchSize == 1 {
+		c.xack(ctx, stream, id)
+		return
+	}
+
+	var ids []string
+	c.ackMu.Lock()
+	c.acks[stream] = append(c.acks[stream], id)
+	if len(c.acks[stream]) >= c.opt.AckBatchSize {
+		ids = c.acks[stream]
+		delete(c.acks, stream)
+	} else if c.ackTimer == nil {
+		ctx := detachedContext{ctx}
+		c.ackTimer = time.AfterFunc(c.opt.AckInterval, func() {
+			c.flushAcks(ctx)
+		})
+	}
+	c.ackMu.Unlock()
+
+	if ids != nil {
+		c.xack(ctx, stream, ids...)
+	}
+}
+
+// flushAcks acknowledges all the messages collected by ack.
+func (c *StreamConsumer) flushAcks(ctx context.Context) {
+	c.ackMu.Lock()
+	acks := c.acks
+	c.acks = make(map[string][]string)
+	if c.ackTimer != nil {
+		c.ackTimer.Stop()
+		c.ackTimer = nil
+	}
+	c.ackMu.Unlock()
+
+	for stream, ids := range acks {
+		c.xack(ctx, stream, ids...)
+	}
+}
+
+func (c *StreamConsumer) xack(ctx context.Context, stream string, ids ...string) {
+	if err := c.client.XAck(ctx, stream, c.opt.Group, ids...).Err(); err != nil {
+		internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+			"XACK failed", "stream", stream, "ids", strings.Join(ids, " "), "error", err)
+	}
+}
@@ -0,0 +1,387 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("StreamConsumer", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("handles and acks messages", func() {
+		var mu sync.Mutex
+		var ids []string
+		failed := make(map[string]bool)
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:     []string{"stream1", "stream2"},
+			Group:       "group",
+			Consumer:    "consumer",
+			StartID:     "0",
+			Concurrency: 4,
+			Block:       100 * time.Millisecond,
+			Handler: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if msg.Values["fail"] == "1" && !failed[msg.ID] {
+					failed[msg.ID] = true
+					return errors.New("temporary error")
+				}
+				ids = append(ids, stream+"-"+msg.ID)
+				return nil
+			},
+			MinRetryBackoff: time.Millisecond,
+		})
+
+		Expect(client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream1", ID: "1-0", Values: map[string]interface{}{"fail": "0"},
+		}).Err()).NotTo(HaveOccurred())
+		Expect(client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream2", ID: "2-0", Values: map[string]interface{}{"fail": "1"},
+		}).Err()).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Run(ctx)
+		}()
+
+		Eventually(func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), ids...)
+		}).Should(ConsistOf("stream1-1-0", "stream2-2-0"))
+
+		Eventually(func() int64 {
+			return client.XPending(ctx, "stream2", "group").Val().Count
+		}).Should(Equal(int64(0)))
+		Expect(client.XPending(ctx, "stream1", "group").Val().Count).To(Equal(int64(0)))
+
+		cancel()
+		Eventually(done).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("reclaims idle pending messages", func() {
+		Expect(client.XGroupCreateMkStream(ctx, "stream", "group", "0").Err()).NotTo(HaveOccurred())
+		good := client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream", Values: map[string]interface{}{"value": "good"},
+		}).Val()
+		bad := client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream", Values: map[string]interface{}{"value": "bad"},
+		}).Val()
+
+		// Read the messages by another consumer that never acks them.
+		Expect(client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "group",
+			Consumer: "crashed",
+			Streams:  []string{"stream", ">"},
+		}).Err()).NotTo(HaveOccurred())
+
+		var handled, poison []string
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:    []string{"stream"},
+			Group:      "group",
+			Consumer:   "consumer",
+			MaxRetries: -1,
+			Handler: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				if msg.Values["value"] == "bad" {
+					return errors.New("can't handle message")
+				}
+				handled = append(handled, msg.ID)
+				return nil
+			},
+		})
+		reclaimer := redis.NewStreamReclaimer(consumer, &redis.StreamReclaimerOptions{
+			MinIdle:       time.Millisecond,
+			Interval:      10 * time.Millisecond,
+			MaxDeliveries: 2,
+			OnPoison: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				poison = append(poison, msg.ID)
+				return nil
+			},
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		runCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		Expect(reclaimer.Run(runCtx)).To(Equal(context.DeadlineExceeded))
+
+		Expect(handled).To(Equal([]string{good}))
+		Expect(poison).To(Equal([]string{bad}))
+		Expect(reclaimer.Stats()).To(Equal(&redis.StreamReclaimerStats{Reclaimed: 2, Poison: 1}))
+		Expect(client.XPending(ctx, "stream", "group").Val().Count).To(Equal(int64(0)))
+	})
+
+	It("moves poison messages to the dead-letter stream", func() {
+		Expect(client.XGroupCreateMkStream(ctx, "stream", "group", "0").Err()).NotTo(HaveOccurred())
+		id := client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream", Values: map[string]interface{}{"value": "bad"},
+		}).Val()
+		Expect(client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "group",
+			Consumer: "crashed",
+			Streams:  []string{"stream", ">"},
+		}).Err()).NotTo(HaveOccurred())
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:    []string{"stream"},
+			Group:      "group",
+			Consumer:   "consumer",
+			MaxRetries: -1,
+			Handler: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				return errors.New("can't handle message")
+			},
+		})
+		reclaimer := redis.NewStreamReclaimer(consumer, &redis.StreamReclaimerOptions{
+			MinIdle:          time.Millisecond,
+			Interval:         10 * time.Millisecond,
+			MaxDeliveries:    2,
+			DeadLetterStream: "dead",
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		runCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		Expect(reclaimer.Run(runCtx)).To(Equal(context.DeadlineExceeded))
+
+		Expect(reclaimer.Stats()).To(Equal(&redis.StreamReclaimerStats{Reclaimed: 1, Poison: 1, DeadLetter: 1}))
+		Expect(client.XPending(ctx, "stream", "group").Val().Count).To(Equal(int64(0)))
+
+		msgs, err := client.XRange(ctx, "dead", "-", "+").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msgs).To(HaveLen(1))
+		Expect(msgs[0].Values).To(Equal(map[string]interface{}{
+			"value":                         "bad",
+			redis.DeadLetterFieldStream:     "stream",
+			redis.DeadLetterFieldID:         id,
+			redis.DeadLetterFieldGroup:      "group",
+			redis.DeadLetterFieldDeliveries: "3",
+			redis.DeadLetterFieldError:      "can't handle message",
+		}))
+	})
+
+	It("skips processed messages", func() {
+		Expect(client.XGroupCreateMkStream(ctx, "stream", "group", "0").Err()).NotTo(HaveOccurred())
+		id := client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "stream", Values: map[string]interface{}{"value": "done"},
+		}).Val()
+		Expect(client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "group",
+			Consumer: "crashed",
+			Streams:  []string{"stream", ">"},
+		}).Err()).NotTo(HaveOccurred())
+
+		// The crashed consumer processed the message, but did not ack it.
+		dedupe := redis.NewStreamKeyDedupeStore(client, "processed:", time.Hour)
+		Expect(dedupe.MarkProcessed(ctx, "stream", "group", id)).NotTo(HaveOccurred())
+
+		var handled int
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:  []string{"stream"},
+			Group:    "group",
+			Consumer: "consumer",
+			Dedupe:   dedupe,
+			Handler: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				handled++
+				return nil
+			},
+		})
+		reclaimer := redis.NewStreamReclaimer(consumer, &redis.StreamReclaimerOptions{
+			MinIdle:  time.Millisecond,
+			Interval: 10 * time.Millisecond,
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		runCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		Expect(reclaimer.Run(runCtx)).To(Equal(context.DeadlineExceeded))
+
+		Expect(handled).To(Equal(0))
+		Expect(client.XPending(ctx, "stream", "group").Val().Count).To(Equal(int64(0)))
+	})
+
+	It("acks messages in batches", func() {
+		var handled int32
+		for i := 0; i < 15; i++ {
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream", Values: []string{"k", "v"},
+			}).Err()).NotTo(HaveOccurred())
+		}
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:      []string{"stream"},
+			Group:        "group",
+			Consumer:     "consumer",
+			StartID:      "0",
+			Block:        100 * time.Millisecond,
+			AckBatchSize: 10,
+			AckInterval:  time.Hour,
+			Handler: func(ctx context.Context, stream string, msg redis.XMessage) error {
+				atomic.AddInt32(&handled, 1)
+				return nil
+			},
+		})
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Run(ctx)
+		}()
+
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&handled)
+		}).Should(Equal(int32(15)))
+		Expect(client.XPending(ctx, "stream", "group").Val().Count).To(Equal(int64(5)))
+
+		// The remaining messages are acked on shutdown.
+		cancel()
+		Eventually(done).Should(Receive(Equal(context.Canceled)))
+		Expect(client.XPending(context.Background(), "stream", "group").Val().Count).To(Equal(int64(0)))
+	})
+})
+
+var _ = Describe("StreamTrimmer", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("trims streams by length and age", func() {
+		old := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond), 10)
+		Expect(client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "events", ID: old + "-0", Values: []string{"k", "v"},
+		}).Err()).NotTo(HaveOccurred())
+		for i := 0; i < 2; i++ {
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "events", Values: []string{"k", "v"},
+			}).Err()).NotTo(HaveOccurred())
+		}
+		for i := 0; i < 5; i++ {
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "logs", Values: []string{"k", "v"},
+			}).Err()).NotTo(HaveOccurred())
+		}
+
+		trimmer := redis.NewStreamTrimmer(client, &redis.StreamTrimmerOptions{
+			Policies: []redis.StreamTrimPolicy{
+				{Stream: "events", MaxAge: time.Minute, Exact: true},
+				{Stream: "logs", MaxLen: 3, Exact: true},
+			},
+		})
+		n, err := trimmer.Trim(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(3)))
+		Expect(client.XLen(ctx, "events").Val()).To(Equal(int64(2)))
+		Expect(client.XLen(ctx, "logs").Val()).To(Equal(int64(3)))
+	})
+})
+
+var _ = Describe("StreamReader", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("delivers messages in order", func() {
+		for i := 0; i < 10; i++ {
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream", Values: []string{"i", strconv.Itoa(i)},
+			}).Err()).NotTo(HaveOccurred())
+		}
+
+		reader := redis.NewStreamReader(client, &redis.StreamReaderOptions{
+			Streams:     []string{"stream"},
+			StartID:     "0",
+			Count:       3,
+			Block:       100 * time.Millisecond,
+			ChannelSize: 1,
+		})
+		ctx, cancel := context.WithCancel(ctx)
+		ch := reader.Channel(ctx)
+
+		for i := 0; i < 10; i++ {
+			var msg *redis.XStreamMessage
+			Eventually(ch).Should(Receive(&msg))
+			Expect(msg.Stream).To(Equal("stream"))
+			Expect(msg.Values["i"]).To(Equal(strconv.Itoa(i)))
+		}
+
+		cancel()
+		Eventually(ch).Should(BeClosed())
+	})
+
+	It("does not skip the messages added between the reads", func() {
+		reader := redis.NewStreamReader(client, &redis.StreamReaderOptions{
+			Streams: []string{"stream"},
+			Block:   10 * time.Millisecond,
+		})
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ch := reader.Channel(ctx)
+
+		// Let the reader resolve "$" before adding the messages.
+		time.Sleep(50 * time.Millisecond)
+		for i := 0; i < 5; i++ {
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream", Values: []string{"i", strconv.Itoa(i)},
+			}).Err()).NotTo(HaveOccurred())
+			time.Sleep(15 * time.Millisecond)
+		}
+
+		for i := 0; i < 5; i++ {
+			var msg *redis.XStreamMessage
+			Eventually(ch).Should(Receive(&msg))
+			Expect(msg.Values["i"]).To(Equal(strconv.Itoa(i)))
+		}
+	})
+
+	It("replays messages between timestamps", func() {
+		base := time.Now().Add(-time.Hour)
+		for i := 0; i < 10; i++ {
+			ms := base.Add(time.Duration(i)*time.Minute).UnixNano() / int64(time.Millisecond)
+			Expect(client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream",
+				ID:     strconv.FormatInt(ms, 10) + "-0",
+				Values: []string{"i", strconv.Itoa(i)},
+			}).Err()).NotTo(HaveOccurred())
+		}
+
+		var replayed []string
+		err := redis.ReplayStream(ctx, client, &redis.StreamReplayOptions{
+			Stream: "stream",
+			Start:  base.Add(2 * time.Minute),
+			End:    base.Add(7 * time.Minute),
+			Count:  2,
+		}, func(ctx context.Context, msg redis.XMessage) error {
+			replayed = append(replayed, msg.Values["i"].(string))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayed).To(Equal([]string{"2", "3", "4", "5", "6", "7"}))
+	})
+})
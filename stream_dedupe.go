@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// StreamDedupeStore records the IDs of processed stream messages so that
+// messages delivered again, e.g. after a consumer crashed before acking,
+// are not handled twice.
+type StreamDedupeStore interface {
+	// IsProcessed reports whether the message was already processed.
+	IsProcessed(ctx context.Context, stream, group, id string) (bool, error)
+	// MarkProcessed records that the message was processed.
+	MarkProcessed(ctx context.Context, stream, group, id string) error
+}
+
+// StreamKeyDedupeStore is a StreamDedupeStore that records every processed
+// message as a key with a TTL.
+type StreamKeyDedupeStore struct {
+	client Cmdable
+	prefix string
+	ttl    time.Duration
+}
+
+var _ StreamDedupeStore = (*StreamKeyDedupeStore)(nil)
+
+// NewStreamKeyDedupeStore returns a StreamKeyDedupeStore that stores the keys
+// with the prefix. The ttl must be longer than the time a message can stay
+// pending before it is reclaimed.
+func NewStreamKeyDedupeStore(client Cmdable, prefix string, ttl time.Duration) *StreamKeyDedupeStore {
+	return &StreamKeyDedupeStore{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (s *StreamKeyDedupeStore) key(stream, group, id string) string {
+	return s.prefix + stream + ":" + group + ":" + id
+}
+
+// IsProcessed reports whether the key of the message exists.
+func (s *StreamKeyDedupeStore) IsProcessed(ctx context.Context, stream, group, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(stream, group, id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MarkProcessed creates the key of the message using SET NX.
+func (s *StreamKeyDedupeStore) MarkProcessed(ctx context.Context, stream, group, id string) error {
+	return s.client.SetNX(ctx, s.key(stream, group, id), 1, s.ttl).Err()
+}
@@ -0,0 +1,242 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// XStreamMessage is a message read from the stream.
+type XStreamMessage struct {
+	Stream string
+	XMessage
+}
+
+// StreamReaderOptions are used to configure a StreamReader.
+type StreamReaderOptions struct {
+	// Streams to read the messages from.
+	Streams []string
+	// StartID is the ID after which the messages are read.
+	// Default is "$", i.e. only new messages are read.
+	StartID string
+	// Count is the maximum number of messages read by a single XREAD.
+	// Default is 100 messages.
+	Count int64
+	// Block is how long XREAD waits for new messages. It also limits
+	// how long it takes to stop the reader.
+	// Default is 1 second.
+	Block time.Duration
+	// ChannelSize is the size of the Go channel.
+	// Default is 100 messages.
+	ChannelSize int
+}
+
+func (opt *StreamReaderOptions) init() {
+	if opt.StartID == "" {
+		opt.StartID = "$"
+	}
+	if opt.Count == 0 {
+		opt.Count = 100
+	}
+	if opt.Block == 0 {
+		opt.Block = time.Second
+	}
+	if opt.ChannelSize == 0 {
+		opt.ChannelSize = 100
+	}
+}
+
+// StreamReader reads messages from streams using XREAD without a consumer
+// group. It's suitable for a single consumer that does not need
+// acknowledgements.
+type StreamReader struct {
+	client UniversalClient
+	opt    StreamReaderOptions
+}
+
+// NewStreamReader returns a StreamReader that uses the client.
+func NewStreamReader(client UniversalClient, opt *StreamReaderOptions) *StreamReader {
+	r := &StreamReader{
+		client: client,
+		opt:    *opt,
+	}
+	r.opt.init()
+	return r
+}
+
+// Channel returns a Go channel for receiving the messages. Every stream is
+// read by a separate goroutine, and messages of the same stream are
+// delivered in order. Reading is paused while the channel is full. The
+// channel is closed when ctx is done.
+func (r *StreamReader) Channel(ctx context.Context) <-chan *XStreamMessage {
+	ch := make(chan *XStreamMessage, r.opt.ChannelSize)
+
+	var wg sync.WaitGroup
+	for _, stream := range r.opt.Streams {
+		wg.Add(1)
+		go func(stream string) {
+			defer wg.Done()
+			r.read(ctx, stream, ch)
+		}(stream)
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch
+}
+
+func (r *StreamReader) read(ctx context.Context, stream string, ch chan<- *XStreamMessage) {
+	lastID := r.opt.StartID
+	for attempt := 0; ctx.Err() == nil; {
+		if lastID == "$" {
+			// "$" is resolved once, so the messages added between the
+			// reads are not skipped.
+			id, err := r.lastGeneratedID(ctx, stream)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				internal.Log(ctx, universalLogger(r.client), internal.LogLevelError,
+					"XINFO STREAM failed", "stream", stream, "error", err)
+				_ = internal.Sleep(ctx, internal.RetryBackoff(attempt, 100*time.Millisecond, time.Second))
+				attempt++
+				continue
+			}
+			lastID = id
+		}
+
+		streams, err := r.client.XRead(ctx, &XReadArgs{
+			Streams: []string{stream, lastID},
+			Count:   r.opt.Count,
+			Block:   r.opt.Block,
+		}).Result()
+		if err != nil {
+			if err == Nil {
+				attempt = 0
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			internal.Log(ctx, universalLogger(r.client), internal.LogLevelError,
+				"XREAD failed", "stream", stream, "error", err)
+			_ = internal.Sleep(ctx, internal.RetryBackoff(attempt, 100*time.Millisecond, time.Second))
+			attempt++
+			continue
+		}
+		attempt = 0
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				select {
+				case ch <- &XStreamMessage{Stream: s.Stream, XMessage: msg}:
+					lastID = msg.ID
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// lastGeneratedID returns the ID of the last message added to the stream,
+// or "0-0" if the stream does not exist.
+func (r *StreamReader) lastGeneratedID(ctx context.Context, stream string) (string, error) {
+	info, err := r.client.XInfoStream(ctx, stream).Result()
+	if err != nil {
+		if isRedisError(err) && strings.Contains(err.Error(), "no such key") {
+			return "0-0", nil
+		}
+		return "", err
+	}
+	return info.LastGeneratedID, nil
+}
+
+//------------------------------------------------------------------------------
+
+// StreamReplayOptions are used to configure ReplayStream.
+type StreamReplayOptions struct {
+	Stream string
+	// Start and End limit the messages by the time they were added. The
+	// time is derived from the millisecond part of the message IDs, so it
+	// only works with auto-generated IDs. Zero values mean the first and
+	// the last message accordingly.
+	Start time.Time
+	End   time.Time
+	// Count is the maximum number of messages read by a single XRANGE.
+	// Default is 100 messages.
+	Count int64
+	// Rate is the maximum number of messages passed to the handler per
+	// second. Default is no limit.
+	Rate int
+}
+
+// ReplayStream reads the messages of the stream between Start and End using
+// XRANGE and passes them in order to fn. It stops and returns the error if
+// fn returns an error.
+func ReplayStream(
+	ctx context.Context,
+	client Cmdable,
+	opt *StreamReplayOptions,
+	fn func(ctx context.Context, msg XMessage) error,
+) error {
+	start, end := "-", "+"
+	if !opt.Start.IsZero() {
+		start = streamTimeID(opt.Start)
+	}
+	if !opt.End.IsZero() {
+		end = streamTimeID(opt.End)
+	}
+	count := opt.Count
+	if count == 0 {
+		count = 100
+	}
+
+	var throttle <-chan time.Time
+	if opt.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opt.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for {
+		msgs, err := client.XRangeN(ctx, opt.Stream, start, end, count).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if throttle != nil {
+				select {
+				case <-throttle:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if err := fn(ctx, msg); err != nil {
+				return err
+			}
+		}
+
+		if int64(len(msgs)) < count {
+			return nil
+		}
+		// Continue after the last message.
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// streamTimeID returns the ID that matches messages added at the millisecond
+// of tm.
+func streamTimeID(tm time.Time) string {
+	return strconv.FormatInt(tm.UnixNano()/int64(time.Millisecond), 10)
+}
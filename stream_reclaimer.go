@@ -0,0 +1,272 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// StreamReclaimerOptions are used to configure a StreamReclaimer.
+type StreamReclaimerOptions struct {
+	// MinIdle is how long a message must be pending before it is claimed.
+	// Default is 1 minute.
+	MinIdle time.Duration
+	// Interval between checks for idle pending messages.
+	// Default is 30 seconds.
+	Interval time.Duration
+	// Count is the maximum number of messages claimed by a single XAUTOCLAIM.
+	// Default is 100 messages.
+	Count int64
+
+	// MaxDeliveries is the number of deliveries after which the message is
+	// considered poison. Poison messages are passed to OnPoison instead of
+	// the handler and are acknowledged.
+	// Default is 0, i.e. messages are never considered poison.
+	MaxDeliveries int64
+	// OnPoison is called for poison messages.
+	OnPoison StreamHandler
+	// DeadLetterStream, when not empty, is the stream poison messages are
+	// moved to. The message values are copied together with the
+	// DeadLetterField* fields that describe the failure. The message is
+	// added to the dead-letter stream and acknowledged in a single
+	// MULTI/EXEC, so with ClusterClient the streams must be in the same
+	// hash slot for the move to be atomic.
+	DeadLetterStream string
+}
+
+// Fields added to the messages moved to the dead-letter stream.
+const (
+	DeadLetterFieldStream     = "dead_letter_stream"     // original stream
+	DeadLetterFieldID         = "dead_letter_id"         // original message ID
+	DeadLetterFieldGroup      = "dead_letter_group"      // consumer group
+	DeadLetterFieldDeliveries = "dead_letter_deliveries" // number of deliveries
+	DeadLetterFieldError      = "dead_letter_error"      // last handler error, if known
+)
+
+func (opt *StreamReclaimerOptions) init() {
+	if opt.MinIdle == 0 {
+		opt.MinIdle = time.Minute
+	}
+	if opt.Interval == 0 {
+		opt.Interval = 30 * time.Second
+	}
+	if opt.Count == 0 {
+		opt.Count = 100
+	}
+}
+
+// StreamReclaimerStats contains StreamReclaimer statistics.
+type StreamReclaimerStats struct {
+	Reclaimed  uint64 // number of messages claimed and passed to the handler
+	Poison     uint64 // number of poison messages
+	DeadLetter uint64 // number of messages moved to the dead-letter stream
+}
+
+// StreamReclaimer periodically claims messages that have been pending
+// for too long, e.g. because the consumer that read them crashed, and passes
+// them to the handler of the StreamConsumer. It uses the streams, group and
+// consumer name of the StreamConsumer.
+type StreamReclaimer struct {
+	reclaimed  uint64 // atomic
+	poison     uint64 // atomic
+	deadLetter uint64 // atomic
+
+	consumer *StreamConsumer
+	opt      StreamReclaimerOptions
+
+	errorsMu sync.Mutex
+	errors   map[streamMessageKey]string // last handler errors
+}
+
+type streamMessageKey struct {
+	stream, id string
+}
+
+// NewStreamReclaimer returns a StreamReclaimer for the consumer.
+// opt can be nil to use the default options.
+func NewStreamReclaimer(consumer *StreamConsumer, opt *StreamReclaimerOptions) *StreamReclaimer {
+	r := &StreamReclaimer{
+		consumer: consumer,
+		errors:   make(map[streamMessageKey]string),
+	}
+	if opt != nil {
+		r.opt = *opt
+	}
+	r.opt.init()
+	return r
+}
+
+// Stats returns StreamReclaimer statistics.
+func (r *StreamReclaimer) Stats() *StreamReclaimerStats {
+	return &StreamReclaimerStats{
+		Reclaimed:  atomic.LoadUint64(&r.reclaimed),
+		Poison:     atomic.LoadUint64(&r.poison),
+		DeadLetter: atomic.LoadUint64(&r.deadLetter),
+	}
+}
+
+// Run claims and handles idle pending messages every Interval until ctx
+// is done. The claimed messages are handled one by one.
+func (r *StreamReclaimer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, stream := range r.consumer.opt.Streams {
+			r.reclaim(ctx, stream)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *StreamReclaimer) reclaim(ctx context.Context, stream string) {
+	c := r.consumer
+	start := "0-0"
+	for ctx.Err() == nil {
+		msgs, next, err := c.client.XAutoClaim(ctx, &XAutoClaimArgs{
+			Stream:   stream,
+			Group:    c.opt.Group,
+			Consumer: c.opt.Consumer,
+			MinIdle:  r.opt.MinIdle,
+			Start:    start,
+			Count:    r.opt.Count,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+					"XAUTOCLAIM failed", "stream", stream, "error", err)
+			}
+			return
+		}
+
+		if len(msgs) > 0 {
+			r.handle(ctx, stream, msgs)
+		}
+
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+func (r *StreamReclaimer) handle(ctx context.Context, stream string, msgs []XMessage) {
+	c := r.consumer
+
+	var deliveries map[string]int64
+	if r.opt.MaxDeliveries > 0 {
+		pending, err := c.client.XPendingExt(ctx, &XPendingExtArgs{
+			Stream:   stream,
+			Group:    c.opt.Group,
+			Start:    msgs[0].ID,
+			End:      msgs[len(msgs)-1].ID,
+			Count:    int64(len(msgs)),
+			Consumer: c.opt.Consumer,
+		}).Result()
+		if err != nil {
+			internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+				"XPENDING failed", "stream", stream, "error", err)
+			return
+		}
+
+		deliveries = make(map[string]int64, len(pending))
+		for _, p := range pending {
+			deliveries[p.ID] = p.RetryCount
+		}
+	}
+
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case msg.Values == nil:
+			// The message was deleted from the stream.
+			r.setError(stream, msg.ID, nil)
+			c.ack(ctx, stream, msg.ID)
+		case r.opt.MaxDeliveries > 0 && deliveries[msg.ID] > r.opt.MaxDeliveries:
+			atomic.AddUint64(&r.poison, 1)
+			if r.opt.OnPoison != nil {
+				if err := r.opt.OnPoison(ctx, stream, msg); err != nil {
+					internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+						"handling poison message failed", "stream", stream, "id", msg.ID, "error", err)
+					continue
+				}
+			}
+			if r.opt.DeadLetterStream == "" {
+				c.ack(ctx, stream, msg.ID)
+				continue
+			}
+			if err := r.moveToDeadLetter(ctx, stream, msg, deliveries[msg.ID]); err != nil {
+				internal.Log(ctx, universalLogger(c.client), internal.LogLevelError,
+					"moving message to dead-letter stream failed", "stream", stream, "id", msg.ID,
+					"dead_letter_stream", r.opt.DeadLetterStream, "error", err)
+				continue
+			}
+			r.setError(stream, msg.ID, nil)
+		default:
+			atomic.AddUint64(&r.reclaimed, 1)
+			err := c.handle(ctx, streamJob{stream: stream, msg: msg})
+			if r.opt.DeadLetterStream != "" {
+				r.setError(stream, msg.ID, err)
+			}
+		}
+	}
+}
+
+func (r *StreamReclaimer) moveToDeadLetter(
+	ctx context.Context, stream string, msg XMessage, deliveries int64,
+) error {
+	values := make(map[string]interface{}, len(msg.Values)+5)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[DeadLetterFieldStream] = stream
+	values[DeadLetterFieldID] = msg.ID
+	values[DeadLetterFieldGroup] = r.consumer.opt.Group
+	values[DeadLetterFieldDeliveries] = deliveries
+	values[DeadLetterFieldError] = r.getError(stream, msg.ID)
+
+	// The message is acknowledged with the XADD, so it is neither lost nor
+	// moved twice.
+	if _, err := r.consumer.client.TxPipelined(ctx, func(pipe Pipeliner) error {
+		pipe.XAdd(ctx, &XAddArgs{
+			Stream: r.opt.DeadLetterStream,
+			Values: values,
+		})
+		pipe.XAck(ctx, stream, r.consumer.opt.Group, msg.ID)
+		return nil
+	}); err != nil {
+		return err
+	}
+	atomic.AddUint64(&r.deadLetter, 1)
+	return nil
+}
+
+func (r *StreamReclaimer) getError(stream, id string) string {
+	r.errorsMu.Lock()
+	defer r.errorsMu.Unlock()
+	return r.errors[streamMessageKey{stream: stream, id: id}]
+}
+
+// setError records the last handler error of the message. The error is
+// deleted when err is nil, i.e. when the message is acknowledged.
+func (r *StreamReclaimer) setError(stream, id string, err error) {
+	key := streamMessageKey{stream: stream, id: id}
+	r.errorsMu.Lock()
+	defer r.errorsMu.Unlock()
+	if err == nil {
+		delete(r.errors, key)
+	} else {
+		r.errors[key] = err.Error()
+	}
+}
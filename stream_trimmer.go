@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+)
+
+// StreamTrimPolicy describes the retention of a stream. When both MaxLen
+// and MaxAge are set, the stream is trimmed by both of them.
+type StreamTrimPolicy struct {
+	Stream string
+
+	// MaxLen is the maximum number of messages (XTRIM MAXLEN).
+	MaxLen int64
+	// MaxAge is the maximum age of the messages (XTRIM MINID). The age is
+	// derived from the millisecond part of the message IDs, so it only
+	// works with auto-generated IDs.
+	MaxAge time.Duration
+
+	// Exact disables approximate trimming ("~"), which is much more
+	// efficient, but can leave a few more messages in the stream.
+	Exact bool
+	// Limit is the maximum number of messages removed by a single
+	// approximate XTRIM. Default is the Redis default.
+	Limit int64
+}
+
+// StreamTrimmerOptions are used to configure a StreamTrimmer.
+type StreamTrimmerOptions struct {
+	Policies []StreamTrimPolicy
+	// Interval between trims.
+	// Default is 1 minute.
+	Interval time.Duration
+}
+
+func (opt *StreamTrimmerOptions) init() {
+	if opt.Interval == 0 {
+		opt.Interval = time.Minute
+	}
+}
+
+// StreamTrimmer periodically trims streams according to the retention
+// policies.
+type StreamTrimmer struct {
+	client UniversalClient
+	opt    StreamTrimmerOptions
+}
+
+// NewStreamTrimmer returns a StreamTrimmer that uses the client.
+func NewStreamTrimmer(client UniversalClient, opt *StreamTrimmerOptions) *StreamTrimmer {
+	t := &StreamTrimmer{
+		client: client,
+		opt:    *opt,
+	}
+	t.opt.init()
+	return t
+}
+
+// Run trims the streams every Interval until ctx is done.
+func (t *StreamTrimmer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := t.Trim(ctx); err != nil && ctx.Err() == nil {
+			internal.Log(ctx, universalLogger(t.client), internal.LogLevelError,
+				"trimming streams failed", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Trim trims all the streams once. It returns the number of removed
+// messages and the first error if any.
+func (t *StreamTrimmer) Trim(ctx context.Context) (int64, error) {
+	var removed int64
+	var firstErr error
+	for i := range t.opt.Policies {
+		n, err := t.trim(ctx, &t.opt.Policies[i])
+		removed += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return removed, firstErr
+}
+
+func (t *StreamTrimmer) trim(ctx context.Context, p *StreamTrimPolicy) (int64, error) {
+	var removed int64
+
+	if p.MaxLen > 0 {
+		var cmd *IntCmd
+		if p.Exact {
+			cmd = t.client.XTrimMaxLen(ctx, p.Stream, p.MaxLen)
+		} else {
+			cmd = t.client.XTrimMaxLenApprox(ctx, p.Stream, p.MaxLen, p.Limit)
+		}
+		n, err := cmd.Result()
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+
+	if p.MaxAge > 0 {
+		minID := streamTimeID(time.Now().Add(-p.MaxAge))
+
+		var cmd *IntCmd
+		if p.Exact {
+			cmd = t.client.XTrimMinID(ctx, p.Stream, minID)
+		} else {
+			cmd = t.client.XTrimMinIDApprox(ctx, p.Stream, minID, p.Limit)
+		}
+		n, err := cmd.Result()
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+
+	return removed, nil
+}
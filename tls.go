@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// getTLSConfig returns the TLS config for a new connection.
+func getTLSConfig(
+	ctx context.Context, cfg *tls.Config, get func(ctx context.Context) (*tls.Config, error),
+) (*tls.Config, error) {
+	if get == nil {
+		return cfg, nil
+	}
+	return get(ctx)
+}
+
+// CertReloader loads the client certificate from the files and reloads it
+// when the files are modified, e.g. the short-lived certificates that are
+// rotated by a SPIFFE agent. It is used with tls.Config.GetClientCertificate,
+// so every new connection uses the certificate that is on disk when the
+// connection is dialed, e.g.
+//
+//	certs, err := redis.NewCertReloader("svid.pem", "svid_key.pem")
+//	if err != nil {
+//		panic(err)
+//	}
+//	rdb := redis.NewClient(&redis.Options{
+//		Addr: "localhost:6379",
+//		TLSConfig: &tls.Config{
+//			RootCAs:              rootCAs,
+//			GetClientCertificate: certs.GetClientCertificate,
+//		},
+//	})
+//
+// The open connections keep using the certificate they were dialed with.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate and the private key from the PEM
+// files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetClientCertificate returns the current certificate. It is meant to be
+// used as tls.Config.GetClientCertificate.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Certificate returns the current certificate. The certificate is reloaded
+// if the files were modified since it was loaded. If the files can't be
+// loaded, e.g. while they are being written, the previous certificate is
+// returned and the files are loaded again next time.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_ = r.reloadLocked()
+	return r.cert
+}
+
+func (r *CertReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked()
+}
+
+func (r *CertReloader) reloadLocked() error {
+	var modTime time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
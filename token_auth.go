@@ -0,0 +1,202 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/farss/redis/v8/internal"
+	"github.com/farss/redis/v8/internal/pool"
+)
+
+// Token is the credentials returned by a TokenSource.
+type Token struct {
+	Username string
+	Password string
+	// Expires is when the token expires. Zero means the token never expires.
+	Expires time.Time
+}
+
+// TokenSource returns the tokens used to authenticate the connections, e.g.
+// the access tokens of an identity provider.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenAuthOptions are used to configure a TokenAuth.
+type TokenAuthOptions struct {
+	// Source returns the tokens.
+	Source TokenSource
+	// RefreshRatio is the part of the lifetime of a token after which a new
+	// token is requested in the background.
+	// Default is 0.7.
+	RefreshRatio float64
+	// RetryBackoff is how long to wait before the token is requested again
+	// after the refresh failed.
+	// Default is 1 second.
+	RetryBackoff time.Duration
+	// Logger is used to log the failed refreshes.
+	// Default is the logger set with SetLogger.
+	Logger Logger
+}
+
+func (opt *TokenAuthOptions) init() {
+	if opt.RefreshRatio == 0 {
+		opt.RefreshRatio = 0.7
+	}
+	if opt.RetryBackoff == 0 {
+		opt.RetryBackoff = time.Second
+	}
+}
+
+// TokenAuth authenticates the connections with the tokens of a TokenSource
+// and re-authenticates them when the token is refreshed, so the connections
+// stay authenticated after the token they were created with expires.
+//
+// The token is refreshed in the background before it expires, and every
+// connection sends AUTH with the new token before it is used again. Idle
+// connections that are not used before the token expires may be closed
+// by the server and are replaced. PubSub connections are not
+// re-authenticated.
+//
+// A TokenAuth can be shared by multiple clients, e.g. all the nodes of a
+// ClusterClient use the same token.
+type TokenAuth struct {
+	opt TokenAuthOptions
+
+	fetchMu sync.Mutex
+
+	mu         sync.Mutex
+	token      *Token
+	gen        uint64 // incremented for every new token
+	refreshAt  time.Time
+	refreshing bool
+}
+
+// NewTokenAuth returns a new TokenAuth. The first token is requested when
+// the first connection is created.
+func NewTokenAuth(opt *TokenAuthOptions) *TokenAuth {
+	a := &TokenAuth{opt: *opt}
+	if a.opt.Source == nil {
+		panic("redis: TokenAuthOptions.Source is required")
+	}
+	a.opt.init()
+	return a
+}
+
+// credentials returns the current token and its generation. A new token is
+// requested in the background after the refresh time or right away if
+// there is no valid token.
+func (a *TokenAuth) credentials(ctx context.Context) (*Token, uint64, error) {
+	now := time.Now()
+
+	a.mu.Lock()
+	token, gen := a.token, a.gen
+	if token != nil && tokenValid(token, now) {
+		if !a.refreshAt.IsZero() && now.After(a.refreshAt) && !a.refreshing {
+			a.refreshing = true
+			go a.refresh()
+		}
+		a.mu.Unlock()
+		return token, gen, nil
+	}
+	a.mu.Unlock()
+
+	return a.fetch(ctx, gen)
+}
+
+// fetch requests a new token unless it was already fetched after the
+// generation gen.
+func (a *TokenAuth) fetch(ctx context.Context, gen uint64) (*Token, uint64, error) {
+	a.fetchMu.Lock()
+	defer a.fetchMu.Unlock()
+
+	a.mu.Lock()
+	if a.gen != gen && a.token != nil && tokenValid(a.token, time.Now()) {
+		token, gen := a.token, a.gen
+		a.mu.Unlock()
+		return token, gen, nil
+	}
+	a.mu.Unlock()
+
+	token, err := a.opt.Source.Token(ctx)
+	if err == nil && token == nil {
+		err = errors.New("redis: TokenSource returned no token")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.token = token
+	a.gen++
+	a.refreshAt = time.Time{}
+	if !token.Expires.IsZero() {
+		lifetime := token.Expires.Sub(now)
+		a.refreshAt = now.Add(time.Duration(float64(lifetime) * a.opt.RefreshRatio))
+	}
+	return a.token, a.gen, nil
+}
+
+func (a *TokenAuth) refresh() {
+	ctx := context.Background()
+
+	a.mu.Lock()
+	gen := a.gen
+	a.mu.Unlock()
+
+	_, _, err := a.fetch(ctx, gen)
+
+	a.mu.Lock()
+	a.refreshing = false
+	if err != nil {
+		a.refreshAt = time.Now().Add(a.opt.RetryBackoff)
+	}
+	a.mu.Unlock()
+
+	if err != nil {
+		internal.Log(ctx, a.opt.Logger, internal.LogLevelWarn, "redis: token refresh failed",
+			"error", err)
+	}
+}
+
+func tokenValid(token *Token, now time.Time) bool {
+	return token.Expires.IsZero() || now.Before(token.Expires)
+}
+
+//------------------------------------------------------------------------------
+
+// reauth authenticates the cn with the current token of Options.TokenAuth if
+// the cn is authenticated with a previous token.
+func (c *baseClient) reauth(ctx context.Context, cn *pool.Conn) error {
+	if c.opt.TokenAuth == nil {
+		return nil
+	}
+
+	token, gen, err := c.opt.TokenAuth.credentials(ctx)
+	if err != nil {
+		c.connPool.Put(ctx, cn)
+		return err
+	}
+	if cn.AuthGen == gen {
+		return nil
+	}
+	cn.AuthGen = gen
+
+	conn := c.newSetupConn(ctx, cn)
+	var cmd *StatusCmd
+	if token.Username != "" {
+		cmd = conn.AuthACL(ctx, token.Username, token.Password)
+	} else {
+		cmd = conn.Auth(ctx, token.Password)
+	}
+	if err := cmd.Err(); err != nil {
+		c.connPool.Remove(ctx, cn, err)
+		return err
+	}
+	return nil
+}
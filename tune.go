@@ -0,0 +1,176 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/farss/redis/v8/internal/pool"
+)
+
+// TuneOptions are the options that can be changed with Tune while the client
+// is in use, e.g. to react to an incident without a restart. Zero values keep
+// the current options.
+type TuneOptions struct {
+	// PoolSize is the new maximum number of socket connections. When the pool
+	// is shrunk, the connections above the new size are closed when they are
+	// returned to the pool.
+	PoolSize int
+	// ReadTimeout is the new timeout for socket reads.
+	// Use value -1 for no timeout.
+	ReadTimeout time.Duration
+	// WriteTimeout is the new timeout for socket writes.
+	// Use value -1 for no timeout.
+	WriteTimeout time.Duration
+}
+
+func (opt *TuneOptions) validate() error {
+	if opt.PoolSize < 0 {
+		return fmt.Errorf("redis: invalid PoolSize: %d", opt.PoolSize)
+	}
+	if opt.ReadTimeout < -1 {
+		return fmt.Errorf("redis: invalid ReadTimeout: %s", opt.ReadTimeout)
+	}
+	if opt.WriteTimeout < -1 {
+		return fmt.Errorf("redis: invalid WriteTimeout: %s", opt.WriteTimeout)
+	}
+	return nil
+}
+
+// socketTimeouts are the timeouts used by a client, which can be changed
+// with Tune.
+type socketTimeouts struct {
+	readTimeout  int64 // atomic time.Duration
+	writeTimeout int64 // atomic time.Duration
+}
+
+func newSocketTimeouts(read, write time.Duration) *socketTimeouts {
+	return &socketTimeouts{
+		readTimeout:  int64(read),
+		writeTimeout: int64(write),
+	}
+}
+
+func (t *socketTimeouts) read() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.readTimeout))
+}
+
+func (t *socketTimeouts) write() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.writeTimeout))
+}
+
+func (t *socketTimeouts) tune(opt *TuneOptions) {
+	if t == nil {
+		return
+	}
+	if opt.ReadTimeout != 0 {
+		atomic.StoreInt64(&t.readTimeout, int64(tunedTimeout(opt.ReadTimeout)))
+	}
+	if opt.WriteTimeout != 0 {
+		atomic.StoreInt64(&t.writeTimeout, int64(tunedTimeout(opt.WriteTimeout)))
+	}
+}
+
+func tunedTimeout(timeout time.Duration) time.Duration {
+	if timeout == -1 {
+		return 0
+	}
+	return timeout
+}
+
+//------------------------------------------------------------------------------
+
+// Tune changes the options of the client while it is in use. The options
+// are also changed for the Conn, Tx and WithContext clients created from
+// the client, but not for the clients created with WithTimeout, and
+// Options still returns the options the client was created with.
+func (c *Client) Tune(opt *TuneOptions) error {
+	if err := opt.validate(); err != nil {
+		return err
+	}
+	c.baseClient.tune(opt)
+	return nil
+}
+
+func (c *baseClient) tune(opt *TuneOptions) {
+	if opt.PoolSize > 0 {
+		if connPool, ok := c.connPool.(*pool.ConnPool); ok {
+			connPool.SetPoolSize(opt.PoolSize)
+		}
+	}
+	c.opt.timeouts.tune(opt)
+}
+
+//------------------------------------------------------------------------------
+
+func (opt *ClusterOptions) readTimeout() time.Duration {
+	if opt.timeouts == nil {
+		return opt.ReadTimeout
+	}
+	return opt.timeouts.read()
+}
+
+func (opt *ClusterOptions) writeTimeout() time.Duration {
+	if opt.timeouts == nil {
+		return opt.WriteTimeout
+	}
+	return opt.timeouts.write()
+}
+
+func (opt *ClusterOptions) poolSize() int {
+	if size := atomic.LoadInt32(&opt.tunedPoolSize); size > 0 {
+		return int(size)
+	}
+	return opt.PoolSize
+}
+
+func (opt *ClusterOptions) readOnly() bool {
+	return atomic.LoadUint32(&opt.tunedReadOnly) == 1
+}
+
+// Tune changes the options of every cluster node, including the nodes
+// that are added later. See Client.Tune for details.
+func (c *ClusterClient) Tune(opt *TuneOptions) error {
+	if err := opt.validate(); err != nil {
+		return err
+	}
+	return c.nodes.tune(opt)
+}
+
+func (c *clusterNodes) tune(opt *TuneOptions) error {
+	// The nodes are created with the lock held, so they use either the old
+	// options and are tuned below or the new options.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return pool.ErrClosed
+	}
+
+	if opt.PoolSize > 0 {
+		atomic.StoreInt32(&c.opt.tunedPoolSize, int32(opt.PoolSize))
+	}
+	c.opt.timeouts.tune(opt)
+
+	for _, node := range c.nodes {
+		node.Client.tune(opt)
+	}
+	return nil
+}
+
+// SetReadOnly enables or disables routing of the read-only commands to the
+// replica nodes, e.g. when the replicas lag behind. ReadOnly can only be
+// enabled again if the client was created with ReadOnly, because the
+// connections to the replicas are initialized with READONLY.
+func (c *ClusterClient) SetReadOnly(readOnly bool) error {
+	if !readOnly {
+		atomic.StoreUint32(&c.opt.tunedReadOnly, 0)
+		return nil
+	}
+	if !c.opt.ReadOnly {
+		return errors.New("redis: ReadOnly can't be enabled for ClusterClient created without ReadOnly")
+	}
+	atomic.StoreUint32(&c.opt.tunedReadOnly, 1)
+	return nil
+}
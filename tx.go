@@ -2,7 +2,10 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/farss/redis/v8/internal"
 	"github.com/farss/redis/v8/internal/pool"
 	"github.com/farss/redis/v8/internal/proto"
 )
@@ -10,6 +13,16 @@ import (
 // TxFailedErr transaction redis failed.
 const TxFailedErr = proto.RedisError("redis: transaction failed")
 
+// TxAbortedErr is returned when Redis discards the transaction because
+// some of the queued commands were rejected, e.g. because of a syntax error.
+// Unlike TxFailedErr it does not depend on watched keys and retrying the
+// transaction is pointless. The rejected commands keep their own errors.
+const TxAbortedErr = proto.RedisError("redis: transaction aborted")
+
+// ErrTxMaxAttempts is returned by WatchRetry when the transaction
+// keeps failing with TxFailedErr after all attempts were used.
+var ErrTxMaxAttempts = errors.New("redis: transaction failed after max attempts")
+
 // Tx implements Redis transactions as described in
 // http://redis.io/topics/transactions. It's NOT safe for concurrent use
 // by multiple goroutines, because Exec resets list of watched keys.
@@ -26,8 +39,11 @@ type Tx struct {
 func (c *Client) newTx(ctx context.Context) *Tx {
 	tx := Tx{
 		baseClient: baseClient{
-			opt:      c.opt,
-			connPool: pool.NewStickyConnPool(c.connPool),
+			opt:       c.opt,
+			connPool:  pool.NewStickyConnPool(c.connPool),
+			cmdStats:  c.cmdStats,
+			errStats:  c.errStats,
+			connHooks: c.connHooks,
 		},
 		hooks: c.hooks.clone(),
 		ctx:   ctx,
@@ -75,6 +91,73 @@ func (c *Client) Watch(ctx context.Context, fn func(*Tx) error, keys ...string)
 	return fn(tx)
 }
 
+// WatchRetryOptions configures how WatchRetry retries transactions.
+type WatchRetryOptions struct {
+	// Maximum number of attempts to run the transaction.
+	// Default is 10 attempts.
+	MaxAttempts int
+	// Minimum backoff between each attempt.
+	// Default is 8 milliseconds; -1 disables backoff.
+	MinBackoff time.Duration
+	// Maximum backoff between each attempt.
+	// Default is 512 milliseconds; -1 disables backoff.
+	MaxBackoff time.Duration
+}
+
+func (opt *WatchRetryOptions) init() {
+	if opt.MaxAttempts <= 0 {
+		opt.MaxAttempts = 10
+	}
+	switch opt.MinBackoff {
+	case -1:
+		opt.MinBackoff = 0
+	case 0:
+		opt.MinBackoff = 8 * time.Millisecond
+	}
+	switch opt.MaxBackoff {
+	case -1:
+		opt.MaxBackoff = 0
+	case 0:
+		opt.MaxBackoff = 512 * time.Millisecond
+	}
+}
+
+type watchFunc func(ctx context.Context, fn func(*Tx) error, keys ...string) error
+
+func watchRetry(
+	ctx context.Context, watch watchFunc, fn func(*Tx) error, opt *WatchRetryOptions, keys []string,
+) error {
+	var o WatchRetryOptions
+	if opt != nil {
+		o = *opt
+	}
+	o.init()
+
+	for attempt := 0; attempt < o.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := internal.RetryBackoff(attempt, o.MinBackoff, o.MaxBackoff)
+			if err := internal.Sleep(ctx, backoff); err != nil {
+				return err
+			}
+		}
+
+		if err := watch(ctx, fn, keys...); err != TxFailedErr {
+			return err
+		}
+	}
+	return ErrTxMaxAttempts
+}
+
+// WatchRetry is like Watch, but runs the transaction again when it fails
+// with TxFailedErr because one of the watched keys was modified.
+// ErrTxMaxAttempts is returned if the transaction fails on every attempt.
+// Options can be nil to use the defaults.
+func (c *Client) WatchRetry(
+	ctx context.Context, fn func(*Tx) error, opt *WatchRetryOptions, keys ...string,
+) error {
+	return watchRetry(ctx, c.Watch, fn, opt, keys)
+}
+
 // Close closes the transaction, releasing any open resources.
 func (c *Tx) Close(ctx context.Context) error {
 	_ = c.Unwatch(ctx).Err()
@@ -110,6 +193,7 @@ func (c *Tx) Unwatch(ctx context.Context, keys ...string) *StatusCmd {
 func (c *Tx) Pipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx: c.ctx,
+		enc: newEncoding(c.opt.Codec, c.opt.TimeEncoding),
 		exec: func(ctx context.Context, cmds []Cmder) error {
 			return c.hooks.processPipeline(ctx, cmds, c.baseClient.processPipeline)
 		},
@@ -129,9 +213,10 @@ func (c *Tx) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder,
 // When using WATCH, EXEC will execute commands only if the watched keys
 // were not modified, allowing for a check-and-set mechanism.
 //
-// Exec always returns list of commands. If transaction fails
-// TxFailedErr is returned. Otherwise Exec returns an error of the first
-// failed command or nil.
+// Exec always returns list of commands. If transaction fails because
+// a watched key was modified TxFailedErr is returned. If Redis rejected some
+// of the queued commands TxAbortedErr is returned. Otherwise Exec returns
+// an error of the first failed command or nil.
 func (c *Tx) TxPipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
 	return c.TxPipeline().Pipelined(ctx, fn)
 }
@@ -140,9 +225,11 @@ func (c *Tx) TxPipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder
 func (c *Tx) TxPipeline() Pipeliner {
 	pipe := Pipeline{
 		ctx: c.ctx,
+		enc: newEncoding(c.opt.Codec, c.opt.TimeEncoding),
 		exec: func(ctx context.Context, cmds []Cmder) error {
 			return c.hooks.processTxPipeline(ctx, cmds, c.baseClient.processTxPipeline)
 		},
+		tx: true,
 	}
 	pipe.init()
 	return &pipe
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strconv"
 	"sync"
+	"time"
 )
 
 var _ = Describe("Tx", func() {
@@ -59,6 +60,75 @@ var _ = Describe("Tx", func() {
 		Expect(n).To(Equal(int64(100)))
 	})
 
+	It("should WatchRetry", func() {
+		incr := func(key string) error {
+			return client.WatchRetry(ctx, func(tx *redis.Tx) error {
+				n, err := tx.Get(ctx, key).Int64()
+				if err != nil && err != redis.Nil {
+					return err
+				}
+
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					pipe.Set(ctx, key, strconv.FormatInt(n+1, 10), 0)
+					return nil
+				})
+				return err
+			}, &redis.WatchRetryOptions{MaxAttempts: 1000, MaxBackoff: time.Millisecond}, key)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				err := incr("key")
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		n, err := client.Get(ctx, "key").Int64()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(10)))
+	})
+
+	It("should return ErrTxMaxAttempts", func() {
+		var attempts int
+		err := client.WatchRetry(ctx, func(tx *redis.Tx) error {
+			attempts++
+			// Modify the watched key to make the transaction fail.
+			Expect(client.Incr(ctx, "key").Err()).NotTo(HaveOccurred())
+
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Incr(ctx, "key")
+				return nil
+			})
+			return err
+		}, &redis.WatchRetryOptions{MaxAttempts: 3, MinBackoff: -1, MaxBackoff: -1}, "key")
+		Expect(err).To(Equal(redis.ErrTxMaxAttempts))
+		Expect(attempts).To(Equal(3))
+	})
+
+	It("should report rejected commands", func() {
+		var set *redis.StatusCmd
+		var bad *redis.Cmd
+		err := client.Watch(ctx, func(tx *redis.Tx) error {
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				set = pipe.Set(ctx, "key", "value", 0)
+				bad = pipe.Do(ctx, "set", "key")
+				return nil
+			})
+			return err
+		}, "key")
+		Expect(err).To(Equal(redis.TxAbortedErr))
+		Expect(set.Err()).To(Equal(redis.TxAbortedErr))
+		Expect(bad.Err()).To(MatchError(ContainSubstring("wrong number of arguments")))
+
+		Expect(client.Get(ctx, "key").Err()).To(Equal(redis.Nil))
+	})
+
 	It("should discard", func() {
 		err := client.Watch(ctx, func(tx *redis.Tx) error {
 			cmds, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
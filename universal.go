@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"time"
 )
@@ -18,23 +19,65 @@ type UniversalOptions struct {
 	// Only single-node and failover clients.
 	DB int
 
+	// KeyPrefix is added to the keys of the commands.
+	// Only single-node and failover clients.
+	KeyPrefix string
+	// Limiter is used to implement a circuit breaker or a rate limiter.
+	// Only single-node and failover clients.
+	Limiter Limiter
+
+	// The network type, either tcp or unix.
+	// Only single-node clients.
+	Network string
+
 	// Common options.
 
+	// Hooks are added to the client with AddHook in order.
+	Hooks []Hook
+
 	Dialer    func(ctx context.Context, network, addr string) (net.Conn, error)
 	OnConnect func(ctx context.Context, cn *Conn) error
 
+	// DNS makes the default dialer resolve the host names on every dial
+	// and rotate the new connections across the addresses.
+	DNS *DNSOptions
+
+	// ClientName is set with CLIENT SETNAME on every new connection, so the
+	// connections can be identified in CLIENT LIST.
+	ClientName string
+	// IdentitySuffix is appended to the library name that is set with
+	// CLIENT SETINFO when EnableIdentity is set, e.g. the service name:
+	// "go-redis(orders)".
+	IdentitySuffix string
+	// EnableIdentity sends CLIENT SETINFO on every new connection to report
+	// the library name and version to Redis >= 7.2.
+	// Default is to not send it.
+	EnableIdentity bool
+
 	Username         string
 	Password         string
 	SentinelUsername string
 	SentinelPassword string
+	// CredentialsProvider is used instead of Username and Password to get
+	// the credentials of every new connection, e.g. short-lived tokens.
+	CredentialsProvider func(ctx context.Context) (username, password string, err error)
+	// TokenAuth authenticates the connections with the tokens that expire.
+	// See Options.TokenAuth.
+	TokenAuth *TokenAuth
 
 	MaxRetries      int
 	MinRetryBackoff time.Duration
 	MaxRetryBackoff time.Duration
+	// RetryPolicy decides whether and when to retry instead of MaxRetries,
+	// MinRetryBackoff and MaxRetryBackoff.
+	RetryPolicy RetryPolicy
 
 	DialTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// ContextDeadline also applies the deadline of the context to the
+	// socket reads and writes without a timeout.
+	ContextDeadline bool
 
 	// PoolFIFO uses FIFO mode for each node connection pool GET/PUT (default LIFO).
 	PoolFIFO bool
@@ -47,6 +90,22 @@ type UniversalOptions struct {
 	IdleCheckFrequency time.Duration
 
 	TLSConfig *tls.Config
+	// GetTLSConfig is called on every new connection to get the TLS config.
+	// See Options.GetTLSConfig.
+	GetTLSConfig func(ctx context.Context) (*tls.Config, error)
+
+	// CircuitBreaker enables a CircuitBreaker for every node.
+	CircuitBreaker *CircuitBreakerOptions
+
+	// CommandStats enables latency histograms of the commands.
+	CommandStats bool
+	// Logger is used to log the messages of the client.
+	Logger Logger
+	// Codec is used to marshal the values of the types that are not
+	// supported natively.
+	Codec Codec
+	// TimeEncoding is how time.Time and time.Duration values are encoded.
+	TimeEncoding TimeEncoding
 
 	// Only cluster clients.
 
@@ -54,11 +113,82 @@ type UniversalOptions struct {
 	ReadOnly       bool
 	RouteByLatency bool
 	RouteRandomly  bool
+	Hedge          *HedgeOptions
+	NewClient      func(opt *Options) *Client
+	ClusterSlots   func(context.Context) ([]ClusterSlot, error)
 
 	// The sentinel master name.
 	// Only failover clients.
 
-	MasterName string
+	MasterName            string
+	SlaveOnly             bool
+	UseDisconnectedSlaves bool
+}
+
+// Validate checks that the options are supported by the client that is
+// returned by NewUniversalClient, i.e. that no option is silently ignored.
+func (o *UniversalOptions) Validate() error {
+	clusterOnly := []universalOption{
+		{"MaxRedirects", o.MaxRedirects != 0},
+		{"ReadOnly", o.ReadOnly},
+		{"RouteByLatency", o.RouteByLatency},
+		{"RouteRandomly", o.RouteRandomly},
+		{"Hedge", o.Hedge != nil},
+		{"NewClient", o.NewClient != nil},
+		{"ClusterSlots", o.ClusterSlots != nil},
+	}
+	failoverOnly := []universalOption{
+		{"SentinelUsername", o.SentinelUsername != ""},
+		{"SentinelPassword", o.SentinelPassword != ""},
+		{"SlaveOnly", o.SlaveOnly},
+		{"UseDisconnectedSlaves", o.UseDisconnectedSlaves},
+	}
+	network := []universalOption{
+		{"Network", o.Network != ""},
+	}
+
+	switch {
+	case o.MasterName != "":
+		if name := firstSetOption(clusterOnly, network); name != "" {
+			return fmt.Errorf("redis: %s is not supported by failover clients", name)
+		}
+	case len(o.Addrs) > 1:
+		notCluster := []universalOption{
+			{"DB", o.DB != 0},
+			{"KeyPrefix", o.KeyPrefix != ""},
+			{"Limiter", o.Limiter != nil},
+		}
+		if name := firstSetOption(notCluster, network); name != "" {
+			return fmt.Errorf("redis: %s is not supported by cluster clients", name)
+		}
+		if name := firstSetOption(failoverOnly); name != "" {
+			return fmt.Errorf("redis: %s requires MasterName", name)
+		}
+	default:
+		if name := firstSetOption(clusterOnly); name != "" {
+			return fmt.Errorf("redis: %s requires two or more Addrs", name)
+		}
+		if name := firstSetOption(failoverOnly); name != "" {
+			return fmt.Errorf("redis: %s requires MasterName", name)
+		}
+	}
+	return nil
+}
+
+type universalOption struct {
+	name string
+	set  bool
+}
+
+func firstSetOption(lists ...[]universalOption) string {
+	for _, list := range lists {
+		for _, o := range list {
+			if o.set {
+				return o.name
+			}
+		}
+	}
+	return ""
 }
 
 // Cluster returns cluster options created from the universal options.
@@ -70,23 +200,36 @@ func (o *UniversalOptions) Cluster() *ClusterOptions {
 	return &ClusterOptions{
 		Addrs:     o.Addrs,
 		Dialer:    o.Dialer,
+		DNS:       o.DNS,
 		OnConnect: o.OnConnect,
 
+		ClientName:     o.ClientName,
+		IdentitySuffix: o.IdentitySuffix,
+		EnableIdentity: o.EnableIdentity,
+
 		Username: o.Username,
 		Password: o.Password,
 
+		CredentialsProvider: o.CredentialsProvider,
+		TokenAuth:           o.TokenAuth,
+
 		MaxRedirects:   o.MaxRedirects,
 		ReadOnly:       o.ReadOnly,
 		RouteByLatency: o.RouteByLatency,
 		RouteRandomly:  o.RouteRandomly,
+		Hedge:          o.Hedge,
+		NewClient:      o.NewClient,
+		ClusterSlots:   o.ClusterSlots,
 
 		MaxRetries:      o.MaxRetries,
 		MinRetryBackoff: o.MinRetryBackoff,
 		MaxRetryBackoff: o.MaxRetryBackoff,
+		RetryPolicy:     o.RetryPolicy,
 
 		DialTimeout:        o.DialTimeout,
 		ReadTimeout:        o.ReadTimeout,
 		WriteTimeout:       o.WriteTimeout,
+		ContextDeadline:    o.ContextDeadline,
 		PoolFIFO:           o.PoolFIFO,
 		PoolSize:           o.PoolSize,
 		MinIdleConns:       o.MinIdleConns,
@@ -95,7 +238,13 @@ func (o *UniversalOptions) Cluster() *ClusterOptions {
 		IdleTimeout:        o.IdleTimeout,
 		IdleCheckFrequency: o.IdleCheckFrequency,
 
-		TLSConfig: o.TLSConfig,
+		TLSConfig:      o.TLSConfig,
+		GetTLSConfig:   o.GetTLSConfig,
+		CircuitBreaker: o.CircuitBreaker,
+		CommandStats:   o.CommandStats,
+		Logger:         o.Logger,
+		Codec:          o.Codec,
+		TimeEncoding:   o.TimeEncoding,
 	}
 }
 
@@ -109,22 +258,36 @@ func (o *UniversalOptions) Failover() *FailoverOptions {
 		SentinelAddrs: o.Addrs,
 		MasterName:    o.MasterName,
 
+		SlaveOnly:             o.SlaveOnly,
+		UseDisconnectedSlaves: o.UseDisconnectedSlaves,
+
 		Dialer:    o.Dialer,
+		DNS:       o.DNS,
 		OnConnect: o.OnConnect,
 
+		ClientName:     o.ClientName,
+		IdentitySuffix: o.IdentitySuffix,
+		EnableIdentity: o.EnableIdentity,
+
 		DB:               o.DB,
+		KeyPrefix:        o.KeyPrefix,
 		Username:         o.Username,
 		Password:         o.Password,
 		SentinelUsername: o.SentinelUsername,
 		SentinelPassword: o.SentinelPassword,
 
+		CredentialsProvider: o.CredentialsProvider,
+		TokenAuth:           o.TokenAuth,
+
 		MaxRetries:      o.MaxRetries,
 		MinRetryBackoff: o.MinRetryBackoff,
 		MaxRetryBackoff: o.MaxRetryBackoff,
+		RetryPolicy:     o.RetryPolicy,
 
-		DialTimeout:  o.DialTimeout,
-		ReadTimeout:  o.ReadTimeout,
-		WriteTimeout: o.WriteTimeout,
+		DialTimeout:     o.DialTimeout,
+		ReadTimeout:     o.ReadTimeout,
+		WriteTimeout:    o.WriteTimeout,
+		ContextDeadline: o.ContextDeadline,
 
 		PoolFIFO:           o.PoolFIFO,
 		PoolSize:           o.PoolSize,
@@ -134,7 +297,14 @@ func (o *UniversalOptions) Failover() *FailoverOptions {
 		IdleTimeout:        o.IdleTimeout,
 		IdleCheckFrequency: o.IdleCheckFrequency,
 
-		TLSConfig: o.TLSConfig,
+		TLSConfig:      o.TLSConfig,
+		GetTLSConfig:   o.GetTLSConfig,
+		Limiter:        o.Limiter,
+		CircuitBreaker: o.CircuitBreaker,
+		CommandStats:   o.CommandStats,
+		Logger:         o.Logger,
+		Codec:          o.Codec,
+		TimeEncoding:   o.TimeEncoding,
 	}
 }
 
@@ -146,21 +316,33 @@ func (o *UniversalOptions) Simple() *Options {
 	}
 
 	return &Options{
+		Network:   o.Network,
 		Addr:      addr,
 		Dialer:    o.Dialer,
+		DNS:       o.DNS,
 		OnConnect: o.OnConnect,
 
-		DB:       o.DB,
-		Username: o.Username,
-		Password: o.Password,
+		ClientName:     o.ClientName,
+		IdentitySuffix: o.IdentitySuffix,
+		EnableIdentity: o.EnableIdentity,
+
+		DB:        o.DB,
+		KeyPrefix: o.KeyPrefix,
+		Username:  o.Username,
+		Password:  o.Password,
+
+		CredentialsProvider: o.CredentialsProvider,
+		TokenAuth:           o.TokenAuth,
 
 		MaxRetries:      o.MaxRetries,
 		MinRetryBackoff: o.MinRetryBackoff,
 		MaxRetryBackoff: o.MaxRetryBackoff,
+		RetryPolicy:     o.RetryPolicy,
 
-		DialTimeout:  o.DialTimeout,
-		ReadTimeout:  o.ReadTimeout,
-		WriteTimeout: o.WriteTimeout,
+		DialTimeout:     o.DialTimeout,
+		ReadTimeout:     o.ReadTimeout,
+		WriteTimeout:    o.WriteTimeout,
+		ContextDeadline: o.ContextDeadline,
 
 		PoolFIFO:           o.PoolFIFO,
 		PoolSize:           o.PoolSize,
@@ -170,7 +352,14 @@ func (o *UniversalOptions) Simple() *Options {
 		IdleTimeout:        o.IdleTimeout,
 		IdleCheckFrequency: o.IdleCheckFrequency,
 
-		TLSConfig: o.TLSConfig,
+		TLSConfig:      o.TLSConfig,
+		GetTLSConfig:   o.GetTLSConfig,
+		Limiter:        o.Limiter,
+		CircuitBreaker: o.CircuitBreaker,
+		CommandStats:   o.CommandStats,
+		Logger:         o.Logger,
+		Codec:          o.Codec,
+		TimeEncoding:   o.TimeEncoding,
 	}
 }
 
@@ -184,11 +373,18 @@ type UniversalClient interface {
 	Cmdable
 	Context() context.Context
 	AddHook(Hook)
+	RegisterHook(Hook, *HookOptions) *HookHandle
+	AddMiddleware(ProcessMiddleware)
 	Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error
+	WatchRetry(ctx context.Context, fn func(*Tx) error, opt *WatchRetryOptions, keys ...string) error
 	Do(ctx context.Context, args ...interface{}) *Cmd
 	Process(ctx context.Context, cmd Cmder) error
 	Subscribe(ctx context.Context, channels ...string) *PubSub
 	PSubscribe(ctx context.Context, channels ...string) *PubSub
+	SSubscribe(ctx context.Context, channels ...string) *PubSub
+	PublishAndConfirm(
+		ctx context.Context, channel string, message interface{}, minReceivers int64, timeout time.Duration,
+	) (int64, error)
 	Close() error
 	PoolStats() *PoolStats
 }
@@ -205,11 +401,20 @@ var (
 // 1. If the MasterName option is specified, a sentinel-backed FailoverClient is returned.
 // 2. if the number of Addrs is two or more, a ClusterClient is returned.
 // 3. Otherwise, a single-node Client is returned.
+//
+// The options that are not supported by the returned client are ignored;
+// use Validate to report them.
 func NewUniversalClient(opts *UniversalOptions) UniversalClient {
+	var client UniversalClient
 	if opts.MasterName != "" {
-		return NewFailoverClient(opts.Failover())
+		client = NewFailoverClient(opts.Failover())
 	} else if len(opts.Addrs) > 1 {
-		return NewClusterClient(opts.Cluster())
+		client = NewClusterClient(opts.Cluster())
+	} else {
+		client = NewClient(opts.Simple())
+	}
+	for _, hook := range opts.Hooks {
+		client.AddHook(hook)
 	}
-	return NewClient(opts.Simple())
+	return client
 }
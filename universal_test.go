@@ -31,3 +31,69 @@ var _ = Describe("UniversalClient", func() {
 		Expect(client.Ping(ctx).Err()).NotTo(HaveOccurred())
 	})
 })
+
+var _ = Describe("UniversalOptions", func() {
+	It("copies the options of the simple client", func() {
+		opt := &redis.UniversalOptions{
+			Addrs:     []string{"localhost:6380"},
+			Network:   "unix",
+			DB:        1,
+			KeyPrefix: "tenant:",
+		}
+		Expect(opt.Validate()).NotTo(HaveOccurred())
+
+		simple := opt.Simple()
+		Expect(simple.Addr).To(Equal("localhost:6380"))
+		Expect(simple.Network).To(Equal("unix"))
+		Expect(simple.DB).To(Equal(1))
+		Expect(simple.KeyPrefix).To(Equal("tenant:"))
+	})
+
+	It("copies the options of the failover client", func() {
+		opt := &redis.UniversalOptions{
+			MasterName: "mymaster",
+			Addrs:      []string{"localhost:26379"},
+			KeyPrefix:  "tenant:",
+			SlaveOnly:  true,
+		}
+		Expect(opt.Validate()).NotTo(HaveOccurred())
+
+		failover := opt.Failover()
+		Expect(failover.KeyPrefix).To(Equal("tenant:"))
+		Expect(failover.SlaveOnly).To(BeTrue())
+	})
+
+	It("reports the options that are not supported by the client", func() {
+		for _, test := range []struct {
+			opt *redis.UniversalOptions
+			err string
+		}{{
+			opt: &redis.UniversalOptions{Addrs: []string{":7000", ":7001"}, DB: 1},
+			err: "redis: DB is not supported by cluster clients",
+		}, {
+			opt: &redis.UniversalOptions{Addrs: []string{":7000", ":7001"}, KeyPrefix: "tenant:"},
+			err: "redis: KeyPrefix is not supported by cluster clients",
+		}, {
+			opt: &redis.UniversalOptions{Addrs: []string{":7000", ":7001"}, SlaveOnly: true},
+			err: "redis: SlaveOnly requires MasterName",
+		}, {
+			opt: &redis.UniversalOptions{Addrs: []string{":6379"}, ReadOnly: true},
+			err: "redis: ReadOnly requires two or more Addrs",
+		}, {
+			opt: &redis.UniversalOptions{Addrs: []string{":6379"}, SentinelPassword: "secret"},
+			err: "redis: SentinelPassword requires MasterName",
+		}, {
+			opt: &redis.UniversalOptions{MasterName: "mymaster", RouteByLatency: true},
+			err: "redis: RouteByLatency is not supported by failover clients",
+		}, {
+			opt: &redis.UniversalOptions{MasterName: "mymaster", Network: "unix"},
+			err: "redis: Network is not supported by failover clients",
+		}} {
+			Expect(test.opt.Validate()).To(MatchError(test.err))
+
+			// The client is still created for compatibility.
+			client := redis.NewUniversalClient(test.opt)
+			Expect(client.Close()).To(Succeed())
+		}
+	})
+})